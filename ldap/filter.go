@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ldap
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/s-gv/orangeforum/ldap/internal/ber"
+	"strings"
+)
+
+// Filter choices (RFC 4511).
+const (
+	filterAnd       byte = 0
+	filterOr        byte = 1
+	filterNot       byte = 2
+	filterEquality  byte = 3
+	filterSubstring byte = 4
+	filterPresent   byte = 7
+)
+
+var errFilter = errors.New("Malformed LDAP filter")
+
+// EscapeFilter escapes a value for use in a search filter, such as a username typed by a user.
+func EscapeFilter(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '(', ')', '\\', 0:
+			b.WriteString("\\" + hex.EncodeToString([]byte{c}))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// compileFilter encodes a string filter (RFC 4515), such as "(&(objectClass=person)(uid=alice))".
+// The &, |, ! operators and equality, presence and substring matches are supported.
+func compileFilter(s string) (*ber.Packet, error) {
+	p, rest, err := parseFilter(s, 0)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, errFilter
+	}
+	return p, nil
+}
+
+func parseFilter(s string, depth int) (*ber.Packet, string, error) {
+	if len(s) < 3 || s[0] != '(' || depth > 16 {
+		return nil, "", errFilter
+	}
+	s = s[1:]
+	switch s[0] {
+	case '&', '|', '!':
+		choice := map[byte]byte{'&': filterAnd, '|': filterOr, '!': filterNot}[s[0]]
+		p := ber.NewSequence(ber.ClassContext | choice)
+		s = s[1:]
+		for len(s) > 0 && s[0] == '(' {
+			var c *ber.Packet
+			var err error
+			if c, s, err = parseFilter(s, depth+1); err != nil {
+				return nil, "", err
+			}
+			p.Children = append(p.Children, c)
+		}
+		if len(s) == 0 || s[0] != ')' || len(p.Children) == 0 || (choice == filterNot && len(p.Children) != 1) {
+			return nil, "", errFilter
+		}
+		return p, s[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	eq := strings.IndexByte(s, '=')
+	if end < 0 || eq < 1 || eq > end {
+		return nil, "", errFilter
+	}
+	attr, value, rest := s[:eq], s[eq+1:end], s[end+1:]
+	if strings.ContainsAny(attr, "<>~:") {
+		return nil, "", errFilter
+	}
+	if value == "*" {
+		return &ber.Packet{Tag: ber.ClassContext | filterPresent, Value: []byte(attr)}, rest, nil
+	}
+	parts := strings.Split(value, "*")
+	for i, part := range parts {
+		unescaped, err := unescapeFilter(part)
+		if err != nil {
+			return nil, "", err
+		}
+		parts[i] = unescaped
+	}
+	if len(parts) == 1 {
+		return ber.NewSequence(ber.ClassContext|filterEquality, ber.NewString(ber.TagOctetString, attr),
+			ber.NewString(ber.TagOctetString, parts[0])), rest, nil
+	}
+	substrings := ber.NewSequence(ber.TagSequence)
+	for i, part := range parts {
+		tag := byte(1) // any
+		if i == 0 {
+			tag = 0 // initial
+		} else if i == len(parts)-1 {
+			tag = 2 // final
+		}
+		if part != "" {
+			substrings.Children = append(substrings.Children, ber.NewString(ber.ClassContext|tag, part))
+		}
+	}
+	return ber.NewSequence(ber.ClassContext|filterSubstring, ber.NewString(ber.TagOctetString, attr), substrings), rest, nil
+}
+
+func unescapeFilter(s string) (string, error) {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", errFilter
+		}
+		c, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", errFilter
+		}
+		b = append(b, c...)
+		i += 2
+	}
+	return string(b), nil
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package ber encodes and decodes the subset of ASN.1 BER used by LDAP: definite
+// lengths and tag numbers below 31.
+package ber
+
+import (
+	"errors"
+	"io"
+)
+
+// Universal tags.
+const (
+	TagBoolean     byte = 0x01
+	TagInteger     byte = 0x02
+	TagOctetString byte = 0x04
+	TagNull        byte = 0x05
+	TagEnumerated  byte = 0x0a
+	TagSequence    byte = 0x30
+	TagSet         byte = 0x31
+)
+
+// Bits of the identifier octet.
+const (
+	ClassApplication byte = 0x40
+	ClassContext     byte = 0x80
+	Constructed      byte = 0x20
+)
+
+// Packets longer than MaxLength are rejected.
+const MaxLength = 1 << 20
+
+var ErrMalformed = errors.New("Malformed BER")
+
+// Packet is a BER element. Constructed elements have Children; primitive ones have Value.
+type Packet struct {
+	Tag      byte // The identifier octet, such as TagSequence or ClassContext|3.
+	Value    []byte
+	Children []*Packet
+}
+
+func (p *Packet) IsConstructed() bool {
+	return p.Tag&Constructed != 0
+}
+
+func NewSequence(tag byte, children ...*Packet) *Packet {
+	return &Packet{Tag: tag | Constructed, Children: children}
+}
+
+func NewString(tag byte, s string) *Packet {
+	return &Packet{Tag: tag, Value: []byte(s)}
+}
+
+func NewInt(tag byte, n int64) *Packet {
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		if (n < 128 && n >= -128) || len(b) == 8 {
+			break
+		}
+		n >>= 8
+	}
+	return &Packet{Tag: tag, Value: b}
+}
+
+func NewBool(b bool) *Packet {
+	if b {
+		return &Packet{Tag: TagBoolean, Value: []byte{0xff}}
+	}
+	return &Packet{Tag: TagBoolean, Value: []byte{0}}
+}
+
+// Int decodes an INTEGER or ENUMERATED value.
+func (p *Packet) Int() (int64, error) {
+	if p.IsConstructed() || len(p.Value) == 0 || len(p.Value) > 8 {
+		return 0, ErrMalformed
+	}
+	n := int64(int8(p.Value[0]))
+	for _, b := range p.Value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+func (p *Packet) String() string {
+	return string(p.Value)
+}
+
+// Child returns the i-th child, or an empty packet if there is none, so that malformed
+// messages can be checked once after decoding all fields.
+func (p *Packet) Child(i int) *Packet {
+	if i < len(p.Children) {
+		return p.Children[i]
+	}
+	return &Packet{Tag: 0xff}
+}
+
+func appendLength(b []byte, n int) []byte {
+	if n < 128 {
+		return append(b, byte(n))
+	}
+	var l []byte
+	for ; n > 0; n >>= 8 {
+		l = append([]byte{byte(n)}, l...)
+	}
+	return append(append(b, 0x80|byte(len(l))), l...)
+}
+
+func (p *Packet) Bytes() []byte {
+	value := p.Value
+	if p.IsConstructed() {
+		value = nil
+		for _, c := range p.Children {
+			value = append(value, c.Bytes()...)
+		}
+	}
+	return append(appendLength([]byte{p.Tag}, len(value)), value...)
+}
+
+// Decode decodes the first element in b and returns it with the bytes that follow it.
+func Decode(b []byte) (*Packet, []byte, error) {
+	return decode(b, 0)
+}
+
+func decode(b []byte, depth int) (*Packet, []byte, error) {
+	if len(b) < 2 || depth > 32 || b[0]&0x1f == 0x1f {
+		return nil, nil, ErrMalformed
+	}
+	p := &Packet{Tag: b[0]}
+	n, b, err := decodeLength(b[1:])
+	if err != nil || n > len(b) {
+		return nil, nil, ErrMalformed
+	}
+	value, rest := b[:n], b[n:]
+	if !p.IsConstructed() {
+		p.Value = value
+		return p, rest, nil
+	}
+	for len(value) > 0 {
+		var c *Packet
+		if c, value, err = decode(value, depth+1); err != nil {
+			return nil, nil, err
+		}
+		p.Children = append(p.Children, c)
+	}
+	return p, rest, nil
+}
+
+func decodeLength(b []byte) (int, []byte, error) {
+	if b[0] < 0x80 {
+		return int(b[0]), b[1:], nil
+	}
+	k := int(b[0] & 0x7f)
+	if k == 0 || k > 3 || len(b) < 1+k {
+		return 0, nil, ErrMalformed
+	}
+	n := 0
+	for _, c := range b[1 : 1+k] {
+		n = n<<8 | int(c)
+	}
+	if n > MaxLength {
+		return 0, nil, ErrMalformed
+	}
+	return n, b[1+k:], nil
+}
+
+// Read reads one element from r.
+func Read(r io.Reader) (*Packet, error) {
+	head := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if head[1] >= 0x80 {
+		k := int(head[1] & 0x7f)
+		if k == 0 || k > 3 {
+			return nil, ErrMalformed
+		}
+		head = head[:2+k]
+		if _, err := io.ReadFull(r, head[2:]); err != nil {
+			return nil, err
+		}
+	}
+	n, _, err := decodeLength(head[1:])
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, len(head)+n)
+	copy(b, head)
+	if _, err := io.ReadFull(r, b[len(head):]); err != nil {
+		return nil, err
+	}
+	p, _, err := Decode(b)
+	return p, err
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package ldap is a minimal LDAPv3 client for checking passwords against a directory:
+// it can bind with a password and search for entries, and nothing else.
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/s-gv/orangeforum/ldap/internal/ber"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Protocol operations (RFC 4511).
+const (
+	opBindRequest     byte = 0
+	opBindResponse    byte = 1
+	opUnbindRequest   byte = 2
+	opSearchRequest   byte = 3
+	opSearchEntry     byte = 4
+	opSearchDone      byte = 5
+	opSearchReference byte = 19
+)
+
+// Result codes.
+const (
+	resultSuccess      int64 = 0
+	resultInvalidCreds int64 = 49
+)
+
+// ErrInvalidCredentials is returned by Bind when the DN or password is wrong.
+var ErrInvalidCredentials = errors.New("Invalid LDAP credentials")
+
+// Searches return at most maxEntries entries.
+const maxEntries = 100
+
+type Conn struct {
+	conn    net.Conn
+	timeout time.Duration
+	msgID   int64
+}
+
+// Entry is a search result. Attribute names are lowercased.
+type Entry struct {
+	DN    string
+	Attrs map[string][]string
+}
+
+func (e Entry) Attr(name string) []string {
+	return e.Attrs[strings.ToLower(name)]
+}
+
+// Dial connects to a server given by an ldap:// or ldaps:// URL. Every request has to
+// be answered within timeout.
+func Dial(rawURL string, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: timeout}
+	switch u.Scheme {
+	case "ldap":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	case "ldaps":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("Unsupported LDAP URL scheme: %s", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn, timeout: timeout}, nil
+}
+
+func (c *Conn) Close() error {
+	c.msgID++
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	c.conn.Write(ber.NewSequence(ber.TagSequence, ber.NewInt(ber.TagInteger, c.msgID),
+		&ber.Packet{Tag: ber.ClassApplication | opUnbindRequest}).Bytes())
+	return c.conn.Close()
+}
+
+func (c *Conn) send(op *ber.Packet) error {
+	c.msgID++
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	_, err := c.conn.Write(ber.NewSequence(ber.TagSequence, ber.NewInt(ber.TagInteger, c.msgID), op).Bytes())
+	return err
+}
+
+// receive returns the protocol operation of the next response to the last request.
+func (c *Conn) receive() (*ber.Packet, error) {
+	for {
+		msg, err := ber.Read(c.conn)
+		if err != nil {
+			return nil, err
+		}
+		id, err := msg.Child(0).Int()
+		if err != nil || len(msg.Children) < 2 {
+			return nil, ber.ErrMalformed
+		}
+		// Unsolicited notifications have ID 0. They only announce that the server is
+		// closing the connection, which the next read finds out anyway.
+		if id == c.msgID {
+			return msg.Child(1), nil
+		}
+	}
+}
+
+func checkResult(op *ber.Packet, want byte) error {
+	if op.Tag != ber.ClassApplication|ber.Constructed|want {
+		return ber.ErrMalformed
+	}
+	code, err := op.Child(0).Int()
+	if err != nil {
+		return err
+	}
+	if code == resultInvalidCreds {
+		return ErrInvalidCredentials
+	}
+	if code != resultSuccess {
+		return fmt.Errorf("LDAP error %d: %s", code, op.Child(2).String())
+	}
+	return nil
+}
+
+// Bind authenticates the connection. An empty password is refused, since servers treat
+// it as an anonymous bind that succeeds without checking anything.
+func (c *Conn) Bind(dn string, password string) error {
+	if password == "" {
+		return ErrInvalidCredentials
+	}
+	err := c.send(ber.NewSequence(ber.ClassApplication|opBindRequest,
+		ber.NewInt(ber.TagInteger, 3),
+		ber.NewString(ber.TagOctetString, dn),
+		ber.NewString(ber.ClassContext|0, password)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive()
+	if err != nil {
+		return err
+	}
+	return checkResult(op, opBindResponse)
+}
+
+// Search returns the entries below baseDN that match filter, with the attributes in attrs.
+func (c *Conn) Search(baseDN string, filter string, attrs []string) ([]Entry, error) {
+	f, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	attrList := ber.NewSequence(ber.TagSequence)
+	for _, attr := range attrs {
+		attrList.Children = append(attrList.Children, ber.NewString(ber.TagOctetString, attr))
+	}
+	err = c.send(ber.NewSequence(ber.ClassApplication|opSearchRequest,
+		ber.NewString(ber.TagOctetString, baseDN),
+		ber.NewInt(ber.TagEnumerated, 2), // Whole subtree
+		ber.NewInt(ber.TagEnumerated, 0), // Never dereference aliases
+		ber.NewInt(ber.TagInteger, maxEntries),
+		ber.NewInt(ber.TagInteger, int64(c.timeout/time.Second)),
+		ber.NewBool(false),
+		f,
+		attrList))
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for {
+		op, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch op.Tag {
+		case ber.ClassApplication | ber.Constructed | opSearchEntry:
+			e := Entry{DN: op.Child(0).String(), Attrs: make(map[string][]string)}
+			for _, attr := range op.Child(1).Children {
+				name := strings.ToLower(attr.Child(0).String())
+				for _, v := range attr.Child(1).Children {
+					e.Attrs[name] = append(e.Attrs[name], v.String())
+				}
+			}
+			entries = append(entries, e)
+		case ber.ClassApplication | ber.Constructed | opSearchReference:
+			// Referrals to other servers aren't followed.
+		default:
+			return entries, checkResult(op, opSearchDone)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ldap
+
+import (
+	"github.com/s-gv/orangeforum/ldap/internal/ber"
+	"github.com/s-gv/orangeforum/ldap/ldaptest"
+	"testing"
+	"time"
+)
+
+func TestBER(t *testing.T) {
+	for _, n := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1 << 40} {
+		p, rest, err := ber.Decode(ber.NewInt(ber.TagInteger, n).Bytes())
+		if err != nil || len(rest) != 0 {
+			t.Fatalf("Decode(%d): %v", n, err)
+		}
+		if got, err := p.Int(); got != n || err != nil {
+			t.Errorf("Int() = %d, want %d", got, n)
+		}
+	}
+	long := ber.NewSequence(ber.TagSequence, ber.NewString(ber.TagOctetString, string(make([]byte, 300))))
+	if p, _, err := ber.Decode(long.Bytes()); err != nil || len(p.Child(0).Value) != 300 {
+		t.Errorf("Long string not decoded: %v", err)
+	}
+	for _, b := range [][]byte{{0x30}, {0x30, 0x05, 0x04}, {0x04, 0x84, 0xff, 0xff, 0xff, 0xff}, {0x1f, 0x00}} {
+		if _, _, err := ber.Decode(b); err == nil {
+			t.Errorf("Malformed BER %x accepted", b)
+		}
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	for _, f := range []string{"(uid=alice)", "(&(objectClass=person)(|(uid=a*)(mail=*@example.com)))", "(!(cn=*))", "(cn=a\\2ab)"} {
+		if _, err := compileFilter(f); err != nil {
+			t.Errorf("compileFilter(%q): %s", f, err)
+		}
+	}
+	for _, f := range []string{"", "uid=alice", "(uid=alice", "(uid=alice))", "(&)", "(!(a=b)(c=d))", "(=x)", "(cn=a\\2)", "(cn>=a)"} {
+		if _, err := compileFilter(f); err == nil {
+			t.Errorf("compileFilter(%q) accepted", f)
+		}
+	}
+	if got := EscapeFilter("a*)(uid=*"); got != "a\\2a\\29\\28uid=\\2a" {
+		t.Errorf("EscapeFilter = %q", got)
+	}
+}
+
+func TestBindAndSearch(t *testing.T) {
+	srv := ldaptest.NewServer()
+	defer srv.Close()
+	srv.AddEntry("cn=reader,dc=example,dc=com", "readerpass", nil)
+	srv.AddEntry("uid=alice,ou=people,dc=example,dc=com", "alicepass", map[string][]string{
+		"uid": {"alice"}, "mail": {"alice@example.com"}, "memberOf": {"cn=staff,dc=example,dc=com", "cn=mods,dc=example,dc=com"}})
+	srv.AddEntry("uid=bob,ou=people,dc=example,dc=com", "bobpass", map[string][]string{"uid": {"bob"}})
+
+	conn, err := Dial(srv.URL, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Dial: %s", err)
+	}
+	defer conn.Close()
+	if err := conn.Bind("cn=reader,dc=example,dc=com", "wrong"); err != ErrInvalidCredentials {
+		t.Errorf("Bind with the wrong password: %v", err)
+	}
+	if err := conn.Bind("cn=reader,dc=example,dc=com", ""); err != ErrInvalidCredentials {
+		t.Errorf("Bind with an empty password: %v", err)
+	}
+	if err := conn.Bind("cn=reader,dc=example,dc=com", "readerpass"); err != nil {
+		t.Fatalf("Bind: %s", err)
+	}
+	entries, err := conn.Search("ou=people,dc=example,dc=com", "(&(uid="+EscapeFilter("ALICE")+")(mail=*))", []string{"mail", "memberOf"})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Search: %v, %v", entries, err)
+	}
+	if e := entries[0]; e.DN != "uid=alice,ou=people,dc=example,dc=com" || e.Attr("mail")[0] != "alice@example.com" ||
+		len(e.Attr("memberOf")) != 2 || e.Attr("uid") != nil {
+		t.Errorf("Unexpected entry: %v", e)
+	}
+	if entries, err := conn.Search("dc=example,dc=com", "(uid=*o*)", nil); err != nil || len(entries) != 1 {
+		t.Errorf("Substring search: %v, %v", entries, err)
+	}
+	if err := conn.Bind(entries[0].DN, "alicepass"); err != nil {
+		t.Errorf("Bind as user: %s", err)
+	}
+}
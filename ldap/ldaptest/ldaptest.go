@@ -0,0 +1,211 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package ldaptest provides an in-process LDAP server for testing LDAP logins without a
+// directory. It answers simple binds and subtree searches over entries added with AddEntry.
+package ldaptest
+
+import (
+	"github.com/s-gv/orangeforum/ldap/internal/ber"
+	"net"
+	"strings"
+	"sync"
+)
+
+type entry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+type Server struct {
+	URL string // Such as "ldap://127.0.0.1:38389".
+
+	ln      net.Listener
+	mu      sync.Mutex
+	entries []entry
+}
+
+func NewServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{URL: "ldap://" + ln.Addr().String(), ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *Server) Close() {
+	s.ln.Close()
+}
+
+// AddEntry adds an entry. If password is empty, binding as the entry fails.
+func (s *Server) AddEntry(dn string, password string, attrs map[string][]string) {
+	e := entry{dn: dn, password: password, attrs: make(map[string][]string)}
+	for name, vals := range attrs {
+		e.attrs[strings.ToLower(name)] = vals
+	}
+	s.mu.Lock()
+	s.entries = append(s.entries, e)
+	s.mu.Unlock()
+}
+
+func result(op byte, code int64, msg string) *ber.Packet {
+	return ber.NewSequence(ber.ClassApplication|op, ber.NewInt(ber.TagEnumerated, code),
+		ber.NewString(ber.TagOctetString, ""), ber.NewString(ber.TagOctetString, msg))
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		msg, err := ber.Read(conn)
+		if err != nil {
+			return
+		}
+		id := msg.Child(0)
+		op := msg.Child(1)
+		reply := func(p *ber.Packet) {
+			conn.Write(ber.NewSequence(ber.TagSequence, id, p).Bytes())
+		}
+		switch op.Tag {
+		case ber.ClassApplication | ber.Constructed | 0: // Bind
+			dn, password := op.Child(1).String(), op.Child(2).String()
+			if op.Child(2).Tag != ber.ClassContext|0 {
+				reply(result(1, 7, "Only simple binds are supported"))
+			} else if password == "" || !s.checkPassword(dn, password) {
+				reply(result(1, 49, "Invalid credentials"))
+			} else {
+				reply(result(1, 0, ""))
+			}
+		case ber.ClassApplication | 2: // Unbind
+			return
+		case ber.ClassApplication | ber.Constructed | 3: // Search
+			for _, e := range s.search(op.Child(0).String(), op.Child(6)) {
+				attrs := ber.NewSequence(ber.TagSequence)
+				for name, vals := range e.attrs {
+					if !isRequested(op.Child(7), name) {
+						continue
+					}
+					set := ber.NewSequence(ber.TagSet)
+					for _, v := range vals {
+						set.Children = append(set.Children, ber.NewString(ber.TagOctetString, v))
+					}
+					attrs.Children = append(attrs.Children, ber.NewSequence(ber.TagSequence, ber.NewString(ber.TagOctetString, name), set))
+				}
+				reply(ber.NewSequence(ber.ClassApplication|4, ber.NewString(ber.TagOctetString, e.dn), attrs))
+			}
+			reply(result(5, 0, ""))
+		default:
+			reply(result(1, 2, "Unsupported operation"))
+		}
+	}
+}
+
+func (s *Server) checkPassword(dn string, password string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) {
+			return e.password != "" && e.password == password
+		}
+	}
+	return false
+}
+
+func isRequested(attrList *ber.Packet, name string) bool {
+	if len(attrList.Children) == 0 {
+		return true
+	}
+	for _, a := range attrList.Children {
+		if strings.EqualFold(a.String(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) search(baseDN string, filter *ber.Packet) []entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []entry
+	for _, e := range s.entries {
+		if strings.HasSuffix(strings.ToLower(e.dn), strings.ToLower(baseDN)) && matches(e, filter) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// matches evaluates a filter. Values are compared ignoring case.
+func matches(e entry, f *ber.Packet) bool {
+	switch f.Tag &^ ber.Constructed {
+	case ber.ClassContext | 0: // And
+		for _, c := range f.Children {
+			if !matches(e, c) {
+				return false
+			}
+		}
+		return true
+	case ber.ClassContext | 1: // Or
+		for _, c := range f.Children {
+			if matches(e, c) {
+				return true
+			}
+		}
+		return false
+	case ber.ClassContext | 2: // Not
+		return !matches(e, f.Child(0))
+	case ber.ClassContext | 3: // Equality
+		for _, v := range e.attrs[strings.ToLower(f.Child(0).String())] {
+			if strings.EqualFold(v, f.Child(1).String()) {
+				return true
+			}
+		}
+		return false
+	case ber.ClassContext | 4: // Substrings
+		for _, v := range e.attrs[strings.ToLower(f.Child(0).String())] {
+			if matchesSubstrings(strings.ToLower(v), f.Child(1)) {
+				return true
+			}
+		}
+		return false
+	case ber.ClassContext | 7: // Present
+		return len(e.attrs[strings.ToLower(f.String())]) > 0
+	}
+	return false
+}
+
+func matchesSubstrings(v string, parts *ber.Packet) bool {
+	for _, p := range parts.Children {
+		sub := strings.ToLower(p.String())
+		switch p.Tag {
+		case ber.ClassContext | 0:
+			if !strings.HasPrefix(v, sub) {
+				return false
+			}
+			v = v[len(sub):]
+		case ber.ClassContext | 1:
+			i := strings.Index(v, sub)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(sub):]
+		case ber.ClassContext | 2:
+			if !strings.HasSuffix(v, sub) {
+				return false
+			}
+			v = ""
+		}
+	}
+	return true
+}
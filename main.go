@@ -10,12 +10,16 @@ import (
 	"github.com/eyedeekay/sam-forwarder/config"
 	"github.com/s-gv/orangeforum/models"
 	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/search"
+	"github.com/s-gv/orangeforum/utils"
 	"github.com/s-gv/orangeforum/views"
 	"golang.org/x/crypto/ssh/terminal"
 	"log"
 	"math/rand"
 	"net/http"
 	"net/http/fcgi"
+	"os"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -66,6 +70,13 @@ func main() {
 	createUser := flag.Bool("createuser", false, "Create user. Optional arguments: <username> <password> <email>")
 	changePasswd := flag.Bool("changepasswd", false, "Change password")
 	deleteSessions := flag.Bool("deletesessions", false, "Delete all sessions (logout all users)")
+	reset2FA := flag.Bool("reset2fa", false, "Turn off two-factor authentication of a user. Argument: <username>")
+	reindex := flag.Bool("reindex", false, "Rebuild the search index")
+	loadDisposable := flag.String("loaddisposable", "", "Block the disposable e-mail domains listed in this file (such as contrib/disposable_email_domains.txt), replacing those loaded before")
+	mailerSpec := flag.String("mailer", "smtp", "Mail transport: smtp, log, or maildir:<dir>")
+	numMailWorkers := flag.Int("mailworkers", 4, "Number of workers sending e-mail")
+	authHeader := flag.String("authheader", "", "Log in as the user named in this header (such as X-Remote-User) when set by a trusted proxy")
+	authProxies := flag.String("authproxies", "", "Comma-separated IP addresses or CIDR ranges of proxies trusted to set -authheader and X-Forwarded-For")
 	fcgiMode := flag.Bool("fcgi", false, "Fast CGI rather than listening on a port")
 	usei2p := flag.Bool("usei2p", false, "Forward the service to the i2p network as an eepSite")
 	i2pconf := flag.String("i2pini", "./contrib/tunnels.orangeforum.conf", "i2p tunnel configuration file to use")
@@ -87,6 +98,7 @@ func main() {
 
 	if *shouldMigrate {
 		models.Migrate()
+		search.Migrate()
 		return
 	}
 
@@ -137,11 +149,47 @@ func main() {
 		return
 	}
 
+	if *reset2FA {
+		args := flag.Args()
+		var userName string
+		if len(args) >= 1 {
+			userName = args[0]
+		} else {
+			fmt.Printf("Username: ")
+			fmt.Scanf("%s\n", &userName)
+		}
+		if err := models.ResetTOTP(userName); err != nil {
+			fmt.Printf("Error resetting two-factor authentication: %s\n", err)
+		}
+		return
+	}
+
 	if *deleteSessions {
 		db.Exec(`DELETE FROM sessions;`)
 		return
 	}
 
+	if *reindex {
+		search.Reindex()
+		return
+	}
+
+	if *loadDisposable != "" {
+		f, err := os.Open(*loadDisposable)
+		if err != nil {
+			fmt.Printf("Error opening %s: %s\n", *loadDisposable, err)
+			return
+		}
+		defer f.Close()
+		n, err := models.LoadDisposableDomains(f)
+		if err != nil {
+			fmt.Printf("Error loading disposable e-mail domains: %s\n", err)
+			return
+		}
+		fmt.Printf("Loaded %d disposable e-mail domains.\n", n)
+		return
+	}
+
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/", views.IndexHandler)
@@ -157,6 +205,12 @@ func main() {
 	mux.HandleFunc("/note", views.NoteHandler)
 
 	mux.HandleFunc("/admin", views.AdminIndexHandler)
+	mux.HandleFunc("/admin/logins", views.AdminLoginsHandler)
+	mux.HandleFunc("/admin/blocklist", views.AdminBlocklistHandler)
+	mux.HandleFunc("/admin/mail", views.AdminMailHandler)
+	mux.HandleFunc("/admin/invites", views.AdminInvitesHandler)
+	mux.HandleFunc("/admin/reports", views.AdminReportsHandler)
+	mux.HandleFunc("/admin/auditlog", views.AdminAuditLogHandler)
 
 	mux.HandleFunc("/pm", views.PrivateMessageHandler)
 	mux.HandleFunc("/pm/new", views.PrivateMessageCreateHandler)
@@ -165,6 +219,13 @@ func main() {
 	mux.HandleFunc("/groups/edit", views.GroupEditHandler)
 	mux.HandleFunc("/groups/subscribe", views.GroupSubscribeHandler)
 	mux.HandleFunc("/groups/unsubscribe", views.GroupUnsubscribeHandler)
+	mux.HandleFunc("/groups/members", views.GroupMembersHandler)
+	mux.HandleFunc("/groups/reports", views.GroupReportsHandler)
+	mux.HandleFunc("/groups/auditlog", views.GroupAuditLogHandler)
+	mux.HandleFunc("/groups/pending", views.GroupPendingHandler)
+	mux.HandleFunc("/groups/bans", views.GroupBansHandler)
+	mux.HandleFunc("/groups/join", views.GroupJoinHandler)
+	mux.HandleFunc("/groups/leave", views.GroupLeaveHandler)
 	mux.HandleFunc("/groups", views.GroupIndexHandler)
 
 	mux.HandleFunc("/topics/new", views.TopicCreateHandler)
@@ -177,18 +238,55 @@ func main() {
 	mux.HandleFunc("/comments/edit", views.CommentUpdateHandler)
 	mux.HandleFunc("/comments", views.CommentIndexHandler)
 
+	mux.HandleFunc("/reports/new", views.ReportCreateHandler)
+
 	mux.HandleFunc("/signup", views.SignupHandler)
 	mux.HandleFunc("/login", views.LoginHandler)
+	mux.HandleFunc("/login/2fa", views.LoginTwoFactorHandler)
+	mux.HandleFunc("/login/passkey", views.PasskeyLoginHandler)
+	mux.HandleFunc("/login/oidc", views.OIDCLoginHandler)
+	mux.HandleFunc("/login/oidc/callback", views.OIDCCallbackHandler)
 	mux.HandleFunc("/logout", views.LogoutHandler)
 	mux.HandleFunc("/changepass", views.ChangePasswdHandler)
 	mux.HandleFunc("/forgotpass", views.ForgotPasswdHandler)
 	mux.HandleFunc("/resetpass", views.ResetPasswdHandler)
 
+	mux.HandleFunc("/search", views.SearchHandler)
+
+	mux.HandleFunc("/notifications", views.NotificationsHandler)
+	mux.HandleFunc("/notifications/open", views.NotificationOpenHandler)
+
+	mux.HandleFunc("/feeds/atom", views.AtomFeedHandler)
+	mux.HandleFunc("/feeds/rss", views.RSSFeedHandler)
+
+	mux.HandleFunc("/api/v1/groups", views.APIGroupsHandler)
+	mux.HandleFunc("/api/v1/topics", views.APITopicsHandler)
+	mux.HandleFunc("/api/v1/comments", views.APICommentsHandler)
+	mux.HandleFunc("/api/v1/messages", views.APIMessagesHandler)
+	mux.HandleFunc("/api/v1/users", views.APIUsersHandler)
+
 	mux.HandleFunc("/users", views.UserProfileHandler)
 	mux.HandleFunc("/users/update", views.UserProfileUpdateHandler)
 	mux.HandleFunc("/users/comments", views.UserCommentsHandler)
 	mux.HandleFunc("/users/topics", views.UserTopicsHandler)
 	mux.HandleFunc("/users/groups", views.UserGroupsHandler)
+	mux.HandleFunc("/users/tokens", views.UserTokensHandler)
+	mux.HandleFunc("/users/sessions", views.UserSessionsHandler)
+	mux.HandleFunc("/users/2fa", views.UserTwoFactorHandler)
+	mux.HandleFunc("/users/passkeys", views.UserPasskeysHandler)
+	mux.HandleFunc("/users/verifyemail", views.VerifyEmailHandler)
+	mux.HandleFunc("/users/invites", views.UserInvitesHandler)
+
+	mailer, err := utils.NewMailer(*mailerSpec)
+	if err != nil {
+		log.Panicf("[ERROR] %s\n", err)
+	}
+	utils.SetMailer(mailer)
+	utils.StartMailQueue(*numMailWorkers)
+	views.StartDigestScheduler()
+	if err := views.SetProxyAuth(*authHeader, strings.Split(*authProxies, ",")); err != nil {
+		log.Panicf("[ERROR] %s\n", err)
+	}
 
 	if *fcgiMode {
 		fcgi.Serve(nil, mux)
@@ -204,7 +302,7 @@ func main() {
 	}
 
 	log.Println("[INFO] Starting orangeforum at", *addr)
-	err := srv.ListenAndServe()
+	err = srv.ListenAndServe()
 	if err != nil {
 		log.Panicf("[ERROR] %s\n", err)
 	}
@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/s-gv/orangeforum/models/db"
+	"strings"
+	"time"
+)
+
+// Scopes of an API token. A token with no scopes can't do anything.
+const (
+	ScopeRead     string = "read"
+	ScopePost     string = "post"
+	ScopeModerate string = "moderate"
+)
+
+var ScopeAllVals = []string{ScopeRead, ScopePost, ScopeModerate}
+
+type APIToken struct {
+	ID           string
+	Name         string
+	Scopes       []string
+	CreatedDate  int64
+	LastUsedDate int64
+}
+
+func hashAPIToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// CreateAPIToken stores the hash of token. The token itself is not saved, so it has to
+// be shown to the user right away.
+func CreateAPIToken(userID string, name string, token string, scopes []string) error {
+	for _, scope := range scopes {
+		if scope != ScopeRead && scope != ScopePost && scope != ScopeModerate {
+			return errors.New("Unknown scope: " + scope)
+		}
+	}
+	db.Exec(`INSERT INTO apitokens(userid, name, tokenhash, scopes, last_used_date, created_date) VALUES(?, ?, ?, ?, ?, ?);`,
+		userID, name, hashAPIToken(token), strings.Join(scopes, ","), 0, time.Now().Unix())
+	return nil
+}
+
+func DeleteAPIToken(userID string, tokenID string) {
+	db.Exec(`DELETE FROM apitokens WHERE id=? AND userid=?;`, tokenID, userID)
+}
+
+func ReadAPITokens(userID string) []APIToken {
+	var tokens []APIToken
+	rows := db.Query(`SELECT id, name, scopes, created_date, last_used_date FROM apitokens WHERE userid=? ORDER BY created_date DESC;`, userID)
+	for rows.Next() {
+		t := APIToken{}
+		var scopes string
+		rows.Scan(&t.ID, &t.Name, &scopes, &t.CreatedDate, &t.LastUsedDate)
+		if scopes != "" {
+			t.Scopes = strings.Split(scopes, ",")
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// ReadAPITokenUser returns the ID of the user that owns token and the token's scopes,
+// and updates the token's last used time. Tokens of banned users are rejected.
+func ReadAPITokenUser(token string) (int64, []string, error) {
+	var tokenID string
+	var userID int64
+	var scopes string
+	var isBanned bool
+	if db.QueryRow(`SELECT apitokens.id, apitokens.userid, apitokens.scopes, users.is_banned FROM apitokens
+		INNER JOIN users ON users.id=apitokens.userid WHERE apitokens.tokenhash=?;`, hashAPIToken(token)).Scan(
+		&tokenID, &userID, &scopes, &isBanned) != nil {
+		return 0, nil, errors.New("Invalid API token")
+	}
+	if isBanned {
+		return 0, nil, errors.New("User banned")
+	}
+	db.Exec(`UPDATE apitokens SET last_used_date=? WHERE id=?;`, time.Now().Unix(), tokenID)
+	if scopes == "" {
+		return userID, []string{}, nil
+	}
+	return userID, strings.Split(scopes, ","), nil
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"github.com/s-gv/orangeforum/models/db"
+	"strings"
+	"time"
+)
+
+// Actions recorded in the audit log. The part before the dot is the kind of target.
+const (
+	AuditTopicEdit       string = "topic.edit"
+	AuditTopicClose      string = "topic.close"
+	AuditTopicReopen     string = "topic.reopen"
+	AuditTopicSticky     string = "topic.sticky"
+	AuditTopicDelete     string = "topic.delete"
+	AuditTopicUndelete   string = "topic.undelete"
+	AuditTopicApprove    string = "topic.approve"
+	AuditTopicReject     string = "topic.reject"
+	AuditCommentEdit     string = "comment.edit"
+	AuditCommentSticky   string = "comment.sticky"
+	AuditCommentDelete   string = "comment.delete"
+	AuditCommentUndelete string = "comment.undelete"
+	AuditCommentApprove  string = "comment.approve"
+	AuditCommentReject   string = "comment.reject"
+	AuditPMDelete        string = "pm.delete"
+	AuditReportDismiss   string = "report.dismiss"
+	AuditUserBan         string = "user.ban"
+	AuditUserUnban       string = "user.unban"
+	AuditUserUnlock      string = "user.unlock"
+	AuditUserLogout      string = "user.logout"
+	AuditUserSuspend     string = "user.suspend"
+	AuditUserUnsuspend   string = "user.unsuspend"
+	AuditUserWarn        string = "user.warn"
+	AuditUserGroupBan    string = "user.groupban"
+	AuditUserGroupUnban  string = "user.groupunban"
+	AuditUserLink        string = "user.link"
+	AuditUserUnlink      string = "user.unlink"
+	AuditGroupMods       string = "group.mods"
+	AuditGroupAdmins     string = "group.admins"
+	AuditGroupDelete     string = "group.delete"
+	AuditGroupUndelete   string = "group.undelete"
+	AuditBlockAdd        string = "block.add"
+	AuditBlockDelete     string = "block.delete"
+	AuditConfigUpdate    string = "config.update"
+)
+
+var AuditActionAllVals = []string{
+	AuditTopicEdit, AuditTopicClose, AuditTopicReopen, AuditTopicSticky, AuditTopicDelete, AuditTopicUndelete,
+	AuditTopicApprove, AuditTopicReject,
+	AuditCommentEdit, AuditCommentSticky, AuditCommentDelete, AuditCommentUndelete, AuditCommentApprove, AuditCommentReject,
+	AuditPMDelete, AuditReportDismiss,
+	AuditUserBan, AuditUserUnban, AuditUserUnlock, AuditUserLogout, AuditUserSuspend, AuditUserUnsuspend, AuditUserWarn,
+	AuditUserGroupBan, AuditUserGroupUnban, AuditUserLink, AuditUserUnlink,
+	AuditGroupMods, AuditGroupAdmins, AuditGroupDelete, AuditGroupUndelete, AuditBlockAdd, AuditBlockDelete, AuditConfigUpdate,
+}
+
+// An AuditEntry records who did what to which post, user, group or config setting.
+// ActorName and Target are copies taken when the entry was made, so the entry still
+// reads the same after the user is renamed or deleted. GroupID is "" for actions
+// outside groups, which only the superadmins can see.
+type AuditEntry struct {
+	ID          string
+	ActorID     string
+	ActorName   string
+	GroupID     string
+	GroupName   string
+	Action      string
+	TargetID    string
+	Target      string
+	OldValue    string
+	NewValue    string
+	IP          string
+	CreatedDate int64
+}
+
+// AuditFilter selects audit log entries. Empty fields match everything. Action matches
+// every action of a kind of target if it has no dot, like "topic".
+type AuditFilter struct {
+	GroupID   string
+	Action    string
+	ActorName string
+	FromDate  int64
+	ToDate    int64
+	BeforeID  string
+}
+
+// CreateAuditEntry appends an entry to the audit log. Entries are never updated or deleted.
+func CreateAuditEntry(e AuditEntry) {
+	db.QueryRow(`SELECT username FROM users WHERE id=?;`, e.ActorID).Scan(&e.ActorName)
+	actor := sql.NullString{String: e.ActorID, Valid: e.ActorID != ""}
+	group := sql.NullString{String: e.GroupID, Valid: e.GroupID != ""}
+	db.Exec(`INSERT INTO auditlog(actorid, actorname, groupid, action, targetid, target, old_value, new_value, ip, created_date)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		actor, e.ActorName, group, e.Action, e.TargetID, e.Target, e.OldValue, e.NewValue, e.IP, time.Now().Unix())
+}
+
+// ReadAuditEntries returns the newest entries that match the filter.
+func ReadAuditEntries(f AuditFilter, limit int) []AuditEntry {
+	var conds []string
+	var args []interface{}
+	if f.GroupID != "" {
+		conds = append(conds, "auditlog.groupid=?")
+		args = append(args, f.GroupID)
+	}
+	if f.Action != "" {
+		if strings.Contains(f.Action, ".") {
+			conds = append(conds, "auditlog.action=?")
+			args = append(args, f.Action)
+		} else {
+			conds = append(conds, "auditlog.action LIKE ?")
+			args = append(args, f.Action+".%")
+		}
+	}
+	if f.ActorName != "" {
+		conds = append(conds, "auditlog.actorname=?")
+		args = append(args, f.ActorName)
+	}
+	if f.FromDate > 0 {
+		conds = append(conds, "auditlog.created_date >= ?")
+		args = append(args, f.FromDate)
+	}
+	if f.ToDate > 0 {
+		conds = append(conds, "auditlog.created_date < ?")
+		args = append(args, f.ToDate)
+	}
+	if f.BeforeID != "" {
+		conds = append(conds, "auditlog.id < ?")
+		args = append(args, f.BeforeID)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, limit)
+	rows := db.Query(`SELECT auditlog.id, auditlog.actorid, auditlog.actorname, auditlog.groupid, COALESCE(groups.name, ''),
+		auditlog.action, auditlog.targetid, auditlog.target, auditlog.old_value, auditlog.new_value, auditlog.ip, auditlog.created_date
+		FROM auditlog LEFT JOIN groups ON groups.id=auditlog.groupid `+where+` ORDER BY auditlog.id DESC LIMIT ?;`, args...)
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var actorID, groupID sql.NullString
+		rows.Scan(&e.ID, &actorID, &e.ActorName, &groupID, &e.GroupName, &e.Action, &e.TargetID, &e.Target,
+			&e.OldValue, &e.NewValue, &e.IP, &e.CreatedDate)
+		e.ActorID, e.GroupID = actorID.String, groupID.String
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// NumAuditEntries is the number of entries made after minDate.
+func NumAuditEntries(minDate int64) int {
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM auditlog WHERE created_date >= ?;`, minDate).Scan(&n)
+	return n
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"bufio"
+	"github.com/s-gv/orangeforum/models/db"
+	"io"
+	"strings"
+	"time"
+)
+
+// Kinds of blocks. An IP block is an IP address or a CIDR range such as "192.0.2.0/24".
+// Email and disposable blocks are e-mail domains; the disposable ones are loaded from a
+// list of throwaway address providers rather than added by hand.
+const (
+	BlockIP         string = "ip"
+	BlockEmail      string = "email"
+	BlockDisposable string = "disposable"
+)
+
+type Block struct {
+	ID          string
+	Kind        string
+	Value       string
+	Reason      string
+	CreatedDate int64
+}
+
+// An IPSharer is another account seen at NumIPs of the IP addresses of a user.
+type IPSharer struct {
+	UserName string
+	NumIPs   int
+}
+
+// CreateBlock adds a block, replacing any earlier block of the same value.
+func CreateBlock(kind string, value string, reason string) {
+	db.Exec(`DELETE FROM blocks WHERE kind=? AND value=?;`, kind, value)
+	db.Exec(`INSERT INTO blocks(kind, value, reason, created_date) VALUES(?, ?, ?, ?);`, kind, value, reason, time.Now().Unix())
+}
+
+// DeleteBlock removes a block and returns it, or an error if there is no such block.
+func DeleteBlock(blockID string) (Block, error) {
+	var b Block
+	if err := db.QueryRow(`SELECT id, kind, value, reason, created_date FROM blocks WHERE id=?;`, blockID).Scan(&b.ID, &b.Kind, &b.Value, &b.Reason, &b.CreatedDate); err != nil {
+		return b, err
+	}
+	db.Exec(`DELETE FROM blocks WHERE id=?;`, blockID)
+	return b, nil
+}
+
+// ReadBlocks returns the blocks of a kind, newest first.
+func ReadBlocks(kind string) []Block {
+	var blocks []Block
+	rows := db.Query(`SELECT id, kind, value, reason, created_date FROM blocks WHERE kind=? ORDER BY id DESC;`, kind)
+	for rows.Next() {
+		var b Block
+		rows.Scan(&b.ID, &b.Kind, &b.Value, &b.Reason, &b.CreatedDate)
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+func NumBlocks(kind string) int {
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM blocks WHERE kind=?;`, kind).Scan(&n)
+	return n
+}
+
+// IsEmailDomainBlocked reports whether the domain, or a domain it is part of, is blocked
+// by hand or is a disposable address provider.
+func IsEmailDomainBlocked(domain string) bool {
+	domain = strings.ToLower(domain)
+	for domain != "" {
+		var n int
+		db.QueryRow(`SELECT COUNT(*) FROM blocks WHERE (kind=? OR kind=?) AND value=?;`, BlockEmail, BlockDisposable, domain).Scan(&n)
+		if n > 0 {
+			return true
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			break
+		}
+		domain = domain[i+1:]
+	}
+	return false
+}
+
+// LoadDisposableDomains replaces the disposable domains with those read from r, one per
+// line. Blank lines and lines starting with '#' are skipped. It returns the number of
+// domains loaded.
+func LoadDisposableDomains(r io.Reader) (int, error) {
+	var domains []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	db.Exec(`DELETE FROM blocks WHERE kind=?;`, BlockDisposable)
+	for _, domain := range domains {
+		CreateBlock(BlockDisposable, domain, "")
+	}
+	return NumBlocks(BlockDisposable), nil
+}
+
+// userIPsSQL lists the IP addresses each user signed up, posted or logged in from.
+const userIPsSQL = `SELECT id AS userid, signup_ip AS ip FROM users
+	UNION SELECT userid, ip FROM topics
+	UNION SELECT userid, ip FROM comments
+	UNION SELECT fromid, ip FROM messages
+	UNION SELECT userid, ip FROM sessions WHERE userid IS NOT NULL`
+
+// ReadIPSharers returns the other accounts seen at the IP addresses of the user, those
+// sharing the most addresses first.
+func ReadIPSharers(userID string) []IPSharer {
+	var sharers []IPSharer
+	rows := db.Query(`SELECT users.username, COUNT(DISTINCT userips.ip) FROM (`+userIPsSQL+`) userips
+		INNER JOIN users ON users.id=userips.userid
+		WHERE userips.userid != ? AND userips.ip != '' AND userips.ip IN (SELECT ip FROM (`+userIPsSQL+`) ownips WHERE ownips.userid=?)
+		GROUP BY users.username ORDER BY COUNT(DISTINCT userips.ip) DESC, users.username;`, userID, userID)
+	for rows.Next() {
+		var s IPSharer
+		rows.Scan(&s.UserName, &s.NumIPs)
+		sharers = append(sharers, s)
+	}
+	return sharers
+}
@@ -13,18 +13,42 @@ const (
 	SignupMsg              string = "signup_msg"
 	CensoredWords          string = "censored_words"
 	SignupDisabled         string = "signup_disabled"
+	InviteOnly             string = "invite_only"
 	GroupCreationDisabled  string = "group_creation_disabled"
 	ImageUploadEnabled     string = "image_upload_enabled"
 	AllowGroupSubscription string = "allow_group_subscription"
 	AllowTopicSubscription string = "allow_topic_subscription"
 	ReadOnlyMode           string = "read_only"
+	Require2FA             string = "require_2fa"
+	RequireVerifiedEmail   string = "require_verified_email"
+	PremodAccountAge       string = "premod_account_age"
+	PremodNumPosts         string = "premod_num_posts"
+	InfractionPointsDays   string = "infraction_points_days"
+	InfractionEscalations  string = "infraction_escalations"
 	DataDir                string = "data_dir"
+	BreachedPasswdFile     string = "breached_passwd_file"
 	BodyAppendage          string = "body_appendage"
+	ForumURL               string = "forum_url"
 	DefaultFromMail        string = "default_from_mail"
 	SMTPHost               string = "smtp_host"
 	SMTPPort               string = "smtp_port"
 	SMTPUser               string = "smtp_user"
 	SMTPPass               string = "smtp_pass"
+	OIDCIssuer             string = "oidc_issuer"
+	OIDCClientID           string = "oidc_client_id"
+	OIDCClientSecret       string = "oidc_client_secret"
+	OIDCScopes             string = "oidc_scopes"
+	OIDCAdminClaim         string = "oidc_admin_claim"
+	OIDCAdminGroup         string = "oidc_admin_group"
+	LDAPURL                string = "ldap_url"
+	LDAPBindDN             string = "ldap_bind_dn"
+	LDAPBindPass           string = "ldap_bind_pass"
+	LDAPBaseDN             string = "ldap_base_dn"
+	LDAPUserFilter         string = "ldap_user_filter"
+	LDAPGroupAttr          string = "ldap_group_attr"
+	LDAPGroupRoles         string = "ldap_group_roles"
+	LDAPOnly               string = "ldap_only"
+	MarkdownDate           string = "markdown_date"
 	Version                string = "version"
 )
 
@@ -59,6 +83,30 @@ func Config(key string) string {
 	if key == CensoredWords {
 		return ""
 	}
+	if key == ForumURL {
+		return ""
+	}
+	if key == BreachedPasswdFile {
+		return ""
+	}
+	if key == OIDCIssuer || key == OIDCClientID || key == OIDCClientSecret || key == OIDCAdminGroup {
+		return ""
+	}
+	if key == OIDCScopes {
+		return "openid profile email"
+	}
+	if key == OIDCAdminClaim {
+		return "groups"
+	}
+	if key == LDAPURL || key == LDAPBindDN || key == LDAPBindPass || key == LDAPBaseDN || key == LDAPGroupRoles {
+		return ""
+	}
+	if key == LDAPUserFilter {
+		return "(uid=%s)"
+	}
+	if key == LDAPGroupAttr {
+		return "memberOf"
+	}
 	return "0"
 }
 
@@ -70,18 +118,41 @@ func ConfigAllVals() map[string]interface{} {
 		SignupMsg:              Config(SignupMsg),
 		CensoredWords:          Config(CensoredWords),
 		SignupDisabled:         Config(SignupDisabled) == "1",
+		InviteOnly:             Config(InviteOnly) == "1",
 		GroupCreationDisabled:  Config(GroupCreationDisabled) == "1",
 		ImageUploadEnabled:     Config(ImageUploadEnabled) == "1",
 		AllowGroupSubscription: Config(AllowGroupSubscription) == "1",
 		AllowTopicSubscription: Config(AllowTopicSubscription) == "1",
 		ReadOnlyMode:           Config(ReadOnlyMode) == "1",
+		Require2FA:             Config(Require2FA) == "1",
+		RequireVerifiedEmail:   Config(RequireVerifiedEmail) == "1",
+		PremodAccountAge:       Config(PremodAccountAge),
+		PremodNumPosts:         Config(PremodNumPosts),
+		InfractionPointsDays:   Config(InfractionPointsDays),
+		InfractionEscalations:  Config(InfractionEscalations),
 		DataDir:                Config(DataDir),
+		BreachedPasswdFile:     Config(BreachedPasswdFile),
 		BodyAppendage:          Config(BodyAppendage),
+		ForumURL:               Config(ForumURL),
 		DefaultFromMail:        Config(DefaultFromMail),
 		SMTPHost:               Config(SMTPHost),
 		SMTPPort:               Config(SMTPPort),
 		SMTPUser:               Config(SMTPUser),
 		SMTPPass:               Config(SMTPPass),
+		OIDCIssuer:             Config(OIDCIssuer),
+		OIDCClientID:           Config(OIDCClientID),
+		OIDCClientSecret:       Config(OIDCClientSecret),
+		OIDCScopes:             Config(OIDCScopes),
+		OIDCAdminClaim:         Config(OIDCAdminClaim),
+		OIDCAdminGroup:         Config(OIDCAdminGroup),
+		LDAPURL:                Config(LDAPURL),
+		LDAPBindDN:             Config(LDAPBindDN),
+		LDAPBindPass:           Config(LDAPBindPass),
+		LDAPBaseDN:             Config(LDAPBaseDN),
+		LDAPUserFilter:         Config(LDAPUserFilter),
+		LDAPGroupAttr:          Config(LDAPGroupAttr),
+		LDAPGroupRoles:         Config(LDAPGroupRoles),
+		LDAPOnly:               Config(LDAPOnly) == "1",
 	}
 	return vals
 }
@@ -40,6 +40,10 @@ func Init(driverName string, dataSourceName string) {
 	}
 }
 
+func DriverName() string {
+	return dbDriverName
+}
+
 func translate(query string) string {
 	if dbDriverName == "postgres" {
 		query = strings.Replace(query, "INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY", -1)
@@ -0,0 +1,75 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"errors"
+	"github.com/s-gv/orangeforum/models/db"
+	"time"
+)
+
+// users.email holds confirmed addresses, and addresses saved before confirmation was added,
+// which have is_email_confirmed unset. A new address is kept in pending_email until the user
+// follows the link with email_token that is e-mailed to it.
+
+// EmailTokenExpiry is how long a confirmation link works.
+const EmailTokenExpiry = 48 * time.Hour
+
+// SetPendingEmail saves email as the unconfirmed address of the user, to be confirmed with
+// token. An empty email cancels a pending change.
+func SetPendingEmail(userID string, email string, token string) {
+	tokenDate := time.Now().Unix()
+	if email == "" {
+		token = ""
+		tokenDate = 0
+	}
+	db.Exec(`UPDATE users SET pending_email=?, email_token=?, email_token_date=? WHERE id=?;`, email, token, tokenDate, userID)
+}
+
+// ReadPendingEmail returns the unconfirmed address of the user, and when the last
+// confirmation link was sent to it.
+func ReadPendingEmail(userID string) (email string, tokenDate int64) {
+	db.QueryRow(`SELECT pending_email, email_token_date FROM users WHERE id=?;`, userID).Scan(&email, &tokenDate)
+	return email, tokenDate
+}
+
+// ReadPendingEmailByToken returns the user and the unconfirmed address that token confirms.
+func ReadPendingEmailByToken(token string) (userID string, email string, err error) {
+	if len(token) > 0 {
+		var tokenDate int64
+		r := db.QueryRow(`SELECT id, pending_email, email_token_date FROM users WHERE email_token=?;`, token)
+		if r.Scan(&userID, &email, &tokenDate) == nil && email != "" {
+			if time.Unix(tokenDate, 0).After(time.Now().Add(-EmailTokenExpiry)) {
+				return userID, email, nil
+			}
+		}
+	}
+	return "", "", errors.New("Invalid/Expired confirmation link.")
+}
+
+// ConfirmEmail makes the address confirmed by token the e-mail address of its user. Password
+// reset links sent to the old address stop working.
+func ConfirmEmail(token string) (userID string, err error) {
+	userID, email, err := ReadPendingEmailByToken(token)
+	if err != nil {
+		return "", err
+	}
+	db.Exec(`UPDATE users SET email=?, is_email_confirmed=?, pending_email='', email_token='', email_token_date=0, reset_token='', reset_token_date=0 WHERE id=?;`,
+		email, true, userID)
+	return userID, nil
+}
+
+// RemoveUserEmail removes the address of the user, along with any pending change.
+func RemoveUserEmail(userID string) {
+	db.Exec(`UPDATE users SET email='', is_email_confirmed=?, pending_email='', email_token='', email_token_date=0, reset_token='', reset_token_date=0 WHERE id=?;`, false, userID)
+}
+
+// IsEmailVerified reports whether the user has a confirmed e-mail address.
+func IsEmailVerified(userID string) bool {
+	var email string
+	var isConfirmed bool
+	db.QueryRow(`SELECT email, is_email_confirmed FROM users WHERE id=?;`, userID).Scan(&email, &isConfirmed)
+	return email != "" && isConfirmed
+}
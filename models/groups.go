@@ -6,21 +6,71 @@ package models
 
 import (
 	"github.com/s-gv/orangeforum/models/db"
+	"strconv"
 	"time"
 )
 
+// VisibleGroupsSQL restricts a query joined with groups to the groups a user can read.
+// It takes two arguments: whether the user is a superadmin, and the user ID.
+const VisibleGroupsSQL = `(groups.is_private=0 OR ?=1 OR groups.id IN (SELECT groupid FROM members WHERE userid=?))`
+
 func CreateGroupMod(userName string, groupID string) {
 	if uid, err := ReadUserIDByName(userName); err == nil {
 		db.Exec(`INSERT INTO mods(userid, groupid, created_date) VALUES(?, ?, ?);`, uid, groupID, time.Now().Unix())
+		CreateGroupMember(strconv.Itoa(uid), groupID)
 	}
 }
 
 func CreateGroupAdmin(userName string, groupID string) {
 	if uid, err := ReadUserIDByName(userName); err == nil {
 		db.Exec(`INSERT INTO admins(userid, groupid, created_date) VALUES(?, ?, ?);`, uid, groupID, time.Now().Unix())
+		CreateGroupMember(strconv.Itoa(uid), groupID)
+	}
+}
+
+func DeleteGroupMod(userID string, groupID string) {
+	db.Exec(`DELETE FROM mods WHERE userid=? AND groupid=?;`, userID, groupID)
+}
+
+func DeleteGroupAdmin(userID string, groupID string) {
+	db.Exec(`DELETE FROM admins WHERE userid=? AND groupid=?;`, userID, groupID)
+}
+
+func CreateGroupMember(userID string, groupID string) {
+	if !IsUserGroupMember(userID, groupID) {
+		db.Exec(`INSERT INTO members(userid, groupid, created_date) VALUES(?, ?, ?);`, userID, groupID, time.Now().Unix())
+	}
+	db.Exec(`DELETE FROM memberrequests WHERE userid=? AND groupid=?;`, userID, groupID)
+}
+
+func DeleteGroupMember(userID string, groupID string) {
+	db.Exec(`DELETE FROM members WHERE userid=? AND groupid=?;`, userID, groupID)
+	db.Exec(`DELETE FROM groupsubscriptions WHERE userid=? AND groupid=?;`, userID, groupID)
+	db.Exec(`DELETE FROM topicsubscriptions WHERE userid=? AND topicid IN (SELECT id FROM topics WHERE groupid=?);`, userID, groupID)
+}
+
+func CreateGroupMemberRequest(userID string, groupID string, isInvite bool) {
+	var tmp string
+	if db.QueryRow(`SELECT id FROM memberrequests WHERE userid=? AND groupid=?;`, userID, groupID).Scan(&tmp) == nil {
+		db.Exec(`UPDATE memberrequests SET is_invite=?, created_date=? WHERE userid=? AND groupid=?;`, isInvite, time.Now().Unix(), userID, groupID)
+	} else {
+		db.Exec(`INSERT INTO memberrequests(userid, groupid, is_invite, created_date) VALUES(?, ?, ?, ?);`, userID, groupID, isInvite, time.Now().Unix())
 	}
 }
 
+func DeleteGroupMemberRequest(userID string, groupID string) {
+	db.Exec(`DELETE FROM memberrequests WHERE userid=? AND groupid=?;`, userID, groupID)
+}
+
+// ReadGroupMemberRequest returns whether there is a pending invite or join request for the user.
+func ReadGroupMemberRequest(userID string, groupID string) (isInvite bool, isRequest bool) {
+	var invite bool
+	if db.QueryRow(`SELECT is_invite FROM memberrequests WHERE userid=? AND groupid=?;`, userID, groupID).Scan(&invite) == nil {
+		return invite, !invite
+	}
+	return false, false
+}
+
 func ReadMods(groupID string) []string {
 	rows := db.Query(`SELECT users.username FROM users INNER JOIN mods ON users.id=mods.userid WHERE mods.groupid=?;`, groupID)
 	var mods []string
@@ -52,6 +102,45 @@ func IsUserGroupAdmin(userID string, groupID string) bool {
 	return false
 }
 
+func IsUserGroupMod(userID string, groupID string) bool {
+	r := db.QueryRow(`SELECT id FROM mods WHERE userid=? AND groupid=?`, userID, groupID)
+	var tmp string
+	if err := r.Scan(&tmp); err == nil {
+		return true
+	}
+	return false
+}
+
+func IsUserGroupMember(userID string, groupID string) bool {
+	r := db.QueryRow(`SELECT id FROM members WHERE userid=? AND groupid=?`, userID, groupID)
+	var tmp string
+	if err := r.Scan(&tmp); err == nil {
+		return true
+	}
+	return false
+}
+
+// CanUserViewGroup reports whether a user can read the topics of a group. Private groups
+// can be read only by their members and the superadmin.
+func CanUserViewGroup(userID string, groupID string) bool {
+	r := db.QueryRow(`SELECT id FROM groups WHERE id=? AND (is_private=0
+		OR id IN (SELECT groupid FROM members WHERE userid=?) OR EXISTS (SELECT id FROM users WHERE id=? AND is_superadmin=1));`, groupID, userID, userID)
+	var tmp string
+	if err := r.Scan(&tmp); err == nil {
+		return true
+	}
+	return false
+}
+
+func IsGroupPrivate(groupID string) bool {
+	r := db.QueryRow(`SELECT is_private FROM groups WHERE id=?;`, groupID)
+	var isPrivate bool
+	if err := r.Scan(&isPrivate); err == nil {
+		return isPrivate
+	}
+	return false
+}
+
 func ReadGroupIDByName(name string) string {
 	r := db.QueryRow(`SELECT id FROM groups WHERE name=?;`, name)
 	var id string
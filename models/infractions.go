@@ -0,0 +1,129 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"github.com/s-gv/orangeforum/models/db"
+	"time"
+)
+
+// A Warning is a formal warning given to a user by a mod of a group, or by a superadmin
+// if GroupID is "". Its points count towards the escalations in InfractionEscalations.
+type Warning struct {
+	ID          string
+	UserID      string
+	GroupID     string
+	GroupName   string
+	IssuerName  string
+	Reason      string
+	Points      int
+	CreatedDate int64
+}
+
+// A GroupBan stops a user from posting in a group until ExpiryDate, or for good if
+// ExpiryDate is 0.
+type GroupBan struct {
+	UserID      string
+	UserName    string
+	Reason      string
+	ExpiryDate  int64
+	CreatedDate int64
+}
+
+func CreateWarning(userID string, groupID string, issuerID string, reason string, points int) {
+	db.Exec(`INSERT INTO warnings(userid, groupid, issuerid, reason, points, created_date) VALUES(?, ?, ?, ?, ?, ?);`,
+		userID, sql.NullString{String: groupID, Valid: groupID != ""}, sql.NullString{String: issuerID, Valid: issuerID != ""},
+		reason, points, time.Now().Unix())
+}
+
+// ReadWarnings returns the warnings given to the user, newest first.
+func ReadWarnings(userID string) []Warning {
+	var warnings []Warning
+	rows := db.Query(`SELECT warnings.id, warnings.userid, warnings.groupid, COALESCE(groups.name, ''), COALESCE(issuers.username, ''),
+		warnings.reason, warnings.points, warnings.created_date
+		FROM warnings LEFT JOIN groups ON groups.id=warnings.groupid LEFT JOIN users issuers ON issuers.id=warnings.issuerid
+		WHERE warnings.userid=? ORDER BY warnings.id DESC;`, userID)
+	for rows.Next() {
+		var w Warning
+		var groupID sql.NullString
+		rows.Scan(&w.ID, &w.UserID, &groupID, &w.GroupName, &w.IssuerName, &w.Reason, &w.Points, &w.CreatedDate)
+		w.GroupID = groupID.String
+		warnings = append(warnings, w)
+	}
+	return warnings
+}
+
+// NumInfractionPoints is the sum of the points of the user's warnings from the mods of the
+// group given since minDate, or of the warnings from the superadmins if groupID is "".
+func NumInfractionPoints(userID string, groupID string, minDate int64) int {
+	var points int
+	if groupID == "" {
+		db.QueryRow(`SELECT COALESCE(SUM(points), 0) FROM warnings WHERE userid=? AND groupid IS NULL AND created_date >= ?;`,
+			userID, minDate).Scan(&points)
+	} else {
+		db.QueryRow(`SELECT COALESCE(SUM(points), 0) FROM warnings WHERE userid=? AND groupid=? AND created_date >= ?;`,
+			userID, groupID, minDate).Scan(&points)
+	}
+	return points
+}
+
+// SuspendUser stops the user from posting anywhere until the given date.
+func SuspendUser(userID string, until int64, reason string) {
+	db.Exec(`UPDATE users SET suspended_until=?, suspend_reason=? WHERE id=?;`, until, reason, userID)
+}
+
+func UnsuspendUser(userID string) {
+	db.Exec(`UPDATE users SET suspended_until=0, suspend_reason='' WHERE id=?;`, userID)
+}
+
+// ReadSuspension returns the end and the reason of the user's suspension. until is 0 if
+// the user is not suspended or the suspension has run out.
+func ReadSuspension(userID string) (until int64, reason string) {
+	db.QueryRow(`SELECT suspended_until, suspend_reason FROM users WHERE id=?;`, userID).Scan(&until, &reason)
+	if until <= time.Now().Unix() {
+		return 0, ""
+	}
+	return until, reason
+}
+
+// CreateGroupBan bans the user from the group, replacing any earlier ban.
+func CreateGroupBan(groupID string, userID string, reason string, expiryDate int64) {
+	db.Exec(`DELETE FROM groupbans WHERE groupid=? AND userid=?;`, groupID, userID)
+	db.Exec(`INSERT INTO groupbans(groupid, userid, reason, expiry_date, created_date) VALUES(?, ?, ?, ?, ?);`,
+		groupID, userID, reason, expiryDate, time.Now().Unix())
+}
+
+func DeleteGroupBan(groupID string, userID string) {
+	db.Exec(`DELETE FROM groupbans WHERE groupid=? AND userid=?;`, groupID, userID)
+}
+
+// ReadGroupBan returns the ban of the user from the group, or an error if the user is
+// not banned or the ban has run out.
+func ReadGroupBan(groupID string, userID string) (GroupBan, error) {
+	b := GroupBan{UserID: userID}
+	if err := db.QueryRow(`SELECT groupbans.reason, groupbans.expiry_date, groupbans.created_date, users.username
+		FROM groupbans INNER JOIN users ON users.id=groupbans.userid
+		WHERE groupbans.groupid=? AND groupbans.userid=? AND (groupbans.expiry_date=0 OR groupbans.expiry_date > ?);`,
+		groupID, userID, time.Now().Unix()).Scan(&b.Reason, &b.ExpiryDate, &b.CreatedDate, &b.UserName); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+// ReadGroupBans returns the bans in the group that have not run out, newest first.
+func ReadGroupBans(groupID string) []GroupBan {
+	var bans []GroupBan
+	rows := db.Query(`SELECT groupbans.userid, users.username, groupbans.reason, groupbans.expiry_date, groupbans.created_date
+		FROM groupbans INNER JOIN users ON users.id=groupbans.userid
+		WHERE groupbans.groupid=? AND (groupbans.expiry_date=0 OR groupbans.expiry_date > ?) ORDER BY groupbans.id DESC;`,
+		groupID, time.Now().Unix())
+	for rows.Next() {
+		var b GroupBan
+		rows.Scan(&b.UserID, &b.UserName, &b.Reason, &b.ExpiryDate, &b.CreatedDate)
+		bans = append(bans, b)
+	}
+	return bans
+}
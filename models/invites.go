@@ -0,0 +1,119 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/s-gv/orangeforum/models/db"
+	"time"
+)
+
+// An Invite lets up to MaxUses people sign up until ExpiryDate, even when the forum is
+// invite-only. Users who sign up with an invite that has a group join the group.
+type Invite struct {
+	ID          string
+	Code        string
+	CreatorName string
+	GroupID     string
+	GroupName   string
+	MaxUses     int
+	NumUses     int
+	IsRevoked   bool
+	ExpiryDate  int64
+	CreatedDate int64
+}
+
+// IsUsable reports whether the invite can still be used to sign up.
+func (i Invite) IsUsable(now time.Time) bool {
+	return !i.IsRevoked && i.NumUses < i.MaxUses && now.Unix() < i.ExpiryDate
+}
+
+// InvitedUser is a user who signed up with an invite.
+type InvitedUser struct {
+	UserName    string
+	InviteID    string
+	InviteCode  string
+	CreatorName string
+	CreatedDate int64
+}
+
+const inviteColumns = `invites.id, invites.code, COALESCE(users.username, ''), invites.groupid, COALESCE(groups.name, ''),
+	invites.max_uses, invites.num_uses, invites.is_revoked, invites.expiry_date, invites.created_date
+	FROM invites LEFT JOIN users ON users.id=invites.userid LEFT JOIN groups ON groups.id=invites.groupid`
+
+func readInvites(rows *db.Rows) []Invite {
+	var invites []Invite
+	for rows.Next() {
+		var i Invite
+		var groupID sql.NullString
+		rows.Scan(&i.ID, &i.Code, &i.CreatorName, &groupID, &i.GroupName, &i.MaxUses, &i.NumUses, &i.IsRevoked, &i.ExpiryDate, &i.CreatedDate)
+		i.GroupID = groupID.String
+		invites = append(invites, i)
+	}
+	return invites
+}
+
+// CreateInvite creates an invite from the user. groupID may be "".
+func CreateInvite(userID string, code string, groupID string, maxUses int, expiryDate int64) {
+	group := sql.NullString{String: groupID, Valid: groupID != ""}
+	db.Exec(`INSERT INTO invites(code, userid, groupid, max_uses, num_uses, is_revoked, expiry_date, created_date) VALUES(?, ?, ?, ?, ?, ?, ?, ?);`,
+		code, userID, group, maxUses, 0, false, expiryDate, time.Now().Unix())
+}
+
+// ReadInvitesByUser returns the latest invites created by the user.
+func ReadInvitesByUser(userID string, limit int) []Invite {
+	return readInvites(db.Query(`SELECT `+inviteColumns+` WHERE invites.userid=? ORDER BY invites.id DESC LIMIT ?;`, userID, limit))
+}
+
+// ReadInvites returns the latest invites.
+func ReadInvites(limit int) []Invite {
+	return readInvites(db.Query(`SELECT `+inviteColumns+` ORDER BY invites.id DESC LIMIT ?;`, limit))
+}
+
+// ReadInviteByCode returns the invite with code, even if it can no longer be used.
+func ReadInviteByCode(code string) (Invite, error) {
+	if code != "" {
+		if invites := readInvites(db.Query(`SELECT `+inviteColumns+` WHERE invites.code=?;`, code)); len(invites) == 1 {
+			return invites[0], nil
+		}
+	}
+	return Invite{}, errors.New("Invite not found.")
+}
+
+// UseInvite records that the user signed up with the invite.
+func UseInvite(inviteID string, userID string) {
+	db.Exec(`UPDATE invites SET num_uses=num_uses+1 WHERE id=?;`, inviteID)
+	db.Exec(`UPDATE users SET inviteid=? WHERE id=?;`, inviteID, userID)
+}
+
+// RevokeInvite revokes an invite created by the user. If userID is "", any invite is revoked.
+func RevokeInvite(inviteID string, userID string) {
+	if userID == "" {
+		db.Exec(`UPDATE invites SET is_revoked=? WHERE id=?;`, true, inviteID)
+	} else {
+		db.Exec(`UPDATE invites SET is_revoked=? WHERE id=? AND userid=?;`, true, inviteID, userID)
+	}
+}
+
+// ReadInvitedUsers returns the users who signed up with an invite most recently.
+func ReadInvitedUsers(limit int) []InvitedUser {
+	rows := db.Query(`SELECT users.username, invites.id, invites.code, COALESCE(creators.username, ''), users.created_date
+		FROM users INNER JOIN invites ON invites.id=users.inviteid LEFT JOIN users creators ON creators.id=invites.userid
+		ORDER BY users.created_date DESC LIMIT ?;`, limit)
+	var users []InvitedUser
+	for rows.Next() {
+		var u InvitedUser
+		rows.Scan(&u.UserName, &u.InviteID, &u.InviteCode, &u.CreatorName, &u.CreatedDate)
+		users = append(users, u)
+	}
+	return users
+}
+
+func NumInvitedUsers() int {
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM users WHERE inviteid IS NOT NULL;`).Scan(&n)
+	return n
+}
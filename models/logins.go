@@ -0,0 +1,106 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"github.com/s-gv/orangeforum/models/db"
+	"time"
+)
+
+// Pages that check a password, a two-factor code or a security key (or probe a username)
+// and record their failures.
+const (
+	LoginActionLogin      string = "login"
+	LoginActionChangePass string = "changepass"
+	LoginActionForgotPass string = "forgotpass"
+	LoginActionTwoFactor  string = "2fa"
+	LoginActionPasskey    string = "passkey"
+)
+
+type LoginFailure struct {
+	ID          string
+	UserName    string
+	IP          string
+	Action      string
+	CreatedDate int64
+}
+
+// RecordLoginFailure logs a failed attempt. userName need not be an existing user.
+func RecordLoginFailure(userName string, ip string, action string) {
+	db.Exec(`INSERT INTO loginfailures(username, ip, action, is_cleared, created_date) VALUES(?, ?, ?, ?, ?);`,
+		userName, ip, action, false, time.Now().Unix())
+}
+
+// NumLoginFailuresByUser returns the number of failed attempts on userName since the unix time
+// since that haven't been cleared, and the time of the latest one.
+func NumLoginFailuresByUser(userName string, since int64) (int, int64) {
+	var n int
+	var last int64
+	db.QueryRow(`SELECT COUNT(*), COALESCE(MAX(created_date), 0) FROM loginfailures WHERE username=? AND is_cleared=? AND created_date >= ?;`,
+		userName, false, since).Scan(&n, &last)
+	return n, last
+}
+
+// NumLoginFailuresByIP is like NumLoginFailuresByUser, but counts the failed attempts from ip.
+func NumLoginFailuresByIP(ip string, since int64) (int, int64) {
+	var n int
+	var last int64
+	db.QueryRow(`SELECT COUNT(*), COALESCE(MAX(created_date), 0) FROM loginfailures WHERE ip=? AND is_cleared=? AND created_date >= ?;`,
+		ip, false, since).Scan(&n, &last)
+	return n, last
+}
+
+// NumLoginFailuresByUserIP is like NumLoginFailuresByUser, but counts only the failed attempts
+// on userName from ip.
+func NumLoginFailuresByUserIP(userName string, ip string, since int64) (int, int64) {
+	var n int
+	var last int64
+	db.QueryRow(`SELECT COUNT(*), COALESCE(MAX(created_date), 0) FROM loginfailures WHERE username=? AND ip=? AND is_cleared=? AND created_date >= ?;`,
+		userName, ip, false, since).Scan(&n, &last)
+	return n, last
+}
+
+// MaxLoginFailuresByUserIP returns the largest number of failed attempts on userName from one
+// IP address since the unix time since that haven't been cleared.
+func MaxLoginFailuresByUserIP(userName string, since int64) int {
+	var n int
+	db.QueryRow(`SELECT COALESCE(MAX(n), 0) FROM (SELECT COUNT(*) AS n FROM loginfailures WHERE username=? AND is_cleared=? AND created_date >= ? GROUP BY ip) AS f;`,
+		userName, false, since).Scan(&n)
+	return n
+}
+
+// NumLoginFailures returns the number of failed attempts since the unix time since.
+func NumLoginFailures(since int64) int {
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM loginfailures WHERE created_date >= ?;`, since).Scan(&n)
+	return n
+}
+
+// ClearLoginFailuresByUser lifts the throttling of userName. The failures stay in the log.
+func ClearLoginFailuresByUser(userName string) {
+	db.Exec(`UPDATE loginfailures SET is_cleared=? WHERE username=? AND is_cleared=?;`, true, userName, false)
+}
+
+// ClearLoginFailuresByIP lifts the throttling of ip. The failures stay in the log.
+func ClearLoginFailuresByIP(ip string) {
+	db.Exec(`UPDATE loginfailures SET is_cleared=? WHERE ip=? AND is_cleared=?;`, true, ip, false)
+}
+
+// ReadLoginFailures returns up to limit failed attempts, newest first.
+func ReadLoginFailures(limit int) []LoginFailure {
+	var failures []LoginFailure
+	rows := db.Query(`SELECT id, username, ip, action, created_date FROM loginfailures ORDER BY created_date DESC, id DESC LIMIT ?;`, limit)
+	for rows.Next() {
+		f := LoginFailure{}
+		rows.Scan(&f.ID, &f.UserName, &f.IP, &f.Action, &f.CreatedDate)
+		failures = append(failures, f)
+	}
+	return failures
+}
+
+// DeleteLoginFailures removes the log entries older than the unix time before.
+func DeleteLoginFailures(before int64) {
+	db.Exec(`DELETE FROM loginfailures WHERE created_date < ?;`, before)
+}
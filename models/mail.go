@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"github.com/s-gv/orangeforum/models/db"
+	"time"
+)
+
+// States of a queued e-mail. Sent e-mails are removed from the queue.
+const (
+	MailPending string = "pending"
+	MailDead    string = "dead"
+)
+
+type QueuedMail struct {
+	ID              string
+	To              string
+	Subject         string
+	Body            string
+	Status          string
+	Attempts        int
+	NextAttemptDate int64
+	LastError       string
+	CreatedDate     int64
+}
+
+func EnqueueMail(to string, subject string, body string) {
+	now := time.Now().Unix()
+	db.Exec(`INSERT INTO outbox(recipient, subject, body, status, attempts, next_attempt_date, last_error, created_date) VALUES(?, ?, ?, ?, ?, ?, ?, ?);`,
+		to, subject, body, MailPending, 0, now, "", now)
+}
+
+func readMails(rows *db.Rows) []QueuedMail {
+	var mails []QueuedMail
+	for rows.Next() {
+		m := QueuedMail{}
+		rows.Scan(&m.ID, &m.To, &m.Subject, &m.Body, &m.Status, &m.Attempts, &m.NextAttemptDate, &m.LastError, &m.CreatedDate)
+		mails = append(mails, m)
+	}
+	return mails
+}
+
+// ReadDueMails returns up to limit pending e-mails whose next attempt is due at now.
+func ReadDueMails(now int64, limit int) []QueuedMail {
+	return readMails(db.Query(`SELECT id, recipient, subject, body, status, attempts, next_attempt_date, last_error, created_date
+		FROM outbox WHERE status=? AND next_attempt_date <= ? ORDER BY next_attempt_date, id LIMIT ?;`, MailPending, now, limit))
+}
+
+// ReadFailedMails returns the e-mails that have failed at least once, newest first.
+func ReadFailedMails(limit int) []QueuedMail {
+	return readMails(db.Query(`SELECT id, recipient, subject, body, status, attempts, next_attempt_date, last_error, created_date
+		FROM outbox WHERE status=? OR attempts > 0 ORDER BY created_date DESC, id DESC LIMIT ?;`, MailDead, limit))
+}
+
+func DeleteMail(mailID string) {
+	db.Exec(`DELETE FROM outbox WHERE id=?;`, mailID)
+}
+
+// UpdateMailFailed records a failed attempt. The e-mail is retried at nextAttemptDate,
+// or never if isDead.
+func UpdateMailFailed(mailID string, attempts int, nextAttemptDate int64, errMsg string, isDead bool) {
+	status := MailPending
+	if isDead {
+		status = MailDead
+	}
+	db.Exec(`UPDATE outbox SET status=?, attempts=?, next_attempt_date=?, last_error=? WHERE id=?;`,
+		status, attempts, nextAttemptDate, errMsg, mailID)
+}
+
+// RetryMail queues a dead e-mail again.
+func RetryMail(mailID string) {
+	db.Exec(`UPDATE outbox SET status=?, attempts=0, next_attempt_date=? WHERE id=?;`, MailPending, time.Now().Unix(), mailID)
+}
@@ -7,9 +7,11 @@ package models
 import (
 	"github.com/s-gv/orangeforum/models/db"
 	"log"
+	"strconv"
+	"time"
 )
 
-const ModelVersion = 4
+const ModelVersion = 25
 
 func Migration1() {
 	db.Exec(`CREATE TABLE configs(name VARCHAR(250), val TEXT);`)
@@ -32,6 +34,25 @@ func Migration1() {
 	db.Exec(`CREATE INDEX users_email_index on users(email);`)
 	db.Exec(`CREATE INDEX users_reset_token_index on users(reset_token);`)
 	db.Exec(`CREATE INDEX users_created_index on users(created_date);`)
+	// db.Exec(`ALTER TABLE users ADD COLUMN digest VARCHAR(16) DEFAULT 'immediate';`) // Migration 8
+	// db.Exec(`ALTER TABLE users ADD COLUMN digest_sent_date INTEGER DEFAULT 0;`) // Migration 8
+	// db.Exec(`CREATE INDEX users_digest_index on users(digest);`) // Migration 8
+	// db.Exec(`ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64) DEFAULT '';`) // Migration 11
+	// db.Exec(`ALTER TABLE users ADD COLUMN totp_last_step INTEGER DEFAULT 0;`) // Migration 11
+	// db.Exec(`ALTER TABLE users ADD COLUMN oidc_subject VARCHAR(512) DEFAULT '';`) // Migration 13
+	// db.Exec(`CREATE INDEX users_oidc_subject_index on users(oidc_subject);`) // Migration 13
+	// db.Exec(`ALTER TABLE users ADD COLUMN pending_email VARCHAR(250) DEFAULT '';`) // Migration 14
+	// db.Exec(`ALTER TABLE users ADD COLUMN email_token VARCHAR(250) DEFAULT '';`) // Migration 14
+	// db.Exec(`ALTER TABLE users ADD COLUMN email_token_date INTEGER DEFAULT 0;`) // Migration 14
+	// db.Exec(`CREATE INDEX users_email_token_index on users(email_token);`) // Migration 14
+	// db.Exec(`ALTER TABLE users ADD COLUMN inviteid INTEGER;`) // Migration 15
+	// db.Exec(`CREATE INDEX users_inviteid_index on users(inviteid);`) // Migration 15
+	// db.Exec(`ALTER TABLE users ADD COLUMN suspended_until INTEGER DEFAULT 0;`) // Migration 20
+	// db.Exec(`ALTER TABLE users ADD COLUMN suspend_reason VARCHAR(250) DEFAULT '';`) // Migration 20
+	// db.Exec(`ALTER TABLE users ADD COLUMN signup_ip VARCHAR(64) DEFAULT '';`) // Migration 21
+	// db.Exec(`CREATE INDEX users_signup_ip_index on users(signup_ip);`) // Migration 21
+	// db.Exec(`ALTER TABLE users ADD COLUMN is_email_confirmed INTEGER DEFAULT 0;`) // Migration 23
+	// db.Exec(`ALTER TABLE users ADD COLUMN is_external INTEGER DEFAULT 0;`) // Migration 25
 
 	db.Exec(`CREATE TABLE groups(
 				id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -44,6 +65,8 @@ func Migration1() {
 		       		updated_date INTEGER
 	);`)
 	// db.Exec(`ALTER TABLE groups ADD COLUMN is_private INTEGER DEFAULT 0;`) // Migration 2.
+	// db.Exec(`ALTER TABLE groups ADD COLUMN premod_account_age INTEGER DEFAULT 0;`) // Migration 19
+	// db.Exec(`ALTER TABLE groups ADD COLUMN premod_num_posts INTEGER DEFAULT 0;`) // Migration 19
 	db.Exec(`CREATE INDEX groups_sticky_index on groups(is_sticky);`)
 	db.Exec(`CREATE INDEX groups_closed_sticky_index on groups(is_closed, is_sticky DESC);`)
 	db.Exec(`CREATE UNIQUE INDEX groups_name_index on groups(name);`)
@@ -69,6 +92,12 @@ func Migration1() {
 	db.Exec(`CREATE INDEX topics_created_index on topics(created_date);`)
 	// db.Exec(`CREATE INDEX topics_groupid_sticky_activity_index on topics(groupid, is_sticky DESC, activity_date DESC);`) // Migration 2
 	// db.Exec(`CREATE INDEX topics_activity_index on topics(activity_date);`) // Migration 2
+	// db.Exec(`ALTER TABLE topics ADD COLUMN is_pending INTEGER DEFAULT 0;`) // Migration 19
+	// db.Exec(`CREATE INDEX topics_groupid_pending_index on topics(groupid, is_pending);`) // Migration 19
+	// db.Exec(`ALTER TABLE topics ADD COLUMN ip VARCHAR(64) DEFAULT '';`) // Migration 21
+	// db.Exec(`CREATE INDEX topics_ip_index on topics(ip);`) // Migration 21
+	// db.Exec(`ALTER TABLE topics ADD COLUMN published_date INTEGER DEFAULT 0;`) // Migration 24
+	// db.Exec(`CREATE INDEX topics_published_index on topics(published_date);`) // Migration 24
 
 	db.Exec(`CREATE TABLE comments(
 				id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -91,6 +120,12 @@ func Migration1() {
 	// db.Exec(`CREATE INDEX comments_topicid_created_index on comments(topicid, created_date);`) // Migration 3
 	// db.Exec(`CREATE INDEX comments_topicid_pos_index on comments(topicid, pos);`) // Migration 3
 	// db.Exec(`CREATE INDEX comments_topicid_posdesc_index on comments(topicid, pos DESC);`) // Migration 3
+	// db.Exec(`ALTER TABLE comments ADD COLUMN is_pending INTEGER DEFAULT 0;`) // Migration 19
+	// db.Exec(`CREATE INDEX comments_pending_index on comments(is_pending);`) // Migration 19
+	// db.Exec(`ALTER TABLE comments ADD COLUMN ip VARCHAR(64) DEFAULT '';`) // Migration 21
+	// db.Exec(`CREATE INDEX comments_ip_index on comments(ip);`) // Migration 21
+	// db.Exec(`ALTER TABLE comments ADD COLUMN published_date INTEGER DEFAULT 0;`) // Migration 24
+	// db.Exec(`CREATE INDEX comments_published_index on comments(published_date);`) // Migration 24
 	db.Exec(`CREATE INDEX comments_created_index on comments(created_date);`)
 
 	db.Exec(`CREATE TABLE mods(
@@ -153,6 +188,13 @@ func Migration1() {
 	);`)
 	db.Exec(`CREATE INDEX sessions_sessionid_index on sessions(sessionid);`)
 	db.Exec(`CREATE INDEX sessions_userid_index on sessions(userid);`)
+	// db.Exec(`ALTER TABLE sessions ADD COLUMN pending_userid INTEGER;`) // Migration 11
+	// db.Exec(`ALTER TABLE sessions ADD COLUMN pending_date INTEGER DEFAULT 0;`) // Migration 11
+	// db.Exec(`ALTER TABLE sessions ADD COLUMN challenge VARCHAR(64) DEFAULT '';`) // Migration 12
+	// db.Exec(`ALTER TABLE sessions ADD COLUMN challenge_date INTEGER DEFAULT 0;`) // Migration 12
+	// db.Exec(`ALTER TABLE sessions ADD COLUMN user_agent VARCHAR(250) DEFAULT '';`) // Migration 16
+	// db.Exec(`ALTER TABLE sessions ADD COLUMN ip VARCHAR(64) DEFAULT '';`) // Migration 16
+	// db.Exec(`ALTER TABLE sessions ADD COLUMN last_seen_date INTEGER DEFAULT 0;`) // Migration 16
 
 	/*
 		db.Exec(`CREATE TABLE messages(
@@ -168,6 +210,105 @@ func Migration1() {
 	// db.Exec(`CREATE INDEX messages_fromid_created_index on messages(fromid, created_date DESC);`) // Migration 4
 	// db.Exec(`CREATE INDEX messages_toid_created_index on messages(toid, created_date DESC);`) // Migration 4
 	// db.Exec(`CREATE INDEX messages_toid_isread_index on messages(toid, is_read);`) // Migration 4
+	// db.Exec(`ALTER TABLE messages ADD COLUMN ip VARCHAR(64) DEFAULT '';`) // Migration 21
+
+	/*
+		db.Exec(`CREATE TABLE members(
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+					groupid INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+					created_date INTEGER
+		);`) */ // Migration 5
+	// db.Exec(`CREATE INDEX members_userid_index on members(userid);`) // Migration 5
+	// db.Exec(`CREATE INDEX members_groupid_userid_index on members(groupid, userid);`) // Migration 5
+
+	/*
+		db.Exec(`CREATE TABLE memberrequests(
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+					groupid INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+					is_invite INTEGER DEFAULT 0,
+					created_date INTEGER
+		);`) */ // Migration 5
+	// db.Exec(`CREATE INDEX memberrequests_userid_index on memberrequests(userid);`) // Migration 5
+	// db.Exec(`CREATE INDEX memberrequests_groupid_userid_index on memberrequests(groupid, userid);`) // Migration 5
+
+	/*
+		db.Exec(`CREATE TABLE apitokens(
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+					name VARCHAR(64) NOT NULL,
+					tokenhash VARCHAR(64) NOT NULL,
+					scopes VARCHAR(64) DEFAULT '',
+					last_used_date INTEGER DEFAULT 0,
+					created_date INTEGER NOT NULL
+		);`) */ // Migration 6
+	// db.Exec(`CREATE UNIQUE INDEX apitokens_tokenhash_index on apitokens(tokenhash);`) // Migration 6
+	// db.Exec(`CREATE INDEX apitokens_userid_index on apitokens(userid);`) // Migration 6
+
+	/*
+		db.Exec(`CREATE TABLE notifications(
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+					actorid INTEGER REFERENCES users(id) ON DELETE SET NULL,
+					kind VARCHAR(16) NOT NULL,
+					content TEXT DEFAULT '',
+					url VARCHAR(256) DEFAULT '',
+					is_read INTEGER DEFAULT 0,
+					created_date INTEGER NOT NULL
+		);`) */ // Migration 7
+	// db.Exec(`CREATE INDEX notifications_userid_created_index on notifications(userid, created_date DESC);`) // Migration 7
+	// db.Exec(`CREATE INDEX notifications_userid_isread_index on notifications(userid, is_read);`) // Migration 7
+
+	/*
+		db.Exec(`CREATE TABLE outbox(
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					recipient VARCHAR(250) NOT NULL,
+					subject TEXT DEFAULT '',
+					body TEXT DEFAULT '',
+					status VARCHAR(16) NOT NULL,
+					attempts INTEGER DEFAULT 0,
+					next_attempt_date INTEGER NOT NULL,
+					last_error TEXT DEFAULT '',
+					created_date INTEGER NOT NULL
+		);`) */ // Migration 9
+	// db.Exec(`CREATE INDEX outbox_status_next_attempt_index on outbox(status, next_attempt_date);`) // Migration 9
+
+	/*
+		db.Exec(`CREATE TABLE loginfailures(
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					username VARCHAR(250) NOT NULL,
+					ip VARCHAR(64) NOT NULL,
+					action VARCHAR(16) NOT NULL,
+					is_cleared INTEGER DEFAULT 0,
+					created_date INTEGER NOT NULL
+		);`) */ // Migration 10
+	// db.Exec(`CREATE INDEX loginfailures_username_created_index on loginfailures(username, created_date);`) // Migration 10
+	// db.Exec(`CREATE INDEX loginfailures_ip_created_index on loginfailures(ip, created_date);`) // Migration 10
+	// db.Exec(`CREATE INDEX loginfailures_created_index on loginfailures(created_date);`) // Migration 10
+
+	/*
+		db.Exec(`CREATE TABLE recoverycodes(
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+					codehash VARCHAR(64) NOT NULL,
+					created_date INTEGER NOT NULL
+		);`) */ // Migration 11
+	// db.Exec(`CREATE INDEX recoverycodes_userid_index on recoverycodes(userid);`) // Migration 11
+
+	/*
+		db.Exec(`CREATE TABLE passkeys(
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+					credentialid VARCHAR(1400) NOT NULL,
+					publickey TEXT NOT NULL,
+					name VARCHAR(64) DEFAULT '',
+					sign_count INTEGER DEFAULT 0,
+					last_used_date INTEGER DEFAULT 0,
+					created_date INTEGER NOT NULL
+		);`) */ // Migration 12
+	// db.Exec(`CREATE UNIQUE INDEX passkeys_credentialid_index on passkeys(credentialid);`) // Migration 12
+	// db.Exec(`CREATE INDEX passkeys_userid_index on passkeys(userid);`) // Migration 12
 
 }
 
@@ -206,6 +347,289 @@ func Migration4() {
 	db.Exec(`CREATE INDEX messages_toid_isread_index on messages(toid, is_read);`)
 }
 
+func Migration5() {
+	db.Exec(`CREATE TABLE members(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+				groupid INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+				created_date INTEGER
+	);`)
+	db.Exec(`CREATE INDEX members_userid_index on members(userid);`)
+	db.Exec(`CREATE INDEX members_groupid_userid_index on members(groupid, userid);`)
+
+	db.Exec(`CREATE TABLE memberrequests(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+				groupid INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+				is_invite INTEGER DEFAULT 0,
+				created_date INTEGER
+	);`)
+	db.Exec(`CREATE INDEX memberrequests_userid_index on memberrequests(userid);`)
+	db.Exec(`CREATE INDEX memberrequests_groupid_userid_index on memberrequests(groupid, userid);`)
+
+	// Admins and mods of a group are its members.
+	db.Exec(`INSERT INTO members(userid, groupid, created_date) SELECT userid, groupid, created_date FROM admins;`)
+	db.Exec(`INSERT INTO members(userid, groupid, created_date) SELECT userid, groupid, created_date FROM mods
+			WHERE NOT EXISTS (SELECT id FROM members WHERE members.userid=mods.userid AND members.groupid=mods.groupid);`)
+}
+
+func Migration6() {
+	db.Exec(`CREATE TABLE apitokens(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+				name VARCHAR(64) NOT NULL,
+				tokenhash VARCHAR(64) NOT NULL,
+				scopes VARCHAR(64) DEFAULT '',
+				last_used_date INTEGER DEFAULT 0,
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE UNIQUE INDEX apitokens_tokenhash_index on apitokens(tokenhash);`)
+	db.Exec(`CREATE INDEX apitokens_userid_index on apitokens(userid);`)
+}
+
+func Migration7() {
+	db.Exec(`CREATE TABLE notifications(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+				actorid INTEGER REFERENCES users(id) ON DELETE SET NULL,
+				kind VARCHAR(16) NOT NULL,
+				content TEXT DEFAULT '',
+				url VARCHAR(256) DEFAULT '',
+				is_read INTEGER DEFAULT 0,
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE INDEX notifications_userid_created_index on notifications(userid, created_date DESC);`)
+	db.Exec(`CREATE INDEX notifications_userid_isread_index on notifications(userid, is_read);`)
+}
+
+func Migration8() {
+	db.Exec(`ALTER TABLE users ADD COLUMN digest VARCHAR(16) DEFAULT 'immediate';`)
+	db.Exec(`ALTER TABLE users ADD COLUMN digest_sent_date INTEGER DEFAULT 0;`)
+	db.Exec(`CREATE INDEX users_digest_index on users(digest);`)
+}
+
+func Migration9() {
+	db.Exec(`CREATE TABLE outbox(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				recipient VARCHAR(250) NOT NULL,
+				subject TEXT DEFAULT '',
+				body TEXT DEFAULT '',
+				status VARCHAR(16) NOT NULL,
+				attempts INTEGER DEFAULT 0,
+				next_attempt_date INTEGER NOT NULL,
+				last_error TEXT DEFAULT '',
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE INDEX outbox_status_next_attempt_index on outbox(status, next_attempt_date);`)
+}
+
+func Migration10() {
+	db.Exec(`CREATE TABLE loginfailures(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				username VARCHAR(250) NOT NULL,
+				ip VARCHAR(64) NOT NULL,
+				action VARCHAR(16) NOT NULL,
+				is_cleared INTEGER DEFAULT 0,
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE INDEX loginfailures_username_created_index on loginfailures(username, created_date);`)
+	db.Exec(`CREATE INDEX loginfailures_ip_created_index on loginfailures(ip, created_date);`)
+	db.Exec(`CREATE INDEX loginfailures_created_index on loginfailures(created_date);`)
+}
+
+func Migration11() {
+	db.Exec(`ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64) DEFAULT '';`)
+	db.Exec(`ALTER TABLE users ADD COLUMN totp_last_step INTEGER DEFAULT 0;`)
+	db.Exec(`ALTER TABLE sessions ADD COLUMN pending_userid INTEGER;`)
+	db.Exec(`ALTER TABLE sessions ADD COLUMN pending_date INTEGER DEFAULT 0;`)
+	db.Exec(`CREATE TABLE recoverycodes(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+				codehash VARCHAR(64) NOT NULL,
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE INDEX recoverycodes_userid_index on recoverycodes(userid);`)
+}
+
+func Migration12() {
+	db.Exec(`ALTER TABLE sessions ADD COLUMN challenge VARCHAR(64) DEFAULT '';`)
+	db.Exec(`ALTER TABLE sessions ADD COLUMN challenge_date INTEGER DEFAULT 0;`)
+	db.Exec(`CREATE TABLE passkeys(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+				credentialid VARCHAR(1400) NOT NULL,
+				publickey TEXT NOT NULL,
+				name VARCHAR(64) DEFAULT '',
+				sign_count INTEGER DEFAULT 0,
+				last_used_date INTEGER DEFAULT 0,
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE UNIQUE INDEX passkeys_credentialid_index on passkeys(credentialid);`)
+	db.Exec(`CREATE INDEX passkeys_userid_index on passkeys(userid);`)
+}
+
+func Migration13() {
+	db.Exec(`ALTER TABLE users ADD COLUMN oidc_subject VARCHAR(512) DEFAULT '';`)
+	db.Exec(`CREATE INDEX users_oidc_subject_index on users(oidc_subject);`)
+}
+
+func Migration14() {
+	db.Exec(`ALTER TABLE users ADD COLUMN pending_email VARCHAR(250) DEFAULT '';`)
+	db.Exec(`ALTER TABLE users ADD COLUMN email_token VARCHAR(250) DEFAULT '';`)
+	db.Exec(`ALTER TABLE users ADD COLUMN email_token_date INTEGER DEFAULT 0;`)
+	db.Exec(`CREATE INDEX users_email_token_index on users(email_token);`)
+}
+
+func Migration15() {
+	db.Exec(`CREATE TABLE invites(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				code VARCHAR(64) NOT NULL,
+				userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+				groupid INTEGER REFERENCES groups(id) ON DELETE SET NULL,
+				max_uses INTEGER DEFAULT 1,
+				num_uses INTEGER DEFAULT 0,
+				is_revoked INTEGER DEFAULT 0,
+				expiry_date INTEGER NOT NULL,
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE UNIQUE INDEX invites_code_index on invites(code);`)
+	db.Exec(`CREATE INDEX invites_userid_index on invites(userid);`)
+	db.Exec(`ALTER TABLE users ADD COLUMN inviteid INTEGER;`)
+	db.Exec(`CREATE INDEX users_inviteid_index on users(inviteid);`)
+}
+
+func Migration16() {
+	db.Exec(`ALTER TABLE sessions ADD COLUMN user_agent VARCHAR(250) DEFAULT '';`)
+	db.Exec(`ALTER TABLE sessions ADD COLUMN ip VARCHAR(64) DEFAULT '';`)
+	db.Exec(`ALTER TABLE sessions ADD COLUMN last_seen_date INTEGER DEFAULT 0;`)
+	db.Exec(`UPDATE sessions SET last_seen_date=updated_date;`)
+}
+
+func Migration17() {
+	db.Exec(`CREATE TABLE reports(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				kind VARCHAR(16) NOT NULL,
+				targetid INTEGER NOT NULL,
+				groupid INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+				reporterid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+				ownerid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+				reason VARCHAR(16) NOT NULL,
+				details TEXT DEFAULT '',
+				content TEXT DEFAULT '',
+				resolution VARCHAR(16) DEFAULT '',
+				resolverid INTEGER REFERENCES users(id) ON DELETE SET NULL,
+				resolved_date INTEGER DEFAULT 0,
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE INDEX reports_groupid_resolution_index on reports(groupid, resolution);`)
+	db.Exec(`CREATE INDEX reports_resolution_index on reports(resolution);`)
+	db.Exec(`CREATE INDEX reports_kind_targetid_index on reports(kind, targetid);`)
+}
+
+func Migration18() {
+	db.Exec(`CREATE TABLE auditlog(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				actorid INTEGER REFERENCES users(id) ON DELETE SET NULL,
+				actorname VARCHAR(32) DEFAULT '',
+				groupid INTEGER REFERENCES groups(id) ON DELETE SET NULL,
+				action VARCHAR(32) NOT NULL,
+				targetid VARCHAR(250) DEFAULT '',
+				target VARCHAR(250) DEFAULT '',
+				old_value TEXT DEFAULT '',
+				new_value TEXT DEFAULT '',
+				ip VARCHAR(64) DEFAULT '',
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE INDEX auditlog_groupid_index on auditlog(groupid, id);`)
+	db.Exec(`CREATE INDEX auditlog_action_index on auditlog(action);`)
+	db.Exec(`CREATE INDEX auditlog_created_date_index on auditlog(created_date);`)
+}
+
+func Migration19() {
+	db.Exec(`ALTER TABLE topics ADD COLUMN is_pending INTEGER DEFAULT 0;`)
+	db.Exec(`CREATE INDEX topics_groupid_pending_index on topics(groupid, is_pending);`)
+	db.Exec(`ALTER TABLE comments ADD COLUMN is_pending INTEGER DEFAULT 0;`)
+	db.Exec(`CREATE INDEX comments_pending_index on comments(is_pending);`)
+	db.Exec(`ALTER TABLE groups ADD COLUMN premod_account_age INTEGER DEFAULT 0;`)
+	db.Exec(`ALTER TABLE groups ADD COLUMN premod_num_posts INTEGER DEFAULT 0;`)
+}
+
+func Migration20() {
+	db.Exec(`ALTER TABLE users ADD COLUMN suspended_until INTEGER DEFAULT 0;`)
+	db.Exec(`ALTER TABLE users ADD COLUMN suspend_reason VARCHAR(250) DEFAULT '';`)
+
+	db.Exec(`CREATE TABLE groupbans(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				groupid INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+				userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+				reason VARCHAR(250) DEFAULT '',
+				expiry_date INTEGER DEFAULT 0,
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE UNIQUE INDEX groupbans_groupid_userid_index on groupbans(groupid, userid);`)
+
+	db.Exec(`CREATE TABLE warnings(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				userid INTEGER REFERENCES users(id) ON DELETE CASCADE,
+				groupid INTEGER REFERENCES groups(id) ON DELETE SET NULL,
+				issuerid INTEGER REFERENCES users(id) ON DELETE SET NULL,
+				reason VARCHAR(250) DEFAULT '',
+				points INTEGER DEFAULT 0,
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE INDEX warnings_userid_created_index on warnings(userid, created_date);`)
+}
+
+func Migration21() {
+	db.Exec(`ALTER TABLE users ADD COLUMN signup_ip VARCHAR(64) DEFAULT '';`)
+	db.Exec(`CREATE INDEX users_signup_ip_index on users(signup_ip);`)
+	db.Exec(`ALTER TABLE topics ADD COLUMN ip VARCHAR(64) DEFAULT '';`)
+	db.Exec(`CREATE INDEX topics_ip_index on topics(ip);`)
+	db.Exec(`ALTER TABLE comments ADD COLUMN ip VARCHAR(64) DEFAULT '';`)
+	db.Exec(`CREATE INDEX comments_ip_index on comments(ip);`)
+	db.Exec(`ALTER TABLE messages ADD COLUMN ip VARCHAR(64) DEFAULT '';`)
+
+	db.Exec(`CREATE TABLE blocks(
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				kind VARCHAR(16) NOT NULL,
+				value VARCHAR(250) NOT NULL,
+				reason VARCHAR(250) DEFAULT '',
+				created_date INTEGER NOT NULL
+	);`)
+	db.Exec(`CREATE UNIQUE INDEX blocks_kind_value_index on blocks(kind, value);`)
+}
+
+// Migration22 records when posts started being rendered as Markdown. Posts written before
+// are rendered the way they used to be; their content is left as it is.
+func Migration22() {
+	WriteConfig(MarkdownDate, strconv.FormatInt(time.Now().Unix(), 10))
+}
+
+// Migration23 records which e-mail addresses were confirmed. Addresses saved before are
+// left unconfirmed.
+func Migration23() {
+	db.Exec(`ALTER TABLE users ADD COLUMN is_email_confirmed INTEGER DEFAULT 0;`)
+}
+
+// Migration24 records when posts were published, which is when they are approved if they
+// were held for approval.
+func Migration24() {
+	db.Exec(`ALTER TABLE topics ADD COLUMN published_date INTEGER DEFAULT 0;`)
+	db.Exec(`UPDATE topics SET published_date=created_date;`)
+	db.Exec(`CREATE INDEX topics_published_index on topics(published_date);`)
+	db.Exec(`ALTER TABLE comments ADD COLUMN published_date INTEGER DEFAULT 0;`)
+	db.Exec(`UPDATE comments SET published_date=created_date;`)
+	db.Exec(`CREATE INDEX comments_published_index on comments(published_date);`)
+}
+
+// Migration25 records which users were created by an external identity provider. Users
+// who log in with single sign-on are marked; those created by LDAP or a trusted proxy
+// can't be told apart from local users, so a superadmin has to link them.
+func Migration25() {
+	db.Exec(`ALTER TABLE users ADD COLUMN is_external INTEGER DEFAULT 0;`)
+	db.Exec(`UPDATE users SET is_external=1 WHERE oidc_subject<>'';`)
+}
+
 func Migrate() {
 	dbver := db.Version()
 	if dbver == ModelVersion {
@@ -244,6 +668,104 @@ func Migrate() {
 			Migration4()
 
 			WriteConfig(Version, "4")
+		} else if dbver == 4 {
+			Migration5()
+
+			WriteConfig(Version, "5")
+		} else if dbver == 5 {
+			Migration6()
+
+			WriteConfig(Version, "6")
+		} else if dbver == 6 {
+			Migration7()
+
+			WriteConfig(Version, "7")
+		} else if dbver == 7 {
+			Migration8()
+
+			WriteConfig(Version, "8")
+			WriteConfig(ForumURL, "")
+		} else if dbver == 8 {
+			Migration9()
+
+			WriteConfig(Version, "9")
+		} else if dbver == 9 {
+			Migration10()
+
+			WriteConfig(Version, "10")
+		} else if dbver == 10 {
+			Migration11()
+
+			WriteConfig(Version, "11")
+			WriteConfig(Require2FA, "0")
+		} else if dbver == 11 {
+			Migration12()
+
+			WriteConfig(Version, "12")
+		} else if dbver == 12 {
+			Migration13()
+
+			WriteConfig(Version, "13")
+			WriteConfig(OIDCIssuer, "")
+			WriteConfig(OIDCClientID, "")
+			WriteConfig(OIDCClientSecret, "")
+			WriteConfig(OIDCScopes, "openid profile email")
+			WriteConfig(OIDCAdminClaim, "groups")
+			WriteConfig(OIDCAdminGroup, "")
+		} else if dbver == 13 {
+			Migration14()
+
+			WriteConfig(Version, "14")
+			WriteConfig(RequireVerifiedEmail, "0")
+		} else if dbver == 14 {
+			Migration15()
+
+			WriteConfig(Version, "15")
+			WriteConfig(InviteOnly, "0")
+		} else if dbver == 15 {
+			Migration16()
+
+			WriteConfig(Version, "16")
+		} else if dbver == 16 {
+			Migration17()
+
+			WriteConfig(Version, "17")
+		} else if dbver == 17 {
+			Migration18()
+
+			WriteConfig(Version, "18")
+		} else if dbver == 18 {
+			Migration19()
+
+			WriteConfig(Version, "19")
+			WriteConfig(PremodAccountAge, "0")
+			WriteConfig(PremodNumPosts, "0")
+		} else if dbver == 19 {
+			Migration20()
+
+			WriteConfig(Version, "20")
+			WriteConfig(InfractionPointsDays, "0")
+			WriteConfig(InfractionEscalations, "")
+		} else if dbver == 20 {
+			Migration21()
+
+			WriteConfig(Version, "21")
+		} else if dbver == 21 {
+			Migration22()
+
+			WriteConfig(Version, "22")
+		} else if dbver == 22 {
+			Migration23()
+
+			WriteConfig(Version, "23")
+		} else if dbver == 23 {
+			Migration24()
+
+			WriteConfig(Version, "24")
+		} else if dbver == 24 {
+			Migration25()
+
+			WriteConfig(Version, "25")
 		}
 		dbver = db.Version()
 	}
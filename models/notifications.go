@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"github.com/s-gv/orangeforum/models/db"
+	"regexp"
+	"time"
+)
+
+// Kinds of notifications.
+const (
+	NotifyTopicReply   string = "topicreply"
+	NotifyCommentReply string = "commentreply"
+	NotifyMention      string = "mention"
+	NotifyNewTopic     string = "newtopic"
+	NotifyModAction    string = "modaction"
+	NotifyReport       string = "report"
+)
+
+type Notification struct {
+	ID          string
+	Kind        string
+	ActorName   string
+	Content     string
+	URL         string
+	IsRead      bool
+	CreatedDate int64
+}
+
+var mentionRe = regexp.MustCompile(`(?:^|[^\w@])@(\w{2,32})`)
+
+// CreateNotification notifies userID that actorID did something described by content.
+// Users are not notified of their own actions.
+func CreateNotification(userID string, actorID string, kind string, content string, url string) {
+	if userID == "" || userID == actorID {
+		return
+	}
+	actor := sql.NullString{String: actorID, Valid: actorID != ""}
+	db.Exec(`INSERT INTO notifications(userid, actorid, kind, content, url, is_read, created_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+		userID, actor, kind, content, url, false, time.Now().Unix())
+}
+
+// ReadMentionedUserIDs returns the IDs of the users @mentioned in content, excluding
+// those that can't read the group.
+func ReadMentionedUserIDs(content string, groupID string) []string {
+	var userIDs []string
+	seen := make(map[string]bool)
+	for _, m := range mentionRe.FindAllStringSubmatch(content, 20) {
+		var userID string
+		if db.QueryRow(`SELECT id FROM users WHERE username=?;`, m[1]).Scan(&userID) != nil || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		if CanUserViewGroup(userID, groupID) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs
+}
+
+func ReadNotifications(userID string, offset int, limit int) []Notification {
+	var notifications []Notification
+	rows := db.Query(`SELECT notifications.id, notifications.kind, users.username, notifications.content, notifications.url,
+		notifications.is_read, notifications.created_date
+		FROM notifications LEFT JOIN users ON users.id=notifications.actorid
+		WHERE notifications.userid=? ORDER BY notifications.created_date DESC, notifications.id DESC LIMIT ? OFFSET ?;`, userID, limit, offset)
+	for rows.Next() {
+		n := Notification{}
+		var actorName sql.NullString
+		rows.Scan(&n.ID, &n.Kind, &actorName, &n.Content, &n.URL, &n.IsRead, &n.CreatedDate)
+		n.ActorName = actorName.String
+		notifications = append(notifications, n)
+	}
+	return notifications
+}
+
+func NumUnreadNotifications(userID string) int {
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE userid=? AND is_read=0;`, userID).Scan(&n)
+	return n
+}
+
+// ReadNotificationURL marks a notification as read and returns its URL.
+func ReadNotificationURL(userID string, notificationID string) (string, error) {
+	var url string
+	if err := db.QueryRow(`SELECT url FROM notifications WHERE id=? AND userid=?;`, notificationID, userID).Scan(&url); err != nil {
+		return "", err
+	}
+	db.Exec(`UPDATE notifications SET is_read=1 WHERE id=?;`, notificationID)
+	return url, nil
+}
+
+func MarkNotificationsRead(userID string, notificationIDs []string) {
+	for _, id := range notificationIDs {
+		db.Exec(`UPDATE notifications SET is_read=1 WHERE id=? AND userid=?;`, id, userID)
+	}
+}
+
+func MarkAllNotificationsRead(userID string) {
+	db.Exec(`UPDATE notifications SET is_read=1 WHERE userid=? AND is_read=0;`, userID)
+}
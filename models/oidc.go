@@ -0,0 +1,55 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"errors"
+	"github.com/s-gv/orangeforum/models/db"
+)
+
+// Users who log in with single sign-on are linked to their identity by an OIDC subject,
+// which is the issuer and the "sub" claim separated by a space. Subjects are unique
+// only within an issuer.
+
+func ReadUserIDByOIDCSubject(subject string) (int, error) {
+	var id int
+	if db.QueryRow(`SELECT id FROM users WHERE oidc_subject=?;`, subject).Scan(&id) == nil {
+		return id, nil
+	}
+	return 0, errors.New("User not found.")
+}
+
+// ReadUserIDByEmail returns the user with a confirmed e-mail address. It fails if more than
+// one user has the address, since it isn't clear which account to use.
+func ReadUserIDByEmail(email string) (int, error) {
+	var ids []int
+	rows := db.Query(`SELECT id FROM users WHERE LOWER(email)=LOWER(?) AND is_email_confirmed=? LIMIT 2;`, email, true)
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	if len(ids) != 1 {
+		return 0, errors.New("User not found.")
+	}
+	return ids[0], nil
+}
+
+func LinkOIDCSubject(userID int, subject string) {
+	db.Exec(`UPDATE users SET oidc_subject=? WHERE id=?;`, subject, userID)
+}
+
+// CreateOIDCUser creates a user who logs in with single sign-on.
+func CreateOIDCUser(userName string, email string, subject string) (int, error) {
+	userID, err := CreateExternalUser(userName, email)
+	if err == nil {
+		LinkOIDCSubject(userID, subject)
+	}
+	return userID, err
+}
+
+func UpdateUserSuperAdmin(userID int, isSuperAdmin bool) {
+	db.Exec(`UPDATE users SET is_superadmin=? WHERE id=?;`, isSuperAdmin, userID)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/s-gv/orangeforum/models/db"
+	"time"
+)
+
+// Passkey is a WebAuthn credential (a security key or a passkey) a user can log in with.
+type Passkey struct {
+	ID           string
+	UserID       string
+	Name         string
+	PublicKey    []byte // COSE_Key
+	SignCount    uint32
+	CreatedDate  int64
+	LastUsedDate int64
+}
+
+// Credential IDs are saved base64url encoded, as browsers send them.
+var passkeyEncoding = base64.RawURLEncoding
+
+func CreatePasskey(userID string, name string, credentialID []byte, publicKey []byte, signCount uint32) error {
+	credID := passkeyEncoding.EncodeToString(credentialID)
+	var tmp string
+	if db.QueryRow(`SELECT id FROM passkeys WHERE credentialid=?;`, credID).Scan(&tmp) == nil {
+		return errors.New("This security key is already registered.")
+	}
+	db.Exec(`INSERT INTO passkeys(userid, credentialid, publickey, name, sign_count, last_used_date, created_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+		userID, credID, passkeyEncoding.EncodeToString(publicKey), name, int64(signCount), 0, time.Now().Unix())
+	return nil
+}
+
+func ReadPasskeys(userID string) []Passkey {
+	var passkeys []Passkey
+	rows := db.Query(`SELECT id, name, created_date, last_used_date FROM passkeys WHERE userid=? ORDER BY created_date DESC;`, userID)
+	for rows.Next() {
+		p := Passkey{UserID: userID}
+		rows.Scan(&p.ID, &p.Name, &p.CreatedDate, &p.LastUsedDate)
+		passkeys = append(passkeys, p)
+	}
+	return passkeys
+}
+
+// ReadPasskeyCredentialIDs returns the credential IDs of a user, so that an authenticator
+// isn't registered twice.
+func ReadPasskeyCredentialIDs(userID string) [][]byte {
+	var ids [][]byte
+	rows := db.Query(`SELECT credentialid FROM passkeys WHERE userid=?;`, userID)
+	for rows.Next() {
+		var credID string
+		rows.Scan(&credID)
+		if id, err := passkeyEncoding.DecodeString(credID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ReadPasskeyByCredentialID returns the passkey with a base64url encoded credential ID.
+func ReadPasskeyByCredentialID(credentialID string) (Passkey, error) {
+	p := Passkey{}
+	var publicKey string
+	var signCount int64
+	if db.QueryRow(`SELECT id, userid, name, publickey, sign_count, created_date, last_used_date FROM passkeys WHERE credentialid=?;`, credentialID).Scan(
+		&p.ID, &p.UserID, &p.Name, &publicKey, &signCount, &p.CreatedDate, &p.LastUsedDate) != nil {
+		return p, errors.New("Unknown security key")
+	}
+	var err error
+	p.PublicKey, err = passkeyEncoding.DecodeString(publicKey)
+	p.SignCount = uint32(signCount)
+	return p, err
+}
+
+func UpdatePasskeyUsed(passkeyID string, signCount uint32) {
+	db.Exec(`UPDATE passkeys SET sign_count=?, last_used_date=? WHERE id=?;`, int64(signCount), time.Now().Unix(), passkeyID)
+}
+
+func DeletePasskey(userID string, passkeyID string) {
+	db.Exec(`DELETE FROM passkeys WHERE id=? AND userid=?;`, passkeyID, userID)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/s-gv/orangeforum/models/db"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// Password hashes are stored as argon2id in the PHC string format, such as
+// "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>" with unpadded base64. Older hashes are
+// hex-encoded bcrypt; they are replaced with argon2id the next time the user logs in.
+
+// Argon2Params are the argon2id parameters of new password hashes. Hashes with other
+// parameters are rehashed on login.
+type Argon2Params struct {
+	Memory  uint32 // in KiB
+	Time    uint32
+	Threads uint8
+	SaltLen int
+	KeyLen  uint32
+}
+
+var PasswdHashParams = Argon2Params{Memory: 64 * 1024, Time: 3, Threads: 2, SaltLen: 16, KeyLen: 32}
+
+const argon2idPrefix = "$argon2id$"
+
+// HashPasswd returns the argon2id hash of passwd with PasswdHashParams.
+func HashPasswd(passwd string) (string, error) {
+	p := PasswdHashParams
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(passwd), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPasswd reports whether passwd matches hash, and whether hash should be replaced
+// because it uses an older algorithm or parameters.
+func CheckPasswd(hash string, passwd string) (ok bool, needsRehash bool) {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		bcryptHash, err := hex.DecodeString(hash)
+		if err != nil {
+			return false, false
+		}
+		return bcrypt.CompareHashAndPassword(bcryptHash, []byte(passwd)) == nil, true
+	}
+	var version int
+	var p Argon2Params
+	fields := strings.Split(strings.TrimPrefix(hash, argon2idPrefix), "$")
+	if len(fields) != 4 {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(fields[0], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(fields[1], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil || p.Time == 0 || p.Threads == 0 {
+		return false, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return false, false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(fields[3])
+	if err != nil || len(key) == 0 {
+		return false, false
+	}
+	p.SaltLen = len(salt)
+	p.KeyLen = uint32(len(key))
+	if subtle.ConstantTimeCompare(argon2.IDKey([]byte(passwd), salt, p.Time, p.Memory, p.Threads, p.KeyLen), key) != 1 {
+		return false, false
+	}
+	return true, p != PasswdHashParams
+}
+
+// UpdateUserPasswdHash replaces the password hash of the user with a new hash of the same
+// password, without touching the reset token.
+func UpdateUserPasswdHash(userName string, passwd string) error {
+	passwdHash, err := HashPasswd(passwd)
+	if err != nil {
+		return err
+	}
+	db.Exec(`UPDATE users SET passwdhash=? WHERE username=?;`, passwdHash, userName)
+	return nil
+}
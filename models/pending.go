@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"errors"
+	"github.com/s-gv/orangeforum/models/db"
+)
+
+// Kinds of posts that can wait for approval.
+const (
+	PendingTopic   string = "topic"
+	PendingComment string = "comment"
+)
+
+// A PendingPost is a topic or comment held for approval by the mods of its group. It is
+// only visible to its author and the mods until it is approved.
+type PendingPost struct {
+	Kind        string
+	ID          string
+	TopicID     string
+	Title       string
+	Content     string
+	UserID      string
+	UserName    string
+	CreatedDate int64
+}
+
+const pendingTopicColumns = `SELECT 'topic', topics.id, topics.id, topics.title, topics.content, users.id, users.username, topics.created_date
+	FROM topics INNER JOIN users ON users.id=topics.userid
+	WHERE topics.is_pending=1 AND topics.is_deleted=0`
+
+const pendingCommentColumns = `SELECT 'comment', comments.id, topics.id, topics.title, comments.content, users.id, users.username, comments.created_date
+	FROM comments INNER JOIN topics ON topics.id=comments.topicid INNER JOIN users ON users.id=comments.userid
+	WHERE comments.is_pending=1 AND comments.is_deleted=0`
+
+func readPendingPosts(rows *db.Rows) []PendingPost {
+	var posts []PendingPost
+	for rows.Next() {
+		var p PendingPost
+		rows.Scan(&p.Kind, &p.ID, &p.TopicID, &p.Title, &p.Content, &p.UserID, &p.UserName, &p.CreatedDate)
+		posts = append(posts, p)
+	}
+	return posts
+}
+
+// ReadPendingPosts returns the oldest topics and comments in the group waiting for approval.
+func ReadPendingPosts(groupID string, limit int) []PendingPost {
+	return readPendingPosts(db.Query(pendingTopicColumns+` AND topics.groupid=? UNION ALL `+
+		pendingCommentColumns+` AND topics.groupid=? ORDER BY 8 LIMIT ?;`, groupID, groupID, limit))
+}
+
+// ReadPendingPost returns the topic or comment in the group if it is waiting for approval.
+func ReadPendingPost(kind string, id string, groupID string) (PendingPost, error) {
+	var posts []PendingPost
+	if kind == PendingTopic {
+		posts = readPendingPosts(db.Query(pendingTopicColumns+` AND topics.id=? AND topics.groupid=?;`, id, groupID))
+	} else if kind == PendingComment {
+		posts = readPendingPosts(db.Query(pendingCommentColumns+` AND comments.id=? AND topics.groupid=?;`, id, groupID))
+	}
+	if len(posts) != 1 {
+		return PendingPost{}, errors.New("Post not found.")
+	}
+	return posts[0], nil
+}
+
+// NumPendingPosts is the number of topics and comments in the group waiting for approval.
+func NumPendingPosts(groupID string) int {
+	var numTopics, numComments int
+	db.QueryRow(`SELECT COUNT(*) FROM topics WHERE groupid=? AND is_pending=1 AND is_deleted=0;`, groupID).Scan(&numTopics)
+	db.QueryRow(`SELECT COUNT(*) FROM comments INNER JOIN topics ON topics.id=comments.topicid
+		WHERE topics.groupid=? AND comments.is_pending=1 AND comments.is_deleted=0;`, groupID).Scan(&numComments)
+	return numTopics + numComments
+}
+
+// NumApprovedPosts is the number of topics and comments of the user that are visible to others.
+func NumApprovedPosts(userID string) int {
+	var numTopics, numComments int
+	db.QueryRow(`SELECT COUNT(*) FROM topics WHERE userid=? AND is_pending=0 AND is_deleted=0;`, userID).Scan(&numTopics)
+	db.QueryRow(`SELECT COUNT(*) FROM comments WHERE userid=? AND is_pending=0 AND is_deleted=0;`, userID).Scan(&numComments)
+	return numTopics + numComments
+}
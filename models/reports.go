@@ -0,0 +1,158 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/s-gv/orangeforum/models/db"
+	"time"
+)
+
+// Kinds of content that can be reported.
+const (
+	ReportTopic   string = "topic"
+	ReportComment string = "comment"
+	ReportPM      string = "pm"
+)
+
+// Reasons for a report.
+const (
+	ReasonSpam       string = "spam"
+	ReasonHarassment string = "harassment"
+	ReasonOffTopic   string = "off-topic"
+	ReasonIllegal    string = "illegal"
+	ReasonOther      string = "other"
+)
+
+var ReportReasonAllVals = []string{ReasonSpam, ReasonHarassment, ReasonOffTopic, ReasonIllegal, ReasonOther}
+
+// Actions that resolve a report. A report with no resolution is open.
+const (
+	ResolveDismiss string = "dismiss"
+	ResolveDelete  string = "delete"
+	ResolveClose   string = "close"
+	ResolveBan     string = "ban"
+)
+
+func IsValidReportReason(reason string) bool {
+	for _, r := range ReportReasonAllVals {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// A Report flags a topic, comment or private message for the mods of its group, or for
+// the superadmins if it is a private message. Content is a copy of the post when it was
+// reported, so that the report can be judged even if the post is edited or deleted.
+type Report struct {
+	ID           string
+	Kind         string
+	TargetID     string
+	GroupID      string
+	GroupName    string
+	ReporterID   string
+	ReporterName string
+	OwnerID      string
+	OwnerName    string
+	Reason       string
+	Details      string
+	Content      string
+	Resolution   string
+	CreatedDate  int64
+}
+
+const reportColumns = `reports.id, reports.kind, reports.targetid, reports.groupid, COALESCE(groups.name, ''),
+	reports.reporterid, COALESCE(reporters.username, ''), reports.ownerid, COALESCE(owners.username, ''),
+	reports.reason, reports.details, reports.content, reports.resolution, reports.created_date
+	FROM reports LEFT JOIN groups ON groups.id=reports.groupid
+	LEFT JOIN users reporters ON reporters.id=reports.reporterid LEFT JOIN users owners ON owners.id=reports.ownerid`
+
+func readReports(rows *db.Rows) []Report {
+	var reports []Report
+	for rows.Next() {
+		var r Report
+		var groupID sql.NullString
+		rows.Scan(&r.ID, &r.Kind, &r.TargetID, &groupID, &r.GroupName, &r.ReporterID, &r.ReporterName, &r.OwnerID, &r.OwnerName,
+			&r.Reason, &r.Details, &r.Content, &r.Resolution, &r.CreatedDate)
+		r.GroupID = groupID.String
+		reports = append(reports, r)
+	}
+	return reports
+}
+
+// CreateReport reports the content of a post. groupID is "" for private messages.
+func CreateReport(kind string, targetID string, groupID string, reporterID string, ownerID string, reason string, details string, content string) {
+	group := sql.NullString{String: groupID, Valid: groupID != ""}
+	db.Exec(`INSERT INTO reports(kind, targetid, groupid, reporterid, ownerid, reason, details, content, resolution, resolved_date, created_date)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		kind, targetID, group, reporterID, ownerID, reason, details, content, "", 0, time.Now().Unix())
+}
+
+// IsReportedBy reports whether the user has an open report on the post.
+func IsReportedBy(kind string, targetID string, reporterID string) bool {
+	var tmp string
+	return db.QueryRow(`SELECT id FROM reports WHERE kind=? AND targetid=? AND reporterid=? AND resolution='';`,
+		kind, targetID, reporterID).Scan(&tmp) == nil
+}
+
+func ReadReport(reportID string) (Report, error) {
+	if reports := readReports(db.Query(`SELECT `+reportColumns+` WHERE reports.id=?;`, reportID)); len(reports) == 1 {
+		return reports[0], nil
+	}
+	return Report{}, errors.New("Report not found.")
+}
+
+// ReadOpenReports returns the oldest open reports in the group. If groupID is "", the
+// open reports of every group and of private messages are returned.
+func ReadOpenReports(groupID string, limit int) []Report {
+	if groupID == "" {
+		return readReports(db.Query(`SELECT `+reportColumns+` WHERE reports.resolution='' ORDER BY reports.id LIMIT ?;`, limit))
+	}
+	return readReports(db.Query(`SELECT `+reportColumns+` WHERE reports.groupid=? AND reports.resolution='' ORDER BY reports.id LIMIT ?;`, groupID, limit))
+}
+
+// ReadOpenReportsByTarget returns the open reports on a post.
+func ReadOpenReportsByTarget(kind string, targetID string) []Report {
+	return readReports(db.Query(`SELECT `+reportColumns+` WHERE reports.kind=? AND reports.targetid=? AND reports.resolution='' ORDER BY reports.id;`,
+		kind, targetID))
+}
+
+// NumOpenReports is the number of open reports in the group, or everywhere if groupID is "".
+func NumOpenReports(groupID string) int {
+	var n int
+	if groupID == "" {
+		db.QueryRow(`SELECT COUNT(*) FROM reports WHERE resolution='';`).Scan(&n)
+	} else {
+		db.QueryRow(`SELECT COUNT(*) FROM reports WHERE groupid=? AND resolution='';`, groupID).Scan(&n)
+	}
+	return n
+}
+
+// ResolveReports closes every open report on a post with resolution.
+func ResolveReports(kind string, targetID string, resolverID string, resolution string) {
+	db.Exec(`UPDATE reports SET resolution=?, resolverid=?, resolved_date=? WHERE kind=? AND targetid=? AND resolution='';`,
+		resolution, resolverID, time.Now().Unix(), kind, targetID)
+}
+
+// ReadReportReviewerIDs returns the IDs of the users who review the reports of the group:
+// its mods and admins, or the superadmins if groupID is "".
+func ReadReportReviewerIDs(groupID string) []string {
+	var rows *db.Rows
+	if groupID == "" {
+		rows = db.Query(`SELECT id FROM users WHERE is_superadmin=?;`, true)
+	} else {
+		rows = db.Query(`SELECT userid FROM mods WHERE groupid=? UNION SELECT userid FROM admins WHERE groupid=?;`, groupID, groupID)
+	}
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		rows.Scan(&userID)
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"github.com/s-gv/orangeforum/models/db"
+)
+
+// UserSession is a logged in session of a user, as shown on the sessions page. The
+// session ID itself is the login cookie, so sessions are referred to by ID instead.
+type UserSession struct {
+	ID           string
+	SessionID    string
+	UserAgent    string
+	IP           string
+	CreatedDate  int64
+	LastSeenDate int64
+}
+
+// ReadUserSessions returns the sessions of the user that were used after minDate, most
+// recently used first.
+func ReadUserSessions(userID string, minDate int64) []UserSession {
+	rows := db.Query(`SELECT id, sessionid, user_agent, ip, created_date, last_seen_date FROM sessions
+		WHERE userid=? AND updated_date >= ? ORDER BY last_seen_date DESC, id DESC;`, userID, minDate)
+	var sessions []UserSession
+	for rows.Next() {
+		var s UserSession
+		rows.Scan(&s.ID, &s.SessionID, &s.UserAgent, &s.IP, &s.CreatedDate, &s.LastSeenDate)
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// DeleteUserSession logs out one session of the user.
+func DeleteUserSession(userID string, id string) {
+	db.Exec(`DELETE FROM sessions WHERE id=? AND userid=?;`, id, userID)
+}
+
+// DeleteUserSessions logs out every session of the user except the one with exceptSessionID,
+// which may be "".
+func DeleteUserSessions(userID string, exceptSessionID string) {
+	db.Exec(`DELETE FROM sessions WHERE userid=? AND sessionid<>?;`, userID, exceptSessionID)
+}
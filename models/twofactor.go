@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/s-gv/orangeforum/models/db"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const numRecoveryCodes = 10
+
+func hashRecoveryCode(code string) string {
+	h := sha256.Sum256([]byte(strings.ToLower(strings.Replace(code, "-", "", -1))))
+	return hex.EncodeToString(h[:])
+}
+
+// ReadTOTPSecret returns the TOTP secret of a user, or "" if two-factor authentication is off.
+func ReadTOTPSecret(userID string) string {
+	var secret string
+	db.QueryRow(`SELECT totp_secret FROM users WHERE id=?;`, userID).Scan(&secret)
+	return secret
+}
+
+func IsTOTPEnabled(userID string) bool {
+	return ReadTOTPSecret(userID) != ""
+}
+
+// EnableTOTP turns on two-factor authentication with secret and returns a fresh set of
+// recovery codes. Only their hashes are saved, so they have to be shown to the user right away.
+func EnableTOTP(userID string, secret string) []string {
+	db.Exec(`UPDATE users SET totp_secret=?, totp_last_step=0 WHERE id=?;`, secret, userID)
+	return CreateRecoveryCodes(userID)
+}
+
+func DisableTOTP(userID string) {
+	db.Exec(`UPDATE users SET totp_secret='', totp_last_step=0 WHERE id=?;`, userID)
+	db.Exec(`DELETE FROM recoverycodes WHERE userid=?;`, userID)
+}
+
+// ResetTOTP turns off two-factor authentication for a user who lost their authenticator.
+func ResetTOTP(userName string) error {
+	userID, err := ReadUserIDByName(userName)
+	if err != nil {
+		return errors.New("User not found")
+	}
+	DisableTOTP(strconv.Itoa(userID))
+	return nil
+}
+
+// UseTOTPStep records that the code of period step was used, so that it can't be used
+// again. It returns false if that code (or a later one) was already used.
+func UseTOTPStep(userID string, step int64) bool {
+	var lastStep int64
+	if db.QueryRow(`SELECT totp_last_step FROM users WHERE id=?;`, userID).Scan(&lastStep) != nil || step <= lastStep {
+		return false
+	}
+	db.Exec(`UPDATE users SET totp_last_step=? WHERE id=?;`, step, userID)
+	return true
+}
+
+// CreateRecoveryCodes replaces the recovery codes of a user.
+func CreateRecoveryCodes(userID string) []string {
+	db.Exec(`DELETE FROM recoverycodes WHERE userid=?;`, userID)
+	var codes []string
+	for i := 0; i < numRecoveryCodes; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		code := hex.EncodeToString(b)
+		code = code[:5] + "-" + code[5:]
+		db.Exec(`INSERT INTO recoverycodes(userid, codehash, created_date) VALUES(?, ?, ?);`, userID, hashRecoveryCode(code), time.Now().Unix())
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// UseRecoveryCode deletes code and returns true if it is one of the user's recovery codes.
+func UseRecoveryCode(userID string, code string) bool {
+	var codeID string
+	if db.QueryRow(`SELECT id FROM recoverycodes WHERE userid=? AND codehash=?;`, userID, hashRecoveryCode(strings.TrimSpace(code))).Scan(&codeID) != nil {
+		return false
+	}
+	db.Exec(`DELETE FROM recoverycodes WHERE id=?;`, codeID)
+	return true
+}
+
+func NumRecoveryCodes(userID string) int {
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM recoverycodes WHERE userid=?;`, userID).Scan(&n)
+	return n
+}
+
+// IsTOTPRequired reports whether the forum requires two-factor authentication of a user:
+// when Require2FA is set, superadmins and group admins must have it on.
+func IsTOTPRequired(userID string) bool {
+	if Config(Require2FA) != "1" {
+		return false
+	}
+	var isSuperAdmin bool
+	db.QueryRow(`SELECT is_superadmin FROM users WHERE id=?;`, userID).Scan(&isSuperAdmin)
+	if isSuperAdmin {
+		return true
+	}
+	var tmp string
+	return db.QueryRow(`SELECT id FROM admins WHERE userid=?;`, userID).Scan(&tmp) == nil
+}
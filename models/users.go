@@ -5,21 +5,42 @@
 package models
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
 	"errors"
 	"github.com/s-gv/orangeforum/models/db"
-	"golang.org/x/crypto/bcrypt"
 	"time"
 )
 
+// E-mail digest preferences. With DigestImmediate, an e-mail is sent for every new post
+// in the user's subscriptions. With DigestDaily and DigestWeekly, the posts are batched
+// into one e-mail per period.
+const (
+	DigestImmediate string = "immediate"
+	DigestDaily     string = "daily"
+	DigestWeekly    string = "weekly"
+	DigestOff       string = "off"
+)
+
+var DigestAllVals = []string{DigestImmediate, DigestDaily, DigestWeekly, DigestOff}
+
+func IsValidDigest(digest string) bool {
+	for _, d := range DigestAllVals {
+		if d == digest {
+			return true
+		}
+	}
+	return false
+}
+
 func createUser(userName string, passwd string, email string, isSuperAdmin bool) error {
-	if passwdHash, err := bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.DefaultCost); err == nil {
+	if passwdHash, err := HashPasswd(passwd); err == nil {
 		r := db.QueryRow(`SELECT username FROM users WHERE username=?;`, userName)
 		var tmp string
 		if err := r.Scan(&tmp); err == sql.ErrNoRows {
-			db.Exec(`INSERT INTO users(username, passwdhash, email, is_superadmin, created_date, updated_date) VALUES(?, ?, ?, ?, ?, ?);`,
-				userName, hex.EncodeToString(passwdHash), email, isSuperAdmin, time.Now().Unix(), time.Now().Unix())
+			db.Exec(`INSERT INTO users(username, passwdhash, email, is_email_confirmed, is_superadmin, created_date, updated_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+				userName, passwdHash, email, email != "", isSuperAdmin, time.Now().Unix(), time.Now().Unix())
 		} else {
 			return errors.New("Username already exists.")
 		}
@@ -29,6 +50,8 @@ func createUser(userName string, passwd string, email string, isSuperAdmin bool)
 	return nil
 }
 
+// CreateUser creates a user. email is taken as confirmed, so it should come from the
+// superadmin or a trusted identity provider.
 func CreateUser(userName string, passwd string, email string) error {
 	return createUser(userName, passwd, email, false)
 }
@@ -37,6 +60,30 @@ func CreateSuperUser(userName string, passwd string) error {
 	return createUser(userName, passwd, "", true)
 }
 
+// CreateExternalUser creates a user who logs in with an external identity provider or
+// directory, and marks the user as external. The user gets a random password, which can
+// be changed with a password reset e-mail.
+func CreateExternalUser(userName string, email string) (int, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	if err := CreateUser(userName, hex.EncodeToString(b), email); err != nil {
+		return 0, err
+	}
+	userID, err := ReadUserIDByName(userName)
+	if err == nil {
+		UpdateUserExternal(userID, true)
+	}
+	return userID, err
+}
+
+// UpdateUserExternal links a user to an external directory, or unlinks the user. Only
+// external users can log in with a directory password.
+func UpdateUserExternal(userID int, isExternal bool) {
+	db.Exec(`UPDATE users SET is_external=? WHERE id=?;`, isExternal, userID)
+}
+
 func ReadUserEmail(userName string) string {
 	r := db.QueryRow(`SELECT email FROM users WHERE username=?;`, userName)
 	var email string
@@ -71,8 +118,8 @@ func ReadUserIDByName(userName string) (int, error) {
 }
 
 func UpdateUserPasswd(userName string, passwd string) error {
-	if passwdHash, err := bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.DefaultCost); err == nil {
-		db.Exec(`UPDATE users SET passwdhash=?, reset_token='', reset_token_date=0 WHERE username=?`, hex.EncodeToString(passwdHash), userName)
+	if passwdHash, err := HashPasswd(passwd); err == nil {
+		db.Exec(`UPDATE users SET passwdhash=?, reset_token='', reset_token_date=0 WHERE username=?`, passwdHash, userName)
 	} else {
 		return err
 	}
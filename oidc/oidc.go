@@ -0,0 +1,358 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package oidc logs users in with an OpenID Connect identity provider, using the
+// authorization code flow with PKCE. Only the ID token is used; the user info endpoint
+// isn't called, so the provider has to put the claims the forum needs in the ID token.
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Discovery documents and keys of providers are cached for metadataLife.
+const metadataLife = time.Hour
+
+// ID tokens are accepted up to clockSkew after they expire.
+const clockSkew = time.Minute
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Provider is an identity provider the forum is registered with as a client.
+type Provider struct {
+	Issuer       string // Such as "https://login.example.com". It must match the issuer in ID tokens.
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // The callback URL registered with the provider.
+	Scopes       []string
+}
+
+// Claims of an ID token.
+type Claims map[string]interface{}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	keys                  map[string]crypto.PublicKey
+	fetchedDate           time.Time
+}
+
+var cache = struct {
+	sync.Mutex
+	m map[string]*metadata
+}{m: make(map[string]*metadata)}
+
+// CodeChallenge returns the S256 PKCE code challenge of a code verifier.
+func CodeChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+func getJSON(u string, v interface{}) error {
+	resp, err := httpClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// metadata returns the discovery document of the provider. If refreshKeys is set, the
+// keys are fetched again, which is done when a token is signed with an unknown key.
+func (p Provider) metadata(refreshKeys bool) (*metadata, error) {
+	cache.Lock()
+	defer cache.Unlock()
+	md, ok := cache.m[p.Issuer]
+	if !ok || time.Since(md.fetchedDate) > metadataLife {
+		md = &metadata{}
+		if err := getJSON(strings.TrimRight(p.Issuer, "/")+"/.well-known/openid-configuration", md); err != nil {
+			return nil, err
+		}
+		if md.Issuer != p.Issuer {
+			return nil, errors.New("Issuer mismatch in OpenID configuration")
+		}
+		if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+			return nil, errors.New("Incomplete OpenID configuration")
+		}
+		refreshKeys = true
+	}
+	if refreshKeys {
+		keys, err := fetchKeys(md.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+		md.keys = keys
+		md.fetchedDate = time.Now()
+		cache.m[p.Issuer] = md
+	}
+	return md, nil
+}
+
+// AuthCodeURL returns the URL of the provider's login page. The state and nonce are
+// checked when the user comes back, and the code challenge when the code is redeemed.
+func (p Provider) AuthCodeURL(state string, nonce string, codeChallenge string) (string, error) {
+	md, err := p.metadata(false)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return md.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the claims of the verified ID token.
+func (p Provider) Exchange(code string, codeVerifier string, nonce string) (Claims, error) {
+	md, err := p.metadata(false)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequest("POST", md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("Malformed token response: %s", resp.Status)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("Token request failed: %s %s", token.Error, token.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return nil, fmt.Errorf("Token request failed: %s", resp.Status)
+	}
+	return p.VerifyIDToken(token.IDToken, nonce, time.Now())
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token.
+func (p Provider) VerifyIDToken(rawToken string, nonce string, now time.Time) (Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed ID token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("Malformed ID token")
+	}
+	md, err := p.metadata(false)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := findKey(md.keys, header.Kid)
+	if !ok {
+		if md, err = p.metadata(true); err != nil {
+			return nil, err
+		}
+		if key, ok = findKey(md.keys, header.Kid); !ok {
+			return nil, errors.New("ID token signed with an unknown key")
+		}
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims.String("iss") != p.Issuer {
+		return nil, errors.New("ID token issuer mismatch")
+	}
+	aud := claims.Strings("aud")
+	if !contains(aud, p.ClientID) || (len(aud) > 1 && claims.String("azp") != p.ClientID) {
+		return nil, errors.New("ID token audience mismatch")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return nil, errors.New("ID token expired")
+	}
+	if nonce == "" || claims.String("nonce") != nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+	if claims.String("sub") == "" {
+		return nil, errors.New("ID token without subject")
+	}
+	return claims, nil
+}
+
+// String returns a string claim, or "" if it is missing.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Bool returns a boolean claim. Some providers send booleans as strings.
+func (c Claims) Bool(name string) bool {
+	switch v := c[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// Strings returns a claim that is a string or an array of strings, such as "aud" or "groups".
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var ss []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	}
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, item := range ss {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err == nil {
+		err = json.Unmarshal(b, v)
+	}
+	if err != nil {
+		return errors.New("Malformed ID token")
+	}
+	return nil
+}
+
+func findKey(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+// fetchKeys returns the RSA and P-256 signing keys in a JWK set, by key ID.
+func fetchKeys(jwksURI string) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(jwksURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil || len(e) > 4 {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if pub.Curve.IsOnCurve(pub.X, pub.Y) {
+				keys[k.Kid] = pub
+			}
+		}
+	}
+	return keys, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	hash := sha256.Sum256(signed)
+	ok := false
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		ok = alg == "RS256" && key.N.BitLen() >= 2048 && rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil
+	case *ecdsa.PublicKey:
+		// JWS ECDSA signatures are r and s concatenated, not ASN.1.
+		ok = alg == "ES256" && len(signature) == 64 &&
+			ecdsa.Verify(key, hash[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:]))
+	}
+	if !ok {
+		return errors.New("Invalid ID token signature")
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package oidc
+
+import (
+	"github.com/s-gv/orangeforum/oidc/oidctest"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// loginForTest follows the provider's redirect back to the forum and returns the code and state.
+func loginForTest(t *testing.T, p Provider, state string, nonce string, verifier string) (string, string) {
+	authURL, err := p.AuthCodeURL(state, nonce, CodeChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %s", err)
+	}
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Authorization request: %s", err)
+	}
+	resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || loc.Host != "forum.test" {
+		t.Fatalf("Unexpected redirect: %s", resp.Header.Get("Location"))
+	}
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestExchange(t *testing.T) {
+	idp := oidctest.NewServer("forum", "s3cret")
+	defer idp.Close()
+	p := Provider{Issuer: idp.URL, ClientID: "forum", ClientSecret: "s3cret", RedirectURL: "https://forum.test/login/oidc/callback", Scopes: []string{"openid", "email"}}
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		idp.Alg = alg
+		idp.Claims = map[string]interface{}{"sub": "alice", "email": "alice@example.com", "email_verified": true, "groups": []string{"staff", "admins"}}
+		code, state := loginForTest(t, p, "st", "nc", "verifier1")
+		if state != "st" {
+			t.Errorf("State not returned: %s", state)
+		}
+		claims, err := p.Exchange(code, "verifier1", "nc")
+		if err != nil {
+			t.Fatalf("%s: Exchange: %s", alg, err)
+		}
+		if claims.String("sub") != "alice" || !claims.Bool("email_verified") || len(claims.Strings("groups")) != 2 {
+			t.Errorf("%s: Unexpected claims: %v", alg, claims)
+		}
+		if _, err := p.Exchange(code, "verifier1", "nc"); err == nil {
+			t.Errorf("%s: Code redeemed twice", alg)
+		}
+	}
+
+	code, _ := loginForTest(t, p, "st", "nc", "verifier1")
+	if _, err := p.Exchange(code, "verifier2", "nc"); err == nil {
+		t.Errorf("Code redeemed with the wrong verifier")
+	}
+	code, _ = loginForTest(t, p, "st", "nc", "verifier1")
+	if _, err := p.Exchange(code, "verifier1", "other"); err == nil {
+		t.Errorf("ID token with the wrong nonce accepted")
+	}
+	wrongSecret := p
+	wrongSecret.ClientSecret = "guess"
+	code, _ = loginForTest(t, p, "st", "nc", "verifier1")
+	if _, err := wrongSecret.Exchange(code, "verifier1", "nc"); err == nil {
+		t.Errorf("Code redeemed with the wrong client secret")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := oidctest.NewServer("forum", "s3cret")
+	defer idp.Close()
+	p := Provider{Issuer: idp.URL, ClientID: "forum"}
+	now := time.Now()
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": idp.URL, "aud": "forum", "sub": "bob", "nonce": "nc", "exp": now.Add(time.Minute).Unix()}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+	if _, err := p.VerifyIDToken(idp.IDToken(claims(nil)), "nc", now); err != nil {
+		t.Fatalf("Valid ID token rejected: %s", err)
+	}
+	for _, c := range []map[string]interface{}{
+		{"iss": "https://evil.example.com"},
+		{"aud": "other"},
+		{"aud": []string{"forum", "other"}},
+		{"exp": now.Add(-time.Hour).Unix()},
+		{"nonce": "other"},
+		{"sub": ""},
+	} {
+		if _, err := p.VerifyIDToken(idp.IDToken(claims(c)), "nc", now); err == nil {
+			t.Errorf("ID token with %v accepted", c)
+		}
+	}
+	token := idp.IDToken(claims(nil))
+	if _, err := p.VerifyIDToken(token[:len(token)-4]+"AAAA", "nc", now); err == nil {
+		t.Errorf("ID token with a bad signature accepted")
+	}
+	if _, err := p.VerifyIDToken("eyJhbGciOiJub25lIn0.eyJzdWIiOiJib2IifQ.", "nc", now); err == nil {
+		t.Errorf("Unsigned ID token accepted")
+	}
+}
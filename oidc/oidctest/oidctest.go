@@ -0,0 +1,194 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package oidctest provides a mock OpenID Connect identity provider for testing single
+// sign-on without a real provider. Its authorization endpoint logs in the user
+// described by Claims right away, without showing a login page.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Server struct {
+	URL          string // The issuer.
+	ClientID     string
+	ClientSecret string
+	Alg          string                 // "RS256" (the default) or "ES256".
+	Claims       map[string]interface{} // Claims of the next ID token, such as "sub" and "email". They override the defaults.
+
+	srv    *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	mu     sync.Mutex
+	codes  map[string]authRequest
+}
+
+type authRequest struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+func NewServer(clientID string, clientSecret string) *Server {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Alg:          "RS256",
+		Claims:       map[string]interface{}{"sub": "user1"},
+		rsaKey:       rsaKey,
+		ecKey:        ecKey,
+		codes:        make(map[string]authRequest),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("client_id") != s.ClientID || redirectURI == "" || q.Get("response_type") != "code" ||
+		!strings.Contains(" "+q.Get("scope")+" ", " openid ") || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	code := randID()
+	s.mu.Lock()
+	s.codes[code] = authRequest{redirectURI, q.Get("nonce"), q.Get("code_challenge")}
+	s.mu.Unlock()
+	u, _ := url.Parse(redirectURI)
+	v := u.Query()
+	v.Set("code", code)
+	v.Set("state", q.Get("state"))
+	u.RawQuery = v.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	if clientID != s.ClientID || clientSecret != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	s.mu.Lock()
+	req, ok := s.codes[r.PostFormValue("code")]
+	delete(s.codes, r.PostFormValue("code"))
+	s.mu.Unlock()
+	h := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != req.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(h[:]) != req.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	claims := map[string]interface{}{
+		"iss":   s.URL,
+		"aud":   s.ClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": req.nonce,
+	}
+	for k, v := range s.Claims {
+		claims[k] = v
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randID(),
+		"token_type":   "Bearer",
+		"id_token":     s.IDToken(claims),
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	enc := base64.RawURLEncoding
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa1", "use": "sig", "alg": "RS256",
+			"n": enc.EncodeToString(s.rsaKey.N.Bytes()), "e": enc.EncodeToString(big.NewInt(int64(s.rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec1", "use": "sig", "alg": "ES256", "crv": "P-256",
+			"x": enc.EncodeToString(pad32(s.ecKey.X.Bytes())), "y": enc.EncodeToString(pad32(s.ecKey.Y.Bytes()))},
+	}})
+}
+
+// IDToken returns an ID token with the given claims, signed with the server's key.
+func (s *Server) IDToken(claims map[string]interface{}) string {
+	kid := "rsa1"
+	if s.Alg == "ES256" {
+		kid = "ec1"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": s.Alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+	var sig []byte
+	if s.Alg == "ES256" {
+		r, ss, err := ecdsa.Sign(rand.Reader, s.ecKey, hash[:])
+		if err != nil {
+			panic(err)
+		}
+		sig = append(pad32(r.Bytes()), pad32(ss.Bytes())...)
+	} else {
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, s.rsaKey, crypto.SHA256, hash[:]); err != nil {
+			panic(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func pad32(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
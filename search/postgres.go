@@ -0,0 +1,38 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package search
+
+import (
+	"github.com/s-gv/orangeforum/models/db"
+)
+
+// The documents are indexed with expression indexes, so postgres keeps them up-to-date.
+// Queries must use exactly the same expressions for the indexes to be used.
+var pgDocuments = map[string]string{
+	"topics":   `to_tsvector('english', topics.title || ' ' || topics.content)`,
+	"comments": `to_tsvector('english', comments.content)`,
+	"messages": `to_tsvector('english', messages.content)`,
+}
+
+type pgSearcher struct{}
+
+func (pgSearcher) Migrate() {
+	db.Exec(`CREATE INDEX IF NOT EXISTS topics_fts_index ON topics USING GIN (to_tsvector('english', title || ' ' || content));`)
+	db.Exec(`CREATE INDEX IF NOT EXISTS comments_fts_index ON comments USING GIN (to_tsvector('english', content));`)
+	db.Exec(`CREATE INDEX IF NOT EXISTS messages_fts_index ON messages USING GIN (to_tsvector('english', content));`)
+}
+
+func (s pgSearcher) Reindex() {
+	s.Migrate()
+	db.Exec(`REINDEX INDEX topics_fts_index;`)
+	db.Exec(`REINDEX INDEX comments_fts_index;`)
+	db.Exec(`REINDEX INDEX messages_fts_index;`)
+}
+
+func (pgSearcher) Search(q Query) []Result {
+	return search(q, func(table string, terms string) (string, []interface{}) {
+		return pgDocuments[table] + ` @@ plainto_tsquery('english', ?)`, []interface{}{terms}
+	})
+}
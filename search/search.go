@@ -0,0 +1,149 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package search implements full-text search over topics, comments and private messages.
+// SQLite databases use an FTS5 index (when the sqlite3 driver is built with the sqlite_fts5 tag)
+// and postgres uses tsvector expression indexes. Without an index, searches fall back to LIKE.
+package search
+
+import (
+	"database/sql"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"sort"
+	"strings"
+)
+
+const (
+	KindTopic   string = "topic"
+	KindComment string = "comment"
+	KindMessage string = "message"
+)
+
+type Query struct {
+	Terms        string
+	Kind         string // One of KindTopic, KindComment, KindMessage, or "" for all.
+	GroupName    string
+	Author       string
+	FromDate     int64 // Unix time. 0 for no lower bound.
+	ToDate       int64 // Unix time (exclusive). 0 for no upper bound.
+	UserID       sql.NullInt64
+	IsSuperAdmin bool
+	Limit        int
+}
+
+type Result struct {
+	Kind        string
+	ID          string
+	TopicID     string
+	Title       string
+	GroupName   string
+	UserName    string
+	ToName      string
+	Content     string
+	CreatedDate int64
+}
+
+type Searcher interface {
+	// Migrate creates the index structures if they don't exist.
+	Migrate()
+	// Reindex rebuilds the index from the topics, comments and messages tables.
+	Reindex()
+	// Search returns results matching q, newest first.
+	Search(q Query) []Result
+}
+
+// matcher returns the driver specific clause (and its arguments) that restricts
+// the rows of table to those matching the search terms.
+type matcher func(table string, terms string) (string, []interface{})
+
+// New returns the Searcher for the configured DB driver.
+func New() Searcher {
+	if db.DriverName() == "postgres" {
+		return pgSearcher{}
+	}
+	if hasFTS5() {
+		return ftsSearcher{}
+	}
+	return likeSearcher{}
+}
+
+func Migrate() {
+	New().Migrate()
+}
+
+func Reindex() {
+	New().Reindex()
+}
+
+func Search(q Query) []Result {
+	return New().Search(q)
+}
+
+// words splits the search terms into at most 10 words.
+func words(terms string) []string {
+	ws := strings.Fields(terms)
+	if len(ws) > 10 {
+		ws = ws[:10]
+	}
+	return ws
+}
+
+func search(q Query, match matcher) []Result {
+	if q.Limit <= 0 {
+		q.Limit = 30
+	}
+	if q.ToDate <= 0 {
+		q.ToDate = 1<<62 - 1
+	}
+	var results []Result
+	if q.Kind == "" || q.Kind == KindTopic {
+		clause, args := match("topics", q.Terms)
+		args = append(args, q.IsSuperAdmin, q.UserID, q.GroupName, q.GroupName, q.Author, q.Author, q.FromDate, q.ToDate, q.Limit)
+		rows := db.Query(`SELECT topics.id, topics.title, topics.content, topics.created_date, users.username, groups.name
+			FROM topics INNER JOIN users ON users.id=topics.userid INNER JOIN groups ON groups.id=topics.groupid
+			WHERE `+clause+` AND topics.is_deleted=0 AND topics.is_pending=0 AND groups.is_closed=0 AND `+models.VisibleGroupsSQL+`
+			AND (?='' OR groups.name=?) AND (?='' OR users.username=?) AND topics.created_date >= ? AND topics.created_date < ?
+			ORDER BY topics.created_date DESC LIMIT ?;`, args...)
+		for rows.Next() {
+			r := Result{Kind: KindTopic}
+			rows.Scan(&r.ID, &r.Title, &r.Content, &r.CreatedDate, &r.UserName, &r.GroupName)
+			r.TopicID = r.ID
+			results = append(results, r)
+		}
+	}
+	if q.Kind == "" || q.Kind == KindComment {
+		clause, args := match("comments", q.Terms)
+		args = append(args, q.IsSuperAdmin, q.UserID, q.GroupName, q.GroupName, q.Author, q.Author, q.FromDate, q.ToDate, q.Limit)
+		rows := db.Query(`SELECT comments.id, comments.topicid, topics.title, comments.content, comments.created_date, users.username, groups.name
+			FROM comments INNER JOIN topics ON topics.id=comments.topicid INNER JOIN users ON users.id=comments.userid INNER JOIN groups ON groups.id=topics.groupid
+			WHERE `+clause+` AND comments.is_deleted=0 AND comments.is_pending=0 AND topics.is_deleted=0 AND topics.is_pending=0 AND groups.is_closed=0 AND `+models.VisibleGroupsSQL+`
+			AND (?='' OR groups.name=?) AND (?='' OR users.username=?) AND comments.created_date >= ? AND comments.created_date < ?
+			ORDER BY comments.created_date DESC LIMIT ?;`, args...)
+		for rows.Next() {
+			r := Result{Kind: KindComment}
+			rows.Scan(&r.ID, &r.TopicID, &r.Title, &r.Content, &r.CreatedDate, &r.UserName, &r.GroupName)
+			results = append(results, r)
+		}
+	}
+	if (q.Kind == "" || q.Kind == KindMessage) && q.GroupName == "" && q.UserID.Valid {
+		clause, args := match("messages", q.Terms)
+		args = append(args, q.UserID, q.UserID, q.Author, q.Author, q.FromDate, q.ToDate, q.Limit)
+		rows := db.Query(`SELECT messages.id, messages.content, messages.created_date, fromusers.username, tousers.username
+			FROM messages INNER JOIN users fromusers ON fromusers.id=messages.fromid INNER JOIN users tousers ON tousers.id=messages.toid
+			WHERE `+clause+` AND (messages.toid=? OR messages.fromid=?)
+			AND (?='' OR fromusers.username=?) AND messages.created_date >= ? AND messages.created_date < ?
+			ORDER BY messages.created_date DESC LIMIT ?;`, args...)
+		for rows.Next() {
+			r := Result{Kind: KindMessage}
+			rows.Scan(&r.ID, &r.Content, &r.CreatedDate, &r.UserName, &r.ToName)
+			results = append(results, r)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].CreatedDate > results[j].CreatedDate })
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results
+}
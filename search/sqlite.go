@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package search
+
+import (
+	"github.com/s-gv/orangeforum/models/db"
+	"log"
+	"strings"
+)
+
+var ftsColumns = map[string]string{
+	"topics":   "title, content",
+	"comments": "content",
+	"messages": "content",
+}
+
+// hasFTS5 reports whether sqlite was compiled with FTS5 and the index tables exist.
+func hasFTS5() bool {
+	if !isFTS5Compiled() {
+		return false
+	}
+	var name string
+	return db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='topics_fts';`).Scan(&name) == nil
+}
+
+func isFTS5Compiled() bool {
+	if db.DriverName() != "sqlite3" {
+		return false
+	}
+	var used int
+	db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5');`).Scan(&used)
+	return used == 1
+}
+
+type ftsSearcher struct{}
+
+func (ftsSearcher) Migrate() {
+	for _, table := range []string{"topics", "comments", "messages"} {
+		cols := ftsColumns[table]
+		newCols := "new." + strings.Replace(cols, ", ", ", new.", -1)
+		oldCols := "old." + strings.Replace(cols, ", ", ", old.", -1)
+		db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS ` + table + `_fts USING fts5(` + cols + `, content='` + table + `', content_rowid='id');`)
+		db.Exec(`CREATE TRIGGER IF NOT EXISTS ` + table + `_fts_insert AFTER INSERT ON ` + table + ` BEGIN
+				INSERT INTO ` + table + `_fts(rowid, ` + cols + `) VALUES(new.id, ` + newCols + `);
+			END;`)
+		db.Exec(`CREATE TRIGGER IF NOT EXISTS ` + table + `_fts_delete AFTER DELETE ON ` + table + ` BEGIN
+				INSERT INTO ` + table + `_fts(` + table + `_fts, rowid, ` + cols + `) VALUES('delete', old.id, ` + oldCols + `);
+			END;`)
+		db.Exec(`CREATE TRIGGER IF NOT EXISTS ` + table + `_fts_update AFTER UPDATE OF ` + cols + ` ON ` + table + ` BEGIN
+				INSERT INTO ` + table + `_fts(` + table + `_fts, rowid, ` + cols + `) VALUES('delete', old.id, ` + oldCols + `);
+				INSERT INTO ` + table + `_fts(rowid, ` + cols + `) VALUES(new.id, ` + newCols + `);
+			END;`)
+	}
+}
+
+func (s ftsSearcher) Reindex() {
+	s.Migrate()
+	for _, table := range []string{"topics", "comments", "messages"} {
+		db.Exec(`INSERT INTO ` + table + `_fts(` + table + `_fts) VALUES('rebuild');`)
+	}
+}
+
+func (ftsSearcher) Search(q Query) []Result {
+	return search(q, func(table string, terms string) (string, []interface{}) {
+		// Quote every word so that FTS5 query syntax in the input is matched literally.
+		var phrases []string
+		for _, w := range words(terms) {
+			phrases = append(phrases, `"`+strings.Replace(w, `"`, `""`, -1)+`"`)
+		}
+		if len(phrases) == 0 {
+			return "1=0", nil
+		}
+		return table + `.id IN (SELECT rowid FROM ` + table + `_fts WHERE ` + table + `_fts MATCH ?)`, []interface{}{strings.Join(phrases, " ")}
+	})
+}
+
+// likeSearcher is used with sqlite builds that don't have FTS5. It scans the tables.
+type likeSearcher struct{}
+
+func (likeSearcher) Migrate() {
+	if isFTS5Compiled() {
+		ftsSearcher{}.Migrate()
+	}
+}
+
+func (likeSearcher) Reindex() {
+	if isFTS5Compiled() {
+		ftsSearcher{}.Reindex()
+		return
+	}
+	log.Printf("[INFO] sqlite3 built without FTS5. Searches will scan the tables.\n")
+}
+
+func (likeSearcher) Search(q Query) []Result {
+	return search(q, func(table string, terms string) (string, []interface{}) {
+		var clauses []string
+		var args []interface{}
+		for _, w := range words(terms) {
+			w = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(w)
+			if table == "topics" {
+				clauses = append(clauses, `(topics.title LIKE ? ESCAPE '\' OR topics.content LIKE ? ESCAPE '\')`)
+				args = append(args, "%"+w+"%", "%"+w+"%")
+			} else {
+				clauses = append(clauses, table+`.content LIKE ? ESCAPE '\'`)
+				args = append(args, "%"+w+"%")
+			}
+		}
+		if len(clauses) == 0 {
+			return "1=0", nil
+		}
+		return strings.Join(clauses, " AND "), args
+	})
+}
@@ -23,4 +23,76 @@ for (var i = 0; i < inputs.length; i++) {
 		}
 	}
 }
+
+function base64urlToBuffer(s) {
+	s = s.replace(/-/g, "+").replace(/_/g, "/");
+	while (s.length % 4) {
+		s += "=";
+	}
+	var str = atob(s);
+	var buf = new Uint8Array(str.length);
+	for (var i = 0; i < str.length; i++) {
+		buf[i] = str.charCodeAt(i);
+	}
+	return buf.buffer;
+}
+
+function bufferToBase64url(buf) {
+	var bytes = new Uint8Array(buf);
+	var str = "";
+	for (var i = 0; i < bytes.length; i++) {
+		str += String.fromCharCode(bytes[i]);
+	}
+	return btoa(str).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+var passkeyAdd = document.getElementById("passkey-add");
+if (!!passkeyAdd) {
+	passkeyAdd.onsubmit = function(e) {
+		e.preventDefault();
+		var form = this;
+		if (!window.PublicKeyCredential) {
+			alert("This browser doesn't support security keys.");
+			return;
+		}
+		var opts = JSON.parse(form.getAttribute("data-options"));
+		opts.challenge = base64urlToBuffer(opts.challenge);
+		opts.user.id = base64urlToBuffer(opts.user.id);
+		for (var i = 0; i < opts.excludeCredentials.length; i++) {
+			opts.excludeCredentials[i].id = base64urlToBuffer(opts.excludeCredentials[i].id);
+		}
+		navigator.credentials.create({publicKey: opts}).then(function(cred) {
+			form.elements["client_data"].value = bufferToBase64url(cred.response.clientDataJSON);
+			form.elements["attestation_object"].value = bufferToBase64url(cred.response.attestationObject);
+			form.submit();
+		}).catch(function(err) {
+			alert(err.message);
+		});
+	};
+}
+
+var passkeyLogin = document.getElementById("passkey-login");
+if (!!passkeyLogin) {
+	if (!window.PublicKeyCredential) {
+		passkeyLogin.style.display = "none";
+	}
+	passkeyLogin.onsubmit = function(e) {
+		e.preventDefault();
+		var form = this;
+		var opts = JSON.parse(form.getAttribute("data-options"));
+		opts.challenge = base64urlToBuffer(opts.challenge);
+		navigator.credentials.get({publicKey: opts}).then(function(cred) {
+			form.elements["credential_id"].value = bufferToBase64url(cred.rawId);
+			form.elements["client_data"].value = bufferToBase64url(cred.response.clientDataJSON);
+			form.elements["authenticator_data"].value = bufferToBase64url(cred.response.authenticatorData);
+			form.elements["signature"].value = bufferToBase64url(cred.response.signature);
+			if (cred.response.userHandle) {
+				form.elements["user_handle"].value = bufferToBase64url(cred.response.userHandle);
+			}
+			form.submit();
+		}).catch(function(err) {
+			alert(err.message);
+		});
+	};
+}
 `
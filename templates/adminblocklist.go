@@ -0,0 +1,93 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const adminblocklistSrc = `
+{{ define "content" }}
+
+<h1><a href="/admin">Admin</a> &gt; Blocklist</h1>
+
+<form action="/admin/blocklist" method="POST">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<table class="form">
+	<tr>
+		<th><label for="kind">Block:</label></th>
+		<td>
+			<select name="kind" id="kind">
+				<option value="ip">IP address or range</option>
+				<option value="email">E-mail domain</option>
+			</select>
+		</td>
+	</tr>
+	<tr>
+		<th><label for="value">Value:</label></th>
+		<td><input type="text" name="value" id="value" placeholder="192.0.2.0/24 or example.com" required></td>
+	</tr>
+	<tr>
+		<th><label for="reason">Reason:</label></th>
+		<td><input type="text" name="reason" id="reason" maxlength="250"></td>
+	</tr>
+{{ if .Common.Msg }}
+	<tr>
+		<th></th>
+		<td><span class="alert">{{ .Common.Msg }}</span></td>
+	</tr>
+{{ end }}
+	<tr>
+		<th></th>
+		<td><input type="submit" name="action" value="Block"></td>
+	</tr>
+</table>
+</form>
+
+<h2>Blocked IP addresses</h2>
+{{ if .IPBlocks }}
+{{ range .IPBlocks }}
+<div class="row">
+	<form action="/admin/blocklist" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="blockid" value="{{ .ID }}">
+		{{ .Value }}
+		<span class="muted">blocked {{ .CreatedDateStr }}{{ if .Reason }}: {{ .Reason }}{{ end }}</span>
+		<input type="submit" name="action" value="Unblock">
+	</form>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No IP addresses are blocked.</div>
+</div>
+{{ end }}
+
+<h2>Blocked e-mail domains</h2>
+{{ if .EmailBlocks }}
+{{ range .EmailBlocks }}
+<div class="row">
+	<form action="/admin/blocklist" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="blockid" value="{{ .ID }}">
+		{{ .Value }}
+		<span class="muted">blocked {{ .CreatedDateStr }}{{ if .Reason }}: {{ .Reason }}{{ end }}</span>
+		<input type="submit" name="action" value="Unblock">
+	</form>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No e-mail domains are blocked.</div>
+</div>
+{{ end }}
+
+<h2>Disposable e-mail domains</h2>
+<div class="row">
+	<div class="muted">{{ .NumDisposable }} domains of disposable e-mail providers are blocked. Loading a file replaces them.</div>
+</div>
+<form action="/admin/blocklist" method="POST" enctype="multipart/form-data">
+	<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+	<input type="file" name="domains" accept=".txt">
+	<input type="submit" name="action" value="Load">
+</form>
+
+{{ end }}`
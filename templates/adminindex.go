@@ -40,6 +40,14 @@ const adminindexSrc = `
 		<th><label for="data_dir"><div class="col-label">Data Directory:</label></th>
 		<td><input type="text" name="data_dir" id="data_dir" value="{{ index .Config "data_dir" }}"></td>
 	</tr>
+	<tr>
+		<th><label for="breached_passwd_file"><div class="col-label">Breached password list (SHA-1, sorted):</label></th>
+		<td><input type="text" name="breached_passwd_file" id="breached_passwd_file" placeholder="/var/lib/orangeforum/pwned-passwords-sha1-ordered-by-hash.txt" value="{{ index .Config "breached_passwd_file" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="forum_url"><div class="col-label">Forum URL (for e-mail links, needed for digests):</label></th>
+		<td><input type="text" name="forum_url" id="forum_url" placeholder="https://forum.example.com" value="{{ index .Config "forum_url" }}"></td>
+	</tr>
 	<tr>
 		<th><label for="default_from_mail"><div class="col-label">FROM E-mail:</label></th>
 		<td><input type="text" name="default_from_mail" id="default_from_mail" value="{{ index .Config "default_from_mail" }}"></td>
@@ -60,14 +68,98 @@ const adminindexSrc = `
 		<th><label for="smtp_pass">SMTP Password:</label></th>
 		<td><input type="text" name="smtp_pass" id="smtp_pass" value="{{ index .Config "smtp_pass" }}"></td>
 	</tr>
+	<tr>
+		<th><label for="oidc_issuer"><div class="col-label">Single sign-on issuer (OIDC):</label></th>
+		<td><input type="text" name="oidc_issuer" id="oidc_issuer" placeholder="https://login.example.com" value="{{ index .Config "oidc_issuer" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="oidc_client_id">Single sign-on client ID:</label></th>
+		<td><input type="text" name="oidc_client_id" id="oidc_client_id" value="{{ index .Config "oidc_client_id" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="oidc_client_secret">Single sign-on client secret:</label></th>
+		<td><input type="text" name="oidc_client_secret" id="oidc_client_secret" value="{{ index .Config "oidc_client_secret" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="oidc_scopes">Single sign-on scopes:</label></th>
+		<td><input type="text" name="oidc_scopes" id="oidc_scopes" value="{{ index .Config "oidc_scopes" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="oidc_admin_claim">Single sign-on group claim:</label></th>
+		<td><input type="text" name="oidc_admin_claim" id="oidc_admin_claim" value="{{ index .Config "oidc_admin_claim" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="oidc_admin_group">Single sign-on superadmin group:</label></th>
+		<td><input type="text" name="oidc_admin_group" id="oidc_admin_group" placeholder="Leave empty to manage superadmins here" value="{{ index .Config "oidc_admin_group" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="ldap_url"><div class="col-label">LDAP server:</label></th>
+		<td><input type="text" name="ldap_url" id="ldap_url" placeholder="ldaps://ldap.example.com" value="{{ index .Config "ldap_url" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="ldap_bind_dn">LDAP bind DN:</label></th>
+		<td><input type="text" name="ldap_bind_dn" id="ldap_bind_dn" placeholder="cn=forum,ou=services,dc=example,dc=com" value="{{ index .Config "ldap_bind_dn" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="ldap_bind_pass">LDAP bind password:</label></th>
+		<td><input type="text" name="ldap_bind_pass" id="ldap_bind_pass" value="{{ index .Config "ldap_bind_pass" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="ldap_base_dn">LDAP base DN:</label></th>
+		<td><input type="text" name="ldap_base_dn" id="ldap_base_dn" placeholder="ou=people,dc=example,dc=com" value="{{ index .Config "ldap_base_dn" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="ldap_user_filter">LDAP user filter:</label></th>
+		<td><input type="text" name="ldap_user_filter" id="ldap_user_filter" value="{{ index .Config "ldap_user_filter" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="ldap_group_attr">LDAP group attribute:</label></th>
+		<td><input type="text" name="ldap_group_attr" id="ldap_group_attr" value="{{ index .Config "ldap_group_attr" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="ldap_group_roles"><div class="col-label">LDAP group roles:</label></th>
+		<td><textarea name="ldap_group_roles" id="ldap_group_roles" rows="4" placeholder="mod General = cn=forum-mods,ou=groups,dc=example,dc=com">{{ index .Config "ldap_group_roles" }}</textarea></td>
+	</tr>
+	<tr>
+		<th><label for="ldap_only">LDAP passwords only (except superadmins):</label></th>
+		<td><input type="checkbox" name="ldap_only" id="ldap_only" value="1"{{ if index .Config "ldap_only" }} checked{{ end }}></td>
+	</tr>
 	<tr>
 		<th><label for="read_only">Read-only mode:</label></th>
 		<td><input type="checkbox" name="read_only" id="read_only" value="1"{{ if index .Config "read_only" }} checked{{ end }}></td>
 	</tr>
+	<tr>
+		<th><label for="require_2fa">Require two-factor authentication for admins:</label></th>
+		<td><input type="checkbox" name="require_2fa" id="require_2fa" value="1"{{ if index .Config "require_2fa" }} checked{{ end }}></td>
+	</tr>
+	<tr>
+		<th><label for="require_verified_email">Require a confirmed e-mail address to post:</label></th>
+		<td><input type="checkbox" name="require_verified_email" id="require_verified_email" value="1"{{ if index .Config "require_verified_email" }} checked{{ end }}></td>
+	</tr>
+	<tr>
+		<th><label for="premod_account_age">Hold posts of accounts younger than (days, 0 = off):</label></th>
+		<td><input type="number" name="premod_account_age" id="premod_account_age" min="0" value="{{ index .Config "premod_account_age" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="premod_num_posts">Hold posts of users with fewer approved posts than (0 = off):</label></th>
+		<td><input type="number" name="premod_num_posts" id="premod_num_posts" min="0" value="{{ index .Config "premod_num_posts" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="infraction_points_days">Warning points count for (days, 0 = always):</label></th>
+		<td><input type="number" name="infraction_points_days" id="infraction_points_days" min="0" value="{{ index .Config "infraction_points_days" }}"></td>
+	</tr>
+	<tr>
+		<th><label for="infraction_escalations"><div class="col-label">Escalations at warning points:</label></th>
+		<td><textarea name="infraction_escalations" id="infraction_escalations" rows="4" placeholder="10 = suspend 7">{{ index .Config "infraction_escalations" }}</textarea></td>
+	</tr>
 	<tr>
 		<th><label for="signup_disabled">Signup disabled:</label></th>
 		<td><input type="checkbox" name="signup_disabled" id="signup_disabled" value="1"{{ if index .Config "signup_disabled" }} checked{{ end }}></td>
 	</tr>
+	<tr>
+		<th><label for="invite_only">Sign-up with an <a href="/admin/invites">invite</a> only:</label></th>
+		<td><input type="checkbox" name="invite_only" id="invite_only" value="1"{{ if index .Config "invite_only" }} checked{{ end }}></td>
+	</tr>
 	<tr>
 		<th><label for="group_creation_disabled">Group creation disabled:</label></th>
 		<td><input type="checkbox" name="group_creation_disabled" id="group_creation_disabled" value="1"{{ if index .Config "group_creation_disabled" }} checked{{ end }}></td>
@@ -168,6 +260,30 @@ const adminindexSrc = `
 		<th>Number of comments:</th>
 		<td>{{ .NumComments }}</td>
 	</tr>
+	<tr>
+		<th><a href="/admin/reports">Open reports:</a></th>
+		<td>{{ .NumReports }}</td>
+	</tr>
+	<tr>
+		<th><a href="/admin/auditlog">Moderation actions (last 24 hours):</a></th>
+		<td>{{ .NumAuditEntries }}</td>
+	</tr>
+	<tr>
+		<th><a href="/admin/mail">Failed e-mails:</a></th>
+		<td>{{ .NumFailedMails }}</td>
+	</tr>
+	<tr>
+		<th><a href="/admin/logins">Failed logins (last hour):</a></th>
+		<td>{{ .NumFailedLogins }}</td>
+	</tr>
+	<tr>
+		<th><a href="/admin/blocklist">Blocked IP addresses and e-mail domains:</a></th>
+		<td>{{ .NumBlocks }}</td>
+	</tr>
+	<tr>
+		<th><a href="/admin/invites">Users who signed up with an invite:</a></th>
+		<td>{{ .NumInvitedUsers }}</td>
+	</tr>
 </table>
 
 {{ end }}`
@@ -0,0 +1,48 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const admininvitesSrc = `
+{{ define "content" }}
+
+<h1><a href="/admin">Admin</a> &gt; Invites</h1>
+
+<h2>Users who signed up with an invite</h2>
+{{ if .InvitedUsers }}
+{{ range .InvitedUsers }}
+<div class="row">
+	<a href="/users?u={{ .UserName }}">{{ .UserName }}</a>
+	<span class="muted">signed up {{ .CreatedDateStr }} with invite {{ .InviteCode }}
+	{{ if .CreatorName }}from <a href="/users?u={{ .CreatorName }}">{{ .CreatorName }}</a>{{ end }}</span>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No users signed up with an invite.</div>
+</div>
+{{ end }}
+
+<h2>Invites</h2>
+{{ if .Invites }}
+{{ range .Invites }}
+<div class="row">
+	<form action="/admin/invites" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="id" value="{{ .ID }}">
+		{{ .Code }}
+		<span class="muted">from {{ if .CreatorName }}<a href="/users?u={{ .CreatorName }}">{{ .CreatorName }}</a>{{ else }}(deleted user){{ end }}
+		{{ if .GroupName }}[{{ .GroupName }}] {{ end }}used {{ .NumUses }} of {{ .MaxUses }}, created {{ .CreatedDateStr }},
+		{{ if .IsRevoked }}revoked{{ else }}expires {{ .ExpiryDateStr }}{{ end }}</span>
+		{{ if .IsUsable }}<input type="submit" name="action" value="Revoke">{{ end }}
+	</form>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No invites.</div>
+</div>
+{{ end }}
+
+{{ end }}`
@@ -0,0 +1,41 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const adminloginsSrc = `
+{{ define "content" }}
+
+<h1><a href="/admin">Admin</a> &gt; Failed logins</h1>
+
+{{ if .Failures }}
+<form action="/admin/logins" method="POST">
+	<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+	<input type="submit" name="action" value="Delete old entries">
+</form>
+<hr class="sep">
+{{ range .Failures }}
+<div class="comment-row">
+	<div class="comment-title muted">
+		{{ .CreatedDateStr }}: {{ .Action }} as <a href="/users?u={{ .UserName }}">{{ .UserName }}</a> from {{ .IP }}
+	</div>
+	<div class="comment">
+		<form action="/admin/logins" method="POST">
+			<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+			<input type="hidden" name="username" value="{{ .UserName }}">
+			<input type="hidden" name="ip" value="{{ .IP }}">
+			<input type="submit" name="action" value="Unlock user">
+			<input type="submit" name="action" value="Unlock IP">
+		</form>
+	</div>
+</div>
+<hr class="sep">
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No failed logins.</div>
+</div>
+{{ end }}
+
+{{ end }}`
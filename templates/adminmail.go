@@ -0,0 +1,38 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const adminmailSrc = `
+{{ define "content" }}
+
+<h1><a href="/admin">Admin</a> &gt; Failed e-mails</h1>
+
+{{ if .Mails }}
+{{ range .Mails }}
+<div class="comment-row">
+	<div class="comment-title muted">
+		To {{ .To }}, queued {{ .CreatedDateStr }}, {{ .Attempts }} attempt(s).
+		{{ if .IsDead }}<span class="alert">Gave up.</span>{{ else }}Next attempt at {{ .NextAttemptStr }}.{{ end }}
+	</div>
+	<div class="comment">
+		<div><b>{{ .Subject }}</b></div>
+		<div class="alert">{{ .LastError }}</div>
+		<form action="/admin/mail" method="POST">
+			<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+			<input type="hidden" name="id" value="{{ .ID }}">
+			<input type="submit" name="action" value="Retry">
+			<input type="submit" name="action" value="Delete">
+		</form>
+	</div>
+</div>
+<hr class="sep">
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No failed e-mails.</div>
+</div>
+{{ end }}
+
+{{ end }}`
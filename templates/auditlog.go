@@ -0,0 +1,85 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const auditlogSrc = `
+{{ define "content" }}
+
+{{ if .GroupName }}
+<h1><a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a> &gt; Audit log</h1>
+{{ else }}
+<h1><a href="/admin">Admin</a> &gt; Audit log</h1>
+{{ end }}
+
+<form action="{{ .LogPath }}" method="GET">
+{{ if .GroupID }}<input type="hidden" name="id" value="{{ .GroupID }}">{{ end }}
+<table class="form">
+	<tr>
+		<th><label for="action">Action:</label></th>
+		<td>
+			<select name="action" id="action">
+				<option value=""{{ if not .Action }} selected{{ end }}>Everything</option>
+				{{ range .Kinds }}
+				<option value="{{ . }}"{{ if eq . $.Action }} selected{{ end }}>{{ . }}.*</option>
+				{{ end }}
+				{{ range .Actions }}
+				<option value="{{ . }}"{{ if eq . $.Action }} selected{{ end }}>{{ . }}</option>
+				{{ end }}
+			</select>
+		</td>
+	</tr>
+	<tr>
+		<th><label for="actor">By (optional):</label></th>
+		<td><input type="text" name="actor" id="actor" value="{{ .Actor }}"></td>
+	</tr>
+	<tr>
+		<th><label for="from">From (optional):</label></th>
+		<td><input type="date" name="from" id="from" value="{{ .FromDate }}" placeholder="YYYY-MM-DD"></td>
+	</tr>
+	<tr>
+		<th><label for="to">To (optional):</label></th>
+		<td><input type="date" name="to" id="to" value="{{ .ToDate }}" placeholder="YYYY-MM-DD"></td>
+	</tr>
+	<tr>
+		<th></th>
+		<td><input type="submit" value="Filter"> <a href="{{ .CSVURL }}">Export CSV</a> <a href="{{ .JSONURL }}">Export JSON</a></td>
+	</tr>
+</table>
+</form>
+
+{{ if .Entries }}
+<div style="margin-top: 30px;">
+{{ range .Entries }}
+<div class="comment-row">
+	<div class="comment-title muted">
+		<b>{{ .Action }}</b>
+		{{ if .Target }}{{ if .URL }}<a href="{{ .URL }}">{{ .Target }}</a>{{ else }}{{ .Target }}{{ end }}{{ end }}
+		{{ if and .GroupName (not $.GroupName) }}in <a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a>{{ end }}
+		by {{ if .ActorName }}<a href="/users?u={{ .ActorName }}">{{ .ActorName }}</a>{{ else }}a deleted user{{ end }}
+		from {{ .IP }} <span title="{{ .DateStr }}">{{ .CreatedDateStr }}</span>
+	</div>
+	{{ if or .OldValue .NewValue }}
+	<div class="comment">
+		{{ if .OldValue }}<div><span class="muted">Before:</span> {{ .OldValue }}</div>{{ end }}
+		{{ if .NewValue }}<div><span class="muted">After:</span> {{ .NewValue }}</div>{{ end }}
+	</div>
+	{{ end }}
+</div>
+<hr class="sep">
+{{ end }}
+</div>
+{{ else }}
+<div class="row">
+	<div class="muted">No entries.</div>
+</div>
+{{ end }}
+
+{{ if .OlderURL }}
+<div class="row">
+	<div><a href="{{ .OlderURL }}">Older</a></div>
+</div>
+{{ end }}
+
+{{ end }}`
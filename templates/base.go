@@ -18,6 +18,10 @@ const baseSrc = `<!DOCTYPE html>
 			{{ .Common.ForumName }}
 		{{ end }}
 	</title>
+	{{ if .Common.FeedURL }}
+	<link rel="alternate" type="application/atom+xml" title="Atom" href="/feeds/atom{{ .Common.FeedURL }}">
+	<link rel="alternate" type="application/rss+xml" title="RSS" href="/feeds/rss{{ .Common.FeedURL }}">
+	{{ end }}
 	{{ block "head" . }}{{ end }}
 </head>
 
@@ -28,7 +32,9 @@ const baseSrc = `<!DOCTYPE html>
 				<a href="/">{{ .Common.ForumName }}</a>{{ if .GroupName }} &gt; <a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a>{{ end }}
 			</div>
 			<div id="navright">
+				<a href="/search">Search</a>
 				{{ if .Common.UserName }}
+				<a href="/notifications">Notifications{{ if .Common.NumNotifications }} <span class="alert">({{ .Common.NumNotifications }})</span>{{ end }}</a>
 				<a href="/users?u={{ .Common.UserName }}">{{ .Common.UserName }}{{ if .Common.IsNotification }}<span class="alert">&#x2757</span>{{ end }}</a>
 				{{ else }}
 				<a href="/login?next={{ .Common.CurrentURL }}">Login</a>
@@ -36,6 +42,9 @@ const baseSrc = `<!DOCTYPE html>
 			</div>
 		</div>
 		<hr>
+		{{ if .Common.SuspensionMsg }}
+		<div class="alert">{{ .Common.SuspensionMsg }}</div>
+		{{ end }}
 		<div id="content">
 		{{ block "content" . }}{{ end }}
 		</div>
@@ -46,7 +55,7 @@ const baseSrc = `<!DOCTYPE html>
 		{{ end }}
 		</div>
 	</div>
-	<script src="/static/js/orangeforum.js?v=140"></script>
+	<script src="/static/js/orangeforum.js?v=141"></script>
 	{{ .Common.BodyAppendage }}
 </body>
 </html>`
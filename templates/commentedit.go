@@ -17,6 +17,7 @@ const commenteditSrc = `
 	<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
 	<input type="hidden" name="id" value="{{ .CommentID }}">
 	<input type="hidden" name="tid" value="{{ .TopicID }}">
+	<input type="hidden" name="parent" value="{{ .ParentID }}">
 	<textarea name="content" rows="12">{{ .Content }}</textarea>
 
 	{{ if .IsImageUploadEnabled }}
@@ -34,7 +35,7 @@ const commenteditSrc = `
 		{{ if not .IsDeleted }}
 		<input type="submit" name="action" value="Update">
 		<input type="submit" name="action" value="Delete">
-		{{ else }}
+		{{ else if or .IsMod .IsAdmin .IsSuperAdmin }}
 		<input type="submit" name="action" value="Undelete">
 		{{ end }}
 	{{ else }}
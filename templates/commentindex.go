@@ -5,20 +5,49 @@
 package templates
 
 const commentindexSrc = `
-{{ define "content" }}
-
-<div class="row">
-	<div class="muted">
-		comment by <a href="/users?u={{ .OwnerName }}">{{ .OwnerName }}</a> in <a href="/topics?id={{ .TopicID }}">{{ .TopicName }}</a> {{ .CreatedDate }}
-		{{ if or .IsOwner $.IsAdmin $.IsMod $.IsSuperAdmin }} | <a href="/comments/edit?id={{ .ID }}">edit</a> {{end}}
+{{ define "comment" }}
+<div class="comment-row" id="comment-{{ .ID }}" style="margin-left: {{ .Indent }}px;">
+	<div class="comment-title muted">
+		<a href="/users?u={{ .UserName }}">{{ .UserName }}</a>
+		<a href="/comments?id={{ .ID }}">{{ .CreatedDate }}</a>
+		{{ if .IsPending }} [awaiting approval]{{ end }}
+		{{ if .CanEdit }} | <a href="/comments/edit?id={{ .ID }}">edit</a>{{ end }}
+		{{ if not .IsDeleted }} | <a href="/comments/new?tid={{ .TopicID }}&parent={{ .ID }}">reply</a>{{ end }}
 	</div>
 	{{ if .IsDeleted }}
-		<div>[DELETED]</div>
+		<div class="comment">[DELETED]</div>
 	{{ else }}
 		<div class="comment">{{ .Content }}</div>
 		{{ if .ImgSrc }}<div><img src="/img?name={{ .ImgSrc }}"></div>{{ end }}
 	{{ end }}
+	{{ if .NumHidden }}<div class="muted"><a href="/comments?id={{ .ID }}">Continue this thread ({{ .NumHidden }} more)</a></div>{{ end }}
 </div>
+{{ end }}
+
+{{ define "content" }}
+
+<h2 id="title"><a href="/topics?id={{ .TopicID }}">{{ .TopicName }}</a></h2>
+<p id="subtitle" class="muted">
+	in <a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a> |
+	<a href="/topics?id={{ .TopicID }}&p={{ .TopicPage }}#comment-{{ .ID }}">view in topic</a> |
+	<a href="/topics?id={{ .TopicID }}&view=threaded">view all threads</a>
+</p>
+
+{{ if .Parents }}
+<div class="muted">In reply to:</div>
+{{ range .Parents }}
+{{ template "comment" . }}
+{{ end }}
+<hr class="sep">
+{{ end }}
+
+{{ template "comment" .Comment }}
 
+{{ if .Replies }}
+<hr class="sep">
+{{ range .Replies }}
+{{ template "comment" . }}
+{{ end }}
+{{ end }}
 
 {{ end }}`
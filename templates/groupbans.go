@@ -0,0 +1,87 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const groupbansSrc = `
+{{ define "content" }}
+
+<h1><a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a> &gt; Bans and warnings</h1>
+
+<form action="{{ .BansURL }}" method="POST">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<table class="form">
+	<tr>
+		<th><label for="username">Username:</label></th>
+		<td><input type="text" name="username" id="username" placeholder="username" required></td>
+	</tr>
+	<tr>
+		<th><label for="reason">Reason (shown to the user):</label></th>
+		<td><input type="text" name="reason" id="reason" maxlength="250" required></td>
+	</tr>
+	<tr>
+		<th><label for="days">Ban for (days, 0 = for good):</label></th>
+		<td><input type="number" name="days" id="days" min="0" value="7"></td>
+	</tr>
+	<tr>
+		<th><label for="points">Warning points:</label></th>
+		<td><input type="number" name="points" id="points" min="0" max="{{ .MaxWarningPoints }}" value="1"></td>
+	</tr>
+{{ if .Common.Msg }}
+	<tr>
+		<th></th>
+		<td><span class="alert">{{ .Common.Msg }}</span></td>
+	</tr>
+{{ end }}
+	<tr>
+		<th></th>
+		<td>
+			<input type="submit" name="action" value="Ban">
+			<input type="submit" name="action" value="Warn">
+		</td>
+	</tr>
+</table>
+</form>
+
+<h2>Banned users</h2>
+{{ if .Bans }}
+{{ range .Bans }}
+<div class="row">
+	<form action="{{ $.BansURL }}" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="userid" value="{{ .UserID }}">
+		<a href="/users?u={{ .UserName }}">{{ .UserName }}</a>
+		<span class="muted">banned {{ .CreatedDateStr }}, {{ if .ExpiryDateStr }}until {{ .ExpiryDateStr }}{{ else }}for good{{ end }}: {{ .Reason }}</span>
+		<input type="submit" name="action" value="Lift">
+	</form>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No one is banned from this group.</div>
+</div>
+{{ end }}
+
+<h2>Accounts sharing an IP address</h2>
+<form action="/groups/bans" method="GET">
+	<input type="hidden" name="id" value="{{ .GroupID }}">
+	<input type="text" name="u" value="{{ .SharerName }}" placeholder="username" required>
+	<input type="submit" value="Find">
+</form>
+{{ if .SharerName }}
+{{ if .Sharers }}
+{{ range .Sharers }}
+<div class="row">
+	<a href="/users?u={{ .UserName }}">{{ .UserName }}</a>
+	<span class="muted">{{ .NumIPs }} shared IP address{{ if gt .NumIPs 1 }}es{{ end }}</span>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No other accounts were seen at the IP addresses of {{ .SharerName }}.</div>
+</div>
+{{ end }}
+{{ end }}
+
+{{ end }}`
@@ -38,12 +38,18 @@ const groupeditSrc = `
 		<th><label for="admins">Admins (can edit this page):</label></th>
 		<td><input type="text" name="admins" id="admins" placeholder="user1, user2" value="{{ .Admins }}"></td>
 	</tr>
-	<!--
 	<tr>
-		<th><label for="is_private">Private:</label></th>
-		<td><input type="checkbox" name="is_private" id="is_private"{{ if .IsPrivate }} value="1" checked{{ end }}></td>
+		<th><label for="is_private">Private (members only):</label></th>
+		<td><input type="checkbox" name="is_private" id="is_private" value="1"{{ if .IsPrivate }} checked{{ end }}>{{ if and .ID .IsPrivate }} <a href="/groups/members?id={{ .ID }}">manage members</a>{{ end }}</td>
+	</tr>
+	<tr>
+		<th><label for="premod_account_age">Hold posts of accounts younger than (days, 0 = off):</label></th>
+		<td><input type="number" name="premod_account_age" id="premod_account_age" min="0" value="{{ .PremodAccountAge }}"></td>
+	</tr>
+	<tr>
+		<th><label for="premod_num_posts">Hold posts of users with fewer approved posts than (0 = off):</label></th>
+		<td><input type="number" name="premod_num_posts" id="premod_num_posts" min="0" value="{{ .PremodNumPosts }}"></td>
 	</tr>
-	-->
 {{ if .Common.IsSuperAdmin }}
 	<tr>
 		<th><label for="is_sticky">Sticky:</label></th>
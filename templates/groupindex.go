@@ -11,6 +11,22 @@ const groupindexSrc = `
 	<a class="link-btn" href="/topics/new?gid={{ .GroupID }}">New topic</a>
 	{{ if or .IsAdmin .IsMod .IsSuperAdmin }}
 	<a class="link-btn" href="/groups/edit?id={{ .GroupID }}">Edit group</a>
+	<a class="link-btn" href="/groups/reports?id={{ .GroupID }}">Reports{{ if .NumReports }} ({{ .NumReports }}){{ end }}</a>
+	<a class="link-btn" href="/groups/pending?id={{ .GroupID }}">Pending{{ if .NumPending }} ({{ .NumPending }}){{ end }}</a>
+	<a class="link-btn" href="/groups/bans?id={{ .GroupID }}">Bans</a>
+	{{ end }}
+	{{ if or .IsAdmin .IsSuperAdmin }}
+	<a class="link-btn" href="/groups/auditlog?id={{ .GroupID }}">Audit log</a>
+	{{ end }}
+	{{ if .IsPrivate }}
+	{{ if or .IsAdmin .IsSuperAdmin }}
+	<a class="link-btn" href="/groups/members?id={{ .GroupID }}">Members</a>
+	{{ else if and .IsMember (not .IsMod) }}
+	<form action="/groups/leave?id={{ .GroupID }}" method="POST">
+		<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+		<input class="btn" type="submit" value="Leave group">
+	</form>
+	{{ end }}
 	{{ end }}
 	{{ if and .Common.UserName .Common.IsGroupSubAllowed }}
 	{{ if .SubToken }}
@@ -28,7 +44,13 @@ const groupindexSrc = `
 </div>
 
 <h1 id="title"><a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a></h1>
-<div class="muted">{{ .GroupDesc }}</div>
+<div class="muted">{{ .GroupDesc }}{{ if .IsPrivate }} [private]{{ end }}</div>
+{{ if .Common.Msg }}
+<div class="alert">{{ .Common.Msg }}</div>
+{{ end }}
+{{ if .BanMsg }}
+<div class="alert">{{ .BanMsg }}</div>
+{{ end }}
 {{ if .HeaderMsg }}
 <h3>{{ .HeaderMsg }}</h3>
 {{ end }}
@@ -38,7 +60,7 @@ const groupindexSrc = `
 {{ range .Topics }}
 	{{ if not .IsDeleted }}
 	<div class="topic-row">
-		<div><a href="/topics?id={{ .ID }}">{{ .Title }}{{ if .IsClosed }} [closed] {{ end }}</a></div>
+		<div><a href="/topics?id={{ .ID }}">{{ .Title }}{{ if .IsClosed }} [closed] {{ end }}{{ if .IsPending }} [awaiting approval] {{ end }}</a></div>
 		<div class="muted"><a href="/users?u={{ .Owner }}">{{ .Owner }}</a> {{ .CreatedDate }} | <a href="/topics?id={{ .ID }}">{{ .NumComments }} comments</a></div>
 	</div>
 	<hr class="sep">
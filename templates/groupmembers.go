@@ -0,0 +1,88 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const groupmembersSrc = `
+{{ define "content" }}
+
+<h1 id="title"><a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a></h1>
+<p id="subtitle" class="muted">Members</p>
+
+<form action="/groups/members?id={{ .GroupID }}" method="POST">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<table class="form">
+	<tr>
+		<th><label for="username">Invite:</label></th>
+		<td><input type="text" name="username" id="username" placeholder="username" required></td>
+	</tr>
+{{ if .Common.Msg }}
+	<tr>
+		<th></th>
+		<td><span class="alert">{{ .Common.Msg }}</span></td>
+	</tr>
+{{ end }}
+	<tr>
+		<th></th>
+		<td><input type="submit" name="action" value="Invite"></td>
+	</tr>
+</table>
+</form>
+
+<h2>Requests to join</h2>
+{{ if .Requests }}
+{{ range .Requests }}
+<div class="row">
+	<form action="/groups/members?id={{ $.GroupID }}" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="userid" value="{{ .UserID }}">
+		<a href="/users?u={{ .UserName }}">{{ .UserName }}</a> <span class="muted">{{ .CreatedDate }}</span>
+		<input type="submit" name="action" value="Approve">
+		<input type="submit" name="action" value="Reject">
+	</form>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No pending requests.</div>
+</div>
+{{ end }}
+
+<h2>Invitations</h2>
+{{ if .Invites }}
+{{ range .Invites }}
+<div class="row">
+	<form action="/groups/members?id={{ $.GroupID }}" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="userid" value="{{ .UserID }}">
+		<a href="/users?u={{ .UserName }}">{{ .UserName }}</a> <span class="muted">invited {{ .CreatedDate }}</span>
+		<input type="submit" name="action" value="Cancel">
+	</form>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No pending invitations.</div>
+</div>
+{{ end }}
+
+<h2>Members</h2>
+{{ if .Members }}
+{{ range .Members }}
+<div class="row">
+	<form action="/groups/members?id={{ $.GroupID }}" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="userid" value="{{ .UserID }}">
+		<a href="/users?u={{ .UserName }}">{{ .UserName }}</a> <span class="muted">joined {{ .CreatedDate }}</span>
+		<input type="submit" name="action" value="Remove">
+	</form>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No members.</div>
+</div>
+{{ end }}
+
+{{ end }}`
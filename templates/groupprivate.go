@@ -0,0 +1,44 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const groupprivateSrc = `
+{{ define "content" }}
+
+<h1 id="title"><a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a></h1>
+<div class="row">
+	<div class="muted">This group is private. Only its members can see the topics posted here.</div>
+</div>
+
+<div class="row">
+{{ if .Common.UserName }}
+	{{ if .IsInvited }}
+	<form action="/groups/join?id={{ .GroupID }}" method="POST">
+		<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+		You have been invited to join this group.
+		<input type="submit" name="action" value="Accept">
+		<input type="submit" name="action" value="Decline">
+	</form>
+	{{ else if .IsRequested }}
+	<div>Your request to join this group is waiting for approval by the group admins.</div>
+	{{ else }}
+	<form action="/groups/join?id={{ .GroupID }}" method="POST">
+		<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+		<input type="submit" name="action" value="Request">
+		to join this group.
+	</form>
+	{{ end }}
+{{ else }}
+	<a href="/login?next={{ .Common.CurrentURL }}">Login</a> to request to join this group.
+{{ end }}
+</div>
+
+{{ if .Common.Msg }}
+<div class="row">
+	<span class="alert">{{ .Common.Msg }}</span>
+</div>
+{{ end }}
+
+{{ end }}`
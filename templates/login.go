@@ -46,4 +46,26 @@ const loginSrc = `
 </table>
 </form>
 
+<form action="/login/passkey" method="POST" id="passkey-login" data-options="{{ .PasskeyOptions }}">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<input type="hidden" name="next" value="{{ .next }}">
+<input type="hidden" name="credential_id">
+<input type="hidden" name="client_data">
+<input type="hidden" name="authenticator_data">
+<input type="hidden" name="signature">
+<input type="hidden" name="user_handle">
+<table class="form">
+	<tr>
+		<th></th>
+		<td><input type="submit" value="Login with a security key or passkey"></td>
+	</tr>
+{{ if .IsOIDCEnabled }}
+	<tr>
+		<th></th>
+		<td><a href="/login/oidc">Login with single sign-on</a></td>
+	</tr>
+{{ end }}
+</table>
+</form>
+
 {{ end }}`
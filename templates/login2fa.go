@@ -0,0 +1,35 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const login2faSrc = `
+{{ define "content" }}
+
+<form action="/login/2fa" method="POST">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<input type="hidden" name="next" value="{{ .next }}">
+<table class="form">
+	<tr>
+		<th></th>
+		<td>Enter the code from your authenticator app, or one of your recovery codes.</td>
+	</tr>
+	<tr>
+		<th><label for="code">Code:</label></th>
+		<td><input type="text" name="code" id="code" autocomplete="one-time-code" autofocus required></td>
+	</tr>
+{{ if .Common.Msg }}
+	<tr>
+		<th></th>
+		<td><span class="alert">{{ .Common.Msg }}</span></td>
+	</tr>
+{{ end }}
+	<tr>
+		<th></th>
+		<td><input type="submit" value="Login"></td>
+	</tr>
+</table>
+</form>
+
+{{ end }}`
@@ -0,0 +1,42 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const notificationsSrc = `
+{{ define "content" }}
+
+<h1 id="title"><a href="/notifications">Notifications</a></h1>
+
+{{ if .Notifications }}
+<form action="/notifications" method="POST">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+{{ range .Notifications }}
+<div class="comment-row">
+	<div class="comment-title muted">
+		{{ if not .IsRead }}<input type="checkbox" name="id" value="{{ .ID }}"> <span class="alert">&#x2757;</span>{{ end }}
+		{{ .CreatedDateStr }}
+	</div>
+	<div class="comment">
+		{{ if .ActorName }}<a href="/users?u={{ .ActorName }}">{{ .ActorName }}</a>{{ else }}Someone{{ end }}
+		<a href="/notifications/open?id={{ .ID }}">{{ .Content }}</a>
+	</div>
+</div>
+<hr class="sep">
+{{ end }}
+<div>
+	<input type="submit" name="action" value="Mark selected as read">
+	<input type="submit" name="action" value="Mark all as read">
+</div>
+</form>
+{{ else }}
+<div class="row">
+	<div class="muted">No notifications to show.</div>
+</div>
+{{ end }}
+{{ if ge .NextPage 0 }}
+<a href="/notifications?p={{ .NextPage }}">More</a>
+{{ end }}
+
+{{ end }}`
@@ -0,0 +1,40 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const pendingSrc = `
+{{ define "content" }}
+
+<h1><a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a> &gt; Pending posts</h1>
+
+{{ if .Common.Msg }}
+<div class="alert">{{ .Common.Msg }}</div>
+{{ end }}
+
+{{ if .Posts }}
+{{ range .Posts }}
+<div class="comment-row">
+	<div class="comment-title muted">
+		{{ if eq .Kind "topic" }}Topic <a href="{{ .URL }}">{{ .TopicName }}</a>{{ else }}<a href="{{ .URL }}">Comment</a> in {{ .TopicName }}{{ end }}
+		by <a href="/users?u={{ .UserName }}">{{ .UserName }}</a> {{ .CreatedDateStr }}
+	</div>
+	<div class="comment">{{ .ContentHTML }}</div>
+	<form action="{{ $.PendingURL }}" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="kind" value="{{ .Kind }}">
+		<input type="hidden" name="postid" value="{{ .ID }}">
+		<input type="submit" name="action" value="Approve">
+		<input type="submit" name="action" value="Reject">
+	</form>
+</div>
+<hr class="sep">
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No posts waiting for approval.</div>
+</div>
+{{ end }}
+
+{{ end }}`
@@ -16,6 +16,7 @@ const pmSrc = `
 		{{ if not .IsRead }}<span class="alert">&#x2757;</span>{{ end }}
 		<a href="/users?u={{ .From }}">{{ .From }}</a> {{ .CreatedDate }} |
 		<a href="/pm?quote={{ .ID }}#end">reply</a> |
+		<a href="/reports/new?kind=pm&id={{ .ID }}">report</a> |
 		<form method="post" action="/pm/delete" style="display: inline;">
 			<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
   			<input type="hidden" name="id" value="{{ .ID }}">
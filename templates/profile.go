@@ -26,6 +26,12 @@ const profileSrc = `
 		<th><label for="email">Email (private):</label></th>
 		<td><input type="email" name="email" id="email" value={{ .Email }}></td>
 	</tr>
+	<tr>
+		<th><label for="digest">Subscription e-mails:</label></th>
+		<td><select name="digest" id="digest">
+			{{ range .Digests }}<option value="{{ . }}"{{ if eq . $.Digest }} selected{{ end }}>{{ . }}</option>{{ end }}
+		</select></td>
+	</tr>
 	{{ if .Common.Msg }}
 	<tr>
 		<th></th>
@@ -36,6 +42,12 @@ const profileSrc = `
 		<th></th>
 		<td><input type="submit" name="action" value="Update"></td>
 	</tr>
+	{{ if .PendingEmail }}
+	<tr>
+		<th>Unconfirmed email:</th>
+		<td>{{ .PendingEmail }} <input type="submit" name="action" value="Resend"></td>
+	</tr>
+	{{ end }}
 {{ end }}
 	<tr>
 		<th><a href="/users/topics?u={{ .UserName }}">topics</a>{{ if or .IsSelf .Common.IsSuperAdmin }} (public){{ end }}</th>
@@ -54,6 +66,10 @@ const profileSrc = `
 		<th><a href="/changepass?u={{ .UserName }}">change password</a></th>
 		<td></td>
 	</tr>
+	<tr>
+		<th><a href="/users/sessions?u={{ .UserName }}">sessions</a></th>
+		<td></td>
+	</tr>
 {{ end }}
 {{ if and .IsSelf .Common.IsSuperAdmin }}
 	<tr>
@@ -70,12 +86,36 @@ const profileSrc = `
 		<th><a href="/pm">private messages{{ if .Common.IsNotification }}<span class="alert">&#x2757</span>{{ end }}</a></th>
 		<td></td>
 	</tr>
+	{{ if .CanInvite }}
+	<tr>
+		<th><a href="/users/invites">invites</a></th>
+		<td></td>
+	</tr>
+	{{ end }}
+	<tr>
+		<th><a href="/users/tokens">API tokens</a></th>
+		<td></td>
+	</tr>
+	<tr>
+		<th><a href="/users/2fa">two-factor authentication</a></th>
+		<td></td>
+	</tr>
+	<tr>
+		<th><a href="/users/passkeys">security keys and passkeys</a></th>
+		<td></td>
+	</tr>
 	<tr>
 		<th><a href="/logout">logout</a></th>
 		<td></td>
 	</tr>
 {{ end }}
 {{ if .Common.IsSuperAdmin }}
+	<tr>
+		<th>Failed logins (last hour):</th>
+		<td>{{ .NumLoginFailures }}{{ if .IsLocked }} <span class="alert">(locked)</span>{{ end }}
+			{{ if .NumLoginFailures }}<input type="submit" name="action" value="Unlock">{{ end }}
+		</td>
+	</tr>
 {{ if not .IsSelf }}
 	<tr>
 		<th></th>
@@ -87,9 +127,56 @@ const profileSrc = `
 			{{ end }}
 		</td>
 	</tr>
+	<tr>
+		<th>Directory login:</th>
+		<td>
+			{{ if .IsExternal }}
+			allowed <input type="submit" name="action" value="Unlink">
+			{{ else }}
+			not allowed <input type="submit" name="action" value="Link">
+			{{ end }}
+		</td>
+	</tr>
+	<tr>
+		<th><label for="reason">Reason (shown to the user):</label></th>
+		<td><input type="text" name="reason" id="reason" maxlength="250"></td>
+	</tr>
+	<tr>
+		<th><label for="days">Suspend for (days):</label></th>
+		<td><input type="number" name="days" id="days" min="1" value="7">
+			<input type="submit" name="action" value="Suspend">
+			{{ if .SuspendedUntil }}<input type="submit" name="action" value="Unsuspend">{{ end }}
+		</td>
+	</tr>
+	<tr>
+		<th><label for="points">Warning points:</label></th>
+		<td><input type="number" name="points" id="points" min="0" value="1">
+			<input type="submit" name="action" value="Warn">
+		</td>
+	</tr>
 {{ end }}
 {{ end }}
 </table>
 </form>
 
+{{ if or .SuspendedUntil .Warnings }}
+<h2>Suspensions and warnings</h2>
+{{ if .SuspendedUntil }}
+<div class="alert">Suspended until {{ .SuspendedUntil }}. Reason: {{ .SuspendReason }}</div>
+{{ end }}
+<div class="muted">Infraction points: {{ .NumPoints }}</div>
+{{ range .Warnings }}
+<div class="comment-row">
+	<div class="comment-title muted">
+		{{ .Points }} points
+		{{ if .GroupName }}in <a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a>{{ end }}
+		{{ if .IssuerName }}from <a href="/users?u={{ .IssuerName }}">{{ .IssuerName }}</a>{{ end }}
+		{{ .CreatedDateStr }}
+	</div>
+	<div class="comment">{{ .Reason }}</div>
+</div>
+<hr class="sep">
+{{ end }}
+{{ end }}
+
 {{ end }}`
@@ -0,0 +1,72 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const profile2faSrc = `
+{{ define "content" }}
+
+<h1>Two-factor authentication</h1>
+
+<p class="muted">
+With two-factor authentication on, logging in needs a code from an authenticator app on your phone
+in addition to your password.
+{{ if .IsRequired }}It is required for superadmins and group admins. Your admin privileges are disabled while it is off.{{ end }}
+</p>
+
+{{ if .Common.Msg }}
+<div class="alert">{{ .Common.Msg }}</div>
+{{ end }}
+
+{{ if .RecoveryCodes }}
+<div class="row">
+	<div>Recovery codes (save them now, they won't be shown again). Each one can be used once to log in without your authenticator app:</div>
+	<pre>{{ range .RecoveryCodes }}{{ . }}
+{{ end }}</pre>
+</div>
+{{ end }}
+
+{{ if .IsEnabled }}
+<div class="row">
+	<div>Two-factor authentication is on. You have {{ .NumRecoveryCodes }} recovery codes left.</div>
+</div>
+<form action="/users/2fa" method="POST">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<table class="form">
+	<tr>
+		<th><label for="code">Code:</label></th>
+		<td><input type="text" name="code" id="code" autocomplete="one-time-code" required></td>
+	</tr>
+	<tr>
+		<th></th>
+		<td>
+			<input type="submit" name="action" value="New recovery codes">
+			<input type="submit" name="action" value="Turn off">
+		</td>
+	</tr>
+</table>
+</form>
+{{ else }}
+<div class="row">
+	<div>Add this key to your authenticator app, or open the link on your phone:</div>
+	<pre>{{ .Secret }}</pre>
+	<div><a href="{{ .URI }}">{{ .URI }}</a></div>
+</div>
+<form action="/users/2fa" method="POST">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<input type="hidden" name="secret" value="{{ .Secret }}">
+<table class="form">
+	<tr>
+		<th><label for="code">Code from the app:</label></th>
+		<td><input type="text" name="code" id="code" autocomplete="one-time-code" required></td>
+	</tr>
+	<tr>
+		<th></th>
+		<td><input type="submit" name="action" value="Turn on"></td>
+	</tr>
+</table>
+</form>
+{{ end }}
+
+{{ end }}`
@@ -42,5 +42,39 @@ const profilegroupsSrc = `
 </div>
 {{ end }}
 
+<h2>Member</h2>
+{{ if .MemberInGroups }}
+{{ range .MemberInGroups }}
+<div class="row">
+	<div>
+		<a href="/groups?name={{ .Name }}">{{ .Name }}</a>{{ if .IsClosed }} [closed]{{ end }}
+	</div>
+	<div class="muted">created {{ .CreatedDate }}</div>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No private groups to show.</div>
+</div>
+{{ end }}
+
+<h2>Invitations</h2>
+{{ if .InvitedToGroups }}
+{{ range .InvitedToGroups }}
+<div class="row">
+	<form action="/groups/join?id={{ .ID }}" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<a href="/groups?name={{ .Name }}">{{ .Name }}</a> <span class="muted">invited {{ .CreatedDate }}</span>
+		<input type="submit" name="action" value="Accept">
+		<input type="submit" name="action" value="Decline">
+	</form>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No invitations.</div>
+</div>
+{{ end }}
+
 {{ end }}
 `
@@ -0,0 +1,68 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const profileinvitesSrc = `
+{{ define "content" }}
+
+<h1>Invites</h1>
+
+<p class="muted">
+Share the sign-up link of an invite with the people you want to invite. An invite works until it expires or has
+been used the given number of times. People who sign up with an invite that has a group join the group.
+</p>
+
+{{ if .Common.Msg }}
+<div class="alert">{{ .Common.Msg }}</div>
+{{ end }}
+
+{{ if .Invites }}
+{{ range .Invites }}
+<div class="row">
+	<form action="/users/invites" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="id" value="{{ .ID }}">
+		<a href="/signup?invite={{ .Code }}">/signup?invite={{ .Code }}</a>
+		<span class="muted">{{ if .GroupName }}[{{ .GroupName }}] {{ end }}used {{ .NumUses }} of {{ .MaxUses }}, created {{ .CreatedDateStr }},
+		{{ if .IsRevoked }}revoked{{ else }}expires {{ .ExpiryDateStr }}{{ end }}</span>
+		{{ if .IsUsable }}<input type="submit" name="action" value="Revoke">{{ end }}
+	</form>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No invites.</div>
+</div>
+{{ end }}
+
+<h2>New invite</h2>
+<form action="/users/invites" method="POST">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<table class="form">
+	<tr>
+		<th><label for="max_uses">Number of uses:</label></th>
+		<td><input type="number" name="max_uses" id="max_uses" min="1" max="{{ .MaxUses }}" value="1" required></td>
+	</tr>
+	<tr>
+		<th><label for="days">Expires in (days):</label></th>
+		<td><input type="number" name="days" id="days" min="1" max="{{ .MaxDays }}" value="7" required></td>
+	</tr>
+	{{ if .Groups }}
+	<tr>
+		<th><label for="gid">Join group:</label></th>
+		<td><select name="gid" id="gid">
+			<option value="">(none)</option>
+			{{ range .Groups }}<option value="{{ .ID }}">{{ .Name }}</option>{{ end }}
+		</select></td>
+	</tr>
+	{{ end }}
+	<tr>
+		<th></th>
+		<td><input type="submit" name="action" value="Create"></td>
+	</tr>
+</table>
+</form>
+
+{{ end }}`
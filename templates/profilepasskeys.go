@@ -0,0 +1,55 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const profilepasskeysSrc = `
+{{ define "content" }}
+
+<h1>Security keys and passkeys</h1>
+
+<p class="muted">
+Log in with a security key, or a passkey saved on your phone or computer, instead of your password.
+</p>
+
+{{ if .Common.Msg }}
+<div class="alert">{{ .Common.Msg }}</div>
+{{ end }}
+
+{{ if .Passkeys }}
+{{ range .Passkeys }}
+<div class="row">
+	<form action="/users/passkeys" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="id" value="{{ .ID }}">
+		{{ .Name }} <span class="muted">added {{ .CreatedDate }}, last used {{ .LastUsedDate }}</span>
+		<input type="submit" name="action" value="Delete">
+	</form>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No security keys.</div>
+</div>
+{{ end }}
+
+<h2>New security key</h2>
+<form action="/users/passkeys" method="POST" id="passkey-add" data-options="{{ .Options }}">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<input type="hidden" name="action" value="Add">
+<input type="hidden" name="client_data">
+<input type="hidden" name="attestation_object">
+<table class="form">
+	<tr>
+		<th><label for="name">Name:</label></th>
+		<td><input type="text" name="name" id="name" maxlength="64" placeholder="My phone" required></td>
+	</tr>
+	<tr>
+		<th></th>
+		<td><input type="submit" value="Add"></td>
+	</tr>
+</table>
+</form>
+
+{{ end }}`
@@ -0,0 +1,46 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const profilesessionsSrc = `
+{{ define "content" }}
+
+<h1>{{ if .IsSelf }}Sessions{{ else }}Sessions of <a href="/users?u={{ .UserName }}">{{ .UserName }}</a>{{ end }}</h1>
+
+<p class="muted">
+{{ if .IsSelf }}These are the browsers and devices you are logged in with. Log out any you don't recognize, and change
+your password if you think someone else knows it.{{ else }}These are the browsers and devices {{ .UserName }} is logged in with.{{ end }}
+</p>
+
+{{ if .Common.Msg }}
+<div class="alert">{{ .Common.Msg }}</div>
+{{ end }}
+
+{{ if .Sessions }}
+{{ range .Sessions }}
+<div class="row">
+	<form action="/users/sessions?u={{ $.UserName }}" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="id" value="{{ .ID }}">
+		{{ if .UserAgent }}{{ .UserAgent }}{{ else }}Unknown browser{{ end }}
+		<span class="muted">{{ .IP }}, logged in {{ .CreatedDate }}, last seen {{ .LastSeenDate }}</span>
+		{{ if .IsCurrent }}<b>(this session)</b>{{ else }}<input type="submit" name="action" value="Revoke">{{ end }}
+	</form>
+</div>
+{{ end }}
+<form action="/users/sessions?u={{ .UserName }}" method="POST">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<p>
+	<input type="submit" name="action" value="Revoke all">
+	<span class="muted">{{ if .IsSelf }}Logs out every session except this one.{{ else }}Logs out every session.{{ end }}</span>
+</p>
+</form>
+{{ else }}
+<div class="row">
+	<div class="muted">No sessions.</div>
+</div>
+{{ end }}
+
+{{ end }}`
@@ -0,0 +1,69 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const profiletokensSrc = `
+{{ define "content" }}
+
+<h1>API tokens</h1>
+
+<p class="muted">
+Scripts and bots can use the API with a token instead of logging in. Send it in the
+<code>Authorization: Bearer &lt;token&gt;</code> header. The <b>read</b> scope allows GET requests,
+<b>post</b> allows creating and editing posts, and <b>moderate</b> allows using your mod and admin privileges.
+</p>
+
+{{ if .Common.Msg }}
+<div class="alert">{{ .Common.Msg }}</div>
+{{ end }}
+
+{{ if .NewToken }}
+<div class="row">
+	<div>New token (copy it now, it won't be shown again):</div>
+	<pre>{{ .NewToken }}</pre>
+</div>
+{{ end }}
+
+{{ if .Tokens }}
+{{ range .Tokens }}
+<div class="row">
+	<form action="/users/tokens" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="id" value="{{ .ID }}">
+		{{ .Name }} <span class="muted">[{{ .Scopes }}] created {{ .CreatedDate }}, last used {{ .LastUsedDate }}</span>
+		<input type="submit" name="action" value="Revoke">
+	</form>
+</div>
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No tokens.</div>
+</div>
+{{ end }}
+
+<h2>New token</h2>
+<form action="/users/tokens" method="POST">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<table class="form">
+	<tr>
+		<th><label for="name">Name:</label></th>
+		<td><input type="text" name="name" id="name" maxlength="64" required></td>
+	</tr>
+	<tr>
+		<th>Scopes:</th>
+		<td>
+			{{ range .Scopes }}
+			<label><input type="checkbox" name="scope_{{ . }}"{{ if eq . "read" }} checked{{ end }}> {{ . }}</label>
+			{{ end }}
+		</td>
+	</tr>
+	<tr>
+		<th></th>
+		<td><input type="submit" name="action" value="Create"></td>
+	</tr>
+</table>
+</form>
+
+{{ end }}`
@@ -0,0 +1,49 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const reportnewSrc = `
+{{ define "content" }}
+
+<h1>Report {{ .KindName }}</h1>
+
+{{ if .Common.Msg }}
+<div class="alert">{{ .Common.Msg }}</div>
+{{ end }}
+
+<div class="comment-row">
+	{{ if .Title }}<div class="comment-title muted"><a href="{{ .URL }}">{{ .Title }}</a></div>{{ end }}
+	<div class="comment">{{ .Content }}</div>
+</div>
+<hr class="sep">
+
+{{ if .IsReported }}
+<div class="row">
+	<div class="muted">You have reported this {{ .KindName }}. <a href="{{ .URL }}">Go back</a>.</div>
+</div>
+{{ else }}
+<form action="/reports/new?kind={{ .Kind }}&id={{ .ID }}" method="POST">
+<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+<table class="form">
+	<tr>
+		<th><label for="reason">Reason:</label></th>
+		<td><select name="reason" id="reason" required>
+			<option value="">(choose)</option>
+			{{ range .Reasons }}<option value="{{ . }}">{{ . }}</option>{{ end }}
+		</select></td>
+	</tr>
+	<tr>
+		<th><label for="details">Details (optional):</label></th>
+		<td><textarea name="details" id="details" rows="4" maxlength="1000"></textarea></td>
+	</tr>
+	<tr>
+		<th></th>
+		<td><input type="submit" value="Report"></td>
+	</tr>
+</table>
+</form>
+{{ end }}
+
+{{ end }}`
@@ -0,0 +1,49 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const reportsSrc = `
+{{ define "content" }}
+
+{{ if .GroupName }}
+<h1><a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a> &gt; Reports</h1>
+{{ else }}
+<h1><a href="/admin">Admin</a> &gt; Reports</h1>
+{{ end }}
+
+{{ if .Common.Msg }}
+<div class="alert">{{ .Common.Msg }}</div>
+{{ end }}
+
+{{ if .Reports }}
+{{ range .Reports }}
+<div class="comment-row">
+	<div class="comment-title muted">
+		<b>{{ .Reason }}</b>:
+		{{ if .URL }}<a href="{{ .URL }}">{{ .KindName }}</a>{{ else }}{{ .KindName }}{{ end }}
+		by <a href="/users?u={{ .OwnerName }}">{{ .OwnerName }}</a>
+		{{ if and .GroupName (not $.GroupName) }}in <a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a>{{ end }}
+		reported by <a href="/users?u={{ .ReporterName }}">{{ .ReporterName }}</a> {{ .CreatedDateStr }}
+	</div>
+	{{ if .Details }}<div class="muted">{{ .Details }}</div>{{ end }}
+	<div class="comment">{{ .ContentHTML }}</div>
+	<form action="{{ $.QueueURL }}" method="POST">
+		<input type="hidden" name="csrf" value="{{ $.Common.CSRF }}">
+		<input type="hidden" name="reportid" value="{{ .ID }}">
+		<input type="submit" name="action" value="Dismiss">
+		<input type="submit" name="action" value="Delete">
+		{{ if ne .Kind "pm" }}<input type="submit" name="action" value="Close">{{ end }}
+		{{ if $.IsSuperAdmin }}<input type="submit" name="action" value="Ban">{{ end }}
+	</form>
+</div>
+<hr class="sep">
+{{ end }}
+{{ else }}
+<div class="row">
+	<div class="muted">No open reports.</div>
+</div>
+{{ end }}
+
+{{ end }}`
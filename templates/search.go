@@ -0,0 +1,83 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const searchSrc = `
+{{ define "content" }}
+
+<form action="/search" method="GET">
+<table class="form">
+	<tr>
+		<th><label for="q">Search:</label></th>
+		<td><input type="text" name="q" id="q" value="{{ .Query }}" required></td>
+	</tr>
+	<tr>
+		<th><label for="in">In:</label></th>
+		<td>
+			<select name="in" id="in">
+				<option value=""{{ if not .In }} selected{{ end }}>Everything</option>
+				<option value="topic"{{ if eq .In "topic" }} selected{{ end }}>Topics</option>
+				<option value="comment"{{ if eq .In "comment" }} selected{{ end }}>Comments</option>
+				{{ if .Common.UserName }}
+				<option value="message"{{ if eq .In "message" }} selected{{ end }}>Private messages</option>
+				{{ end }}
+			</select>
+		</td>
+	</tr>
+	<tr>
+		<th><label for="group">Group (optional):</label></th>
+		<td><input type="text" name="group" id="group" value="{{ .Group }}"></td>
+	</tr>
+	<tr>
+		<th><label for="author">Author (optional):</label></th>
+		<td><input type="text" name="author" id="author" value="{{ .Author }}"></td>
+	</tr>
+	<tr>
+		<th><label for="from">From (optional):</label></th>
+		<td><input type="date" name="from" id="from" value="{{ .FromDate }}" placeholder="YYYY-MM-DD"></td>
+	</tr>
+	<tr>
+		<th><label for="to">To (optional):</label></th>
+		<td><input type="date" name="to" id="to" value="{{ .ToDate }}" placeholder="YYYY-MM-DD"></td>
+	</tr>
+	<tr>
+		<th></th>
+		<td><input type="submit" value="Search"></td>
+	</tr>
+</table>
+</form>
+
+{{ if .IsSearched }}
+{{ if .Results }}
+<div style="margin-top: 30px;">
+{{ range .Results }}
+	<div class="topic-row">
+		<div><a href="{{ .URL }}">{{ if eq .Kind "message" }}Message from {{ .UserName }} to {{ .ToName }}{{ else if eq .Kind "comment" }}Comment on {{ .Title }}{{ else }}{{ .Title }}{{ end }}</a></div>
+		<div>{{ .Snippet }}</div>
+		<div class="muted">
+			{{ if eq .Kind "message" }}
+			{{ .CreatedDate }}
+			{{ else }}
+			<a href="/users?u={{ .UserName }}">{{ .UserName }}</a> in <a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a> {{ .CreatedDate }}
+			{{ end }}
+		</div>
+	</div>
+	<hr class="sep">
+{{ end }}
+</div>
+{{ else }}
+<div class="row">
+	<div class="muted">No results.</div>
+</div>
+{{ end }}
+{{ end }}
+
+{{ if .NextURL }}
+<div class="row">
+	<div><a href="{{ .NextURL }}">More</a></div>
+</div>
+{{ end }}
+
+{{ end }}`
@@ -30,6 +30,12 @@ const signupSrc = `
 		<th><label for="confirm">Confirm password:</label></th>
 		<td><input type="password" name="confirm" id="confirm" required></td>
 	</tr>
+	{{ if or .IsInviteOnly .Invite }}
+	<tr>
+		<th><label for="invite">Invite code:</label></th>
+		<td><input type="text" name="invite" id="invite" value="{{ .Invite }}"{{ if .IsInviteOnly }} required{{ end }}></td>
+	</tr>
+	{{ end }}
 	<tr>
 		<th><label for="email">Email (optional):</label></th>
 		<td><input type="text" name="email" id="email"></td>
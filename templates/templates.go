@@ -16,6 +16,15 @@ func init() {
 	tmpls["adminindex.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["adminindex.html"].New("adminindex").Parse(adminindexSrc))
 
+	tmpls["adminlogins.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["adminlogins.html"].New("adminlogins").Parse(adminloginsSrc))
+
+	tmpls["adminblocklist.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["adminblocklist.html"].New("adminblocklist").Parse(adminblocklistSrc))
+
+	tmpls["adminmail.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["adminmail.html"].New("adminmail").Parse(adminmailSrc))
+
 	tmpls["changepass.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["changepass.html"].New("changepass").Parse(changepassSrc))
 
@@ -37,6 +46,12 @@ func init() {
 	tmpls["groupedit.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["groupedit.html"].New("groupedit").Parse(groupeditSrc))
 
+	tmpls["groupmembers.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["groupmembers.html"].New("groupmembers").Parse(groupmembersSrc))
+
+	tmpls["groupprivate.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["groupprivate.html"].New("groupprivate").Parse(groupprivateSrc))
+
 	tmpls["groups.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["groups.html"].New("groups").Parse(groupindexSrc))
 
@@ -46,21 +61,45 @@ func init() {
 	tmpls["login.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["login.html"].New("login").Parse(loginSrc))
 
+	tmpls["login2fa.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["login2fa.html"].New("login2fa").Parse(login2faSrc))
+
+	tmpls["notifications.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["notifications.html"].New("notifications").Parse(notificationsSrc))
+
 	tmpls["profile.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["profile.html"].New("profile").Parse(profileSrc))
 
+	tmpls["profile2fa.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["profile2fa.html"].New("profile2fa").Parse(profile2faSrc))
+
 	tmpls["profilecomments.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["profilecomments.html"].New("profilecomments").Parse(profilecommentsSrc))
 
+	tmpls["profilepasskeys.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["profilepasskeys.html"].New("profilepasskeys").Parse(profilepasskeysSrc))
+
 	tmpls["profiletopics.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["profiletopics.html"].New("profiletopics").Parse(profiletopicsSrc))
 
 	tmpls["profilegroups.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["profilegroups.html"].New("profilegroups").Parse(profilegroupsSrc))
 
+	tmpls["profiletokens.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["profiletokens.html"].New("profiletokens").Parse(profiletokensSrc))
+
+	tmpls["profilesessions.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["profilesessions.html"].New("profilesessions").Parse(profilesessionsSrc))
+
+	tmpls["profileinvites.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["profileinvites.html"].New("profileinvites").Parse(profileinvitesSrc))
+
 	tmpls["resetpass.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["resetpass.html"].New("resetpass").Parse(resetpassSrc))
 
+	tmpls["search.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["search.html"].New("search").Parse(searchSrc))
+
 	tmpls["signup.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["signup.html"].New("signup").Parse(signupSrc))
 
@@ -70,6 +109,27 @@ func init() {
 	tmpls["topicindex.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["topicindex.html"].New("topicindex").Parse(topicindexSrc))
 
+	tmpls["reportnew.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["reportnew.html"].New("reportnew").Parse(reportnewSrc))
+
+	tmpls["reports.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["reports.html"].New("reports").Parse(reportsSrc))
+
+	tmpls["auditlog.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["auditlog.html"].New("auditlog").Parse(auditlogSrc))
+
+	tmpls["pending.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["pending.html"].New("pending").Parse(pendingSrc))
+
+	tmpls["groupbans.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["groupbans.html"].New("groupbans").Parse(groupbansSrc))
+
+	tmpls["admininvites.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["admininvites.html"].New("admininvites").Parse(admininvitesSrc))
+
+	tmpls["verifyemail.html"] = template.Must(template.New("base").Parse(baseSrc))
+	template.Must(tmpls["verifyemail.html"].New("verifyemail").Parse(verifyemailSrc))
+
 	tmpls["pm.html"] = template.Must(template.New("base").Parse(baseSrc))
 	template.Must(tmpls["pm.html"].New("pm").Parse(pmSrc))
 }
@@ -50,7 +50,7 @@ const topiceditSrc = `
 					<input type="submit" name="action" value="Close">
 					{{ end }}
 					<input type="submit" name="action" value="Delete">
-				{{ else }}
+				{{ else if or .IsMod .IsAdmin .IsSuperAdmin }}
 					<input type="submit" name="action" value="Undelete">
 				{{ end }}
 			{{ else }}
@@ -29,8 +29,9 @@ const topicindexSrc = `
 	{{ end }}
 </div>
 
-<h2 id="title"><a href="/topics?id={{ .TopicID }}">{{ .TopicName }}{{ if .IsClosed }} [closed]{{ end }}</a></h2>
-<div class="comment-title muted"><a href="/users?u={{ .OwnerName }}">{{ .OwnerName }}</a> in <a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a> {{ .CreatedDate }}</div>
+<h2 id="title"><a href="/topics?id={{ .TopicID }}">{{ .TopicName }}{{ if .IsClosed }} [closed]{{ end }}{{ if .IsPending }} [awaiting approval]{{ end }}</a></h2>
+<div class="comment-title muted"><a href="/users?u={{ .OwnerName }}">{{ .OwnerName }}</a> in <a href="/groups?name={{ .GroupName }}">{{ .GroupName }}</a> {{ .CreatedDate }}
+	| <a href="/reports/new?kind=topic&id={{ .TopicID }}">report</a></div>
 <div class="comment-row">
 	<div class="comment">
 		<p>{{ .Content }}</p>
@@ -38,15 +39,22 @@ const topicindexSrc = `
 </div>
 <hr class="sep">
 
+<div class="muted">
+	View: {{ if .IsThreaded }}<a href="/topics?id={{ .TopicID }}">flat</a> | threaded{{ else }}flat | <a href="/topics?id={{ .TopicID }}&view=threaded">threaded</a>{{ end }}
+</div>
+
 {{ if .Comments }}
 {{ range .Comments }}
-<div class="comment-row" id="comment-{{ .ID }}">
+<div class="comment-row" id="comment-{{ .ID }}"{{ if $.IsThreaded }} style="margin-left: {{ .Indent }}px;"{{ end }}>
 	<div class="comment-title muted">
 		<a href="/users?u={{ .UserName }}">{{ .UserName }}</a>
 		<a href="/comments?id={{ .ID }}">{{ .CreatedDate }}</a>
+		{{ if and .ParentID (not $.IsThreaded) }} in reply to <a href="/comments?id={{ .ParentID }}">{{ .ParentUserName }}</a>{{ end }}
+		{{ if .IsPending }} [awaiting approval]{{ end }}
 		{{ if or .IsOwner $.IsAdmin $.IsMod $.IsSuperAdmin }} | <a href="/comments/edit?id={{ .ID }}">edit</a>{{end}}
+		{{ if and (not .IsDeleted) (not $.IsClosed) }} | <a href="/comments/new?tid={{ $.TopicID }}&parent={{ .ID }}">reply</a>{{ end }}
 		{{ if not .IsDeleted }} | <a href="/comments/new?tid={{ $.TopicID }}&quote={{ .ID }}">quote</a>{{ end }}
-		| <a href="/pm?flag={{ .ID }}#end">flag</a>
+		{{ if not .IsDeleted }} | <a href="/reports/new?kind=comment&id={{ .ID }}">report</a>{{ end }}
 	</div>
 	{{ if .IsDeleted }}
 		<div class="comment">[DELETED]</div>
@@ -54,6 +62,7 @@ const topicindexSrc = `
 		<div class="comment">{{ .Content }}</div>
 		{{ if .ImgSrc }}<div><img src="/img?name={{ .ImgSrc }}"></div>{{ end }}
 	{{ end }}
+	{{ if .NumHidden }}<div class="muted"><a href="/comments?id={{ .ID }}">Continue this thread ({{ .NumHidden }} more)</a></div>{{ end }}
 </div>
 <hr class="sep">
 {{ end }}
@@ -71,7 +80,7 @@ const topicindexSrc = `
 		{{ if eq $i $.CurrentPage }}
 		{{ $i }}
 		{{ else }}
-		<a href="/topics?id={{ $.TopicID }}&p={{ $i }}">{{ $i }}</a>
+		<a href="/topics?id={{ $.TopicID }}&p={{ $i }}{{ if $.IsThreaded }}&view=threaded{{ end }}">{{ $i }}</a>
 		{{ end }}
 	{{ end }}
 	</div>
@@ -79,7 +88,7 @@ const topicindexSrc = `
 
 {{ if not .IsLastPage }}
 <div>
-	<div><a href="/topics?id={{ .TopicID }}&p={{ .NextPage }}">Next Page</a></div>
+	<div><a href="/topics?id={{ .TopicID }}&p={{ .NextPage }}{{ if .IsThreaded }}&view=threaded{{ end }}">Next Page</a></div>
 </div>
 {{ end }}
 
@@ -0,0 +1,35 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package templates
+
+const verifyemailSrc = `
+{{ define "content" }}
+
+<form action="/users/verifyemail" method="POST">
+<input type="hidden" name="csrf" value={{ .Common.CSRF }}>
+<input type="hidden" name="t" value={{ .Token }}>
+<table class="form">
+	<tr>
+		<th>Username:</th>
+		<td>{{ .UserName }}</td>
+	</tr>
+	<tr>
+		<th>E-mail:</th>
+		<td>{{ .Email }}</td>
+	</tr>
+{{ if .Common.Msg }}
+	<tr>
+		<th></th>
+		<td><span class="alert">{{ .Common.Msg }}</span></td>
+	</tr>
+{{ end }}
+	<tr>
+		<th></th>
+		<td><input type="submit" value="Confirm e-mail address"></td>
+	</tr>
+</table>
+</form>
+
+{{ end }}`
@@ -0,0 +1,80 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+)
+
+// IsPasswdBreached reports whether passwd is in the breached password list at path. The
+// list has one uppercase hex SHA-1 hash per line, optionally followed by ":" and a count,
+// sorted by hash like the "ordered by hash" download of Have I Been Pwned. The file is
+// binary searched, so it is never read into memory.
+func IsPasswdBreached(path string, passwd string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	sum := sha1.Sum([]byte(passwd))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// Find the first line starting at or after an offset in [lo, hi) whose hash is >= hash.
+	lo, hi := int64(0), fi.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, err := lineAfter(f, mid)
+		if err != nil {
+			return false, err
+		}
+		if line == "" || lineHash(line) >= hash {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	line, err := lineAfter(f, lo)
+	if err != nil {
+		return false, err
+	}
+	return line != "" && lineHash(line) == hash, nil
+}
+
+// lineAfter returns the first complete line that starts at or after off, or "" at the end
+// of the file. A line starts at 0 or right after a newline.
+func lineAfter(f *os.File, off int64) (string, error) {
+	if off > 0 {
+		off--
+	}
+	r := bufio.NewReader(io.NewSectionReader(f, off, 1<<62))
+	if off > 0 {
+		if _, err := r.ReadString('\n'); err == io.EOF {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func lineHash(line string) string {
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	return strings.ToUpper(strings.TrimSpace(line))
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIsPasswdBreached(t *testing.T) {
+	var breached []string
+	for i := 0; i < 500; i++ {
+		breached = append(breached, fmt.Sprintf("breached%d", i))
+	}
+	var lines []string
+	for i, passwd := range breached {
+		sum := sha1.Sum([]byte(passwd))
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), i+1))
+	}
+	sort.Strings(lines)
+	dir, _ := ioutil.TempDir("", "orangeforum-breached")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "breached.txt")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, passwd := range breached {
+		if ok, err := IsPasswdBreached(path, passwd); !ok || err != nil {
+			t.Errorf("IsPasswdBreached(%q) = %v, %v; want true", passwd, ok, err)
+		}
+	}
+	for _, passwd := range []string{"", "breached500", "correct horse battery staple"} {
+		if ok, err := IsPasswdBreached(path, passwd); ok || err != nil {
+			t.Errorf("IsPasswdBreached(%q) = %v, %v; want false", passwd, ok, err)
+		}
+	}
+	if _, err := IsPasswdBreached(filepath.Join(dir, "missing.txt"), "breached0"); err == nil {
+		t.Errorf("No error for a missing list")
+	}
+}
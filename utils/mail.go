@@ -5,37 +5,144 @@
 package utils
 
 import (
+	"errors"
 	"github.com/s-gv/orangeforum/models"
 	"log"
-	"net/smtp"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
 )
 
+// A Mailer delivers e-mail. Deliver is called by the mail queue workers, and a returned
+// error means the e-mail is retried later.
+type Mailer interface {
+	Deliver(to string, subject string, body string) error
+}
+
+var (
+	mailer   Mailer = LogMailer{}
+	mailerMu sync.RWMutex
+)
+
+var (
+	maxMailAttempts  = 8
+	mailRetryDelay   = 30 * time.Second
+	maxMailRetry     = 6 * time.Hour
+	mailPollInterval = 5 * time.Second
+	mailBatchSize    = 100
+)
+
+func SetMailer(m Mailer) {
+	mailerMu.Lock()
+	mailer = m
+	mailerMu.Unlock()
+}
+
+func CurrentMailer() Mailer {
+	mailerMu.RLock()
+	defer mailerMu.RUnlock()
+	return mailer
+}
+
+// NewMailer returns the Mailer described by spec: "smtp" sends e-mail with the SMTP
+// settings from the admin page, "maildir:<dir>" writes e-mail to a maildir, and "log"
+// writes e-mail to the log.
+func NewMailer(spec string) (Mailer, error) {
+	switch {
+	case spec == "smtp":
+		return NewSMTPMailer(), nil
+	case spec == "log":
+		return LogMailer{}, nil
+	case strings.HasPrefix(spec, "maildir:"):
+		return NewMaildirMailer(strings.TrimPrefix(spec, "maildir:"))
+	}
+	return nil, errors.New("Unknown mailer: " + spec)
+}
+
+// SendMail queues an e-mail. It is delivered in the background by the mail queue.
 func SendMail(to string, sub string, body string) {
-	go func(to string, sub string, body string) {
-		smtpHost := models.Config(models.SMTPHost)
-		from := models.Config(models.DefaultFromMail)
-		if from != "" && smtpHost != "" {
-			smtpUser := models.Config(models.SMTPUser)
-			smtpPass := models.Config(models.SMTPPass)
-			auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
-			msg := []byte("From: " + models.Config(models.ForumName) + "<" + from + ">\r\n" +
-				"To: " + to + "\r\n" +
-				"Subject: " + sub + "\r\n" +
-				"\r\n" +
-				body + "\r\n")
-			var err error
-			if smtpUser != "" {
-				err = smtp.SendMail(models.Config(models.SMTPHost)+":"+models.Config(models.SMTPPort), auth, from, []string{to}, msg)
-			} else {
-				err = smtp.SendMail(models.Config(models.SMTPHost)+":"+models.Config(models.SMTPPort), nil, from, []string{to}, msg)
-			}
+	models.EnqueueMail(to, sub, body)
+}
 
-			if err != nil {
-				log.Printf("[ERROR] Error sending mail: %s\n", err)
-			}
-		} else {
-			log.Printf("[ERROR] SMTP not configured.\n")
+// StartMailQueue starts numWorkers workers that deliver queued e-mail with the current Mailer.
+func StartMailQueue(numWorkers int) {
+	go func() {
+		for {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						log.Printf("[ERROR] Error in mail queue: %s\n[INFO] Debug stack: %s\n", r, debug.Stack())
+					}
+				}()
+				// Keep going while there is a backlog.
+				for processMailQueue(time.Now(), numWorkers) == mailBatchSize {
+					log.Printf("[INFO] Mail queue has a backlog.\n")
+				}
+			}()
+			time.Sleep(mailPollInterval)
 		}
+	}()
+}
+
+// processMailQueue delivers the e-mails due at now and returns the number of e-mails tried.
+func processMailQueue(now time.Time, numWorkers int) int {
+	mails := models.ReadDueMails(now.Unix(), mailBatchSize)
+	m := CurrentMailer()
+	jobs := make(chan models.QueuedMail)
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for mail := range jobs {
+				deliverMail(m, mail, now)
+			}
+		}()
+	}
+	for _, mail := range mails {
+		jobs <- mail
+	}
+	close(jobs)
+	wg.Wait()
+	return len(mails)
+}
+
+// mailRetryAfter returns how long to wait before retrying an e-mail that has failed
+// attempts times. The delay doubles with every attempt.
+func mailRetryAfter(attempts int) time.Duration {
+	d := mailRetryDelay
+	for i := 1; i < attempts && d < maxMailRetry; i++ {
+		d *= 2
+	}
+	if d > maxMailRetry {
+		d = maxMailRetry
+	}
+	return d
+}
+
+func deliverMail(m Mailer, mail models.QueuedMail, now time.Time) {
+	err := m.Deliver(mail.To, mail.Subject, mail.Body)
+	if err == nil {
+		models.DeleteMail(mail.ID)
+		return
+	}
+	attempts := mail.Attempts + 1
+	isDead := attempts >= maxMailAttempts
+	if isDead {
+		log.Printf("[ERROR] Giving up on mail to %s after %d attempts: %s\n", mail.To, attempts, err)
+	} else {
+		log.Printf("[ERROR] Error sending mail to %s (attempt %d): %s\n", mail.To, attempts, err)
+	}
+	models.UpdateMailFailed(mail.ID, attempts, now.Add(mailRetryAfter(attempts)).Unix(), err.Error(), isDead)
+}
 
-	}(to, sub, body)
+// formatMail returns the message for an e-mail from the forum.
+func formatMail(from string, to string, sub string, body string) []byte {
+	return []byte("From: " + models.Config(models.ForumName) + "<" + from + ">\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + sub + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"\r\n" +
+		body + "\r\n")
 }
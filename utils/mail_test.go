@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	db.Init("sqlite3", "file::memory:?cache=shared")
+	models.Migrate()
+	os.Exit(m.Run())
+}
+
+type failingMailer struct{}
+
+func (m failingMailer) Deliver(to string, sub string, body string) error {
+	return errors.New("connection refused")
+}
+
+func TestMailRetries(t *testing.T) {
+	SetMailer(failingMailer{})
+	defer SetMailer(LogMailer{})
+
+	SendMail("retry@example.com", "Retry", "Body")
+	now := time.Now()
+	for i := 1; i <= maxMailAttempts; i++ {
+		if n := processMailQueue(now, 2); n != 1 {
+			t.Fatalf("Attempt %d: processed %d mails", i, n)
+		}
+		if n := processMailQueue(now, 2); n != 0 {
+			t.Errorf("Attempt %d: mail retried before backoff: %d", i, n)
+		}
+		now = now.Add(mailRetryAfter(i))
+	}
+	failed := models.ReadFailedMails(10)
+	if len(failed) != 1 || failed[0].Status != models.MailDead || failed[0].LastError != "connection refused" {
+		t.Fatalf("Mail not dead after %d attempts: %+v", maxMailAttempts, failed)
+	}
+	if n := processMailQueue(now.Add(24*time.Hour), 2); n != 0 {
+		t.Errorf("Dead mail retried: %d", n)
+	}
+	models.RetryMail(failed[0].ID)
+	SetMailer(LogMailer{})
+	if n := processMailQueue(time.Now(), 2); n != 1 || len(models.ReadFailedMails(10)) != 0 {
+		t.Errorf("Retried mail not sent: %d", n)
+	}
+	if mailRetryAfter(1) != mailRetryDelay || mailRetryAfter(2) != 2*mailRetryDelay || mailRetryAfter(100) != maxMailRetry {
+		t.Errorf("Unexpected backoff")
+	}
+}
+
+// serveSMTP accepts one SMTP session on l and sends the message data on msgs.
+func serveSMTP(l net.Listener, msgs chan<- string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	conn.Write([]byte("220 localhost ESMTP\r\n"))
+	data := ""
+	inData := false
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if inData {
+			if line == ".\r\n" {
+				inData = false
+				msgs <- data
+				conn.Write([]byte("250 OK\r\n"))
+			} else {
+				data += line
+			}
+			continue
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			conn.Write([]byte("250 localhost\r\n"))
+		case cmd == "DATA":
+			inData = true
+			conn.Write([]byte("354 Go ahead\r\n"))
+		case cmd == "QUIT":
+			conn.Write([]byte("221 Bye\r\n"))
+			return
+		default:
+			conn.Write([]byte("250 OK\r\n"))
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	defer l.Close()
+	msgs := make(chan string, 1)
+	go serveSMTP(l, msgs)
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	SetMailer(&SMTPMailer{Host: host, Port: port, From: "forum@example.com"})
+	defer SetMailer(LogMailer{})
+
+	SendMail("smtp@example.com", "Hello over SMTP", "Body")
+	if n := processMailQueue(time.Now(), 1); n != 1 {
+		t.Fatalf("Processed %d mails", n)
+	}
+	select {
+	case msg := <-msgs:
+		if !strings.Contains(msg, "Subject: Hello over SMTP") || !strings.Contains(msg, "To: smtp@example.com") {
+			t.Errorf("Unexpected message: %s", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SMTP server did not get the message")
+	}
+	if len(models.ReadDueMails(time.Now().Unix(), 10)) != 0 {
+		t.Errorf("Sent mail still queued")
+	}
+}
+
+func TestMaildirMailer(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "orangeforum-maildir")
+	defer os.RemoveAll(dir)
+	m, err := NewMailer("maildir:" + dir)
+	if err != nil {
+		t.Fatalf("Error creating maildir mailer: %s", err)
+	}
+	if err := m.Deliver("maildir@example.com", "Hello maildir", "Body"); err != nil {
+		t.Fatalf("Error delivering: %s", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "new", "*"))
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 file in maildir, got %d", len(files))
+	}
+	if b, _ := ioutil.ReadFile(files[0]); !strings.Contains(string(b), "Subject: Hello maildir") {
+		t.Errorf("Unexpected message: %s", b)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP codes (RFC 6238) with the parameters every authenticator app supports:
+// HMAC-SHA1, 6 digits and a 30 second period.
+const totpPeriod = 30
+const totpDigits = 6
+
+// totpSkew is the number of periods before and after the current one whose codes are
+// accepted, to allow for clock drift.
+const totpSkew = 1
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random base32 encoded secret.
+func NewTOTPSecret() string {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return totpEncoding.EncodeToString(key)
+}
+
+// TOTPCode returns the code of secret for the period step.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	n := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", n%1000000), nil
+}
+
+// ValidateTOTP checks code against secret at the time now, and returns the period the
+// code belongs to. Callers should reject a period that was already used.
+func ValidateTOTP(secret string, code string, now time.Time) (int64, bool) {
+	code = strings.Replace(code, " ", "", -1)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	cur := now.Unix() / totpPeriod
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		want, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPURI returns the otpauth:// URI that authenticator apps import.
+func TOTPURI(issuer string, account string, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("period", fmt.Sprint(totpPeriod))
+	v.Set("digits", fmt.Sprint(totpDigits))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + v.Encode()
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// The SHA1 test vectors of RFC 6238, truncated to 6 digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	for _, c := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	} {
+		if code, err := TOTPCode(secret, c.unix/totpPeriod); err != nil || code != c.code {
+			t.Errorf("TOTPCode at %d = %s, %v; want %s", c.unix, code, err, c.code)
+		}
+	}
+
+	now := time.Unix(1111111111, 0)
+	if step, ok := ValidateTOTP(secret, "050 471", now); !ok || step != 1111111111/totpPeriod {
+		t.Errorf("Current code rejected: %d, %v", step, ok)
+	}
+	if _, ok := ValidateTOTP(secret, "081804", now); !ok {
+		t.Errorf("Code of the previous period rejected")
+	}
+	if _, ok := ValidateTOTP(secret, "287082", now); ok {
+		t.Errorf("Stale code accepted")
+	}
+
+	uri := TOTPURI("My Forum", "alice", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/My%20Forum:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("Unexpected URI: %s", uri)
+	}
+	if s := NewTOTPSecret(); len(s) != 32 {
+		t.Errorf("Unexpected secret: %s", s)
+	}
+}
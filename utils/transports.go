@@ -0,0 +1,80 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package utils
+
+import (
+	"errors"
+	"github.com/s-gv/orangeforum/models"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// SMTPMailer sends e-mail through an SMTP server. Authentication is used only if User is set.
+type SMTPMailer struct {
+	Host string
+	Port string
+	User string
+	Pass string
+	From string
+}
+
+// NewSMTPMailer returns an SMTPMailer with the settings from the admin page.
+func NewSMTPMailer() *SMTPMailer {
+	return &SMTPMailer{
+		Host: models.Config(models.SMTPHost),
+		Port: models.Config(models.SMTPPort),
+		User: models.Config(models.SMTPUser),
+		Pass: models.Config(models.SMTPPass),
+		From: models.Config(models.DefaultFromMail),
+	}
+}
+
+func (m *SMTPMailer) Deliver(to string, sub string, body string) error {
+	if m.From == "" || m.Host == "" {
+		return errors.New("SMTP not configured")
+	}
+	var auth smtp.Auth
+	if m.User != "" {
+		auth = smtp.PlainAuth("", m.User, m.Pass, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, formatMail(m.From, to, sub, body))
+}
+
+// MaildirMailer writes each e-mail to a file in the "new" directory of a maildir.
+type MaildirMailer struct {
+	Dir string
+}
+
+func NewMaildirMailer(dir string) (*MaildirMailer, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &MaildirMailer{Dir: dir}, nil
+}
+
+func (m *MaildirMailer) Deliver(to string, sub string, body string) error {
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "." + strconv.Itoa(os.Getpid()) + "_" + strconv.Itoa(rand.Int()) + ".orangeforum"
+	tmpPath := filepath.Join(m.Dir, "tmp", name)
+	if err := ioutil.WriteFile(tmpPath, formatMail(models.Config(models.DefaultFromMail), to, sub, body), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(m.Dir, "new", name))
+}
+
+// LogMailer writes e-mail to the log instead of sending it.
+type LogMailer struct{}
+
+func (m LogMailer) Deliver(to string, sub string, body string) error {
+	log.Printf("[INFO] Mail to %s. Subject: %s\n%s\n", to, sub, body)
+	return nil
+}
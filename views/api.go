@@ -0,0 +1,747 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The JSON API lives under /api/v1. Responses are JSON objects, and errors have the
+// form {"error": "<message>"} with an appropriate status code. Lists are paginated
+// with a cursor: pass the "next_cursor" of a response as the "cursor" parameter to
+// get the next page. "next_cursor" is absent on the last page.
+
+var apiTopicsPerPage = 30
+var apiCommentsPerPage = 50
+var apiMessagesPerPage = 50
+
+type apiGroup struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	HeaderMsg   string `json:"header_msg,omitempty"`
+	IsPrivate   bool   `json:"is_private"`
+	IsClosed    bool   `json:"is_closed"`
+}
+
+type apiTopic struct {
+	ID           int64  `json:"id"`
+	GroupID      int64  `json:"group_id"`
+	GroupName    string `json:"group_name"`
+	Author       string `json:"author"`
+	Title        string `json:"title"`
+	Content      string `json:"content"`
+	IsSticky     bool   `json:"is_sticky"`
+	IsClosed     bool   `json:"is_closed"`
+	IsPending    bool   `json:"is_pending"`
+	NumComments  int    `json:"num_comments"`
+	CreatedDate  int64  `json:"created_date"`
+	UpdatedDate  int64  `json:"updated_date"`
+	ActivityDate int64  `json:"activity_date"`
+}
+
+type apiComment struct {
+	ID          int64  `json:"id"`
+	TopicID     int64  `json:"topic_id"`
+	ParentID    int64  `json:"parent_id,omitempty"`
+	Author      string `json:"author"`
+	Content     string `json:"content"`
+	Image       string `json:"image,omitempty"`
+	IsSticky    bool   `json:"is_sticky"`
+	IsPending   bool   `json:"is_pending"`
+	CreatedDate int64  `json:"created_date"`
+	UpdatedDate int64  `json:"updated_date"`
+}
+
+type apiMessage struct {
+	ID          int64  `json:"id"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Content     string `json:"content"`
+	IsRead      bool   `json:"is_read"`
+	CreatedDate int64  `json:"created_date"`
+}
+
+type apiUser struct {
+	UserName     string `json:"username"`
+	About        string `json:"about"`
+	Email        string `json:"email,omitempty"`
+	PendingEmail string `json:"pending_email,omitempty"`
+	IsBanned     bool   `json:"is_banned"`
+	IsSuperAdmin bool   `json:"is_superadmin"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// writePermsError writes the response for an error returned by readTopicPerms or readCommentPerms.
+func writePermsError(w http.ResponseWriter, err error) {
+	if err == errNotFound {
+		writeJSONError(w, http.StatusNotFound, "Not found.")
+	} else {
+		writeJSONError(w, http.StatusForbidden, "Forbidden.")
+	}
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(v); err != nil {
+		return errors.New("Invalid JSON in request body.")
+	}
+	return nil
+}
+
+// API wraps the handlers of the JSON API. Unlike UA, it never creates a session. A
+// request is authenticated with an API token ("Authorization: Bearer <token>") or with
+// the session cookie. With the cookie, requests that change state must send the
+// csrftoken cookie's value in the X-CSRF-Token header.
+func API(handler func(w http.ResponseWriter, r *http.Request, sess Session)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Printf("[INFO] Recovered from panic: %s\n[INFO] Debug stack: %s\n", rec, debug.Stack())
+				writeJSONError(w, http.StatusInternalServerError, "Internal server error. This event has been logged.")
+			}
+		}()
+		sess, isToken, err := readTokenSession(r)
+		if isToken {
+			if err != nil {
+				writeJSONError(w, http.StatusUnauthorized, "Invalid API token.")
+				return
+			}
+			if !sess.HasScope(requestScope(r)) {
+				writeJSONError(w, http.StatusForbidden, "API token does not have the "+requestScope(r)+" scope.")
+				return
+			}
+		} else if sess, err = readSession(r); err != nil {
+			sess = Session{}
+		}
+		if r.Method != "GET" && r.Method != "HEAD" {
+			if !sess.UserID.Valid {
+				writeJSONError(w, http.StatusUnauthorized, "Login required.")
+				return
+			}
+			if !sess.IsToken && r.Header.Get("X-CSRF-Token") != sess.CSRFToken {
+				writeJSONError(w, http.StatusForbidden, "Invalid CSRF token.")
+				return
+			}
+			if models.Config(models.ReadOnlyMode) != "0" && !sess.IsUserSuperAdmin() {
+				writeJSONError(w, http.StatusForbidden, "Forum is in read-only mode.")
+				return
+			}
+		}
+		handler(w, r, sess)
+	}
+}
+
+// APIGroupsHandler lists the groups visible to the user, or returns the group named by the "name" parameter.
+var APIGroupsHandler = API(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	if r.Method != "GET" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+	if name := r.FormValue("name"); name != "" {
+		g := apiGroup{}
+		if db.QueryRow(`SELECT id, name, description, header_msg, is_private, is_closed FROM groups WHERE name=?;`, name).Scan(
+			&g.ID, &g.Name, &g.Description, &g.HeaderMsg, &g.IsPrivate, &g.IsClosed) != nil {
+			writeJSONError(w, http.StatusNotFound, "Group not found.")
+			return
+		}
+		if !sess.CanViewGroup(strconv.FormatInt(g.ID, 10)) {
+			writeJSONError(w, http.StatusForbidden, "This group is private.")
+			return
+		}
+		g.Description = censor(g.Description)
+		g.HeaderMsg = censor(g.HeaderMsg)
+		writeJSON(w, http.StatusOK, g)
+		return
+	}
+	groups := []apiGroup{}
+	rows := db.Query(`SELECT id, name, description, is_private, is_closed FROM groups WHERE is_closed=0 AND `+models.VisibleGroupsSQL+` ORDER BY name;`,
+		sess.IsUserSuperAdmin(), sess.UserID)
+	for rows.Next() {
+		g := apiGroup{}
+		rows.Scan(&g.ID, &g.Name, &g.Description, &g.IsPrivate, &g.IsClosed)
+		g.Description = censor(g.Description)
+		groups = append(groups, g)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"groups": groups})
+})
+
+func readAPITopic(topicID string) (apiTopic, error) {
+	t := apiTopic{}
+	if db.QueryRow(`SELECT topics.id, topics.groupid, groups.name, users.username, topics.title, topics.content, topics.is_sticky, topics.is_closed,
+		topics.is_pending, topics.num_comments, topics.created_date, topics.updated_date, topics.activity_date
+		FROM topics INNER JOIN groups ON groups.id=topics.groupid INNER JOIN users ON users.id=topics.userid
+		WHERE topics.id=? AND topics.is_deleted=0;`, topicID).Scan(
+		&t.ID, &t.GroupID, &t.GroupName, &t.Author, &t.Title, &t.Content, &t.IsSticky, &t.IsClosed,
+		&t.IsPending, &t.NumComments, &t.CreatedDate, &t.UpdatedDate, &t.ActivityDate) != nil {
+		return t, errNotFound
+	}
+	t.Title = censor(t.Title)
+	t.Content = censor(t.Content)
+	return t, nil
+}
+
+// APITopicsHandler reads, creates, updates and deletes topics.
+//
+//	GET    ?id=<topic id>                  a topic
+//	GET    ?gid=<group id>[&cursor=...]    the topics in a group, most recently active first
+//	POST   {"group_id", "title", "content", "is_sticky"}
+//	PATCH  ?id=<topic id> {"title", "content", "is_sticky", "is_closed"}
+//	DELETE ?id=<topic id>
+var APITopicsHandler = API(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	topicID := r.FormValue("id")
+	switch r.Method {
+	case "GET":
+		if topicID == "" {
+			groupID := r.FormValue("gid")
+			var tmp string
+			if db.QueryRow(`SELECT id FROM groups WHERE id=?;`, groupID).Scan(&tmp) != nil {
+				writeJSONError(w, http.StatusNotFound, "Group not found.")
+				return
+			}
+			if !sess.CanViewGroup(groupID) {
+				writeJSONError(w, http.StatusForbidden, "This group is private.")
+				return
+			}
+			cursor, err := strconv.ParseInt(r.FormValue("cursor"), 10, 64)
+			if err != nil || cursor <= 0 {
+				cursor = 1<<62 - 1
+			}
+			topics := []apiTopic{}
+			rows := db.Query(`SELECT topics.id, topics.groupid, groups.name, users.username, topics.title, topics.content, topics.is_sticky, topics.is_closed,
+				topics.num_comments, topics.created_date, topics.updated_date, topics.activity_date
+				FROM topics INNER JOIN groups ON groups.id=topics.groupid INNER JOIN users ON users.id=topics.userid
+				WHERE topics.groupid=? AND topics.is_deleted=0 AND topics.is_pending=0 AND topics.activity_date < ?
+				ORDER BY topics.activity_date DESC LIMIT ?;`, groupID, cursor, apiTopicsPerPage)
+			for rows.Next() {
+				t := apiTopic{}
+				rows.Scan(&t.ID, &t.GroupID, &t.GroupName, &t.Author, &t.Title, &t.Content, &t.IsSticky, &t.IsClosed,
+					&t.NumComments, &t.CreatedDate, &t.UpdatedDate, &t.ActivityDate)
+				t.Title = censor(t.Title)
+				t.Content = censor(t.Content)
+				topics = append(topics, t)
+			}
+			resp := map[string]interface{}{"topics": topics}
+			if len(topics) >= apiTopicsPerPage {
+				resp["next_cursor"] = strconv.FormatInt(topics[len(topics)-1].ActivityDate, 10)
+			}
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		t, err := readAPITopic(topicID)
+		if err != nil || !sess.CanViewGroup(strconv.FormatInt(t.GroupID, 10)) {
+			writeJSONError(w, http.StatusNotFound, "Topic not found.")
+			return
+		}
+		if _, err := readTopicPerms(&sess, topicID); err == errNotFound {
+			writeJSONError(w, http.StatusNotFound, "Topic not found.")
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	case "POST":
+		if err := checkEmailVerified(&sess); err != nil {
+			writeJSONError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		var req struct {
+			GroupID  int64  `json:"group_id"`
+			Title    string `json:"title"`
+			Content  string `json:"content"`
+			IsSticky bool   `json:"is_sticky"`
+		}
+		if err := readJSON(r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		groupID := strconv.FormatInt(req.GroupID, 10)
+		var groupName string
+		isGroupClosed := true
+		if db.QueryRow(`SELECT name, is_closed FROM groups WHERE id=?;`, groupID).Scan(&groupName, &isGroupClosed) != nil {
+			writeJSONError(w, http.StatusNotFound, "Group not found.")
+			return
+		}
+		if isGroupClosed || !sess.CanViewGroup(groupID) {
+			writeJSONError(w, http.StatusForbidden, "Forbidden.")
+			return
+		}
+		if err := checkCanPost(r, &sess, groupID); err != nil {
+			writeJSONError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		title := strings.TrimSpace(req.Title)
+		content := strings.TrimSpace(req.Content)
+		if err := validateTopic(title, content); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		isMod, isAdmin, isSuperAdmin := sess.groupRoles(groupID)
+		isSticky := req.IsSticky && (isMod || isAdmin || isSuperAdmin)
+		isPending := isPostHeld(&sess, groupID)
+		now := time.Now().Unix()
+		db.Exec(`INSERT INTO topics(title, content, userid, groupid, is_sticky, is_pending, ip, created_date, updated_date, activity_date, published_date) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+			title, content, sess.UserID, groupID, isSticky, isPending, remoteIP(r), now, now, now, now)
+		var newTopicID string
+		db.QueryRow(`SELECT id FROM topics WHERE userid=? AND groupid=? ORDER BY id DESC LIMIT 1;`, sess.UserID, groupID).Scan(&newTopicID)
+		if !isPending {
+			publishTopic(r, &sess, groupID, groupName, newTopicID, title, content)
+		}
+		t, _ := readAPITopic(newTopicID)
+		writeJSON(w, http.StatusCreated, t)
+	case "PATCH":
+		perms, err := readTopicPerms(&sess, topicID)
+		if err != nil {
+			writePermsError(w, err)
+			return
+		}
+		if !perms.CanEdit() {
+			writeJSONError(w, http.StatusForbidden, "Forbidden.")
+			return
+		}
+		var req struct {
+			Title    *string `json:"title"`
+			Content  *string `json:"content"`
+			IsSticky *bool   `json:"is_sticky"`
+			IsClosed *bool   `json:"is_closed"`
+		}
+		if err := readJSON(r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if (req.IsSticky != nil || req.IsClosed != nil) && !perms.CanModerate() {
+			writeJSONError(w, http.StatusForbidden, "Only moderators can pin or close topics.")
+			return
+		}
+		if req.Title != nil || req.Content != nil {
+			if err := checkCanPost(r, &sess, perms.GroupID); err != nil {
+				writeJSONError(w, http.StatusForbidden, err.Error())
+				return
+			}
+		}
+		var title, content string
+		var wasSticky bool
+		db.QueryRow(`SELECT title, content, is_sticky FROM topics WHERE id=?;`, topicID).Scan(&title, &content, &wasSticky)
+		oldTitle, oldContent := title, content
+		if req.Title != nil {
+			title = strings.TrimSpace(*req.Title)
+		}
+		if req.Content != nil {
+			content = strings.TrimSpace(*req.Content)
+		}
+		if err := validateTopic(title, content); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Title != nil || req.Content != nil {
+			db.Exec(`UPDATE topics SET title=?, content=?, updated_date=? WHERE id=?;`, title, content, time.Now().Unix(), topicID)
+			notifyTopicModAction(&sess, perms, "edited")
+			if title != oldTitle || content != oldContent {
+				auditTopic(r, &sess, perms, models.AuditTopicEdit, oldTitle+"\n\n"+oldContent, title+"\n\n"+content)
+			}
+		}
+		if req.IsSticky != nil {
+			db.Exec(`UPDATE topics SET is_sticky=? WHERE id=?;`, *req.IsSticky, topicID)
+			if *req.IsSticky != wasSticky {
+				auditTopic(r, &sess, perms, models.AuditTopicSticky, strconv.FormatBool(wasSticky), strconv.FormatBool(*req.IsSticky))
+			}
+		}
+		if req.IsClosed != nil {
+			db.Exec(`UPDATE topics SET is_closed=? WHERE id=?;`, *req.IsClosed, topicID)
+			if *req.IsClosed {
+				notifyTopicModAction(&sess, perms, "closed")
+				auditTopic(r, &sess, perms, models.AuditTopicClose, "", "")
+			} else {
+				notifyTopicModAction(&sess, perms, "reopened")
+				auditTopic(r, &sess, perms, models.AuditTopicReopen, "", "")
+			}
+		}
+		t, err := readAPITopic(topicID)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "Topic not found.")
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	case "DELETE":
+		perms, err := readTopicPerms(&sess, topicID)
+		if err != nil {
+			writePermsError(w, err)
+			return
+		}
+		if !perms.CanEdit() {
+			writeJSONError(w, http.StatusForbidden, "Forbidden.")
+			return
+		}
+		db.Exec(`UPDATE topics SET is_deleted=1 WHERE id=?;`, topicID)
+		notifyTopicModAction(&sess, perms, "deleted")
+		auditTopic(r, &sess, perms, models.AuditTopicDelete, "", "")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+})
+
+func readAPIComment(commentID string) (apiComment, error) {
+	c := apiComment{}
+	var pos int
+	var parentID sql.NullInt64
+	if db.QueryRow(`SELECT comments.id, comments.topicid, comments.parentid, users.username, comments.content, comments.image, comments.pos, comments.is_pending, comments.created_date, comments.updated_date
+		FROM comments INNER JOIN users ON users.id=comments.userid WHERE comments.id=? AND comments.is_deleted=0;`, commentID).Scan(
+		&c.ID, &c.TopicID, &parentID, &c.Author, &c.Content, &c.Image, &pos, &c.IsPending, &c.CreatedDate, &c.UpdatedDate) != nil {
+		return c, errNotFound
+	}
+	c.ParentID = parentID.Int64
+	c.Content = censor(c.Content)
+	c.IsSticky = pos < 0
+	return c, nil
+}
+
+// APICommentsHandler reads, creates, updates and deletes comments.
+//
+//	GET    ?id=<comment id>                a comment
+//	GET    ?tid=<topic id>[&cursor=...]    the comments in a topic, in the order they are shown in the topic
+//	POST   {"topic_id", "parent_id", "content", "is_sticky"}
+//	PATCH  ?id=<comment id> {"content", "is_sticky"}
+//	DELETE ?id=<comment id>
+var APICommentsHandler = API(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	commentID := r.FormValue("id")
+	switch r.Method {
+	case "GET":
+		if commentID == "" {
+			topicID := r.FormValue("tid")
+			var groupID string
+			if db.QueryRow(`SELECT groupid FROM topics WHERE id=? AND is_deleted=0 AND is_pending=0;`, topicID).Scan(&groupID) != nil || !sess.CanViewGroup(groupID) {
+				writeJSONError(w, http.StatusNotFound, "Topic not found.")
+				return
+			}
+			cursor, err := strconv.ParseInt(r.FormValue("cursor"), 10, 64)
+			if err != nil {
+				cursor = -(1<<62 - 1)
+			}
+			comments := []apiComment{}
+			var lastPos int64
+			rows := db.Query(`SELECT comments.id, comments.topicid, comments.parentid, users.username, comments.content, comments.image, comments.pos, comments.created_date, comments.updated_date
+				FROM comments INNER JOIN users ON users.id=comments.userid
+				WHERE comments.topicid=? AND comments.is_deleted=0 AND comments.is_pending=0 AND comments.pos > ? ORDER BY comments.pos LIMIT ?;`, topicID, cursor, apiCommentsPerPage)
+			for rows.Next() {
+				c := apiComment{}
+				var parentID sql.NullInt64
+				rows.Scan(&c.ID, &c.TopicID, &parentID, &c.Author, &c.Content, &c.Image, &lastPos, &c.CreatedDate, &c.UpdatedDate)
+				c.ParentID = parentID.Int64
+				c.Content = censor(c.Content)
+				c.IsSticky = lastPos < 0
+				comments = append(comments, c)
+			}
+			resp := map[string]interface{}{"comments": comments}
+			if len(comments) >= apiCommentsPerPage {
+				resp["next_cursor"] = strconv.FormatInt(lastPos, 10)
+			}
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		c, err := readAPIComment(commentID)
+		var groupID string
+		if err == nil && db.QueryRow(`SELECT groupid FROM topics WHERE id=? AND is_deleted=0;`, c.TopicID).Scan(&groupID) != nil {
+			err = errNotFound
+		}
+		if err != nil || !sess.CanViewGroup(groupID) {
+			writeJSONError(w, http.StatusNotFound, "Comment not found.")
+			return
+		}
+		if _, err := readCommentPerms(&sess, commentID); err == errNotFound {
+			writeJSONError(w, http.StatusNotFound, "Comment not found.")
+			return
+		}
+		writeJSON(w, http.StatusOK, c)
+	case "POST":
+		if err := checkEmailVerified(&sess); err != nil {
+			writeJSONError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		var req struct {
+			TopicID  int64  `json:"topic_id"`
+			ParentID int64  `json:"parent_id"`
+			Content  string `json:"content"`
+			IsSticky bool   `json:"is_sticky"`
+		}
+		if err := readJSON(r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		topicID := strconv.FormatInt(req.TopicID, 10)
+		perms, err := readTopicPerms(&sess, topicID)
+		if err != nil {
+			writePermsError(w, err)
+			return
+		}
+		if perms.IsTopicClosed || perms.IsTopicDeleted {
+			writeJSONError(w, http.StatusForbidden, "This topic is closed.")
+			return
+		}
+		if err := checkCanPost(r, &sess, perms.GroupID); err != nil {
+			writeJSONError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		parentID := ""
+		if req.ParentID != 0 {
+			parentID = strconv.FormatInt(req.ParentID, 10)
+		}
+		parent, err := readParentComment(&sess, topicID, parentID)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Parent comment not found in this topic.")
+			return
+		}
+		content := strings.TrimSpace(req.Content)
+		if err := validateComment(content, false); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var topicName string
+		db.QueryRow(`SELECT title FROM topics WHERE id=?;`, topicID).Scan(&topicName)
+		newPos, _ := createComment(r, &sess, topicID, topicName, parent, content, "", req.IsSticky && perms.CanModerate())
+		var newCommentID string
+		db.QueryRow(`SELECT id FROM comments WHERE topicid=? AND pos=?;`, topicID, newPos).Scan(&newCommentID)
+		c, _ := readAPIComment(newCommentID)
+		writeJSON(w, http.StatusCreated, c)
+	case "PATCH":
+		perms, err := readCommentPerms(&sess, commentID)
+		if err != nil {
+			writePermsError(w, err)
+			return
+		}
+		if !perms.CanEdit() {
+			writeJSONError(w, http.StatusForbidden, "Forbidden.")
+			return
+		}
+		var req struct {
+			Content  *string `json:"content"`
+			IsSticky *bool   `json:"is_sticky"`
+		}
+		if err := readJSON(r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.IsSticky != nil && !perms.CanModerate() {
+			writeJSONError(w, http.StatusForbidden, "Only moderators can pin comments.")
+			return
+		}
+		var content string
+		var pos int
+		db.QueryRow(`SELECT content, pos FROM comments WHERE id=?;`, commentID).Scan(&content, &pos)
+		oldContent, wasSticky := content, pos < 0
+		if req.Content != nil {
+			if err := checkCanPost(r, &sess, perms.GroupID); err != nil {
+				writeJSONError(w, http.StatusForbidden, err.Error())
+				return
+			}
+			content = strings.TrimSpace(*req.Content)
+			if err := validateComment(content, false); err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		if req.IsSticky != nil {
+			pos = stickyPos(pos, *req.IsSticky)
+		}
+		db.Exec(`UPDATE comments SET content=?, pos=?, updated_date=? WHERE id=?;`, content, pos, time.Now().Unix(), commentID)
+		if req.Content != nil {
+			notifyCommentModAction(&sess, perms, commentID, "edited")
+			if content != oldContent {
+				auditComment(r, &sess, perms, commentID, models.AuditCommentEdit, oldContent, content)
+			}
+		}
+		if req.IsSticky != nil && *req.IsSticky != wasSticky {
+			auditComment(r, &sess, perms, commentID, models.AuditCommentSticky, strconv.FormatBool(wasSticky), strconv.FormatBool(*req.IsSticky))
+		}
+		c, err := readAPIComment(commentID)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "Comment not found.")
+			return
+		}
+		writeJSON(w, http.StatusOK, c)
+	case "DELETE":
+		perms, err := readCommentPerms(&sess, commentID)
+		if err != nil {
+			writePermsError(w, err)
+			return
+		}
+		if !perms.CanEdit() {
+			writeJSONError(w, http.StatusForbidden, "Forbidden.")
+			return
+		}
+		db.Exec(`UPDATE comments SET is_deleted=1 WHERE id=?;`, commentID)
+		notifyCommentModAction(&sess, perms, commentID, "deleted")
+		auditComment(r, &sess, perms, commentID, models.AuditCommentDelete, "", "")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+})
+
+// APIMessagesHandler reads, sends and deletes the user's private messages.
+//
+//	GET    [?cursor=...]               received messages, newest first
+//	POST   {"to": ["<username>", ...], "content"}
+//	DELETE ?id=<message id>
+var APIMessagesHandler = API(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	if !sess.UserID.Valid {
+		writeJSONError(w, http.StatusUnauthorized, "Login required.")
+		return
+	}
+	switch r.Method {
+	case "GET":
+		cursor, err := strconv.ParseInt(r.FormValue("cursor"), 10, 64)
+		if err != nil || cursor <= 0 {
+			cursor = 1<<62 - 1
+		}
+		msgs := []apiMessage{}
+		rows := db.Query(`SELECT messages.id, fromusers.username, tousers.username, messages.content, messages.is_read, messages.created_date
+			FROM messages INNER JOIN users fromusers ON fromusers.id=messages.fromid INNER JOIN users tousers ON tousers.id=messages.toid
+			WHERE messages.toid=? AND messages.created_date < ? ORDER BY messages.created_date DESC LIMIT ?;`, sess.UserID, cursor, apiMessagesPerPage)
+		for rows.Next() {
+			m := apiMessage{}
+			rows.Scan(&m.ID, &m.From, &m.To, &m.Content, &m.IsRead, &m.CreatedDate)
+			m.Content = censor(m.Content)
+			msgs = append(msgs, m)
+		}
+		resp := map[string]interface{}{"messages": msgs}
+		if len(msgs) >= apiMessagesPerPage {
+			resp["next_cursor"] = strconv.FormatInt(msgs[len(msgs)-1].CreatedDate, 10)
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case "POST":
+		var req struct {
+			To      []string `json:"to"`
+			Content string   `json:"content"`
+		}
+		if err := readJSON(r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		content := strings.TrimSpace(req.Content)
+		if len(req.To) == 0 {
+			writeJSONError(w, http.StatusBadRequest, "No users to send the message to.")
+			return
+		}
+		if content == "" || len(content) > 5000 {
+			writeJSONError(w, http.StatusBadRequest, "Message should have 1-5000 characters.")
+			return
+		}
+		if err := checkEmailVerified(&sess); err != nil {
+			writeJSONError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if err := checkCanPost(r, &sess, ""); err != nil {
+			writeJSONError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		toUserIDs := []string{}
+		for _, toUserName := range req.To {
+			var userID string
+			if db.QueryRow(`SELECT id FROM users WHERE username=?;`, strings.TrimSpace(toUserName)).Scan(&userID) != nil {
+				writeJSONError(w, http.StatusBadRequest, "Username not found: "+toUserName)
+				return
+			}
+			toUserIDs = append(toUserIDs, userID)
+		}
+		for _, userID := range toUserIDs {
+			db.Exec(`INSERT INTO messages(fromid, toid, content, ip, created_date) VALUES(?, ?, ?, ?, ?);`, sess.UserID, userID, content, remoteIP(r), time.Now().Unix())
+		}
+		writeJSON(w, http.StatusCreated, map[string]int{"sent": len(toUserIDs)})
+	case "DELETE":
+		db.Exec(`DELETE FROM messages WHERE id=? AND toid=?;`, r.FormValue("id"), sess.UserID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+})
+
+// APIUsersHandler reads and updates user profiles. The e-mail address is shown only to
+// the user and to superadmins; a new address is shown as pending_email until it is
+// confirmed. The address can't be changed with an API token, since it is used to reset the
+// password. Without the "u" parameter, it returns the logged in user.
+//
+//	GET    [?u=<username>]
+//	PATCH  ?u=<username> {"email", "about"}
+var APIUsersHandler = API(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	userName := r.FormValue("u")
+	if userName == "" {
+		var err error
+		if userName, err = sess.UserName(); err != nil {
+			writeJSONError(w, http.StatusUnauthorized, "Login required.")
+			return
+		}
+	}
+	u := apiUser{}
+	var userID int64
+	if db.QueryRow(`SELECT id, username, about, email, is_banned, is_superadmin FROM users WHERE username=?;`, userName).Scan(
+		&userID, &u.UserName, &u.About, &u.Email, &u.IsBanned, &u.IsSuperAdmin) != nil {
+		writeJSONError(w, http.StatusNotFound, "User not found.")
+		return
+	}
+	isSelf := sess.UserID.Valid && sess.UserID.Int64 == userID
+	isSuperAdmin := sess.IsUserSuperAdmin()
+	switch r.Method {
+	case "GET":
+	case "PATCH":
+		if !isSelf && !isSuperAdmin {
+			writeJSONError(w, http.StatusForbidden, "Forbidden.")
+			return
+		}
+		var req struct {
+			Email *string `json:"email"`
+			About *string `json:"about"`
+		}
+		if err := readJSON(r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Email != nil && sess.IsToken {
+			writeJSONError(w, http.StatusForbidden, "The e-mail address can't be changed with an API token.")
+			return
+		}
+		if req.About != nil {
+			u.About = *req.About
+		}
+		if len(u.About) > 1024 {
+			writeJSONError(w, http.StatusBadRequest, "About should have fewer than 1024 characters.")
+			return
+		}
+		if req.Email != nil {
+			if _, err := updateEmail(r, strconv.FormatInt(userID, 10), u.UserName, strings.TrimSpace(*req.Email)); err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			db.QueryRow(`SELECT email FROM users WHERE id=?;`, userID).Scan(&u.Email)
+		}
+		db.Exec(`UPDATE users SET about=? WHERE id=?;`, u.About, userID)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+	if isSelf || isSuperAdmin {
+		u.PendingEmail, _ = models.ReadPendingEmail(strconv.FormatInt(userID, 10))
+	} else {
+		u.Email = ""
+	}
+	writeJSON(w, http.StatusOK, u)
+})
@@ -0,0 +1,171 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"encoding/json"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func apiRequestForTest(handler http.HandlerFunc, method string, target string, body string, sessionID string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if sessionID != "" {
+		req.AddCookie(&http.Cookie{Name: "sessionid", Path: "/", Value: sessionID, HttpOnly: true})
+		var csrf string
+		db.QueryRow(`SELECT csrf FROM sessions WHERE sessionid=?;`, sessionID).Scan(&csrf)
+		req.Header.Set("X-CSRF-Token", csrf)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAPITopicsAndComments(t *testing.T) {
+	models.CreateUser("apiauthor", "apiauthor12345", "")
+	models.CreateUser("apiother", "apiother12345", "")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"apigroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("apigroup")
+
+	authorSess := sessionForTest("apiauthor")
+	otherSess := sessionForTest("apiother")
+
+	if rr := apiRequestForTest(APITopicsHandler, "POST", "/api/v1/topics", `{"group_id": `+groupID+`, "title": "API topic title"}`, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous user can create topic: got %v", rr.Code)
+	}
+	req, _ := http.NewRequest("POST", "/api/v1/topics", strings.NewReader(`{"group_id": `+groupID+`, "title": "API topic title"}`))
+	req.AddCookie(&http.Cookie{Name: "sessionid", Path: "/", Value: authorSess, HttpOnly: true})
+	rr := httptest.NewRecorder()
+	APITopicsHandler(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Topic created without CSRF token: got %v", rr.Code)
+	}
+
+	rr = apiRequestForTest(APITopicsHandler, "POST", "/api/v1/topics", `{"group_id": `+groupID+`, "title": "API topic title"}`, authorSess)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Error creating topic: got %v, body %s", rr.Code, rr.Body.String())
+	}
+	var topic apiTopic
+	json.Unmarshal(rr.Body.Bytes(), &topic)
+	topicID := strconv.FormatInt(topic.ID, 10)
+	if topic.Title != "API topic title" || topic.Author != "apiauthor" {
+		t.Errorf("Unexpected topic: %+v", topic)
+	}
+
+	rr = apiRequestForTest(APICommentsHandler, "POST", "/api/v1/comments", `{"topic_id": `+topicID+`, "content": "A comment"}`, authorSess)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Error creating comment: got %v, body %s", rr.Code, rr.Body.String())
+	}
+	var comment apiComment
+	json.Unmarshal(rr.Body.Bytes(), &comment)
+	commentID := strconv.FormatInt(comment.ID, 10)
+
+	if rr := apiRequestForTest(APICommentsHandler, "PATCH", "/api/v1/comments?id="+commentID, `{"content": "Edited by someone else"}`, otherSess); rr.Code != http.StatusForbidden {
+		t.Errorf("Non-owner can edit comment: got %v", rr.Code)
+	}
+	if rr := apiRequestForTest(APITopicsHandler, "PATCH", "/api/v1/topics?id="+topicID, `{"title": "Edited by someone else"}`, otherSess); rr.Code != http.StatusForbidden {
+		t.Errorf("Non-owner can edit topic: got %v", rr.Code)
+	}
+	if rr := apiRequestForTest(APICommentsHandler, "PATCH", "/api/v1/comments?id="+commentID, `{"content": "Edited comment"}`, authorSess); rr.Code != http.StatusOK {
+		t.Errorf("Owner cannot edit comment: got %v", rr.Code)
+	}
+	if rr := apiRequestForTest(APITopicsHandler, "PATCH", "/api/v1/topics?id="+topicID, `{"is_closed": true}`, authorSess); rr.Code != http.StatusForbidden {
+		t.Errorf("Non-moderator can close topic: got %v", rr.Code)
+	}
+
+	rr = apiRequestForTest(APICommentsHandler, "GET", "/api/v1/comments?tid="+topicID, "", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Edited comment") {
+		t.Errorf("Error listing comments: got %v, body %s", rr.Code, rr.Body.String())
+	}
+
+	db.Exec(`UPDATE groups SET is_private=1 WHERE id=?;`, groupID)
+	if rr := apiRequestForTest(APITopicsHandler, "GET", "/api/v1/topics?id="+topicID, "", otherSess); rr.Code != http.StatusNotFound {
+		t.Errorf("Non-member can read topic in private group: got %v", rr.Code)
+	}
+	if rr := apiRequestForTest(APITopicsHandler, "GET", "/api/v1/topics?gid="+groupID, "", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Anonymous user can list topics in private group: got %v", rr.Code)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	models.CreateUser("apibot", "apibot12345", "")
+	userID, _ := models.ReadUserIDByName("apibot")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"apibotgroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("apibotgroup")
+	models.CreateGroupMod("apibot", groupID)
+
+	readToken, postToken := randSeq(32), randSeq(32)
+	models.CreateAPIToken(strconv.Itoa(userID), "reader", readToken, []string{models.ScopeRead})
+	models.CreateAPIToken(strconv.Itoa(userID), "poster", postToken, []string{models.ScopeRead, models.ScopePost})
+
+	tokenRequest := func(method string, target string, body string, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		if strings.HasPrefix(target, "/api/v1/topics") {
+			APITopicsHandler(rr, req)
+		} else {
+			APIUsersHandler(rr, req)
+		}
+		return rr
+	}
+
+	if rr := tokenRequest("GET", "/api/v1/users", "", readToken); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "apibot") {
+		t.Errorf("Error reading user with token: got %v, body %s", rr.Code, rr.Body.String())
+	}
+	if rr := tokenRequest("GET", "/api/v1/users", "", "not-a-token"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Invalid token accepted: got %v", rr.Code)
+	}
+	if rr := tokenRequest("PATCH", "/api/v1/users", `{"email": "thief@example.com"}`, postToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Token can change the e-mail address: got %v", rr.Code)
+	}
+	if email, _ := models.ReadPendingEmail(strconv.Itoa(userID)); email != "" {
+		t.Errorf("E-mail address changed with a token: %q", email)
+	}
+	adminID, _ := models.ReadUserIDByName("admin")
+	adminToken := randSeq(32)
+	models.CreateAPIToken(strconv.Itoa(adminID), "admin", adminToken, []string{models.ScopeRead, models.ScopePost, models.ScopeModerate})
+	req, _ := http.NewRequest("POST", "/admin", strings.NewReader("forum_name=Taken+over"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rr := httptest.NewRecorder()
+	AdminIndexHandler(rr, req)
+	if rr.Code == http.StatusOK || models.Config(models.ForumName) == "Taken over" {
+		t.Errorf("Token accepted by an HTML page: got %v", rr.Code)
+	}
+	newTopic := `{"group_id": ` + groupID + `, "title": "Posted by a bot", "is_sticky": true}`
+	if rr := tokenRequest("POST", "/api/v1/topics", newTopic, readToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Token without post scope can create topic: got %v", rr.Code)
+	}
+	rr = tokenRequest("POST", "/api/v1/topics", newTopic, postToken)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Error creating topic with token: got %v, body %s", rr.Code, rr.Body.String())
+	}
+	var topic apiTopic
+	json.Unmarshal(rr.Body.Bytes(), &topic)
+	if topic.IsSticky {
+		t.Errorf("Token without moderate scope can pin topic.")
+	}
+
+	var lastUsed int64
+	db.QueryRow(`SELECT last_used_date FROM apitokens WHERE name=?;`, "poster").Scan(&lastUsed)
+	if lastUsed == 0 {
+		t.Errorf("Last used time of token not updated.")
+	}
+	var tokenHash string
+	db.QueryRow(`SELECT tokenhash FROM apitokens WHERE name=?;`, "poster").Scan(&tokenHash)
+	if tokenHash == postToken {
+		t.Errorf("Token stored in plain text.")
+	}
+}
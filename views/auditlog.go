@@ -0,0 +1,270 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/templates"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var numAuditEntriesPerPage = 50
+
+var maxAuditExportEntries = 10000
+
+// secretConfigs are config settings whose values are not written to the audit log.
+var secretConfigs = map[string]bool{
+	models.SMTPPass:         true,
+	models.OIDCClientSecret: true,
+	models.LDAPBindPass:     true,
+}
+
+// audit records an action of the session user in the audit log.
+func audit(r *http.Request, sess *Session, e models.AuditEntry) {
+	e.ActorID = sessUserID(sess)
+	e.IP = remoteIP(r)
+	models.CreateAuditEntry(e)
+}
+
+// auditTopic records a moderation action on a topic. Owners can edit and delete their own
+// topics, so those actions are only recorded when someone else takes them.
+func auditTopic(r *http.Request, sess *Session, perms postPerms, action string, oldValue string, newValue string) {
+	if perms.IsOwner && (action == models.AuditTopicEdit || action == models.AuditTopicDelete) {
+		return
+	}
+	var title string
+	db.QueryRow(`SELECT title FROM topics WHERE id=?;`, perms.TopicID).Scan(&title)
+	audit(r, sess, models.AuditEntry{
+		GroupID:  perms.GroupID,
+		Action:   action,
+		TargetID: perms.TopicID,
+		Target:   title,
+		OldValue: oldValue,
+		NewValue: newValue,
+	})
+}
+
+// auditComment is like auditTopic, but for a comment.
+func auditComment(r *http.Request, sess *Session, perms postPerms, commentID string, action string, oldValue string, newValue string) {
+	if perms.IsOwner && (action == models.AuditCommentEdit || action == models.AuditCommentDelete) {
+		return
+	}
+	var title string
+	db.QueryRow(`SELECT title FROM topics WHERE id=?;`, perms.TopicID).Scan(&title)
+	audit(r, sess, models.AuditEntry{
+		GroupID:  perms.GroupID,
+		Action:   action,
+		TargetID: commentID,
+		Target:   `comment in "` + title + `"`,
+		OldValue: oldValue,
+		NewValue: newValue,
+	})
+}
+
+// auditUser records an action on the account of a user.
+func auditUser(r *http.Request, sess *Session, userID string, userName string, action string) {
+	audit(r, sess, models.AuditEntry{Action: action, TargetID: userID, Target: userName})
+}
+
+// auditConfig records each config setting that changed between oldConfig and newConfig.
+// The values of secret settings are left out.
+func auditConfig(r *http.Request, sess *Session, oldConfig map[string]interface{}, newConfig map[string]interface{}) {
+	var keys []string
+	for key := range newConfig {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		oldVal, newVal := fmt.Sprint(oldConfig[key]), fmt.Sprint(newConfig[key])
+		if oldVal == newVal {
+			continue
+		}
+		if secretConfigs[key] {
+			oldVal, newVal = "", ""
+		}
+		audit(r, sess, models.AuditEntry{Action: models.AuditConfigUpdate, TargetID: key, Target: key, OldValue: oldVal, NewValue: newVal})
+	}
+}
+
+// auditTargetURL links to the target of an entry, or is "" if it has no page.
+func auditTargetURL(e models.AuditEntry) string {
+	kind := strings.SplitN(e.Action, ".", 2)[0]
+	if kind == "topic" {
+		return "/topics?id=" + e.TargetID
+	} else if kind == "comment" {
+		return "/comments?id=" + e.TargetID
+	} else if kind == "user" {
+		return "/users?u=" + url.QueryEscape(e.Target)
+	} else if kind == "group" {
+		return "/groups/edit?id=" + e.TargetID
+	} else if kind == "block" {
+		return "/admin/blocklist"
+	}
+	return ""
+}
+
+// csvCell quotes a value that a spreadsheet would otherwise run as a formula.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// auditLog shows the audit log of a group, or of the whole forum if groupID is "", and
+// exports it as CSV or JSON. The caller checks that the user may see it.
+func auditLog(w http.ResponseWriter, r *http.Request, sess *Session, groupID string, groupName string) {
+	action := r.FormValue("action")
+	actor := strings.TrimSpace(r.FormValue("actor"))
+	fromDateStr := r.FormValue("from")
+	toDateStr := r.FormValue("to")
+	format := r.FormValue("format")
+
+	filter := models.AuditFilter{GroupID: groupID, Action: action, ActorName: actor}
+	if t, err := time.Parse("2006-01-02", fromDateStr); err == nil {
+		filter.FromDate = t.Unix()
+	}
+	if t, err := time.Parse("2006-01-02", toDateStr); err == nil {
+		filter.ToDate = t.AddDate(0, 0, 1).Unix()
+	}
+	if before, err := strconv.ParseInt(r.FormValue("before"), 10, 64); err == nil && before > 0 {
+		filter.BeforeID = strconv.FormatInt(before, 10)
+	}
+
+	if format == "csv" || format == "json" {
+		entries := models.ReadAuditEntries(filter, maxAuditExportEntries)
+		w.Header().Set("Content-Disposition", `attachment; filename="auditlog.`+format+`"`)
+		if format == "json" {
+			type jsonEntry struct {
+				ID          string `json:"id"`
+				CreatedDate int64  `json:"created_date"`
+				Actor       string `json:"actor"`
+				Group       string `json:"group"`
+				Action      string `json:"action"`
+				TargetID    string `json:"target_id"`
+				Target      string `json:"target"`
+				OldValue    string `json:"old_value"`
+				NewValue    string `json:"new_value"`
+				IP          string `json:"ip"`
+			}
+			jsonEntries := []jsonEntry{}
+			for _, e := range entries {
+				jsonEntries = append(jsonEntries, jsonEntry{e.ID, e.CreatedDate, e.ActorName, e.GroupName, e.Action,
+					e.TargetID, e.Target, e.OldValue, e.NewValue, e.IP})
+			}
+			writeJSON(w, http.StatusOK, jsonEntries)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "date", "actor", "group", "action", "target_id", "target", "old_value", "new_value", "ip"})
+		for _, e := range entries {
+			record := []string{e.ID, time.Unix(e.CreatedDate, 0).UTC().Format(time.RFC3339), e.ActorName, e.GroupName, e.Action,
+				e.TargetID, e.Target, e.OldValue, e.NewValue, e.IP}
+			for i := range record {
+				record[i] = csvCell(record[i])
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		return
+	}
+
+	logPath := "/admin/auditlog"
+	query := url.Values{}
+	if groupID != "" {
+		logPath = "/groups/auditlog"
+		query.Set("id", groupID)
+	}
+	for k, v := range map[string]string{"action": action, "actor": actor, "from": fromDateStr, "to": toDateStr} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	query.Set("format", "csv")
+	csvURL := logPath + "?" + query.Encode()
+	query.Set("format", "json")
+	jsonURL := logPath + "?" + query.Encode()
+	query.Del("format")
+
+	type Entry struct {
+		models.AuditEntry
+		URL            string
+		DateStr        string
+		CreatedDateStr string
+	}
+	var entries []Entry
+	for _, e := range models.ReadAuditEntries(filter, numAuditEntriesPerPage) {
+		entries = append(entries, Entry{
+			AuditEntry:     e,
+			URL:            auditTargetURL(e),
+			DateStr:        time.Unix(e.CreatedDate, 0).UTC().Format(time.RFC3339),
+			CreatedDateStr: timeAgoFromNow(time.Unix(e.CreatedDate, 0)),
+		})
+	}
+	olderURL := ""
+	if len(entries) >= numAuditEntriesPerPage {
+		query.Set("before", entries[len(entries)-1].ID)
+		olderURL = logPath + "?" + query.Encode()
+	}
+
+	var kinds []string
+	for _, a := range models.AuditActionAllVals {
+		kind := strings.SplitN(a, ".", 2)[0]
+		if len(kinds) == 0 || kinds[len(kinds)-1] != kind {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	commonData := readCommonData(r, *sess)
+	commonData.PageTitle = "Audit log"
+
+	templates.Render(w, "auditlog.html", map[string]interface{}{
+		"Common":    commonData,
+		"GroupID":   groupID,
+		"GroupName": groupName,
+		"LogPath":   logPath,
+		"Kinds":     kinds,
+		"Actions":   models.AuditActionAllVals,
+		"Action":    action,
+		"Actor":     actor,
+		"FromDate":  fromDateStr,
+		"ToDate":    toDateStr,
+		"Entries":   entries,
+		"OlderURL":  olderURL,
+		"CSVURL":    csvURL,
+		"JSONURL":   jsonURL,
+	})
+}
+
+var GroupAuditLogHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	groupID := r.FormValue("id")
+	var groupName string
+	if db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName) != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	if _, isAdmin, isSuperAdmin := sess.groupRoles(groupID); !isAdmin && !isSuperAdmin {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	auditLog(w, r, &sess, groupID, groupName)
+})
+
+var AdminAuditLogHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	if !sess.IsUserSuperAdmin() {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	auditLog(w, r, &sess, "", "")
+})
@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"encoding/json"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	models.CreateUser("alowner", "alowner12345", "")
+	models.CreateUser("almod", "almod12345", "")
+	models.CreateUser("aladmin", "aladmin12345", "")
+	ownerID, _ := models.ReadUserIDByName("alowner")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"algroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("algroup")
+	models.CreateGroupMod("almod", groupID)
+	models.CreateGroupAdmin("aladmin", groupID)
+	var topicID, ownTopicID string
+	for _, title := range []string{"Audited topic", "Topic deleted by owner"} {
+		db.Exec(`INSERT INTO topics(title, content, userid, groupid, created_date, updated_date, activity_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+			title, "Some content", ownerID, groupID, time.Now().Unix(), time.Now().Unix(), time.Now().Unix())
+	}
+	db.QueryRow(`SELECT id FROM topics WHERE title=?;`, "Audited topic").Scan(&topicID)
+	db.QueryRow(`SELECT id FROM topics WHERE title=?;`, "Topic deleted by owner").Scan(&ownTopicID)
+
+	modSess := sessionForTest("almod")
+	postFromForTest(TopicUpdateHandler, "/topics/edit?id="+topicID,
+		url.Values{"action": {"Update"}, "title": {"Audited topic"}, "content": {"Some content"}, "is_sticky": {"1"}}, modSess, "192.0.2.90:4000")
+	postFromForTest(TopicUpdateHandler, "/topics/edit?id="+topicID,
+		url.Values{"action": {"Close"}, "title": {"Audited topic"}, "content": {"Some content"}}, modSess, "192.0.2.90:4000")
+	postFromForTest(TopicUpdateHandler, "/topics/edit?id="+ownTopicID,
+		url.Values{"action": {"Delete"}, "title": {"Topic deleted by owner"}, "content": {"Some content"}}, sessionForTest("alowner"), "192.0.2.91:4000")
+
+	entries := models.ReadAuditEntries(models.AuditFilter{GroupID: groupID}, 10)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries in the group's audit log, got %d: %v", len(entries), entries)
+	}
+	if e := entries[0]; e.Action != models.AuditTopicClose || e.ActorName != "almod" || e.TargetID != topicID || e.IP != "192.0.2.90" {
+		t.Errorf("Close not recorded: %v", e)
+	}
+	if e := entries[1]; e.Action != models.AuditTopicSticky || e.OldValue != "false" || e.NewValue != "true" {
+		t.Errorf("Sticky change not recorded: %v", e)
+	}
+
+	adminSess := sessionForTest("admin")
+	postFromForTest(GroupEditHandler, "/groups/edit?id="+groupID,
+		url.Values{"action": {"Update"}, "name": {"algroup"}, "mods": {""}, "admins": {"aladmin"}}, adminSess, "192.0.2.92:4000")
+	entries = models.ReadAuditEntries(models.AuditFilter{GroupID: groupID, Action: "group"}, 10)
+	if len(entries) != 1 || entries[0].Action != models.AuditGroupMods || entries[0].OldValue != "almod" || entries[0].NewValue != "" {
+		t.Errorf("Mod list rewrite not recorded: %v", entries)
+	}
+
+	if rr := getForTest(GroupAuditLogHandler, "/groups/auditlog?id="+groupID, modSess); rr.Code != http.StatusForbidden {
+		t.Errorf("Mod can see the group's audit log: %d", rr.Code)
+	}
+	if rr := getForTest(AdminAuditLogHandler, "/admin/auditlog", sessionForTest("aladmin")); rr.Code != http.StatusForbidden {
+		t.Errorf("Group admin can see the global audit log: %d", rr.Code)
+	}
+	adminGroupSess := sessionForTest("aladmin")
+	body := getForTest(GroupAuditLogHandler, "/groups/auditlog?id="+groupID+"&action=topic", adminGroupSess).Body.String()
+	if !strings.Contains(body, "<b>topic.close</b>") || strings.Contains(body, "<b>group.mods</b>") {
+		t.Errorf("Group audit log not filtered by action: %s", body)
+	}
+	rr := getForTest(GroupAuditLogHandler, "/groups/auditlog?id="+groupID+"&actor=almod&format=csv", adminGroupSess)
+	if csv := rr.Body.String(); !strings.HasPrefix(csv, "id,date,actor") || strings.Count(csv, "\n") != 3 {
+		t.Errorf("CSV export doesn't have the mod's 2 entries: %s", csv)
+	}
+	rr = getForTest(GroupAuditLogHandler, "/groups/auditlog?id="+groupID+"&format=json", adminGroupSess)
+	var exported []map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &exported); err != nil || len(exported) != 3 {
+		t.Errorf("JSON export doesn't have the group's 3 entries: %v %s", err, rr.Body.String())
+	}
+
+	req, _ := http.NewRequest("POST", "/admin", nil)
+	req.RemoteAddr = "192.0.2.93:4000"
+	sess := Session{}
+	adminID, _ := models.ReadUserIDByName("admin")
+	sess.UserID.Int64, sess.UserID.Valid = int64(adminID), true
+	auditConfig(req, &sess,
+		map[string]interface{}{models.ForumName: "Old forum", models.SMTPPass: "oldsecret", models.SignupDisabled: false},
+		map[string]interface{}{models.ForumName: "New forum", models.SMTPPass: "newsecret", models.SignupDisabled: false})
+	entries = models.ReadAuditEntries(models.AuditFilter{Action: models.AuditConfigUpdate}, 10)
+	if len(entries) != 2 || entries[0].TargetID != models.SMTPPass || entries[1].NewValue != "New forum" {
+		t.Fatalf("Config changes not recorded: %v", entries)
+	}
+	if entries[0].OldValue != "" || entries[0].NewValue != "" {
+		t.Errorf("Secret config value written to the audit log: %v", entries[0])
+	}
+	body = getForTest(AdminAuditLogHandler, "/admin/auditlog", adminSess).Body.String()
+	if !strings.Contains(body, "<b>config.update</b>") || !strings.Contains(body, "<b>topic.close</b>") {
+		t.Errorf("Global audit log doesn't show every entry: %s", body)
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                  "",
+		"Flame war":         "Flame war",
+		"=HYPERLINK(\"x\")": "'=HYPERLINK(\"x\")",
+		"+1":                "'+1",
+		"-2+3":              "'-2+3",
+		"@SUM(A1)":          "'@SUM(A1)",
+		"192.0.2.1":         "192.0.2.1",
+		"a=b":               "a=b",
+	} {
+		if got := csvCell(in); got != want {
+			t.Errorf("csvCell(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
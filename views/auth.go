@@ -14,6 +14,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -31,12 +32,20 @@ var LoginHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session)
 	if r.Method == "POST" {
 		userName := r.PostFormValue("username")
 		passwd := r.PostFormValue("passwd")
-		if len(userName) > 200 || len(passwd) > 200 {
+		if len(userName) > 200 || len(passwd) > maxPasswdLen {
 			fmt.Fprint(w, "username / password too long.")
 			return
 		}
-		if err = sess.Authenticate(userName, passwd); err == nil {
-			http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		if err := checkLoginIP(r, userName); err != nil {
+			sess.SetFlashMsg(err.Error())
+			http.Redirect(w, r, "/login?next="+redirectURL, http.StatusSeeOther)
+			return
+		}
+		if err = authenticate(r, &sess, userName, passwd, models.LoginActionLogin); err == nil {
+			http.Redirect(w, r, loginRedirectURL(&sess, redirectURL), http.StatusSeeOther)
+			return
+		} else if err == errTwoFactorRequired {
+			http.Redirect(w, r, "/login/2fa?next="+redirectURL, http.StatusSeeOther)
 			return
 		} else {
 			sess.SetFlashMsg(err.Error())
@@ -45,9 +54,11 @@ var LoginHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session)
 		}
 	}
 	templates.Render(w, "login.html", map[string]interface{}{
-		"Common":   readCommonData(r, sess),
-		"next":     template.URL(url.QueryEscape(redirectURL)),
-		"LoginMsg": models.Config(models.LoginMsg),
+		"Common":         readCommonData(r, sess),
+		"next":           template.URL(url.QueryEscape(redirectURL)),
+		"LoginMsg":       models.Config(models.LoginMsg),
+		"PasskeyOptions": passkeyLoginOptions(r, &sess),
+		"IsOIDCEnabled":  models.Config(models.OIDCIssuer) != "",
 	})
 })
 
@@ -68,66 +79,90 @@ var SignupHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session
 	}
 
 	isSignupDisabled := models.Config(models.SignupDisabled) != "0"
+	isInviteOnly := models.Config(models.InviteOnly) != "0" && !sess.IsUserSuperAdmin()
+	inviteCode := strings.TrimSpace(r.FormValue("invite"))
+	signupURL := "/signup"
+	if inviteCode != "" {
+		signupURL = "/signup?invite=" + url.QueryEscape(inviteCode)
+	}
 
 	if r.Method == "POST" {
 		userName := strings.TrimSpace(r.PostFormValue("username"))
 		passwd := r.PostFormValue("passwd")
 		passwdConfirm := r.PostFormValue("confirm")
 		email := strings.TrimSpace(r.PostFormValue("email"))
-		if len(userName) < 2 || len(userName) > 32 {
-			sess.SetFlashMsg("Username should have 2-32 characters.")
-			http.Redirect(w, r, "/signup", http.StatusSeeOther)
+		if !sess.IsUserSuperAdmin() && isIPBlocked(remoteIP(r)) {
+			sess.SetFlashMsg(errIPBlocked.Error())
+			http.Redirect(w, r, signupURL, http.StatusSeeOther)
 			return
 		}
-		if censored := censor(userName); censored != userName {
-			sess.SetFlashMsg("Fix username: " + censored)
-			http.Redirect(w, r, "/signup", http.StatusSeeOther)
-			return
-		}
-		hasSpecial := false
-		for _, ch := range userName {
-			if (ch < 'A' || ch > 'Z') && (ch < 'a' || ch > 'z') && ch != '_' && (ch < '0' || ch > '9') {
-				hasSpecial = true
+		var invite models.Invite
+		if isInviteOnly || inviteCode != "" {
+			if invite, err = checkInvite(inviteCode); err != nil {
+				sess.SetFlashMsg(err.Error())
+				http.Redirect(w, r, signupURL, http.StatusSeeOther)
+				return
 			}
 		}
-		if hasSpecial {
-			sess.SetFlashMsg("Username can contain only alphabets, numbers, and underscore.")
-			http.Redirect(w, r, "/signup", http.StatusSeeOther)
+		if err := validateUserName(userName); err != nil {
+			sess.SetFlashMsg(err.Error())
+			http.Redirect(w, r, signupURL, http.StatusSeeOther)
 			return
 		}
 		if models.ProbeUser(userName) {
 			sess.SetFlashMsg("Username already registered.")
-			http.Redirect(w, r, "/signup", http.StatusSeeOther)
+			http.Redirect(w, r, signupURL, http.StatusSeeOther)
 			return
 		}
 		if err := validatePasswd(passwd, passwdConfirm); err != nil {
 			sess.SetFlashMsg(err.Error())
-			http.Redirect(w, r, "/signup", http.StatusSeeOther)
+			http.Redirect(w, r, signupURL, http.StatusSeeOther)
 			return
 		}
-		if len(email) > 64 {
-			sess.SetFlashMsg("Email should have fewer than 64 characters.")
-			http.Redirect(w, r, "/signup", http.StatusSeeOther)
-			return
+		if email != "" {
+			if err := validateEmail(email); err != nil {
+				sess.SetFlashMsg(err.Error())
+				http.Redirect(w, r, signupURL, http.StatusSeeOther)
+				return
+			}
 		}
 		if isSignupDisabled && !sess.IsUserSuperAdmin() {
 			ErrForbiddenHandler(w, r)
 			return
 		}
-		models.CreateUser(userName, passwd, email)
+		// The e-mail address is saved once it is confirmed.
+		models.CreateUser(userName, passwd, "")
+		userID, _ := models.ReadUserIDByName(userName)
+		if !sess.IsUserSuperAdmin() {
+			db.Exec(`UPDATE users SET signup_ip=? WHERE id=?;`, remoteIP(r), userID)
+		}
+		if invite.ID != "" {
+			useInvite(invite, strconv.Itoa(userID))
+		}
+		msg := ""
+		if email != "" {
+			sendEmailConfirmation(r, strconv.Itoa(userID), userName, email)
+			msg = "Confirmation link sent to " + email + "."
+		}
 		if sess.IsUserSuperAdmin() {
-			sess.SetFlashMsg("User " + userName + " created")
+			sess.SetFlashMsg(strings.TrimSpace("User " + userName + " created. " + msg))
 			http.Redirect(w, r, "/signup", http.StatusSeeOther)
 			return
 		}
 		sess.Authenticate(userName, passwd)
+		if msg != "" {
+			sess.SetFlashMsg(msg)
+		}
 		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
 	}
 	templates.Render(w, "signup.html", map[string]interface{}{
-		"Common":     readCommonData(r, sess),
-		"next":       template.URL(url.QueryEscape(redirectURL)),
-		"IsDisabled": isSignupDisabled && !sess.IsUserSuperAdmin(),
-		"SignupMsg":  models.Config(models.SignupMsg),
+		"Common":       readCommonData(r, sess),
+		"next":         template.URL(url.QueryEscape(redirectURL)),
+		"IsDisabled":   isSignupDisabled && !sess.IsUserSuperAdmin(),
+		"IsInviteOnly": isInviteOnly,
+		"Invite":       inviteCode,
+		"SignupMsg":    models.Config(models.SignupMsg),
 	})
 })
 
@@ -145,10 +180,14 @@ var ChangePasswdHandler = UA(func(w http.ResponseWriter, r *http.Request, sess S
 	if r.Method == "POST" {
 		if !commonData.IsSuperAdmin {
 			passwd := r.PostFormValue("passwd")
-			if sess.Authenticate(userName, passwd) != nil {
+			if err := authenticate(r, &sess, userName, passwd, models.LoginActionChangePass); err == errIncorrectLogin {
 				sess.SetFlashMsg("Current password incorrect.")
 				http.Redirect(w, r, "/changepass?u="+userName, http.StatusSeeOther)
 				return
+			} else if err != nil {
+				sess.SetFlashMsg(err.Error())
+				http.Redirect(w, r, "/changepass?u="+userName, http.StatusSeeOther)
+				return
 			}
 		}
 		newPasswd := r.PostFormValue("newpass")
@@ -161,11 +200,10 @@ var ChangePasswdHandler = UA(func(w http.ResponseWriter, r *http.Request, sess S
 		if err := models.UpdateUserPasswd(userName, newPasswd); err != nil {
 			log.Panicf("[ERROR] Error changing password: %s\n", err)
 		}
-		if commonData.IsSuperAdmin {
-			var userID string
-			db.QueryRow(`SELECT id FROM users WHERE username=?;`, userName).Scan(&userID)
-			db.Exec(`DELETE FROM sessions WHERE userid=?;`, userID)
-		}
+		// Someone else may know the old password, so log out the user's other sessions.
+		var userID string
+		db.QueryRow(`SELECT id FROM users WHERE username=?;`, userName).Scan(&userID)
+		models.DeleteUserSessions(userID, sess.SessionID)
 		sess.SetFlashMsg("Password change successful.")
 		http.Redirect(w, r, "/changepass?u="+userName, http.StatusSeeOther)
 		return
@@ -179,14 +217,26 @@ var ChangePasswdHandler = UA(func(w http.ResponseWriter, r *http.Request, sess S
 var ForgotPasswdHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session) {
 	if r.Method == "POST" {
 		userName := r.PostFormValue("username")
-		if userName == "" || len(userName) > 200 || !models.ProbeUser(userName) {
+		if len(userName) > 200 {
+			fmt.Fprint(w, "username too long.")
+			return
+		}
+		ip := remoteIP(r)
+		if wait := loginWait(userName, ip, time.Now()); wait > 0 {
+			sess.SetFlashMsg(errLoginThrottled(wait).Error())
+			http.Redirect(w, r, "/forgotpass", http.StatusSeeOther)
+			return
+		}
+		if userName == "" || !models.ProbeUser(userName) {
+			// Probing for usernames counts against the client, not against any account.
+			models.RecordLoginFailure(userName, ip, models.LoginActionForgotPass)
 			sess.SetFlashMsg("Username doesn't exist.")
 			http.Redirect(w, r, "/forgotpass", http.StatusSeeOther)
 			return
 		}
 		email := models.ReadUserEmail(userName)
 		if !strings.ContainsRune(email, '@') {
-			sess.SetFlashMsg("E-mail address not set. Contact site admin to reset the password.")
+			sess.SetFlashMsg("E-mail address not set or not confirmed. Contact site admin to reset the password.")
 			http.Redirect(w, r, "/forgotpass", http.StatusSeeOther)
 			return
 		}
@@ -226,6 +276,9 @@ var ResetPasswdHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Se
 			return
 		}
 		models.UpdateUserPasswd(userName, passwd)
+		var userID string
+		db.QueryRow(`SELECT id FROM users WHERE username=?;`, userName).Scan(&userID)
+		models.DeleteUserSessions(userID, sess.SessionID)
 		sess.SetFlashMsg("Password change successful.")
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
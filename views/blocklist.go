@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"errors"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/templates"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errIPBlocked = errors.New("Sign-ups, logins and posts from your IP address are blocked.")
+
+// isIPBlocked reports whether ip is one of the blocked addresses or in a blocked range.
+func isIPBlocked(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, b := range models.ReadBlocks(models.BlockIP) {
+		if ipNet, err := parseIPNet(b.Value); err == nil && ipNet.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLoginIP returns errIPBlocked if the client is blocked. Superadmins can always log
+// in, so that they can't lock themselves out.
+func checkLoginIP(r *http.Request, userName string) error {
+	if !isIPBlocked(remoteIP(r)) {
+		return nil
+	}
+	var isSuperAdmin bool
+	db.QueryRow(`SELECT is_superadmin FROM users WHERE username=?;`, userName).Scan(&isSuperAdmin)
+	if isSuperAdmin {
+		return nil
+	}
+	return errIPBlocked
+}
+
+// checkEmailBlocked returns an error if the domain of email is blocked or belongs to a
+// disposable address provider.
+func checkEmailBlocked(email string) error {
+	domain := strings.ToLower(email[strings.LastIndexByte(email, '@')+1:])
+	if models.IsEmailDomainBlocked(domain) {
+		return errors.New("E-mail addresses at " + domain + " can't be used here.")
+	}
+	return nil
+}
+
+// validateBlock checks the value of a new block and returns it in the form it is saved.
+func validateBlock(kind string, value string) (string, error) {
+	if kind == models.BlockIP {
+		if _, err := parseIPNet(value); err != nil {
+			return "", errors.New("Invalid IP address or range: " + value)
+		}
+		return value, nil
+	} else if kind == models.BlockEmail {
+		domain := strings.ToLower(strings.TrimPrefix(value, "@"))
+		if len(domain) > 250 || !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@ \t") {
+			return "", errors.New("Invalid e-mail domain: " + value)
+		}
+		return domain, nil
+	}
+	return "", errors.New("Unknown kind of block.")
+}
+
+var AdminBlocklistHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	if !sess.IsUserSuperAdmin() {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	if r.Method == "POST" {
+		action := r.PostFormValue("action")
+		if action == "Block" {
+			kind := r.PostFormValue("kind")
+			reason := strings.TrimSpace(r.PostFormValue("reason"))
+			value, err := validateBlock(kind, strings.TrimSpace(r.PostFormValue("value")))
+			if err != nil {
+				sess.SetFlashMsg(err.Error())
+			} else if len(reason) > 250 {
+				sess.SetFlashMsg("Reason should have fewer than 250 characters.")
+			} else {
+				models.CreateBlock(kind, value, reason)
+				audit(r, &sess, models.AuditEntry{Action: models.AuditBlockAdd, TargetID: kind, Target: value, NewValue: reason})
+				sess.SetFlashMsg(value + " blocked.")
+			}
+		} else if action == "Unblock" {
+			if b, err := models.DeleteBlock(r.PostFormValue("blockid")); err == nil {
+				audit(r, &sess, models.AuditEntry{Action: models.AuditBlockDelete, TargetID: b.Kind, Target: b.Value, OldValue: b.Reason})
+				sess.SetFlashMsg(b.Value + " unblocked.")
+			}
+		} else if action == "Load" {
+			file, _, err := r.FormFile("domains")
+			if err != nil {
+				sess.SetFlashMsg("Choose a file with one domain per line.")
+			} else {
+				defer file.Close()
+				n, err := models.LoadDisposableDomains(file)
+				if err != nil {
+					sess.SetFlashMsg("Error reading the file: " + err.Error())
+				} else {
+					sess.SetFlashMsg(strconv.Itoa(n) + " disposable e-mail domains loaded.")
+				}
+			}
+		}
+		http.Redirect(w, r, "/admin/blocklist", http.StatusSeeOther)
+		return
+	}
+
+	type Block struct {
+		models.Block
+		CreatedDateStr string
+	}
+	readBlocks := func(kind string) []Block {
+		var blocks []Block
+		for _, b := range models.ReadBlocks(kind) {
+			blocks = append(blocks, Block{b, timeAgoFromNow(time.Unix(b.CreatedDate, 0))})
+		}
+		return blocks
+	}
+	templates.Render(w, "adminblocklist.html", map[string]interface{}{
+		"Common":        readCommonData(r, sess),
+		"IPBlocks":      readBlocks(models.BlockIP),
+		"EmailBlocks":   readBlocks(models.BlockEmail),
+		"NumDisposable": models.NumBlocks(models.BlockDisposable),
+	})
+})
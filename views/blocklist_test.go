@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPBlocks(t *testing.T) {
+	adminSess := sessionForTest("admin")
+	anonSess := randSeq(32)
+	db.Exec(`INSERT INTO sessions(sessionid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		anonSess, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+
+	postFromForTest(AdminBlocklistHandler, "/admin/blocklist", url.Values{"action": {"Block"}, "kind": {models.BlockIP}, "value": {"203.0.113.0/33"}}, adminSess, "192.0.2.1:4000")
+	if n := models.NumBlocks(models.BlockIP); n != 0 {
+		t.Fatalf("Invalid range blocked")
+	}
+	postFromForTest(AdminBlocklistHandler, "/admin/blocklist", url.Values{"action": {"Block"}, "kind": {models.BlockIP}, "value": {"203.0.113.0/24"}, "reason": {"Ban evasion"}}, adminSess, "192.0.2.1:4000")
+	blocks := models.ReadBlocks(models.BlockIP)
+	if len(blocks) != 1 {
+		t.Fatalf("Range not blocked")
+	}
+	defer models.DeleteBlock(blocks[0].ID)
+
+	signup := url.Values{"username": {"evader"}, "passwd": {"evader12345"}, "confirm": {"evader12345"}}
+	postFromForTest(SignupHandler, "/signup", signup, anonSess, "203.0.113.9:4000")
+	if models.ProbeUser("evader") {
+		t.Fatalf("Signed up from a blocked IP address")
+	}
+	postFromForTest(SignupHandler, "/signup", signup, anonSess, "192.0.2.130:4000")
+	var signupIP string
+	db.QueryRow(`SELECT signup_ip FROM users WHERE username=?;`, "evader").Scan(&signupIP)
+	if signupIP != "192.0.2.130" {
+		t.Fatalf("Signup IP address not recorded: %q", signupIP)
+	}
+
+	loginSess := randSeq(32)
+	db.Exec(`INSERT INTO sessions(sessionid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		loginSess, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+	rr := postFromForTest(LoginHandler, "/login", url.Values{"username": {"evader"}, "passwd": {"evader12345"}}, loginSess, "203.0.113.9:4000")
+	if loc := rr.Header().Get("Location"); loc == "/" {
+		t.Errorf("Logged in from a blocked IP address")
+	}
+	rr = postFromForTest(LoginHandler, "/login", url.Values{"username": {"admin"}, "passwd": {"admin12345"}}, loginSess, "203.0.113.9:4000")
+	if loc := rr.Header().Get("Location"); loc != "/" {
+		t.Errorf("Superadmin locked out by a block: %s", loc)
+	}
+
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"blockgroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("blockgroup")
+	evaderSess := sessionForTest("evader")
+	postFromForTest(TopicCreateHandler, "/topics/new", url.Values{"gid": {groupID}, "title": {"From a blocked network"}, "content": {"Hi"}}, evaderSess, "203.0.113.9:4000")
+	postFromForTest(TopicCreateHandler, "/topics/new", url.Values{"gid": {groupID}, "title": {"From an open network"}, "content": {"Hi"}}, evaderSess, "192.0.2.131:4000")
+	var numTopics int
+	var topicIP string
+	db.QueryRow(`SELECT COUNT(*), MAX(ip) FROM topics WHERE groupid=?;`, groupID).Scan(&numTopics, &topicIP)
+	if numTopics != 1 || topicIP != "192.0.2.131" {
+		t.Errorf("Posting from a blocked IP address not stopped, or posting IP address not recorded: %d %q", numTopics, topicIP)
+	}
+
+	postFromForTest(AdminBlocklistHandler, "/admin/blocklist", url.Values{"action": {"Unblock"}, "blockid": {blocks[0].ID}}, adminSess, "192.0.2.1:4000")
+	if isIPBlocked("203.0.113.9") {
+		t.Errorf("Range not unblocked")
+	}
+	if entries := models.ReadAuditEntries(models.AuditFilter{Action: "block"}, 10); len(entries) != 2 {
+		t.Errorf("Blocks not in the audit log: %v", entries)
+	}
+}
+
+func TestEmailBlocks(t *testing.T) {
+	adminSess := sessionForTest("admin")
+	postFromForTest(AdminBlocklistHandler, "/admin/blocklist", url.Values{"action": {"Block"}, "kind": {models.BlockEmail}, "value": {"@Spammy.example"}}, adminSess, "192.0.2.1:4000")
+	blocks := models.ReadBlocks(models.BlockEmail)
+	if len(blocks) != 1 || blocks[0].Value != "spammy.example" {
+		t.Fatalf("Domain not blocked: %v", blocks)
+	}
+	defer models.DeleteBlock(blocks[0].ID)
+
+	n, err := models.LoadDisposableDomains(strings.NewReader("# Throwaway addresses\nMailinator.com\n\nyopmail.com\nyopmail.com\n"))
+	if err != nil || n != 2 {
+		t.Fatalf("Disposable domains not loaded: %d %v", n, err)
+	}
+	defer models.LoadDisposableDomains(strings.NewReader(""))
+
+	for _, email := range []string{"eve@spammy.example", "eve@mail.spammy.example", "eve@mailinator.com", "eve@YOPMAIL.com"} {
+		if err := validateEmail(email); err == nil {
+			t.Errorf("Blocked address accepted: %s", email)
+		}
+	}
+	for _, email := range []string{"eve@example.com", "eve@notmailinator.com"} {
+		if err := validateEmail(email); err != nil {
+			t.Errorf("Address rejected: %s: %v", email, err)
+		}
+	}
+}
+
+func TestIPSharers(t *testing.T) {
+	models.CreateUser("puppeteer", "puppeteer12345", "")
+	models.CreateUser("puppet", "puppet12345", "")
+	models.CreateUser("bystander", "bystander12345", "")
+	models.CreateUser("sharemod", "sharemod12345", "")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"sharegroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("sharegroup")
+	models.CreateGroupMod("sharemod", groupID)
+	db.Exec(`UPDATE users SET signup_ip=? WHERE username=?;`, "192.0.2.140", "puppet")
+
+	post := func(userName string, title string, remoteAddr string) {
+		postFromForTest(TopicCreateHandler, "/topics/new", url.Values{"gid": {groupID}, "title": {title}, "content": {"..."}},
+			sessionForTest(userName), remoteAddr)
+	}
+	post("puppeteer", "I am right", "192.0.2.140:4000")
+	post("puppeteer", "I am still right", "192.0.2.141:4000")
+	post("puppet", "He is right", "192.0.2.141:4000")
+	post("bystander", "Who knows", "192.0.2.142:4000")
+
+	puppeteerID, _ := models.ReadUserIDByName("puppeteer")
+	sharers := models.ReadIPSharers(strconv.Itoa(puppeteerID))
+	if len(sharers) != 1 || sharers[0].UserName != "puppet" || sharers[0].NumIPs != 2 {
+		t.Errorf("Accounts sharing an IP address not found: %v", sharers)
+	}
+	body := getForTest(GroupBansHandler, "/groups/bans?id="+groupID+"&u=puppeteer", sessionForTest("sharemod")).Body.String()
+	if !strings.Contains(body, "puppet</a>") || strings.Contains(body, "bystander") || strings.Contains(body, "192.0.2.14") {
+		t.Errorf("Bans page doesn't list the accounts sharing an IP address, or shows the addresses: %s", body)
+	}
+}
@@ -6,6 +6,7 @@ package views
 
 import (
 	"database/sql"
+	"errors"
 	"github.com/s-gv/orangeforum/models"
 	"github.com/s-gv/orangeforum/models/db"
 	"github.com/s-gv/orangeforum/templates"
@@ -16,93 +17,190 @@ import (
 	"time"
 )
 
+func validateComment(content string, hasImage bool) error {
+	if (len(content) < 2 && !hasImage) || len(content) > 5000 {
+		return errors.New("Comment should have 2-5000 characters.")
+	}
+	return nil
+}
+
+// stickyPos returns the position of a comment given whether it should be pinned.
+// Pinned comments have negative positions so that they sort first.
+func stickyPos(pos int, isSticky bool) int {
+	if (isSticky && pos > 0) || (!isSticky && pos < 0) {
+		return -pos
+	}
+	return pos
+}
+
+// createComment adds a comment to the topic and returns the position of the new comment,
+// and whether it is held for a mod's approval. Otherwise it is published right away.
+// parentID is the comment being replied to, if any.
+func createComment(r *http.Request, sess *Session, topicID string, topicName string, parentID sql.NullInt64, content string, imageName string, isSticky bool) (int, bool) {
+	var lastPos int
+	db.QueryRow(`SELECT pos FROM comments WHERE topicid=? ORDER BY pos DESC LIMIT 1;`, topicID).Scan(&lastPos)
+	newPos := stickyPos(lastPos+1, isSticky)
+
+	var groupID string
+	db.QueryRow(`SELECT groupid FROM topics WHERE id=?;`, topicID).Scan(&groupID)
+	isPending := isPostHeld(sess, groupID)
+	db.Exec(`INSERT INTO comments(content, image, topicid, userid, parentid, pos, is_pending, ip, created_date, updated_date, published_date) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		content, imageName, topicID, sess.UserID, parentID, newPos, isPending, remoteIP(r), int64(time.Now().Unix()), int64(time.Now().Unix()), int64(time.Now().Unix()))
+	var commentID string
+	db.QueryRow(`SELECT id FROM comments WHERE topicid=? AND pos=?;`, topicID, newPos).Scan(&commentID)
+	if !isPending {
+		publishComment(r, sess, topicID, topicName, commentID, content)
+	}
+	return newPos, isPending
+}
+
+// publishComment counts a new comment in its topic and bumps the topic, and notifies the
+// topic subscribers and the users the comment replies to or mentions. sess is the session
+// of the author.
+func publishComment(r *http.Request, sess *Session, topicID string, topicName string, commentID string, content string) {
+	db.Exec(`UPDATE topics SET num_comments=num_comments+1, activity_date=? WHERE id=?;`, int(time.Now().Unix()), topicID)
+	notifyNewComment(sess, topicID, commentID, content)
+	if models.Config(models.AllowTopicSubscription) != "0" {
+		var userName string
+		db.QueryRow(`SELECT username FROM users WHERE id=?;`, sess.UserID).Scan(&userName)
+		topicURL := "http://" + r.Host + "/topics?id=" + topicID
+		rows := db.Query(`SELECT users.email, topicsubscriptions.token FROM users
+			INNER JOIN topicsubscriptions ON users.id=topicsubscriptions.userid AND topicsubscriptions.topicid=?
+			INNER JOIN topics ON topics.id=topicsubscriptions.topicid
+			INNER JOIN groups ON groups.id=topics.groupid
+			WHERE users.digest=? AND (groups.is_private=0 OR users.is_superadmin=1 OR users.id IN (SELECT userid FROM members WHERE groupid=groups.id));`, topicID, models.DigestImmediate)
+		for rows.Next() {
+			var email, token string
+			rows.Scan(&email, &token)
+			if email != "" {
+				unSubURL := "http://" + r.Host + "/topics/unsubscribe?token=" + token
+				utils.SendMail(email, `New comment in "`+topicName+`"`,
+					"A new comment has been posted by "+userName+" in \""+topicName+"\".\r\nSee the comment at "+topicURL+"\r\n\r\nIf you do not want these emails, unsubscribe by following this link: "+unSubURL)
+			}
+		}
+	}
+}
+
 var CommentIndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session) {
 	commentID := r.FormValue("id")
-	var groupID, topicID, topicName, groupName, ownerID, ownerName, content, imgSrc string
-	var cDate int64
-	var isDeleted bool
+	var groupID, topicID, topicName, groupName string
+	var pos int
 
-	if db.QueryRow(`SELECT userid, topicid, content, image, is_deleted, created_date FROM comments WHERE id=?;`, commentID).Scan(
-		&ownerID, &topicID, &content, &imgSrc, &isDeleted, &cDate) != nil {
+	if db.QueryRow(`SELECT topicid, pos FROM comments WHERE id=?;`, commentID).Scan(&topicID, &pos) != nil {
 		ErrNotFoundHandler(w, r)
 		return
 	}
 	db.QueryRow(`SELECT groupid, title FROM topics WHERE id=?;`, topicID).Scan(&groupID, &topicName)
-	db.QueryRow(`SELECT username FROM users WHERE id=?;`, ownerID).Scan(&ownerName)
+	if !sess.CanViewGroup(groupID) {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	if _, err := readCommentPerms(&sess, commentID); err == errNotFound {
+		ErrNotFoundHandler(w, r)
+		return
+	}
 	db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName)
+	isMod, isAdmin, isSuperAdmin := sess.groupRoles(groupID)
 
-	var tmp string
-	db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName)
-	isMod := sess.UserID.Valid && db.QueryRow(`SELECT id FROM mods WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
-	isAdmin := sess.UserID.Valid && db.QueryRow(`SELECT id FROM admins WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
-	isSuperAdmin := false
-	if sess.UserID.Valid {
-		db.QueryRow(`SELECT is_superadmin FROM users WHERE id=?`, sess.UserID).Scan(&isSuperAdmin)
+	// Show the comment with the comments it replies to above it and its replies below it.
+	comments := readCommentThread(&sess, topicID, commentID)
+	byID := make(map[string]threadComment)
+	for i, c := range comments {
+		comments[i].CanEdit = c.IsOwner || isMod || isAdmin || isSuperAdmin
+		byID[c.ID] = comments[i]
+	}
+	children := threadChildren(comments)
+	comment := byID[commentID]
+	var parents []threadComment
+	for parent, ok := byID[comment.ParentID]; ok && len(parents) < 50; parent, ok = byID[parent.ParentID] {
+		parents = append([]threadComment{parent}, parents...)
+	}
+	replies := flattenThread(children, comment, 0, nil)[1:]
+
+	page := pos / numCommentsPerPage
+	if page < 0 {
+		page = 0
 	}
-	isOwner := sess.UserID.Valid && db.QueryRow(`SELECT userid FROM comments WHERE id=?;`, commentID).Scan(&tmp) == nil
+
+	commonData := readCommonData(r, sess)
+	commonData.PageTitle = censor(topicName)
 
 	templates.Render(w, "commentindex.html", map[string]interface{}{
-		"Common":       readCommonData(r, sess),
+		"Common":       commonData,
 		"ID":           commentID,
 		"TopicID":      topicID,
-		"TopicName":    topicName,
+		"TopicName":    censor(topicName),
+		"TopicPage":    page,
 		"GroupName":    groupName,
-		"OwnerName":    ownerName,
-		"Content":      formatComment(content),
-		"ImgSrc":       imgSrc,
+		"Comment":      comment,
+		"Parents":      parents,
+		"Replies":      replies,
 		"IsMod":        isMod,
 		"IsAdmin":      isAdmin,
 		"IsSuperAdmin": isSuperAdmin,
-		"IsOwner":      isOwner,
-		"IsDeleted":    isDeleted,
-		"CreatedDate":  timeAgoFromNow(time.Unix(cDate, 0)),
 	})
 })
 
 var CommentCreateHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
 	topicID := r.FormValue("tid")
 	quoteID := r.FormValue("quote")
+	parentID := r.FormValue("parent")
 	content := strings.TrimSpace(r.PostFormValue("content"))
 	isSticky := r.PostFormValue("is_sticky") != ""
 	isImageUploadEnabled := models.Config(models.ImageUploadEnabled) != "0"
-	var groupID, groupName, topicName, parentComment, topicOwnerID, topicOwnerName string
-	var topicCreatedDate int64
+	var topicName, parentComment, topicOwnerID, topicOwnerName string
+	var topicCreatedDate, parentCreatedDate int64
 
-	if db.QueryRow(`SELECT userid, groupid, title, content, created_date FROM topics WHERE id=?;`, topicID).Scan(
-		&topicOwnerID, &groupID, &topicName, &parentComment, &topicCreatedDate) != nil {
+	perms, err := readTopicPerms(&sess, topicID)
+	if err == errNotFound {
 		ErrNotFoundHandler(w, r)
 		return
 	}
-	isClosed := true
-	db.QueryRow(`SELECT is_closed FROM groups WHERE id=?;`, groupID).Scan(&isClosed)
-
-	if isClosed {
+	if err != nil || perms.IsTopicClosed || perms.IsTopicDeleted {
 		ErrForbiddenHandler(w, r)
 		return
 	}
+	groupName := perms.GroupName
+	isMod, isAdmin, isSuperAdmin := perms.IsMod, perms.IsAdmin, perms.IsSuperAdmin
+	db.QueryRow(`SELECT userid, title, content, created_date FROM topics WHERE id=?;`, topicID).Scan(
+		&topicOwnerID, &topicName, &parentComment, &topicCreatedDate)
 	db.QueryRow(`SELECT username FROM users WHERE id=?;`, topicOwnerID).Scan(&topicOwnerName)
+	parentCreatedDate = topicCreatedDate
 
-	var tmp string
-	db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName)
-	isMod := db.QueryRow(`SELECT id FROM mods WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
-	isAdmin := db.QueryRow(`SELECT id FROM admins WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
-	isSuperAdmin := false
-	db.QueryRow(`SELECT is_superadmin FROM users WHERE id=?;`, sess.UserID).Scan(&isSuperAdmin)
+	parent, err := readParentComment(&sess, topicID, parentID)
+	if err != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	if parent.Valid {
+		db.QueryRow(`SELECT content, created_date FROM comments WHERE id=?;`, parent.Int64).Scan(&parentComment, &parentCreatedDate)
+	}
 
 	quoteContent := ""
 	if quoteID != "" {
 		var quotedUser string
 		var isDeleted bool
-		db.QueryRow(`SELECT comments.content, comments.is_deleted, users.username FROM comments INNER JOIN users ON comments.userid=users.id WHERE comments.id=?;`, quoteID).Scan(&quoteContent, &isDeleted, &quotedUser)
-		if !isDeleted {
-			quoteContent = formatReply(quotedUser, quoteContent)
+		var quoteCreatedDate int64
+		db.QueryRow(`SELECT comments.content, comments.is_deleted, comments.created_date, users.username FROM comments INNER JOIN users ON comments.userid=users.id WHERE comments.id=? AND comments.topicid=?;`, quoteID, topicID).Scan(&quoteContent, &isDeleted, &quoteCreatedDate, &quotedUser)
+		if _, err := readCommentPerms(&sess, quoteID); err == nil && !isDeleted {
+			quoteContent = formatReply(quotedUser, postMarkdown(quoteContent, quoteCreatedDate))
 		} else {
 			quoteContent = ""
 		}
 	}
 
 	if r.Method == "POST" {
-		if !isMod && !isAdmin && !isSuperAdmin {
+		if err := checkEmailVerified(&sess); err != nil {
+			sess.SetFlashMsg(err.Error())
+			http.Redirect(w, r, "/comments/new?tid="+topicID+"&parent="+parentID, http.StatusSeeOther)
+			return
+		}
+		if err := checkCanPost(r, &sess, perms.GroupID); err != nil {
+			sess.SetFlashMsg(err.Error())
+			http.Redirect(w, r, "/comments/new?tid="+topicID+"&parent="+parentID, http.StatusSeeOther)
+			return
+		}
+		if !perms.CanModerate() {
 			isSticky = false
 		}
 		imageName := ""
@@ -110,36 +208,21 @@ var CommentCreateHandler = A(func(w http.ResponseWriter, r *http.Request, sess S
 			imageName = saveImage(r)
 		}
 
-		if (len(content) < 2 && imageName == "") || len(content) > 5000 {
-			sess.SetFlashMsg("Comment should have 2-5000 characters.")
-			http.Redirect(w, r, "/comments/new?tid="+topicID, http.StatusSeeOther)
+		if err := validateComment(content, imageName != ""); err != nil {
+			sess.SetFlashMsg(err.Error())
+			http.Redirect(w, r, "/comments/new?tid="+topicID+"&parent="+parentID, http.StatusSeeOther)
 			return
 		}
 
-		var lastPos int
-		db.QueryRow(`SELECT pos FROM comments WHERE topicid=? ORDER BY pos DESC LIMIT 1;`, topicID).Scan(&lastPos)
-		newPos := lastPos + 1
-		if isSticky {
-			newPos = -newPos
+		newPos, isPending := createComment(r, &sess, topicID, topicName, parent, content, imageName, isSticky)
+		if isPending {
+			sess.SetFlashMsg("Your comment will be visible to others after a moderator approves it.")
 		}
-
-		db.Exec(`INSERT INTO comments(content, image, topicid, userid, parentid, pos, created_date, updated_date) VALUES(?, ?, ?, ?, ?, ?, ?, ?);`,
-			content, imageName, topicID, sess.UserID, sql.NullInt64{Valid: false}, newPos, int64(time.Now().Unix()), int64(time.Now().Unix()))
-		db.Exec(`UPDATE topics SET num_comments=num_comments+1, activity_date=? WHERE id=?;`, int(time.Now().Unix()), topicID)
-		if models.Config(models.AllowTopicSubscription) != "0" {
-			var userName string
-			db.QueryRow(`SELECT username FROM users WHERE id=?;`, sess.UserID).Scan(&userName)
-			topicURL := "http://" + r.Host + "/topics?id=" + topicID
-			rows := db.Query(`SELECT users.email, topicsubscriptions.token FROM users INNER JOIN topicsubscriptions ON users.id=topicsubscriptions.userid AND topicsubscriptions.topicid=?;`, topicID)
-			for rows.Next() {
-				var email, token string
-				rows.Scan(&email, &token)
-				if email != "" {
-					unSubURL := "http://" + r.Host + "/topics/unsubscribe?token=" + token
-					utils.SendMail(email, `New comment in "`+topicName+`"`,
-						"A new comment has been posted by "+userName+" in \""+topicName+"\".\r\nSee the comment at "+topicURL+"\r\n\r\nIf you do not want these emails, unsubscribe by following this link: "+unSubURL)
-				}
-			}
+		if parent.Valid {
+			var newCommentID string
+			db.QueryRow(`SELECT id FROM comments WHERE topicid=? AND pos=?;`, topicID, newPos).Scan(&newCommentID)
+			http.Redirect(w, r, "/comments?id="+parentID+"#comment-"+newCommentID, http.StatusSeeOther)
+			return
 		}
 		page := newPos / numCommentsPerPage
 		if page < 0 {
@@ -155,9 +238,10 @@ var CommentCreateHandler = A(func(w http.ResponseWriter, r *http.Request, sess S
 		"TopicOwnerName":       topicOwnerName,
 		"TopicCreatedDate":     timeAgoFromNow(time.Unix(topicCreatedDate, 0)),
 		"CommentID":            "",
+		"ParentID":             parentID,
 		"TopicName":            topicName,
 		"GroupName":            groupName,
-		"ParentComment":        parentComment,
+		"ParentComment":        formatComment(parentComment, parentCreatedDate),
 		"Content":              quoteContent,
 		"IsSticky":             false,
 		"IsMod":                isMod,
@@ -172,49 +256,35 @@ var CommentUpdateHandler = A(func(w http.ResponseWriter, r *http.Request, sess S
 	content := strings.TrimSpace(r.PostFormValue("content"))
 	isSticky := r.PostFormValue("is_sticky") != ""
 
-	var groupID, topicID, groupName, topicName, parentComment, topicOwnerName, topicOwnerID string
+	var topicName, parentComment, topicOwnerName, topicOwnerID string
 	var topicCreatedDate int64
 	var pos int
-	if db.QueryRow(`SELECT topicid, pos FROM comments WHERE id=?;`, commentID).Scan(&topicID, &pos) != nil {
+	perms, err := readCommentPerms(&sess, commentID)
+	if err == errNotFound {
 		ErrNotFoundHandler(w, r)
 		return
 	}
-	if db.QueryRow(`SELECT userid, groupid, title, content, created_date FROM topics WHERE id=?;`, topicID).Scan(
-		&topicOwnerID, &groupID, &topicName, &parentComment, &topicCreatedDate) != nil {
-		ErrNotFoundHandler(w, r)
-		return
-	}
-	isClosed := true
-	db.QueryRow(`SELECT is_closed FROM groups WHERE id=?;`, groupID).Scan(&isClosed)
-	if !isClosed {
-		db.QueryRow(`SELECT is_closed FROM topics WHERE id=?;`, topicID).Scan(&isClosed)
-	}
-
-	if isClosed {
+	if err != nil || !perms.CanEdit() {
 		ErrForbiddenHandler(w, r)
 		return
 	}
-
+	topicID, groupName := perms.TopicID, perms.GroupName
+	isMod, isAdmin, isSuperAdmin := perms.IsMod, perms.IsAdmin, perms.IsSuperAdmin
+	db.QueryRow(`SELECT pos FROM comments WHERE id=?;`, commentID).Scan(&pos)
+	db.QueryRow(`SELECT userid, title, content, created_date FROM topics WHERE id=?;`, topicID).Scan(
+		&topicOwnerID, &topicName, &parentComment, &topicCreatedDate)
 	db.QueryRow(`SELECT username FROM users WHERE id=?;`, topicOwnerID).Scan(&topicOwnerName)
 
-	var tmp string
-	db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName)
-	isMod := db.QueryRow(`SELECT id FROM mods WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
-	isAdmin := db.QueryRow(`SELECT id FROM admins WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
-	isSuperAdmin := false
-	db.QueryRow(`SELECT is_superadmin FROM users WHERE id=?`, sess.UserID).Scan(&isSuperAdmin)
-	isOwner := db.QueryRow(`SELECT userid FROM comments WHERE id=?;`, commentID).Scan(&tmp) == nil
-
-	if !isOwner && !isMod && !isAdmin && !isSuperAdmin {
-		ErrForbiddenHandler(w, r)
-		return
-	}
-
 	if r.Method == "POST" {
 		action := r.PostFormValue("action")
 		if action == "Update" {
-			if len(content) < 2 || len(content) > 5000 {
-				sess.SetFlashMsg("Comment should have 2-5000 characters.")
+			if err := checkCanPost(r, &sess, perms.GroupID); err != nil {
+				sess.SetFlashMsg(err.Error())
+				http.Redirect(w, r, "/comments/edit?id="+commentID, http.StatusSeeOther)
+				return
+			}
+			if err := validateComment(content, false); err != nil {
+				sess.SetFlashMsg(err.Error())
 				http.Redirect(w, r, "/comments/edit?id="+commentID, http.StatusSeeOther)
 				return
 			}
@@ -222,19 +292,21 @@ var CommentUpdateHandler = A(func(w http.ResponseWriter, r *http.Request, sess S
 				http.Redirect(w, r, "/comments/edit?id="+commentID, http.StatusSeeOther)
 				return
 			}
-			if !isMod && !isAdmin && !isSuperAdmin {
+			if !perms.CanModerate() {
 				isSticky = (pos < 0)
 			}
-			if isSticky {
-				if pos > 0 {
-					pos = -pos
-				}
-			} else {
-				if pos < 0 {
-					pos = -pos
-				}
-			}
+			var oldContent string
+			db.QueryRow(`SELECT content FROM comments WHERE id=?;`, commentID).Scan(&oldContent)
+			wasSticky := pos < 0
+			pos = stickyPos(pos, isSticky)
 			db.Exec(`UPDATE comments SET content=?, pos=?, updated_date=? WHERE id=?;`, content, pos, int64(time.Now().Unix()), commentID)
+			notifyCommentModAction(&sess, perms, commentID, "edited")
+			if content != oldContent {
+				auditComment(r, &sess, perms, commentID, models.AuditCommentEdit, oldContent, content)
+			}
+			if isSticky != wasSticky {
+				auditComment(r, &sess, perms, commentID, models.AuditCommentSticky, strconv.FormatBool(wasSticky), strconv.FormatBool(isSticky))
+			}
 			page := pos / numCommentsPerPage
 			if page < 0 {
 				page = 0
@@ -243,10 +315,14 @@ var CommentUpdateHandler = A(func(w http.ResponseWriter, r *http.Request, sess S
 		}
 		if action == "Delete" {
 			db.Exec(`UPDATE comments SET is_deleted=1 WHERE id=?;`, commentID)
+			notifyCommentModAction(&sess, perms, commentID, "deleted")
+			auditComment(r, &sess, perms, commentID, models.AuditCommentDelete, "", "")
 			http.Redirect(w, r, "/comments/edit?id="+commentID, http.StatusSeeOther)
 		}
-		if action == "Undelete" {
+		if action == "Undelete" && perms.CanModerate() {
 			db.Exec(`UPDATE comments SET is_deleted=0 WHERE id=?;`, commentID)
+			notifyCommentModAction(&sess, perms, commentID, "restored")
+			auditComment(r, &sess, perms, commentID, models.AuditCommentUndelete, "", "")
 			http.Redirect(w, r, "/comments/edit?id="+commentID, http.StatusSeeOther)
 		}
 		return
@@ -261,9 +337,10 @@ var CommentUpdateHandler = A(func(w http.ResponseWriter, r *http.Request, sess S
 		"TopicOwnerName":       topicOwnerName,
 		"TopicCreatedDate":     timeAgoFromNow(time.Unix(topicCreatedDate, 0)),
 		"CommentID":            commentID,
+		"ParentID":             "",
 		"TopicName":            topicName,
 		"GroupName":            groupName,
-		"ParentComment":        parentComment,
+		"ParentComment":        formatComment(parentComment, topicCreatedDate),
 		"Content":              content,
 		"IsSticky":             isSticky,
 		"IsMod":                isMod,
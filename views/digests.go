@@ -0,0 +1,140 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/utils"
+	"log"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+var digestCheckInterval = 10 * time.Minute
+
+// digestPeriods is how often digests are sent, in seconds.
+var digestPeriods = map[string]int64{
+	models.DigestDaily:  24 * 60 * 60,
+	models.DigestWeekly: 7 * 24 * 60 * 60,
+}
+
+type digestUser struct {
+	ID           string
+	UserName     string
+	Email        string
+	Digest       string
+	SentDate     int64
+	IsSuperAdmin bool
+}
+
+// StartDigestScheduler periodically e-mails digests to users who have asked for them.
+func StartDigestScheduler() {
+	go func() {
+		for {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						log.Printf("[ERROR] Error sending digests: %s\n[INFO] Debug stack: %s\n", r, debug.Stack())
+					}
+				}()
+				sendDigests(time.Now())
+			}()
+			time.Sleep(digestCheckInterval)
+		}
+	}()
+}
+
+// sendDigests e-mails the users whose digest is due and returns the number of e-mails sent.
+// A digest covers the posts from the user's digest_sent_date up to now, and digest_sent_date
+// is then moved to now. Since each digest starts where the previous one stopped, restarts
+// don't duplicate or drop posts. Digests wait until the forum URL is set, since there is no
+// request to take the links' host from.
+func sendDigests(now time.Time) int {
+	if models.Config(models.ForumURL) == "" {
+		return 0
+	}
+	var users []digestUser
+	rows := db.Query(`SELECT id, username, email, digest, digest_sent_date, is_superadmin FROM users
+		WHERE (digest=? OR digest=?) AND is_banned=0 AND email<>'';`, models.DigestDaily, models.DigestWeekly)
+	for rows.Next() {
+		u := digestUser{}
+		rows.Scan(&u.ID, &u.UserName, &u.Email, &u.Digest, &u.SentDate, &u.IsSuperAdmin)
+		users = append(users, u)
+	}
+
+	numSent := 0
+	for _, u := range users {
+		period := digestPeriods[u.Digest]
+		if now.Unix()-u.SentDate < period {
+			continue
+		}
+		since := u.SentDate
+		if since == 0 {
+			since = now.Unix() - period
+		}
+		body := digestBody(u, since, now.Unix())
+		db.Exec(`UPDATE users SET digest_sent_date=? WHERE id=?;`, now.Unix(), u.ID)
+		if body != "" {
+			subject := "Daily digest from " + models.Config(models.ForumName)
+			if u.Digest == models.DigestWeekly {
+				subject = "Weekly digest from " + models.Config(models.ForumName)
+			}
+			utils.SendMail(u.Email, subject, body)
+			numSent++
+		}
+	}
+	return numSent
+}
+
+// digestBody lists the topics published in the user's subscribed groups and the comments
+// published in the user's subscribed topics in [since, until). Posts held for approval are
+// published when they are approved. It returns "" if there is nothing new.
+func digestBody(u digestUser, since int64, until int64) string {
+	baseURL := models.Config(models.ForumURL)
+	body := ""
+	if models.Config(models.AllowGroupSubscription) != "0" {
+		rows := db.Query(`SELECT topics.id, topics.title, groups.name, users.username FROM topics
+			INNER JOIN groupsubscriptions ON groupsubscriptions.groupid=topics.groupid AND groupsubscriptions.userid=?
+			INNER JOIN groups ON groups.id=topics.groupid INNER JOIN users ON users.id=topics.userid
+			WHERE topics.published_date >= ? AND topics.published_date < ? AND topics.is_deleted=0 AND topics.is_pending=0 AND topics.userid<>?
+			AND groups.is_closed=0 AND `+models.VisibleGroupsSQL+` ORDER BY topics.published_date;`,
+			u.ID, since, until, u.ID, u.IsSuperAdmin, u.ID)
+		topics := ""
+		for rows.Next() {
+			var topicID, title, groupName, author string
+			rows.Scan(&topicID, &title, &groupName, &author)
+			topics += "- \"" + censor(title) + "\" by " + author + " in " + groupName + ": " + baseURL + "/topics?id=" + topicID + "\r\n"
+		}
+		if topics != "" {
+			body += "New topics in your groups:\r\n" + topics + "\r\n"
+		}
+	}
+	if models.Config(models.AllowTopicSubscription) != "0" {
+		rows := db.Query(`SELECT topics.id, topics.title, COUNT(comments.id) FROM comments
+			INNER JOIN topicsubscriptions ON topicsubscriptions.topicid=comments.topicid AND topicsubscriptions.userid=?
+			INNER JOIN topics ON topics.id=comments.topicid INNER JOIN groups ON groups.id=topics.groupid
+			WHERE comments.published_date >= ? AND comments.published_date < ? AND comments.is_deleted=0 AND comments.is_pending=0 AND comments.userid<>?
+			AND topics.is_deleted=0 AND topics.is_pending=0 AND groups.is_closed=0 AND `+models.VisibleGroupsSQL+`
+			GROUP BY topics.id, topics.title ORDER BY MIN(comments.published_date);`,
+			u.ID, since, until, u.ID, u.IsSuperAdmin, u.ID)
+		comments := ""
+		for rows.Next() {
+			var topicID, title string
+			var numComments int
+			rows.Scan(&topicID, &title, &numComments)
+			comments += "- " + strconv.Itoa(numComments) + " new comment(s) in \"" + censor(title) + "\": " + baseURL + "/topics?id=" + topicID + "\r\n"
+		}
+		if comments != "" {
+			body += "New comments in your topics:\r\n" + comments + "\r\n"
+		}
+	}
+	if body == "" {
+		return ""
+	}
+	return body + "To change how often you get these e-mails, update your profile at " + baseURL + "/users?u=" + url.QueryEscape(u.UserName)
+}
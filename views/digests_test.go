@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigests(t *testing.T) {
+	oldAllow := models.Config(models.AllowGroupSubscription)
+	models.WriteConfig(models.AllowGroupSubscription, "1")
+	defer models.WriteConfig(models.AllowGroupSubscription, oldAllow)
+	oldURL := models.Config(models.ForumURL)
+	defer models.WriteConfig(models.ForumURL, oldURL)
+
+	models.CreateUser("dgreader", "dgreader12345", "dgreader@example.com")
+	models.CreateUser("dgposter", "dgposter12345", "")
+	readerID, _ := models.ReadUserIDByName("dgreader")
+	posterID, _ := models.ReadUserIDByName("dgposter")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"dggroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("dggroup")
+	db.Exec(`INSERT INTO groupsubscriptions(userid, groupid, token, created_date) VALUES(?, ?, ?, ?);`, readerID, groupID, randSeq(64), time.Now().Unix())
+
+	start := time.Now().Add(-time.Hour)
+	db.Exec(`UPDATE users SET digest=?, digest_sent_date=? WHERE id=?;`, models.DigestDaily, start.Unix(), readerID)
+	postTopic := func(title string, date time.Time) {
+		db.Exec(`INSERT INTO topics(title, content, userid, groupid, created_date, updated_date, activity_date, published_date) VALUES(?, ?, ?, ?, ?, ?, ?, ?);`,
+			title, "", posterID, groupID, date.Unix(), date.Unix(), date.Unix(), date.Unix())
+	}
+	postTopic("First digest topic", start.Add(time.Minute))
+
+	if n := sendDigests(start.Add(time.Hour)); n != 0 {
+		t.Errorf("Digest sent before the period elapsed: %d", n)
+	}
+	u := digestUser{ID: strconv.Itoa(readerID), UserName: "dgreader", Digest: models.DigestDaily}
+	if body := digestBody(u, start.Unix(), start.Add(time.Hour).Unix()); !strings.Contains(body, "First digest topic") {
+		t.Errorf("Digest does not have topic: %s", body)
+	}
+
+	day := start.Add(24 * time.Hour)
+	models.WriteConfig(models.ForumURL, "")
+	if n := sendDigests(day); n != 0 {
+		t.Errorf("Digest sent before the forum URL was set: %d", n)
+	}
+	models.WriteConfig(models.ForumURL, "https://forum.example.com")
+	if n := sendDigests(day); n != 1 {
+		t.Errorf("Daily digest not sent: %d", n)
+	}
+	if n := sendDigests(day.Add(24 * time.Hour)); n != 0 {
+		t.Errorf("Digest sent with nothing new: %d", n)
+	}
+	// A topic posted exactly at the watermark goes into the next digest.
+	postTopic("Second digest topic", day.Add(24*time.Hour))
+	var sentDate int64
+	db.QueryRow(`SELECT digest_sent_date FROM users WHERE id=?;`, readerID).Scan(&sentDate)
+	if body := digestBody(u, sentDate, day.Add(48*time.Hour).Unix()); !strings.Contains(body, "Second digest topic") || strings.Contains(body, "First digest topic") {
+		t.Errorf("Digest after watermark: %s", body)
+	}
+
+	// A topic held for approval goes into the digest after it is approved, even though it
+	// was posted before the watermark.
+	db.Exec(`INSERT INTO topics(title, content, userid, groupid, is_pending, created_date, updated_date, activity_date, published_date) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		"Held digest topic", "", posterID, groupID, true, sentDate-60, sentDate-60, sentDate-60, sentDate-60)
+	var heldID string
+	db.QueryRow(`SELECT id FROM topics WHERE title=?;`, "Held digest topic").Scan(&heldID)
+	postFromForTest(GroupPendingHandler, "/groups/pending?id="+groupID, url.Values{"kind": {models.PendingTopic}, "postid": {heldID}, "action": {"Approve"}}, sessionForTest("admin"), "192.0.2.1:4000")
+	if body := digestBody(u, time.Now().Unix()-60, time.Now().Unix()+60); !strings.Contains(body, "Held digest topic") {
+		t.Errorf("Digest doesn't have a topic approved after it was posted: %s", body)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"errors"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/templates"
+	"github.com/s-gv/orangeforum/utils"
+	"net/http"
+	"net/mail"
+	"time"
+)
+
+// A confirmation e-mail can be resent once every emailResendInterval.
+const emailResendInterval = time.Minute
+
+var errEmailNotVerified = errors.New("Confirm your e-mail address from your profile page before posting.")
+
+func validateEmail(email string) error {
+	if len(email) > 64 {
+		return errors.New("Email should have fewer than 64 characters.")
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return errors.New("Invalid e-mail address.")
+	}
+	return checkEmailBlocked(email)
+}
+
+// sendEmailConfirmation saves email as the pending address of the user, and e-mails it a
+// link to confirm it.
+func sendEmailConfirmation(r *http.Request, userID string, userName string, email string) {
+	token := randSeq(40)
+	models.SetPendingEmail(userID, email, token)
+
+	forumName := models.Config(models.ForumName)
+	link := "https://" + r.Host + "/users/verifyemail?t=" + token
+	sub := forumName + " E-mail Confirmation"
+	msg := "Someone (hopefully you) set this as the e-mail address of " + userName + " at " + forumName + ".\r\n" +
+		"To confirm it, visit " + link + "\r\n\r\nIf not, just ignore this message."
+	utils.SendMail(email, sub, msg)
+}
+
+// updateEmail changes the e-mail address of the user. Removing the address takes effect
+// at once, but a new address is used only after it is confirmed. Saving an unconfirmed
+// address again sends a link to confirm it. It returns a message for
+// the user.
+func updateEmail(r *http.Request, userID string, userName string, email string) (string, error) {
+	var oldEmail string
+	db.QueryRow(`SELECT email FROM users WHERE id=?;`, userID).Scan(&oldEmail)
+	if email == oldEmail && (email == "" || models.IsEmailVerified(userID)) {
+		return "", nil
+	}
+	if email == "" {
+		models.RemoveUserEmail(userID)
+		return "E-mail address removed.", nil
+	}
+	if err := validateEmail(email); err != nil {
+		return "", err
+	}
+	if pendingEmail, tokenDate := models.ReadPendingEmail(userID); pendingEmail == email && time.Unix(tokenDate, 0).After(time.Now().Add(-emailResendInterval)) {
+		return "Confirmation link already sent to " + email + ". Try again in a minute.", nil
+	}
+	sendEmailConfirmation(r, userID, userName, email)
+	return "Confirmation link sent to " + email + ". The new address is used after it is confirmed.", nil
+}
+
+// checkEmailVerified returns errEmailNotVerified if the forum requires a confirmed e-mail
+// address to post and the user doesn't have one. Superadmins can always post.
+func checkEmailVerified(sess *Session) error {
+	if models.Config(models.RequireVerifiedEmail) != "1" || sess.IsUserSuperAdmin() {
+		return nil
+	}
+	if !models.IsEmailVerified(sessUserID(sess)) {
+		return errEmailNotVerified
+	}
+	return nil
+}
+
+var VerifyEmailHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	token := r.FormValue("t")
+	userID, email, err := models.ReadPendingEmailByToken(token)
+	if err != nil {
+		sess.SetFlashMsg(err.Error())
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	var userName string
+	db.QueryRow(`SELECT username FROM users WHERE id=?;`, userID).Scan(&userName)
+	if r.Method == "POST" {
+		models.ConfirmEmail(token)
+		sess.SetFlashMsg("E-mail address confirmed.")
+		if sessUserID(&sess) == userID {
+			http.Redirect(w, r, "/users?u="+userName, http.StatusSeeOther)
+		} else {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		}
+		return
+	}
+	templates.Render(w, "verifyemail.html", map[string]interface{}{
+		"Common":   readCommonData(r, sess),
+		"Token":    token,
+		"UserName": userName,
+		"Email":    email,
+	})
+})
@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailVerification(t *testing.T) {
+	anonSess := randSeq(32)
+	db.Exec(`INSERT INTO sessions(sessionid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		anonSess, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+	signup := url.Values{"username": {"carol"}, "passwd": {"carol12345"}, "confirm": {"carol12345"}}
+	signup.Set("email", "carol@example.com\r\nBcc: x@example.com")
+	postFromForTest(SignupHandler, "/signup", signup, anonSess, "192.0.2.50:4000")
+	if models.ProbeUser("carol") {
+		t.Fatalf("Signed up with an invalid e-mail address")
+	}
+	signup.Set("email", "carol@example.com")
+	postFromForTest(SignupHandler, "/signup", signup, anonSess, "192.0.2.50:4000")
+	carolID, err := models.ReadUserIDByName("carol")
+	if err != nil {
+		t.Fatalf("Signup failed")
+	}
+	if models.ReadUserEmail("carol") != "" {
+		t.Errorf("E-mail address saved before it was confirmed")
+	}
+	var token string
+	db.QueryRow(`SELECT email_token FROM users WHERE id=?;`, carolID).Scan(&token)
+	var numMails int
+	db.QueryRow(`SELECT COUNT(*) FROM outbox WHERE recipient=? AND body LIKE ?;`, "carol@example.com", "%"+token+"%").Scan(&numMails)
+	if token == "" || numMails != 1 {
+		t.Fatalf("Confirmation link not sent")
+	}
+
+	models.WriteConfig(models.RequireVerifiedEmail, "1")
+	defer models.WriteConfig(models.RequireVerifiedEmail, "0")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"emailgroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("emailgroup")
+	carolSess := sessionForTest("carol")
+	numTopics := func() int {
+		var n int
+		db.QueryRow(`SELECT COUNT(*) FROM topics WHERE groupid=?;`, groupID).Scan(&n)
+		return n
+	}
+	postTopic := url.Values{"gid": {groupID}, "title": {"Hello there"}, "content": {"First post"}}
+	postFromForTest(TopicCreateHandler, "/topics/new", postTopic, carolSess, "192.0.2.50:4000")
+	if numTopics() != 0 {
+		t.Errorf("Posted without a confirmed e-mail address")
+	}
+	numMessages := func() int {
+		var n int
+		db.QueryRow(`SELECT COUNT(*) FROM messages WHERE fromid=?;`, carolID).Scan(&n)
+		return n
+	}
+	postFromForTest(PrivateMessageCreateHandler, "/pm/new", url.Values{"to": {"admin"}, "content": {"Hi"}}, carolSess, "192.0.2.50:4000")
+	if rr := apiRequestForTest(APIMessagesHandler, "POST", "/api/v1/messages", `{"to": ["admin"], "content": "Hi"}`, carolSess); rr.Code != http.StatusForbidden || numMessages() != 0 {
+		t.Errorf("Sent a private message without a confirmed e-mail address: %d", rr.Code)
+	}
+
+	if rr := getForTest(VerifyEmailHandler, "/users/verifyemail?t="+token, ""); !strings.Contains(rr.Body.String(), "carol@example.com") {
+		t.Errorf("Confirmation page doesn't show the address")
+	}
+	if models.ReadUserEmail("carol") != "" {
+		t.Errorf("E-mail address confirmed by GET")
+	}
+	postFromForTest(VerifyEmailHandler, "/users/verifyemail", url.Values{"t": {token}}, carolSess, "192.0.2.50:4000")
+	if models.ReadUserEmail("carol") != "carol@example.com" {
+		t.Fatalf("E-mail address not confirmed")
+	}
+	postFromForTest(TopicCreateHandler, "/topics/new", postTopic, carolSess, "192.0.2.50:4000")
+	if numTopics() != 1 {
+		t.Errorf("Not allowed to post with a confirmed e-mail address")
+	}
+
+	update := url.Values{"u": {"carol"}, "action": {"Update"}, "email": {"carol2@example.com"}, "digest": {models.DigestImmediate}}
+	postFromForTest(UserProfileUpdateHandler, "/users/update", update, carolSess, "192.0.2.50:4000")
+	pendingEmail, _ := models.ReadPendingEmail(strconv.Itoa(carolID))
+	if models.ReadUserEmail("carol") != "carol@example.com" || pendingEmail != "carol2@example.com" {
+		t.Fatalf("E-mail change took effect before it was confirmed")
+	}
+	update.Set("about", "Hi")
+	update.Set("email", "carol@example.com")
+	postFromForTest(UserProfileUpdateHandler, "/users/update", update, carolSess, "192.0.2.50:4000")
+	if pendingEmail, _ := models.ReadPendingEmail(strconv.Itoa(carolID)); pendingEmail != "carol2@example.com" {
+		t.Errorf("Pending e-mail change lost when updating the profile")
+	}
+
+	db.QueryRow(`SELECT email_token FROM users WHERE id=?;`, carolID).Scan(&token)
+	db.Exec(`UPDATE users SET email_token_date=? WHERE id=?;`, time.Now().Add(-models.EmailTokenExpiry-time.Minute).Unix(), carolID)
+	if rr := postFromForTest(VerifyEmailHandler, "/users/verifyemail", url.Values{"t": {token}}, carolSess, "192.0.2.50:4000"); rr.Code != http.StatusSeeOther || models.ReadUserEmail("carol") != "carol@example.com" {
+		t.Errorf("Expired confirmation link worked")
+	}
+
+	postFromForTest(UserProfileUpdateHandler, "/users/update", url.Values{"u": {"carol"}, "action": {"Resend"}}, carolSess, "192.0.2.50:4000")
+	var newToken string
+	db.QueryRow(`SELECT email_token FROM users WHERE id=?;`, carolID).Scan(&newToken)
+	if newToken == token {
+		t.Fatalf("Confirmation link not resent")
+	}
+	postFromForTest(VerifyEmailHandler, "/users/verifyemail", url.Values{"t": {newToken}}, carolSess, "192.0.2.50:4000")
+	if models.ReadUserEmail("carol") != "carol2@example.com" {
+		t.Errorf("Resent confirmation link didn't work")
+	}
+
+	// An address saved before confirmation was added.
+	db.Exec(`UPDATE users SET is_email_confirmed=? WHERE id=?;`, false, carolID)
+	postFromForTest(TopicCreateHandler, "/topics/new", postTopic, carolSess, "192.0.2.50:4000")
+	if numTopics() != 1 {
+		t.Errorf("Posted with an unconfirmed e-mail address from before confirmation was added")
+	}
+	update.Set("email", "carol2@example.com")
+	postFromForTest(UserProfileUpdateHandler, "/users/update", update, carolSess, "192.0.2.50:4000")
+	if pendingEmail, _ := models.ReadPendingEmail(strconv.Itoa(carolID)); pendingEmail != "carol2@example.com" {
+		t.Errorf("Confirmation link not sent to an unconfirmed address saved again")
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var numFeedEntries = 30
+
+type feedEntry struct {
+	ID      string
+	Title   string
+	URL     string
+	Author  string
+	Content string // HTML
+	Date    time.Time
+}
+
+type feed struct {
+	Title   string
+	URL     string
+	FeedURL string
+	Updated time.Time
+	Entries []feedEntry
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Link    atomLink `xml:"link"`
+	Author  string   `xml:"author>name"`
+	Updated string   `xml:"updated"`
+	Content atomText `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	Author      string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+}
+
+type rssFeed struct {
+	XMLName       xml.Name  `xml:"rss"`
+	Version       string    `xml:"version,attr"`
+	Title         string    `xml:"channel>title"`
+	Link          string    `xml:"channel>link"`
+	Description   string    `xml:"channel>description"`
+	LastBuildDate string    `xml:"channel>lastBuildDate"`
+	Items         []rssItem `xml:"channel>item"`
+}
+
+func (f *feed) atom() interface{} {
+	a := atomFeed{
+		ID:      f.FeedURL,
+		Title:   f.Title,
+		Links:   []atomLink{{Href: f.URL}, {Href: f.FeedURL, Rel: "self"}},
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+	}
+	for _, e := range f.Entries {
+		a.Entries = append(a.Entries, atomEntry{
+			ID:      e.ID,
+			Title:   e.Title,
+			Link:    atomLink{Href: e.URL},
+			Author:  e.Author,
+			Updated: e.Date.UTC().Format(time.RFC3339),
+			Content: atomText{Type: "html", Body: e.Content},
+		})
+	}
+	return a
+}
+
+func (f *feed) rss() interface{} {
+	rf := rssFeed{
+		Version:       "2.0",
+		Title:         f.Title,
+		Link:          f.URL,
+		Description:   f.Title,
+		LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+	}
+	for _, e := range f.Entries {
+		rf.Items = append(rf.Items, rssItem{
+			Title:       e.Title,
+			Link:        e.URL,
+			GUID:        e.ID,
+			Author:      e.Author,
+			PubDate:     e.Date.UTC().Format(time.RFC1123Z),
+			Description: e.Content,
+		})
+	}
+	return rf
+}
+
+// readFeed builds the feed selected by the request parameters: the latest topics in the
+// forum, or in the group "g", the latest comments in the topic "t", or the latest topics
+// and comments of the user "u". Only content visible to sess is included.
+func readFeed(r *http.Request, sess Session) (feed, error) {
+	host := "http://" + r.Host
+	forumName := models.Config(models.ForumName)
+	isSuperAdmin := sess.IsUserSuperAdmin()
+	f := feed{FeedURL: host + r.URL.Path}
+	if r.URL.RawQuery != "" {
+		f.FeedURL += "?" + r.URL.RawQuery
+	}
+
+	var rows *db.Rows
+	if groupName := r.FormValue("g"); groupName != "" {
+		var groupID string
+		if db.QueryRow(`SELECT id FROM groups WHERE name=? AND is_closed=0;`, groupName).Scan(&groupID) != nil || !sess.CanViewGroup(groupID) {
+			return f, errNotFound
+		}
+		f.Title = groupName + " - " + forumName
+		f.URL = host + "/groups?name=" + url.QueryEscape(groupName)
+		rows = db.Query(`SELECT topics.id, topics.title, topics.content, topics.created_date, users.username
+			FROM topics INNER JOIN users ON users.id=topics.userid
+			WHERE topics.groupid=? AND topics.is_deleted=0 AND topics.is_pending=0 ORDER BY topics.created_date DESC LIMIT ?;`, groupID, numFeedEntries)
+	} else if topicID := r.FormValue("t"); topicID != "" {
+		var groupID, title string
+		if db.QueryRow(`SELECT topics.groupid, topics.title FROM topics INNER JOIN groups ON groups.id=topics.groupid
+			WHERE topics.id=? AND topics.is_deleted=0 AND topics.is_pending=0 AND groups.is_closed=0;`, topicID).Scan(&groupID, &title) != nil || !sess.CanViewGroup(groupID) {
+			return f, errNotFound
+		}
+		f.Title = censor(title) + " - " + forumName
+		f.URL = host + "/topics?id=" + topicID
+		crows := db.Query(`SELECT comments.id, comments.content, comments.created_date, users.username
+			FROM comments INNER JOIN users ON users.id=comments.userid
+			WHERE comments.topicid=? AND comments.is_deleted=0 AND comments.is_pending=0 ORDER BY comments.created_date DESC LIMIT ?;`, topicID, numFeedEntries)
+		for crows.Next() {
+			var id, content, author string
+			var cDate int64
+			crows.Scan(&id, &content, &cDate, &author)
+			f.Entries = append(f.Entries, feedEntry{
+				ID:      host + "/comments?id=" + id,
+				Title:   "Comment by " + author + " in " + censor(title),
+				URL:     host + "/comments?id=" + id,
+				Author:  author,
+				Content: string(formatComment(content, cDate)),
+				Date:    time.Unix(cDate, 0),
+			})
+		}
+	} else if userName := r.FormValue("u"); userName != "" {
+		var userID string
+		if db.QueryRow(`SELECT id FROM users WHERE username=?;`, userName).Scan(&userID) != nil {
+			return f, errNotFound
+		}
+		f.Title = userName + " - " + forumName
+		f.URL = host + "/users?u=" + url.QueryEscape(userName)
+		crows := db.Query(`SELECT comments.id, comments.content, comments.created_date, topics.title
+			FROM comments INNER JOIN topics ON topics.id=comments.topicid INNER JOIN groups ON groups.id=topics.groupid
+			WHERE comments.userid=? AND comments.is_deleted=0 AND comments.is_pending=0 AND topics.is_deleted=0 AND topics.is_pending=0 AND groups.is_closed=0 AND `+models.VisibleGroupsSQL+`
+			ORDER BY comments.created_date DESC LIMIT ?;`, userID, isSuperAdmin, sess.UserID, numFeedEntries)
+		for crows.Next() {
+			var id, content, title string
+			var cDate int64
+			crows.Scan(&id, &content, &cDate, &title)
+			f.Entries = append(f.Entries, feedEntry{
+				ID:      host + "/comments?id=" + id,
+				Title:   "Comment by " + userName + " in " + censor(title),
+				URL:     host + "/comments?id=" + id,
+				Author:  userName,
+				Content: string(formatComment(content, cDate)),
+				Date:    time.Unix(cDate, 0),
+			})
+		}
+		rows = db.Query(`SELECT topics.id, topics.title, topics.content, topics.created_date, users.username
+			FROM topics INNER JOIN users ON users.id=topics.userid INNER JOIN groups ON groups.id=topics.groupid
+			WHERE topics.userid=? AND topics.is_deleted=0 AND topics.is_pending=0 AND groups.is_closed=0 AND `+models.VisibleGroupsSQL+`
+			ORDER BY topics.created_date DESC LIMIT ?;`, userID, isSuperAdmin, sess.UserID, numFeedEntries)
+	} else {
+		f.Title = forumName
+		f.URL = host + "/"
+		rows = db.Query(`SELECT topics.id, topics.title, topics.content, topics.created_date, users.username
+			FROM topics INNER JOIN users ON users.id=topics.userid INNER JOIN groups ON groups.id=topics.groupid
+			WHERE topics.is_deleted=0 AND topics.is_pending=0 AND groups.is_closed=0 AND `+models.VisibleGroupsSQL+`
+			ORDER BY topics.created_date DESC LIMIT ?;`, isSuperAdmin, sess.UserID, numFeedEntries)
+	}
+	if rows != nil {
+		for rows.Next() {
+			var id, title, content, author string
+			var cDate int64
+			rows.Scan(&id, &title, &content, &cDate, &author)
+			f.Entries = append(f.Entries, feedEntry{
+				ID:      host + "/topics?id=" + id,
+				Title:   censor(title),
+				URL:     host + "/topics?id=" + id,
+				Author:  author,
+				Content: string(formatComment(content, cDate)),
+				Date:    time.Unix(cDate, 0),
+			})
+		}
+	}
+
+	sort.SliceStable(f.Entries, func(i, j int) bool { return f.Entries[i].Date.After(f.Entries[j].Date) })
+	if len(f.Entries) > numFeedEntries {
+		f.Entries = f.Entries[:numFeedEntries]
+	}
+	f.Updated = time.Unix(0, 0)
+	if len(f.Entries) > 0 {
+		f.Updated = f.Entries[0].Date
+	}
+	return f, nil
+}
+
+func serveFeed(w http.ResponseWriter, r *http.Request, contentType string, render func(f *feed) interface{}) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("[INFO] Recovered from panic: %s\n[INFO] Debug stack: %s\n", rec, debug.Stack())
+			http.Error(w, "Internal server error. This event has been logged.", http.StatusInternalServerError)
+		}
+	}()
+	// Feed readers don't keep cookies, so don't open a session for them. An API
+	// token can be used to read the feeds of private groups.
+	sess, isToken, err := readTokenSession(r)
+	if isToken && err != nil {
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if isToken && !sess.HasScope(models.ScopeRead) {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	f, err := readFeed(r, sess)
+	if err != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	body, err := xml.MarshalIndent(render(&f), "", "  ")
+	if err != nil {
+		log.Panicf("[ERROR] Error rendering feed: %s\n", err)
+	}
+	body = append([]byte(xml.Header), body...)
+
+	sum := sha1.Sum(body)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	if isToken {
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(5*60))
+	} else {
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(5*60))
+	}
+	http.ServeContent(w, r, "", f.Updated, bytes.NewReader(body))
+}
+
+func AtomFeedHandler(w http.ResponseWriter, r *http.Request) {
+	serveFeed(w, r, "application/atom+xml; charset=utf-8", (*feed).atom)
+}
+
+func RSSFeedHandler(w http.ResponseWriter, r *http.Request) {
+	serveFeed(w, r, "application/rss+xml; charset=utf-8", (*feed).rss)
+}
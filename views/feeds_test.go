@@ -0,0 +1,78 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFeeds(t *testing.T) {
+	models.CreateUser("feeder", "feeder12345", "")
+	userID, _ := models.ReadUserIDByName("feeder")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"feedpublic", "", time.Now().Unix(), time.Now().Unix())
+	db.Exec(`INSERT INTO groups(name, description, is_private, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		"feedprivate", "", true, time.Now().Unix(), time.Now().Unix())
+	publicID := models.ReadGroupIDByName("feedpublic")
+	privateID := models.ReadGroupIDByName("feedprivate")
+	db.Exec(`INSERT INTO topics(title, content, userid, groupid, created_date, updated_date, activity_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+		"Public feed topic", "Some **bold** text", userID, publicID, time.Now().Unix(), time.Now().Unix(), time.Now().Unix())
+	db.Exec(`INSERT INTO topics(title, content, userid, groupid, is_deleted, created_date, updated_date, activity_date) VALUES(?, ?, ?, ?, ?, ?, ?, ?);`,
+		"Deleted feed topic", "", userID, publicID, true, time.Now().Unix(), time.Now().Unix(), time.Now().Unix())
+	db.Exec(`INSERT INTO topics(title, content, userid, groupid, created_date, updated_date, activity_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+		"Private feed topic", "", userID, privateID, time.Now().Unix(), time.Now().Unix(), time.Now().Unix())
+
+	rr := getForTest(AtomFeedHandler, "/feeds/atom?u=feeder", "")
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "Public feed topic") || !strings.Contains(body, "&lt;strong&gt;bold&lt;/strong&gt;") {
+		t.Errorf("Atom feed does not have topic: got %v, body %s", rr.Code, body)
+	}
+	if strings.Contains(body, "Deleted feed topic") || strings.Contains(body, "Private feed topic") {
+		t.Errorf("Atom feed has deleted or private topic.")
+	}
+	if rr := getForTest(RSSFeedHandler, "/feeds/rss?g=feedprivate", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("RSS feed of private group is public: got %v", rr.Code)
+	}
+	if body := getForTest(RSSFeedHandler, "/feeds/rss?g=feedpublic", "").Body.String(); !strings.Contains(body, "<rss") || !strings.Contains(body, "Public feed topic") {
+		t.Errorf("RSS feed does not have topic: %s", body)
+	}
+
+	models.CreateGroupMember(strconv.Itoa(userID), privateID)
+	readToken, postToken := randSeq(32), randSeq(32)
+	models.CreateAPIToken(strconv.Itoa(userID), "reader", readToken, []string{models.ScopeRead})
+	models.CreateAPIToken(strconv.Itoa(userID), "poster", postToken, []string{models.ScopePost})
+	tokenFeed := func(token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/feeds/rss?g=feedprivate", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		RSSFeedHandler(rr, req)
+		return rr
+	}
+	if rr := tokenFeed(readToken); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Private feed topic") {
+		t.Errorf("Feed of private group not readable with a token: got %v", rr.Code)
+	}
+	if rr := tokenFeed(postToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Feed readable with a token without the read scope: got %v", rr.Code)
+	}
+
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("Feed has no ETag.")
+	}
+	req, _ := http.NewRequest("GET", "/feeds/atom?u=feeder", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	AtomFeedHandler(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Conditional GET of feed: got %v", rr.Code)
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/s-gv/orangeforum/models"
 	"github.com/s-gv/orangeforum/models/db"
 	"github.com/s-gv/orangeforum/templates"
+	"github.com/s-gv/orangeforum/utils"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -17,11 +19,29 @@ import (
 var GroupIndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session) {
 	name := r.FormValue("name")
 	var groupID, groupDesc, headerMsg string
-	if db.QueryRow(`SELECT id, description, header_msg FROM groups WHERE name=?;`, name).Scan(&groupID, &groupDesc, &headerMsg) != nil {
+	var isPrivate bool
+	if db.QueryRow(`SELECT id, description, header_msg, is_private FROM groups WHERE name=?;`, name).Scan(&groupID, &groupDesc, &headerMsg, &isPrivate) != nil {
 		ErrNotFoundHandler(w, r)
 		return
 	}
 
+	if !sess.CanViewGroup(groupID) {
+		isInvited, isRequested := false, false
+		if sess.IsUserValid() {
+			isInvited, isRequested = models.ReadGroupMemberRequest(strconv.FormatInt(sess.UserID.Int64, 10), groupID)
+		}
+		commonData := readCommonData(r, sess)
+		commonData.PageTitle = name
+		templates.Render(w, "groupprivate.html", map[string]interface{}{
+			"Common":      commonData,
+			"GroupName":   name,
+			"GroupID":     groupID,
+			"IsInvited":   isInvited,
+			"IsRequested": isRequested,
+		})
+		return
+	}
+
 	subToken := ""
 	if sess.UserID.Valid {
 		db.QueryRow(`SELECT token FROM groupsubscriptions WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&subToken)
@@ -38,21 +58,29 @@ var GroupIndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Ses
 		Title       string
 		IsDeleted   bool
 		IsClosed    bool
+		IsPending   bool
 		Owner       string
 		NumComments int
 		CreatedDate string
 		cDateUnix   int64
 	}
+	// Topics waiting for approval are only listed for their owners and the mods.
+	pendingFilter := "AND (topics.is_pending=0 OR topics.userid=?)"
+	args := []interface{}{groupID, sess.UserID}
+	if isMod, isAdmin, isSuperAdmin := sess.groupRoles(groupID); isMod || isAdmin || isSuperAdmin {
+		pendingFilter = ""
+		args = []interface{}{groupID}
+	}
 	var topics []Topic
 	var rows *db.Rows
 	if lastTopicDate == 0 {
-		rows = db.Query(`SELECT topics.id, topics.title, topics.is_deleted, topics.is_closed, topics.num_comments, topics.created_date, users.username FROM topics INNER JOIN users ON topics.userid = users.id AND topics.groupid=? ORDER BY topics.is_sticky DESC, topics.activity_date DESC LIMIT ?;`, groupID, numTopicsPerPage)
+		rows = db.Query(`SELECT topics.id, topics.title, topics.is_deleted, topics.is_closed, topics.is_pending, topics.num_comments, topics.created_date, users.username FROM topics INNER JOIN users ON topics.userid = users.id AND topics.groupid=? `+pendingFilter+` ORDER BY topics.is_sticky DESC, topics.activity_date DESC LIMIT ?;`, append(args, numTopicsPerPage)...)
 	} else {
-		rows = db.Query(`SELECT topics.id, topics.title, topics.is_deleted, topics.is_closed, topics.num_comments, topics.created_date, users.username FROM topics INNER JOIN users ON topics.userid = users.id AND topics.groupid=? AND topics.is_sticky=0 AND topics.created_date < ? ORDER BY topics.activity_date DESC LIMIT ?;`, groupID, lastTopicDate, numTopicsPerPage)
+		rows = db.Query(`SELECT topics.id, topics.title, topics.is_deleted, topics.is_closed, topics.is_pending, topics.num_comments, topics.created_date, users.username FROM topics INNER JOIN users ON topics.userid = users.id AND topics.groupid=? `+pendingFilter+` AND topics.is_sticky=0 AND topics.created_date < ? ORDER BY topics.activity_date DESC LIMIT ?;`, append(args, lastTopicDate, numTopicsPerPage)...)
 	}
 	for rows.Next() {
 		t := Topic{}
-		rows.Scan(&t.ID, &t.Title, &t.IsDeleted, &t.IsClosed, &t.NumComments, &t.cDateUnix, &t.Owner)
+		rows.Scan(&t.ID, &t.Title, &t.IsDeleted, &t.IsClosed, &t.IsPending, &t.NumComments, &t.cDateUnix, &t.Owner)
 		t.CreatedDate = timeAgoFromNow(time.Unix(t.cDateUnix, 0))
 		t.Title = censor(t.Title)
 		topics = append(topics, t)
@@ -61,11 +89,24 @@ var GroupIndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Ses
 	isSuperAdmin := false
 	isAdmin := false
 	isMod := false
+	isMember := false
 	if sess.IsUserValid() {
 		db.QueryRow(`SELECT is_superadmin FROM users WHERE id=?;`, sess.UserID).Scan(&isSuperAdmin)
 		var tmp string
 		isAdmin = db.QueryRow(`SELECT id FROM admins WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
 		isMod = db.QueryRow(`SELECT id FROM mods WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
+		isMember = db.QueryRow(`SELECT id FROM members WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
+	}
+
+	banMsg := ""
+	if ban, err := models.ReadGroupBan(groupID, sessUserID(&sess)); err == nil {
+		banMsg = groupBanMsg(ban)
+	}
+
+	numReports, numPending := 0, 0
+	if isMod || isAdmin || isSuperAdmin {
+		numReports = models.NumOpenReports(groupID)
+		numPending = models.NumPendingPosts(groupID)
 	}
 
 	if len(topics) >= numTopicsPerPage {
@@ -76,6 +117,7 @@ var GroupIndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Ses
 
 	commonData := readCommonData(r, sess)
 	commonData.PageTitle = name
+	commonData.FeedURL = "?g=" + url.QueryEscape(name)
 
 	templates.Render(w, "groupindex.html", map[string]interface{}{
 		"Common":        commonData,
@@ -88,6 +130,11 @@ var GroupIndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Ses
 		"IsMod":         isMod,
 		"IsAdmin":       isAdmin,
 		"IsSuperAdmin":  isSuperAdmin,
+		"IsPrivate":     isPrivate,
+		"IsMember":      isMember,
+		"NumReports":    numReports,
+		"NumPending":    numPending,
+		"BanMsg":        banMsg,
 		"LastTopicDate": lastTopicDate,
 	})
 })
@@ -108,6 +155,7 @@ var GroupEditHandler = A(func(w http.ResponseWriter, r *http.Request, sess Sessi
 	isSticky := r.FormValue("is_sticky") != ""
 	isPrivate := r.FormValue("is_private") != ""
 	isDeleted := false
+	premodAccountAge, premodNumPosts, premodErr := parsePremodThresholds(r.FormValue("premod_account_age"), r.FormValue("premod_num_posts"))
 	mods := strings.Split(r.FormValue("mods"), ",")
 	for i, mod := range mods {
 		mods[i] = strings.TrimSpace(mod)
@@ -160,7 +208,13 @@ var GroupEditHandler = A(func(w http.ResponseWriter, r *http.Request, sess Sessi
 				http.Redirect(w, r, "/groups/edit", http.StatusSeeOther)
 				return
 			}
-			db.Exec(`INSERT INTO groups(name, description, header_msg, is_sticky, is_private, created_date, updated_date) VALUES(?, ?, ?, ?, ?, ?, ?);`, name, desc, headerMsg, isSticky, isPrivate, time.Now().Unix(), time.Now().Unix())
+			if premodErr != nil {
+				sess.SetFlashMsg(premodErr.Error())
+				http.Redirect(w, r, "/groups/edit", http.StatusSeeOther)
+				return
+			}
+			db.Exec(`INSERT INTO groups(name, description, header_msg, is_sticky, is_private, premod_account_age, premod_num_posts, created_date, updated_date) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+				name, desc, headerMsg, isSticky, isPrivate, premodAccountAge, premodNumPosts, time.Now().Unix(), time.Now().Unix())
 			groupID := models.ReadGroupIDByName(name)
 			for _, mod := range mods {
 				if mod != "" {
@@ -204,12 +258,18 @@ var GroupEditHandler = A(func(w http.ResponseWriter, r *http.Request, sess Sessi
 				http.Redirect(w, r, "/groups/edit?id="+groupID, http.StatusSeeOther)
 				return
 			}
-			isUserSuperAdmin := false
-			db.QueryRow(`SELECT is_superadmin FROM users WHERE id=?;`, sess.UserID).Scan(&isUserSuperAdmin)
-			if !isUserSuperAdmin {
+			if premodErr != nil {
+				sess.SetFlashMsg(premodErr.Error())
+				http.Redirect(w, r, "/groups/edit?id="+groupID, http.StatusSeeOther)
+				return
+			}
+			if !commonData.IsSuperAdmin {
 				db.QueryRow(`SELECT is_sticky FROM groups WHERE id=?;`, groupID).Scan(&isSticky)
 			}
-			db.Exec(`UPDATE groups SET name=?, description=?, header_msg=?, is_sticky=?, is_private=?, updated_date=? WHERE id=?;`, name, desc, headerMsg, isSticky, isPrivate, time.Now().Unix(), groupID)
+			oldMods := strings.Join(models.ReadMods(groupID), ", ")
+			oldAdmins := strings.Join(models.ReadAdmins(groupID), ", ")
+			db.Exec(`UPDATE groups SET name=?, description=?, header_msg=?, is_sticky=?, is_private=?, premod_account_age=?, premod_num_posts=?, updated_date=? WHERE id=?;`,
+				name, desc, headerMsg, isSticky, isPrivate, premodAccountAge, premodNumPosts, time.Now().Unix(), groupID)
 			db.Exec(`DELETE FROM mods WHERE groupid=?;`, groupID)
 			db.Exec(`DELETE FROM admins WHERE groupid=?;`, groupID)
 			for _, mod := range mods {
@@ -222,12 +282,22 @@ var GroupEditHandler = A(func(w http.ResponseWriter, r *http.Request, sess Sessi
 					models.CreateGroupAdmin(admin, groupID)
 				}
 			}
+			if newMods := strings.Join(models.ReadMods(groupID), ", "); newMods != oldMods {
+				audit(r, &sess, models.AuditEntry{GroupID: groupID, Action: models.AuditGroupMods, TargetID: groupID, Target: name, OldValue: oldMods, NewValue: newMods})
+			}
+			if newAdmins := strings.Join(models.ReadAdmins(groupID), ", "); newAdmins != oldAdmins {
+				audit(r, &sess, models.AuditEntry{GroupID: groupID, Action: models.AuditGroupAdmins, TargetID: groupID, Target: name, OldValue: oldAdmins, NewValue: newAdmins})
+			}
 			http.Redirect(w, r, "/groups?name="+name, http.StatusSeeOther)
 		} else if action == "Delete" {
 			db.Exec(`UPDATE groups SET is_closed=1 WHERE id=?;`, groupID)
+			db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&name)
+			audit(r, &sess, models.AuditEntry{GroupID: groupID, Action: models.AuditGroupDelete, TargetID: groupID, Target: name})
 			http.Redirect(w, r, "/groups/edit?id="+groupID, http.StatusSeeOther)
 		} else if action == "Undelete" {
 			db.Exec(`UPDATE groups SET is_closed=0 WHERE id=?;`, groupID)
+			db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&name)
+			audit(r, &sess, models.AuditEntry{GroupID: groupID, Action: models.AuditGroupUndelete, TargetID: groupID, Target: name})
 			http.Redirect(w, r, "/groups/edit?id="+groupID, http.StatusSeeOther)
 		}
 		return
@@ -235,24 +305,26 @@ var GroupEditHandler = A(func(w http.ResponseWriter, r *http.Request, sess Sessi
 
 	if groupID != "" {
 		// Open to edit
-		db.QueryRow(`SELECT name, description, header_msg, is_sticky, is_private, is_closed FROM groups WHERE id=?;`, groupID).Scan(
-			&name, &desc, &headerMsg, &isSticky, &isPrivate, &isDeleted,
+		db.QueryRow(`SELECT name, description, header_msg, is_sticky, is_private, is_closed, premod_account_age, premod_num_posts FROM groups WHERE id=?;`, groupID).Scan(
+			&name, &desc, &headerMsg, &isSticky, &isPrivate, &isDeleted, &premodAccountAge, &premodNumPosts,
 		)
 		mods = models.ReadMods(groupID)
 		admins = models.ReadAdmins(groupID)
 	}
 
 	templates.Render(w, "groupedit.html", map[string]interface{}{
-		"Common":    readCommonData(r, sess),
-		"ID":        groupID,
-		"GroupName": name,
-		"Desc":      desc,
-		"HeaderMsg": headerMsg,
-		"IsSticky":  isSticky,
-		"IsPrivate": isPrivate,
-		"IsDeleted": isDeleted,
-		"Mods":      strings.Join(mods, ", "),
-		"Admins":    strings.Join(admins, ", "),
+		"Common":           readCommonData(r, sess),
+		"ID":               groupID,
+		"GroupName":        name,
+		"Desc":             desc,
+		"HeaderMsg":        headerMsg,
+		"IsSticky":         isSticky,
+		"IsPrivate":        isPrivate,
+		"IsDeleted":        isDeleted,
+		"PremodAccountAge": premodAccountAge,
+		"PremodNumPosts":   premodNumPosts,
+		"Mods":             strings.Join(mods, ", "),
+		"Admins":           strings.Join(admins, ", "),
 	})
 })
 
@@ -267,6 +339,10 @@ var GroupSubscribeHandler = A(func(w http.ResponseWriter, r *http.Request, sess
 		ErrNotFoundHandler(w, r)
 		return
 	}
+	if !sess.CanViewGroup(groupID) {
+		ErrForbiddenHandler(w, r)
+		return
+	}
 	if r.Method == "POST" {
 		var tmp string
 		if db.QueryRow(`SELECT id FROM groupsubscriptions WHERE userid=? AND groupid=?;`, sess.UserID, groupID).Scan(&tmp) != nil {
@@ -305,3 +381,130 @@ var GroupUnsubscribeHandler = UA(func(w http.ResponseWriter, r *http.Request, se
 	<input type="submit" value="Unsubscribe">
 	</form></body></html>`))
 })
+
+var GroupMembersHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	groupID := r.FormValue("id")
+	var groupName string
+	if db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName) != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	if !models.IsUserGroupAdmin(strconv.FormatInt(sess.UserID.Int64, 10), groupID) && !sess.IsUserSuperAdmin() {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+
+	if r.Method == "POST" {
+		action := r.PostFormValue("action")
+		userID := r.PostFormValue("userid")
+		if action == "Invite" {
+			userName := strings.TrimSpace(r.PostFormValue("username"))
+			var email string
+			if db.QueryRow(`SELECT id, email FROM users WHERE username=?;`, userName).Scan(&userID, &email) != nil {
+				sess.SetFlashMsg("Username not found: " + userName)
+			} else if models.IsUserGroupMember(userID, groupID) {
+				sess.SetFlashMsg(userName + " is already a member.")
+			} else if _, isRequested := models.ReadGroupMemberRequest(userID, groupID); isRequested {
+				models.CreateGroupMember(userID, groupID)
+				sess.SetFlashMsg(userName + " had asked to join and is now a member.")
+			} else {
+				models.CreateGroupMemberRequest(userID, groupID, true)
+				if email != "" {
+					groupURL := "http://" + r.Host + "/groups?name=" + groupName
+					utils.SendMail(email, "Invitation to join "+groupName,
+						"You have been invited to join the private group "+groupName+".\r\nAccept or decline the invitation at "+groupURL)
+				}
+				sess.SetFlashMsg(userName + " invited.")
+			}
+		} else if action == "Approve" {
+			if _, isRequested := models.ReadGroupMemberRequest(userID, groupID); isRequested {
+				models.CreateGroupMember(userID, groupID)
+			}
+		} else if action == "Reject" || action == "Cancel" {
+			models.DeleteGroupMemberRequest(userID, groupID)
+		} else if action == "Remove" {
+			if models.IsUserGroupAdmin(userID, groupID) || models.IsUserGroupMod(userID, groupID) {
+				sess.SetFlashMsg("Remove the user from the admins and mods of the group first.")
+			} else {
+				models.DeleteGroupMember(userID, groupID)
+			}
+		}
+		http.Redirect(w, r, "/groups/members?id="+groupID, http.StatusSeeOther)
+		return
+	}
+
+	type Member struct {
+		UserID      string
+		UserName    string
+		CreatedDate string
+	}
+	readMembers := func(query string) []Member {
+		var members []Member
+		rows := db.Query(query, groupID)
+		for rows.Next() {
+			m := Member{}
+			var cDate int64
+			rows.Scan(&m.UserID, &m.UserName, &cDate)
+			m.CreatedDate = timeAgoFromNow(time.Unix(cDate, 0))
+			members = append(members, m)
+		}
+		return members
+	}
+	members := readMembers(`SELECT users.id, users.username, members.created_date FROM members INNER JOIN users ON members.userid=users.id AND members.groupid=? ORDER BY users.username;`)
+	requests := readMembers(`SELECT users.id, users.username, memberrequests.created_date FROM memberrequests INNER JOIN users ON memberrequests.userid=users.id AND memberrequests.groupid=? AND memberrequests.is_invite=0 ORDER BY memberrequests.created_date;`)
+	invites := readMembers(`SELECT users.id, users.username, memberrequests.created_date FROM memberrequests INNER JOIN users ON memberrequests.userid=users.id AND memberrequests.groupid=? AND memberrequests.is_invite=1 ORDER BY memberrequests.created_date;`)
+
+	commonData := readCommonData(r, sess)
+	commonData.PageTitle = groupName + " members"
+
+	templates.Render(w, "groupmembers.html", map[string]interface{}{
+		"Common":    commonData,
+		"GroupID":   groupID,
+		"GroupName": groupName,
+		"Members":   members,
+		"Requests":  requests,
+		"Invites":   invites,
+	})
+})
+
+var GroupJoinHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	groupID := r.FormValue("id")
+	var groupName string
+	if db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName) != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	if r.Method == "POST" {
+		userID := strconv.FormatInt(sess.UserID.Int64, 10)
+		isInvited, _ := models.ReadGroupMemberRequest(userID, groupID)
+		action := r.PostFormValue("action")
+		if action == "Accept" && isInvited {
+			models.CreateGroupMember(userID, groupID)
+		} else if action == "Decline" && isInvited {
+			models.DeleteGroupMemberRequest(userID, groupID)
+		} else if action == "Request" && !isInvited && !models.IsUserGroupMember(userID, groupID) {
+			models.CreateGroupMemberRequest(userID, groupID, false)
+			sess.SetFlashMsg("Request sent to the group admins.")
+		}
+	}
+	http.Redirect(w, r, "/groups?name="+groupName, http.StatusSeeOther)
+})
+
+var GroupLeaveHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	groupID := r.FormValue("id")
+	var groupName string
+	if db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName) != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	if r.Method == "POST" {
+		userID := strconv.FormatInt(sess.UserID.Int64, 10)
+		if models.IsUserGroupAdmin(userID, groupID) || models.IsUserGroupMod(userID, groupID) {
+			sess.SetFlashMsg("Admins and mods cannot leave the group.")
+			http.Redirect(w, r, "/groups?name="+groupName, http.StatusSeeOther)
+			return
+		}
+		models.DeleteGroupMember(userID, groupID)
+	}
+	http.Redirect(w, r, "/groups?name="+groupName, http.StatusSeeOther)
+})
@@ -0,0 +1,78 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sessionForTest(userName string) string {
+	userID, _ := models.ReadUserIDByName(userName)
+	sessionID := randSeq(32)
+	db.Exec(`INSERT INTO sessions(sessionid, userid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?, ?);`,
+		sessionID, userID, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+	return sessionID
+}
+
+func getForTest(handler http.HandlerFunc, target string, sessionID string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", target, nil)
+	if sessionID != "" {
+		req.AddCookie(&http.Cookie{Name: "sessionid", Path: "/", Value: sessionID, HttpOnly: true})
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPrivateGroup(t *testing.T) {
+	models.CreateUser("pgmember", "pgmember12345", "")
+	models.CreateUser("pgoutsider", "pgoutsider12345", "")
+	memberID, _ := models.ReadUserIDByName("pgmember")
+
+	db.Exec(`INSERT INTO groups(name, description, is_private, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		"pgteam", "Team only", true, time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("pgteam")
+	models.CreateGroupMember(strconv.Itoa(memberID), groupID)
+	db.Exec(`INSERT INTO topics(title, content, userid, groupid, created_date, updated_date, activity_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+		"Secret team roadmap", "", memberID, groupID, time.Now().Unix(), time.Now().Unix(), time.Now().Unix())
+	var topicID string
+	db.QueryRow(`SELECT id FROM topics WHERE groupid=?;`, groupID).Scan(&topicID)
+
+	memberSess := sessionForTest("pgmember")
+	outsiderSess := sessionForTest("pgoutsider")
+
+	if rr := getForTest(TopicIndexHandler, "/topics?id="+topicID, memberSess); rr.Code != http.StatusOK {
+		t.Errorf("Member cannot see topic in private group: got %v", rr.Code)
+	}
+	if rr := getForTest(TopicIndexHandler, "/topics?id="+topicID, outsiderSess); rr.Code != http.StatusNotFound {
+		t.Errorf("Non-member can see topic in private group: got %v", rr.Code)
+	}
+	if rr := getForTest(TopicIndexHandler, "/topics?id="+topicID, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Anonymous user can see topic in private group: got %v", rr.Code)
+	}
+
+	if body := getForTest(IndexHandler, "/", outsiderSess).Body.String(); strings.Contains(body, "Secret team roadmap") {
+		t.Errorf("Index page lists topic in private group to a non-member.")
+	}
+	if body := getForTest(IndexHandler, "/", memberSess).Body.String(); !strings.Contains(body, "Secret team roadmap") {
+		t.Errorf("Index page does not list topic in private group to a member.")
+	}
+
+	body := getForTest(GroupIndexHandler, "/groups?name=pgteam", outsiderSess).Body.String()
+	if strings.Contains(body, "Secret team roadmap") || !strings.Contains(body, "This group is private") {
+		t.Errorf("Private group page shows topics to a non-member. Body: %s\n", body)
+	}
+
+	if body := getForTest(UserTopicsHandler, "/users/topics?u=pgmember", outsiderSess).Body.String(); strings.Contains(body, "Secret team roadmap") {
+		t.Errorf("Profile page lists topic in private group to a non-member.")
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"errors"
+	"fmt"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/templates"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An escalation suspends a user who reaches a number of infraction points for Days days,
+// or bans the user for good if Days is 0.
+type escalation struct {
+	Points int
+	Days   int
+}
+
+// parseEscalations parses the infraction escalations setting, which has lines such as
+// "10 = suspend 7" (suspend for 7 days at 10 points) or "30 = ban".
+func parseEscalations(s string) ([]escalation, error) {
+	var escalations []escalation
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid escalation: %s", line)
+		}
+		points, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		action := strings.Fields(parts[1])
+		if err != nil || points <= 0 || len(action) == 0 {
+			return nil, fmt.Errorf("Invalid escalation: %s", line)
+		}
+		e := escalation{Points: points}
+		if action[0] == "suspend" && len(action) == 2 {
+			if e.Days, err = strconv.Atoi(action[1]); err != nil || e.Days <= 0 {
+				return nil, fmt.Errorf("Invalid escalation: %s", line)
+			}
+		} else if action[0] != "ban" || len(action) != 1 {
+			return nil, fmt.Errorf("Invalid escalation: %s", line)
+		}
+		escalations = append(escalations, e)
+	}
+	return escalations, nil
+}
+
+func expiryDateStr(expiryDate int64) string {
+	return time.Unix(expiryDate, 0).Format("2006-01-02 15:04")
+}
+
+// suspensionMsg tells a suspended user why and for how long.
+func suspensionMsg(until int64, reason string) string {
+	return "You are suspended until " + expiryDateStr(until) + ". Reason: " + reason
+}
+
+// groupBanMsg tells a user banned from a group why and for how long.
+func groupBanMsg(ban models.GroupBan) string {
+	if ban.ExpiryDate == 0 {
+		return "You are banned from posting in this group. Reason: " + ban.Reason
+	}
+	return "You are banned from posting in this group until " + expiryDateStr(ban.ExpiryDate) + ". Reason: " + ban.Reason
+}
+
+// checkCanPost returns an error with the reason and the end of the ban if the user is
+// suspended, or banned from the group, or errIPBlocked if the client is blocked. groupID
+// is "" for private messages.
+func checkCanPost(r *http.Request, sess *Session, groupID string) error {
+	if !sess.IsUserSuperAdmin() && isIPBlocked(remoteIP(r)) {
+		return errIPBlocked
+	}
+	userID := sessUserID(sess)
+	if until, reason := models.ReadSuspension(userID); until != 0 {
+		return errors.New(suspensionMsg(until, reason))
+	}
+	if groupID != "" {
+		if ban, err := models.ReadGroupBan(groupID, userID); err == nil {
+			return errors.New(groupBanMsg(ban))
+		}
+	}
+	return nil
+}
+
+// maxGroupWarningPoints caps the points of a warning from the mods of a group.
+const maxGroupWarningPoints = 10
+
+// infractionPoints is the sum of the points of the user's warnings in the group (or from
+// the superadmins if groupID is "") that have not run out.
+func infractionPoints(userID string, groupID string) int {
+	var minDate int64
+	if days, _ := strconv.Atoi(models.Config(models.InfractionPointsDays)); days > 0 {
+		minDate = time.Now().AddDate(0, 0, -days).Unix()
+	}
+	return models.NumInfractionPoints(userID, groupID, minDate)
+}
+
+// suspendUser stops the user from posting until the given date and tells the user why.
+func suspendUser(r *http.Request, sess *Session, userID string, userName string, until int64, reason string) {
+	models.SuspendUser(userID, until, reason)
+	models.CreateNotification(userID, sessUserID(sess), models.NotifyModAction,
+		"suspended you until "+expiryDateStr(until)+". Reason: "+reason, "/users?u="+url.QueryEscape(userName))
+	audit(r, sess, models.AuditEntry{Action: models.AuditUserSuspend, TargetID: userID, Target: userName,
+		NewValue: "until " + expiryDateStr(until) + ": " + reason})
+}
+
+// banFromGroup stops the user from posting in the group until expiryDate, or for good if
+// it is 0, and tells the user why.
+func banFromGroup(r *http.Request, sess *Session, groupID string, userID string, userName string, reason string, expiryDate int64) {
+	var groupName string
+	db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName)
+	until := "for good"
+	if expiryDate != 0 {
+		until = "until " + expiryDateStr(expiryDate)
+	}
+	models.CreateGroupBan(groupID, userID, reason, expiryDate)
+	models.CreateNotification(userID, sessUserID(sess), models.NotifyModAction,
+		"banned you from posting in "+groupName+" "+until+". Reason: "+reason, "/groups?name="+url.QueryEscape(groupName))
+	audit(r, sess, models.AuditEntry{GroupID: groupID, Action: models.AuditUserGroupBan, TargetID: userID, Target: userName,
+		NewValue: until + ": " + reason})
+}
+
+// warnUser gives the user a warning from the mods of the group, or from the superadmins if
+// groupID is "". Points of the two kinds are counted apart. If the warning brings the
+// user's points up to an escalation, the user is suspended or banned from the forum for a
+// warning from the superadmins, or banned from the group for a warning from its mods; if
+// it reaches several escalations, the strictest one is applied.
+func warnUser(r *http.Request, sess *Session, userID string, userName string, groupID string, reason string, points int) {
+	oldPoints := infractionPoints(userID, groupID)
+	models.CreateWarning(userID, groupID, sessUserID(sess), reason, points)
+	newPoints := oldPoints + points
+	models.CreateNotification(userID, sessUserID(sess), models.NotifyModAction,
+		fmt.Sprintf("warned you (%d points). Reason: %s", points, reason), "/users?u="+url.QueryEscape(userName))
+	audit(r, sess, models.AuditEntry{GroupID: groupID, Action: models.AuditUserWarn, TargetID: userID, Target: userName,
+		NewValue: fmt.Sprintf("%d points: %s", points, reason)})
+
+	escalations, _ := parseEscalations(models.Config(models.InfractionEscalations))
+	var reached *escalation
+	for i, e := range escalations {
+		if oldPoints < e.Points && e.Points <= newPoints && (reached == nil || e.Points > reached.Points) {
+			reached = &escalations[i]
+		}
+	}
+	if reached == nil {
+		return
+	}
+	escalationReason := fmt.Sprintf("Reached %d infraction points. Last warning: %s", newPoints, reason)
+	if groupID != "" {
+		var expiryDate int64
+		if reached.Days != 0 {
+			expiryDate = time.Now().AddDate(0, 0, reached.Days).Unix()
+		}
+		if ban, err := models.ReadGroupBan(groupID, userID); err != nil || (ban.ExpiryDate != 0 && (expiryDate == 0 || ban.ExpiryDate < expiryDate)) {
+			banFromGroup(r, sess, groupID, userID, userName, escalationReason, expiryDate)
+		}
+		return
+	}
+	if reached.Days == 0 {
+		db.Exec(`UPDATE users SET is_banned=1 WHERE id=?;`, userID)
+		db.Exec(`DELETE FROM sessions WHERE userid=?;`, userID)
+		audit(r, sess, models.AuditEntry{Action: models.AuditUserBan, TargetID: userID, Target: userName, NewValue: escalationReason})
+		return
+	}
+	until := time.Now().AddDate(0, 0, reached.Days).Unix()
+	if oldUntil, _ := models.ReadSuspension(userID); oldUntil < until {
+		suspendUser(r, sess, userID, userName, until, escalationReason)
+	}
+}
+
+var GroupBansHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	groupID := r.FormValue("id")
+	var groupName string
+	if db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName) != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	if isMod, isAdmin, isSuperAdmin := sess.groupRoles(groupID); !isMod && !isAdmin && !isSuperAdmin {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	bansURL := "/groups/bans?id=" + groupID
+
+	if r.Method == "POST" {
+		action := r.PostFormValue("action")
+		userName := strings.TrimSpace(r.PostFormValue("username"))
+		reason := strings.TrimSpace(r.PostFormValue("reason"))
+		var userID string
+		var isUserSuperAdmin bool
+		if action == "Lift" {
+			userID = r.PostFormValue("userid")
+			db.QueryRow(`SELECT username FROM users WHERE id=?;`, userID).Scan(&userName)
+			models.DeleteGroupBan(groupID, userID)
+			audit(r, &sess, models.AuditEntry{GroupID: groupID, Action: models.AuditUserGroupUnban, TargetID: userID, Target: userName})
+			sess.SetFlashMsg("Ban lifted.")
+		} else if db.QueryRow(`SELECT id, is_superadmin FROM users WHERE username=?;`, userName).Scan(&userID, &isUserSuperAdmin) != nil {
+			sess.SetFlashMsg("Username not found: " + userName)
+		} else if reason == "" || len(reason) > 250 {
+			sess.SetFlashMsg("Give a reason of up to 250 characters.")
+		} else if isUserSuperAdmin || models.IsUserGroupMod(userID, groupID) || models.IsUserGroupAdmin(userID, groupID) {
+			sess.SetFlashMsg("The mods and admins of the group can't be banned or warned.")
+		} else if action == "Ban" {
+			days, err := strconv.Atoi(strings.TrimSpace(r.PostFormValue("days")))
+			if err != nil || days < 0 {
+				sess.SetFlashMsg("Number of days should be a whole number, or 0 to ban for good.")
+				http.Redirect(w, r, bansURL, http.StatusSeeOther)
+				return
+			}
+			var expiryDate int64
+			until := "for good"
+			if days > 0 {
+				expiryDate = time.Now().AddDate(0, 0, days).Unix()
+				until = "until " + expiryDateStr(expiryDate)
+			}
+			banFromGroup(r, &sess, groupID, userID, userName, reason, expiryDate)
+			sess.SetFlashMsg(userName + " banned " + until + ".")
+		} else if action == "Warn" {
+			points, err := strconv.Atoi(strings.TrimSpace(r.PostFormValue("points")))
+			if err != nil || points < 0 || points > maxGroupWarningPoints {
+				sess.SetFlashMsg(fmt.Sprintf("Points should be a whole number from 0 to %d.", maxGroupWarningPoints))
+				http.Redirect(w, r, bansURL, http.StatusSeeOther)
+				return
+			}
+			warnUser(r, &sess, userID, userName, groupID, reason, points)
+			sess.SetFlashMsg(userName + " warned.")
+		}
+		http.Redirect(w, r, bansURL, http.StatusSeeOther)
+		return
+	}
+
+	type Ban struct {
+		models.GroupBan
+		ExpiryDateStr  string
+		CreatedDateStr string
+	}
+	var bans []Ban
+	for _, b := range models.ReadGroupBans(groupID) {
+		ban := Ban{GroupBan: b, CreatedDateStr: timeAgoFromNow(time.Unix(b.CreatedDate, 0))}
+		if b.ExpiryDate != 0 {
+			ban.ExpiryDateStr = expiryDateStr(b.ExpiryDate)
+		}
+		bans = append(bans, ban)
+	}
+
+	// Accounts seen at the same IP addresses as a suspected sock puppet. The addresses
+	// themselves are not shown.
+	sharerName := strings.TrimSpace(r.FormValue("u"))
+	var sharers []models.IPSharer
+	if userID, err := models.ReadUserIDByName(sharerName); sharerName != "" && err == nil {
+		sharers = models.ReadIPSharers(strconv.Itoa(userID))
+	}
+
+	commonData := readCommonData(r, sess)
+	commonData.PageTitle = "Bans and warnings"
+
+	templates.Render(w, "groupbans.html", map[string]interface{}{
+		"Common":           commonData,
+		"GroupID":          groupID,
+		"GroupName":        groupName,
+		"BansURL":          bansURL,
+		"Bans":             bans,
+		"SharerName":       sharerName,
+		"Sharers":          sharers,
+		"MaxWarningPoints": maxGroupWarningPoints,
+	})
+})
@@ -0,0 +1,176 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEscalations(t *testing.T) {
+	escalations, err := parseEscalations("10 = suspend 7\n\n 30=ban \n")
+	if err != nil || len(escalations) != 2 || escalations[0] != (escalation{10, 7}) || escalations[1] != (escalation{30, 0}) {
+		t.Errorf("Escalations not parsed: %v %v", escalations, err)
+	}
+	for _, s := range []string{"10 = suspend", "10 = suspend 0", "ten = ban", "0 = ban", "10 = ban 3", "10 = kick"} {
+		if _, err := parseEscalations(s); err == nil {
+			t.Errorf("Invalid escalation accepted: %q", s)
+		}
+	}
+}
+
+func TestGroupBans(t *testing.T) {
+	models.CreateUser("gbuser", "gbuser12345", "")
+	models.CreateUser("gbmod", "gbmod12345", "")
+	userID, _ := models.ReadUserIDByName("gbuser")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"gbgroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("gbgroup")
+	models.CreateGroupMod("gbmod", groupID)
+	db.Exec(`INSERT INTO topics(title, content, userid, groupid, created_date, updated_date, activity_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+		"Ban topic", "", userID, groupID, time.Now().Unix(), time.Now().Unix(), time.Now().Unix())
+	var topicID string
+	db.QueryRow(`SELECT id FROM topics WHERE title=?;`, "Ban topic").Scan(&topicID)
+	numComments := func() int {
+		var n int
+		db.QueryRow(`SELECT COUNT(*) FROM comments WHERE topicid=?;`, topicID).Scan(&n)
+		return n
+	}
+
+	userSess := sessionForTest("gbuser")
+	modSess := sessionForTest("gbmod")
+	if rr := getForTest(GroupBansHandler, "/groups/bans?id="+groupID, userSess); rr.Code != http.StatusForbidden {
+		t.Errorf("Bans page visible to a user who is not a mod: %d", rr.Code)
+	}
+	postFromForTest(GroupBansHandler, "/groups/bans?id="+groupID,
+		url.Values{"action": {"Ban"}, "username": {"gbmod"}, "reason": {"Trying"}, "days": {"1"}}, modSess, "192.0.2.110:4000")
+	modID, _ := models.ReadUserIDByName("gbmod")
+	if _, err := models.ReadGroupBan(groupID, strconv.Itoa(modID)); err == nil {
+		t.Errorf("Mod of the group banned")
+	}
+
+	postFromForTest(GroupBansHandler, "/groups/bans?id="+groupID,
+		url.Values{"action": {"Ban"}, "username": {"gbuser"}, "reason": {"Flame war"}, "days": {"1"}}, modSess, "192.0.2.110:4000")
+	postFromForTest(CommentCreateHandler, "/comments/new?tid="+topicID, url.Values{"content": {"One more thing"}}, userSess, "192.0.2.111:4000")
+	if numComments() != 0 {
+		t.Errorf("Banned user commented in the group")
+	}
+	postFromForTest(TopicUpdateHandler, "/topics/edit?id="+topicID, url.Values{"action": {"Update"}, "title": {"Ban topic"}, "content": {"Edited while banned"}}, userSess, "192.0.2.111:4000")
+	if rr := apiRequestForTest(APITopicsHandler, "PATCH", "/api/v1/topics?id="+topicID, `{"content": "Edited while banned"}`, userSess); rr.Code != http.StatusForbidden {
+		t.Errorf("Banned user edited a topic with the API: %d", rr.Code)
+	}
+	var topicContent string
+	db.QueryRow(`SELECT content FROM topics WHERE id=?;`, topicID).Scan(&topicContent)
+	if topicContent != "" {
+		t.Errorf("Banned user edited a topic in the group")
+	}
+	if body := getForTest(GroupIndexHandler, "/groups?name=gbgroup", userSess).Body.String(); !strings.Contains(body, "banned from posting in this group until") ||
+		!strings.Contains(body, "Flame war") {
+		t.Errorf("Group page doesn't tell the banned user the reason and the expiry")
+	}
+	if n := models.NumUnreadNotifications(strconv.Itoa(userID)); n != 1 {
+		t.Errorf("Banned user has %d notifications, want 1", n)
+	}
+
+	// Bans lift themselves when they run out.
+	db.Exec(`UPDATE groupbans SET expiry_date=? WHERE userid=?;`, time.Now().Add(-time.Minute).Unix(), userID)
+	postFromForTest(CommentCreateHandler, "/comments/new?tid="+topicID, url.Values{"content": {"Back again"}}, userSess, "192.0.2.111:4000")
+	if numComments() != 1 {
+		t.Errorf("User can't post after the ban ran out")
+	}
+
+	postFromForTest(GroupBansHandler, "/groups/bans?id="+groupID,
+		url.Values{"action": {"Ban"}, "username": {"gbuser"}, "reason": {"Again"}, "days": {"0"}}, modSess, "192.0.2.110:4000")
+	if ban, err := models.ReadGroupBan(groupID, strconv.Itoa(userID)); err != nil || ban.ExpiryDate != 0 {
+		t.Fatalf("Permanent ban not recorded: %v %v", ban, err)
+	}
+	postFromForTest(GroupBansHandler, "/groups/bans?id="+groupID,
+		url.Values{"action": {"Lift"}, "userid": {strconv.Itoa(userID)}}, modSess, "192.0.2.110:4000")
+	if _, err := models.ReadGroupBan(groupID, strconv.Itoa(userID)); err == nil {
+		t.Errorf("Ban not lifted")
+	}
+	if entries := models.ReadAuditEntries(models.AuditFilter{GroupID: groupID, Action: "user"}, 10); len(entries) != 3 {
+		t.Errorf("Group bans not in the audit log: %v", entries)
+	}
+
+	// Warnings from the mods of a group escalate to a ban from the group, never from the forum.
+	models.WriteConfig(models.InfractionEscalations, "3 = ban")
+	defer models.WriteConfig(models.InfractionEscalations, "")
+	warn := func(points string) {
+		postFromForTest(GroupBansHandler, "/groups/bans?id="+groupID,
+			url.Values{"action": {"Warn"}, "username": {"gbuser"}, "reason": {"Off-topic"}, "points": {points}}, modSess, "192.0.2.110:4000")
+	}
+	warn("1000000")
+	if n := infractionPoints(strconv.Itoa(userID), groupID); n != 0 {
+		t.Errorf("Warning over the cap given: %d points", n)
+	}
+	warn("3")
+	var isBanned bool
+	db.QueryRow(`SELECT is_banned FROM users WHERE id=?;`, userID).Scan(&isBanned)
+	if ban, err := models.ReadGroupBan(groupID, strconv.Itoa(userID)); err != nil || ban.ExpiryDate != 0 || isBanned {
+		t.Errorf("Group warnings didn't escalate to a ban from the group only: %v %v banned=%v", ban, err, isBanned)
+	}
+	if n := infractionPoints(strconv.Itoa(userID), ""); n != 0 {
+		t.Errorf("Group warnings counted as forum-wide points: %d", n)
+	}
+}
+
+func TestWarningEscalation(t *testing.T) {
+	models.CreateUser("wuser", "wuser12345", "")
+	userID, _ := models.ReadUserIDByName("wuser")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"wgroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("wgroup")
+	models.WriteConfig(models.InfractionEscalations, "3 = suspend 2\n5 = ban")
+	defer models.WriteConfig(models.InfractionEscalations, "")
+
+	adminSess := sessionForTest("admin")
+	userSess := sessionForTest("wuser")
+	warn := func(points string) {
+		postFromForTest(UserProfileUpdateHandler, "/users/update",
+			url.Values{"u": {"wuser"}, "action": {"Warn"}, "reason": {"Spamming links"}, "points": {points}}, adminSess, "192.0.2.120:4000")
+	}
+	warn("2")
+	if until, _ := models.ReadSuspension(strconv.Itoa(userID)); until != 0 {
+		t.Errorf("Suspended below the escalation threshold")
+	}
+	warn("1")
+	until, reason := models.ReadSuspension(strconv.Itoa(userID))
+	if until < time.Now().AddDate(0, 0, 2).Add(-time.Minute).Unix() || !strings.Contains(reason, "Spamming links") {
+		t.Fatalf("Not suspended for 2 days at 3 points: %d %q", until, reason)
+	}
+	body := getForTest(UserProfileHandler, "/users?u=wuser", userSess).Body.String()
+	if !strings.Contains(body, "You are suspended until "+expiryDateStr(until)) || !strings.Contains(body, "Infraction points: 3") {
+		t.Errorf("Suspended user doesn't see the reason and the expiry: %s", body)
+	}
+	rr := apiRequestForTest(APITopicsHandler, "POST", "/api/v1/topics", `{"group_id": `+groupID+`, "title": "While suspended"}`, userSess)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "suspended") {
+		t.Errorf("Suspended user posted: %d %s", rr.Code, rr.Body.String())
+	}
+
+	warn("2")
+	var isBanned bool
+	db.QueryRow(`SELECT is_banned FROM users WHERE id=?;`, userID).Scan(&isBanned)
+	if !isBanned {
+		t.Errorf("Not banned at 5 points")
+	}
+	if n := models.NumUnreadNotifications(strconv.Itoa(userID)); n != 4 {
+		t.Errorf("Warned user has %d notifications, want 4 (3 warnings and a suspension)", n)
+	}
+
+	// Points run out after the configured number of days.
+	models.WriteConfig(models.InfractionPointsDays, "30")
+	defer models.WriteConfig(models.InfractionPointsDays, "0")
+	db.Exec(`UPDATE warnings SET created_date=? WHERE userid=?;`, time.Now().AddDate(0, 0, -31).Unix(), userID)
+	if n := infractionPoints(strconv.Itoa(userID), ""); n != 0 {
+		t.Errorf("Old warnings still count %d points", n)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"errors"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/templates"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	numInvitesPerPage = 100
+	maxInviteUses     = 1000
+	maxInviteDays     = 90
+)
+
+var errInvalidInvite = errors.New("Invalid or expired invite code.")
+
+type inviteGroup struct {
+	ID   string
+	Name string
+}
+
+// inviteGroups returns the groups that people who sign up with the user's invites can join:
+// every group for superadmins, and the groups the user is an admin of for others.
+func inviteGroups(sess *Session) []inviteGroup {
+	var rows *db.Rows
+	if sess.IsUserSuperAdmin() {
+		rows = db.Query(`SELECT id, name FROM groups ORDER BY name;`)
+	} else if !sess.isMissingTOTP() {
+		rows = db.Query(`SELECT groups.id, groups.name FROM groups INNER JOIN admins ON admins.groupid=groups.id AND admins.userid=? ORDER BY groups.name;`, sess.UserID)
+	} else {
+		return nil
+	}
+	var groups []inviteGroup
+	for rows.Next() {
+		var g inviteGroup
+		rows.Scan(&g.ID, &g.Name)
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// canCreateInvites reports whether the user can invite people. Superadmins and the admins
+// and mods of groups can.
+func canCreateInvites(sess *Session) bool {
+	if !sess.UserID.Valid {
+		return false
+	}
+	if sess.IsUserSuperAdmin() {
+		return true
+	}
+	var tmp string
+	return db.QueryRow(`SELECT id FROM mods WHERE userid=? LIMIT 1;`, sess.UserID).Scan(&tmp) == nil ||
+		(db.QueryRow(`SELECT id FROM admins WHERE userid=? LIMIT 1;`, sess.UserID).Scan(&tmp) == nil && !sess.isMissingTOTP())
+}
+
+// checkInvite returns the invite with code if it can be used to sign up.
+func checkInvite(code string) (models.Invite, error) {
+	invite, err := models.ReadInviteByCode(code)
+	if err != nil || !invite.IsUsable(time.Now()) {
+		return invite, errInvalidInvite
+	}
+	return invite, nil
+}
+
+// useInvite records that the user signed up with the invite, and adds the user to the
+// invite's group.
+func useInvite(invite models.Invite, userID string) {
+	models.UseInvite(invite.ID, userID)
+	if invite.GroupID != "" {
+		models.CreateGroupMember(userID, invite.GroupID)
+	}
+}
+
+type inviteRow struct {
+	models.Invite
+	IsUsable       bool
+	ExpiryDateStr  string
+	CreatedDateStr string
+}
+
+func readInviteRows(invites []models.Invite) []inviteRow {
+	now := time.Now()
+	var rows []inviteRow
+	for _, i := range invites {
+		rows = append(rows, inviteRow{
+			Invite:         i,
+			IsUsable:       i.IsUsable(now),
+			ExpiryDateStr:  time.Unix(i.ExpiryDate, 0).Format("2006-01-02 15:04"),
+			CreatedDateStr: timeAgoFromNow(time.Unix(i.CreatedDate, 0)),
+		})
+	}
+	return rows
+}
+
+var UserInvitesHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	if !canCreateInvites(&sess) {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	userID := sessUserID(&sess)
+	groups := inviteGroups(&sess)
+
+	if r.Method == "POST" {
+		action := r.PostFormValue("action")
+		if action == "Create" {
+			maxUses, err := strconv.Atoi(r.PostFormValue("max_uses"))
+			if err != nil || maxUses < 1 || maxUses > maxInviteUses {
+				sess.SetFlashMsg("Number of uses should be 1-" + strconv.Itoa(maxInviteUses) + ".")
+				http.Redirect(w, r, "/users/invites", http.StatusSeeOther)
+				return
+			}
+			days, err := strconv.Atoi(r.PostFormValue("days"))
+			if err != nil || days < 1 || days > maxInviteDays {
+				sess.SetFlashMsg("Days should be 1-" + strconv.Itoa(maxInviteDays) + ".")
+				http.Redirect(w, r, "/users/invites", http.StatusSeeOther)
+				return
+			}
+			groupID := r.PostFormValue("gid")
+			if groupID != "" {
+				isAllowed := false
+				for _, g := range groups {
+					if g.ID == groupID {
+						isAllowed = true
+					}
+				}
+				if !isAllowed {
+					ErrForbiddenHandler(w, r)
+					return
+				}
+			}
+			code := randSeq(12)
+			models.CreateInvite(userID, code, groupID, maxUses, time.Now().Add(time.Duration(days)*24*time.Hour).Unix())
+			sess.SetFlashMsg("Invite created.")
+		} else if action == "Revoke" {
+			models.RevokeInvite(r.PostFormValue("id"), userID)
+			sess.SetFlashMsg("Invite revoked.")
+		}
+		http.Redirect(w, r, "/users/invites", http.StatusSeeOther)
+		return
+	}
+
+	commonData := readCommonData(r, sess)
+	commonData.PageTitle = "Invites"
+
+	templates.Render(w, "profileinvites.html", map[string]interface{}{
+		"Common":  commonData,
+		"Invites": readInviteRows(models.ReadInvitesByUser(userID, numInvitesPerPage)),
+		"Groups":  groups,
+		"MaxUses": maxInviteUses,
+		"MaxDays": maxInviteDays,
+	})
+})
+
+var AdminInvitesHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	if !sess.IsUserSuperAdmin() {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	if r.Method == "POST" {
+		if r.PostFormValue("action") == "Revoke" {
+			models.RevokeInvite(r.PostFormValue("id"), "")
+		}
+		http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+		return
+	}
+
+	type InvitedUser struct {
+		models.InvitedUser
+		CreatedDateStr string
+	}
+	var users []InvitedUser
+	for _, u := range models.ReadInvitedUsers(numInvitesPerPage) {
+		users = append(users, InvitedUser{u, timeAgoFromNow(time.Unix(u.CreatedDate, 0))})
+	}
+	templates.Render(w, "admininvites.html", map[string]interface{}{
+		"Common":       readCommonData(r, sess),
+		"Invites":      readInviteRows(models.ReadInvites(numInvitesPerPage)),
+		"InvitedUsers": users,
+	})
+})
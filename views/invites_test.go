@@ -0,0 +1,93 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInvites(t *testing.T) {
+	models.WriteConfig(models.InviteOnly, "1")
+	defer models.WriteConfig(models.InviteOnly, "0")
+
+	models.CreateUser("inviter", "inviter12345", "")
+	models.CreateUser("noinviter", "noinviter12345", "")
+	db.Exec(`INSERT INTO groups(name, description, is_private, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		"invitegroup", "", true, time.Now().Unix(), time.Now().Unix())
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"otherinvitegroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("invitegroup")
+	models.CreateGroupAdmin("inviter", groupID)
+	inviterSess := sessionForTest("inviter")
+
+	if rr := getForTest(UserInvitesHandler, "/users/invites", sessionForTest("noinviter")); rr.Code != http.StatusForbidden {
+		t.Errorf("User without privileges can invite: %d", rr.Code)
+	}
+	create := url.Values{"action": {"Create"}, "max_uses": {"1"}, "days": {"7"}, "gid": {models.ReadGroupIDByName("otherinvitegroup")}}
+	if rr := postFromForTest(UserInvitesHandler, "/users/invites", create, inviterSess, "192.0.2.60:4000"); rr.Code != http.StatusForbidden {
+		t.Errorf("Invite to a group the user isn't an admin of: %d", rr.Code)
+	}
+	create.Set("gid", groupID)
+	postFromForTest(UserInvitesHandler, "/users/invites", create, inviterSess, "192.0.2.60:4000")
+	inviterID, _ := models.ReadUserIDByName("inviter")
+	invites := models.ReadInvitesByUser(strconv.Itoa(inviterID), 10)
+	if len(invites) != 1 || invites[0].GroupID != groupID || invites[0].MaxUses != 1 {
+		t.Fatalf("Invite not created: %v", invites)
+	}
+	code := invites[0].Code
+
+	signup := func(userName string, code string) bool {
+		sessionID := randSeq(32)
+		db.Exec(`INSERT INTO sessions(sessionid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+			sessionID, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+		form := url.Values{"username": {userName}, "passwd": {"invitee12345"}, "confirm": {"invitee12345"}, "invite": {code}}
+		postFromForTest(SignupHandler, "/signup", form, sessionID, "192.0.2.61:4000")
+		return models.ProbeUser(userName)
+	}
+	if signup("invitee0", "") || signup("invitee0", "bogus") {
+		t.Errorf("Signed up without a valid invite")
+	}
+	if !signup("invitee1", code) {
+		t.Fatalf("Signup with an invite failed")
+	}
+	inviteeID, _ := models.ReadUserIDByName("invitee1")
+	if !models.IsUserGroupMember(strconv.Itoa(inviteeID), groupID) {
+		t.Errorf("Invitee didn't join the invite's group")
+	}
+	if signup("invitee2", code) {
+		t.Errorf("Invite used more than its number of uses")
+	}
+
+	create.Set("max_uses", "5")
+	create.Set("gid", "")
+	postFromForTest(UserInvitesHandler, "/users/invites", create, inviterSess, "192.0.2.60:4000")
+	code = models.ReadInvitesByUser(strconv.Itoa(inviterID), 10)[0].Code
+	db.Exec(`UPDATE invites SET expiry_date=? WHERE code=?;`, time.Now().Add(-time.Minute).Unix(), code)
+	if signup("invitee3", code) {
+		t.Errorf("Expired invite used")
+	}
+	db.Exec(`UPDATE invites SET expiry_date=? WHERE code=?;`, time.Now().Add(time.Hour).Unix(), code)
+	invite, _ := models.ReadInviteByCode(code)
+	postFromForTest(UserInvitesHandler, "/users/invites", url.Values{"action": {"Revoke"}, "id": {invite.ID}}, sessionForTest("noinviter"), "192.0.2.60:4000")
+	if !signup("invitee4", code) {
+		t.Errorf("Invite revoked by another user")
+	}
+	postFromForTest(UserInvitesHandler, "/users/invites", url.Values{"action": {"Revoke"}, "id": {invite.ID}}, inviterSess, "192.0.2.60:4000")
+	if signup("invitee5", code) {
+		t.Errorf("Revoked invite used")
+	}
+
+	rr := getForTest(AdminInvitesHandler, "/admin/invites", sessionForTest("admin"))
+	if body := rr.Body.String(); !strings.Contains(body, "invitee1") || !strings.Contains(body, "invitee4") || strings.Contains(body, "invitee5") {
+		t.Errorf("Admin report doesn't list the invited users")
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"fmt"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/templates"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Failed attempts older than loginFailureWindow are not counted.
+const loginFailureWindow = time.Hour
+const loginBaseDelay = time.Second
+const loginMaxDelay = 5 * time.Minute
+
+var numLoginFailures = 100
+
+// loginThrottle allows numFree failed attempts, then doubles the wait after each further
+// failure. After numLockout failures, no attempt is allowed until loginFailureWindow has
+// passed since the last failure.
+type loginThrottle struct {
+	numFree    int
+	numLockout int
+}
+
+// Failures are counted on an account from one IP address, so that others can't lock a
+// user out, and from an IP address on all accounts.
+var userIPLoginThrottle = loginThrottle{numFree: 3, numLockout: 10}
+var ipLoginThrottle = loginThrottle{numFree: 10, numLockout: 50}
+
+// wait returns how long after now the next attempt must wait, given numFailures failed
+// attempts, the latest of which was at lastFailure.
+func (t loginThrottle) wait(numFailures int, lastFailure int64, now time.Time) time.Duration {
+	if numFailures < t.numFree {
+		return 0
+	}
+	delay := loginFailureWindow
+	if numFailures < t.numLockout {
+		delay = loginBaseDelay << uint(numFailures-t.numFree)
+		if delay > loginMaxDelay {
+			delay = loginMaxDelay
+		}
+	}
+	if wait := time.Unix(lastFailure, 0).Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (t loginThrottle) isLocked(numFailures int) bool {
+	return numFailures >= t.numLockout
+}
+
+// loginWait returns how long the next attempt on userName from ip must wait.
+func loginWait(userName string, ip string, now time.Time) time.Duration {
+	since := now.Add(-loginFailureWindow).Unix()
+	n, last := models.NumLoginFailuresByUserIP(userName, ip, since)
+	wait := userIPLoginThrottle.wait(n, last, now)
+	n, last = models.NumLoginFailuresByIP(ip, since)
+	if ipWait := ipLoginThrottle.wait(n, last, now); ipWait > wait {
+		wait = ipWait
+	}
+	return wait
+}
+
+func errLoginThrottled(wait time.Duration) error {
+	if wait > time.Minute {
+		return fmt.Errorf("Too many failed attempts. Try again in %d minutes.", int((wait+time.Minute-1)/time.Minute))
+	}
+	return fmt.Errorf("Too many failed attempts. Try again in %d seconds.", int((wait+time.Second-1)/time.Second))
+}
+
+// authenticate is like sess.Authenticate, but refuses to check the password while
+// userName or the client is throttled, and records incorrect passwords.
+func authenticate(r *http.Request, sess *Session, userName string, passwd string, action string) error {
+	ip := remoteIP(r)
+	if wait := loginWait(userName, ip, time.Now()); wait > 0 {
+		return errLoginThrottled(wait)
+	}
+	err := sess.Authenticate(userName, passwd)
+	if err == errIncorrectLogin {
+		models.RecordLoginFailure(userName, ip, action)
+	} else if err == nil {
+		models.ClearLoginFailuresByUser(userName)
+	}
+	return err
+}
+
+var AdminLoginsHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	if !sess.IsUserSuperAdmin() {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	if r.Method == "POST" {
+		action := r.PostFormValue("action")
+		if action == "Unlock user" {
+			userName := r.PostFormValue("username")
+			models.ClearLoginFailuresByUser(userName)
+			if userID, err := models.ReadUserIDByName(userName); err == nil {
+				auditUser(r, &sess, strconv.Itoa(userID), userName, models.AuditUserUnlock)
+			}
+		} else if action == "Unlock IP" {
+			models.ClearLoginFailuresByIP(r.PostFormValue("ip"))
+		} else if action == "Delete old entries" {
+			models.DeleteLoginFailures(time.Now().Add(-loginFailureWindow).Unix())
+		}
+		http.Redirect(w, r, "/admin/logins", http.StatusSeeOther)
+		return
+	}
+
+	type LoginFailure struct {
+		models.LoginFailure
+		CreatedDateStr string
+	}
+	var failures []LoginFailure
+	for _, f := range models.ReadLoginFailures(numLoginFailures) {
+		failures = append(failures, LoginFailure{f, timeAgoFromNow(time.Unix(f.CreatedDate, 0))})
+	}
+	templates.Render(w, "adminlogins.html", map[string]interface{}{
+		"Common":   readCommonData(r, sess),
+		"Failures": failures,
+	})
+})
@@ -0,0 +1,108 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postFromForTest(handler http.HandlerFunc, target string, form url.Values, sessionID string, remoteAddr string) *httptest.ResponseRecorder {
+	var csrf string
+	db.QueryRow(`SELECT csrf FROM sessions WHERE sessionid=?;`, sessionID).Scan(&csrf)
+	form.Set("csrf", csrf)
+	req, _ := http.NewRequest("POST", target, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "sessionid", Path: "/", Value: sessionID, HttpOnly: true})
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestLoginThrottleWait(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	th := loginThrottle{numFree: 3, numLockout: 10}
+	for _, c := range []struct {
+		numFailures int
+		lastFailure int64
+		want        time.Duration
+	}{
+		{2, now.Unix(), 0},
+		{3, now.Unix(), time.Second},
+		{5, now.Unix(), 4 * time.Second},
+		{5, now.Unix() - 10, 0},
+		{9, now.Unix(), 64 * time.Second},
+		{10, now.Unix() - 60, loginFailureWindow - time.Minute},
+	} {
+		if got := th.wait(c.numFailures, c.lastFailure, now); got != c.want {
+			t.Errorf("wait(%d, %d) = %v, want %v", c.numFailures, c.lastFailure-now.Unix(), got, c.want)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	models.CreateUser("lockee", "lockee12345", "")
+	anonSess := randSeq(32)
+	db.Exec(`INSERT INTO sessions(sessionid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		anonSess, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+	readMsg := func() string {
+		var msg string
+		db.QueryRow(`SELECT msg FROM sessions WHERE sessionid=?;`, anonSess).Scan(&msg)
+		return msg
+	}
+
+	rr := postFromForTest(LoginHandler, "/login", url.Values{"username": {"lockee"}, "passwd": {"wrong"}}, anonSess, "192.0.2.10:4000")
+	if n, _ := models.NumLoginFailuresByUser("lockee", 0); rr.Code != http.StatusSeeOther || n != 1 {
+		t.Fatalf("Incorrect password not recorded: got %v, %d failures", rr.Code, n)
+	}
+	if n, _ := models.NumLoginFailuresByIP("192.0.2.10", 0); n != 1 {
+		t.Errorf("Incorrect password not recorded for IP: %d failures", n)
+	}
+
+	for i := 0; i < userIPLoginThrottle.numLockout; i++ {
+		models.RecordLoginFailure("lockee", "192.0.2.11", models.LoginActionLogin)
+	}
+	rr = postFromForTest(LoginHandler, "/login", url.Values{"username": {"lockee"}, "passwd": {"lockee12345"}}, anonSess, "192.0.2.11:4000")
+	if loc := rr.Header().Get("Location"); loc == "/" || !strings.Contains(readMsg(), "Too many failed attempts") {
+		t.Fatalf("Locked account could log in: %s, %q", loc, readMsg())
+	}
+
+	adminSess := sessionForTest("admin")
+	if body := getForTest(UserProfileHandler, "/users?u=lockee", adminSess).Body.String(); !strings.Contains(body, "(locked)") {
+		t.Errorf("Profile does not show the lockout: %s", body)
+	}
+	postFromForTest(UserProfileUpdateHandler, "/users/update", url.Values{"u": {"lockee"}, "action": {"Unlock"}}, adminSess, "192.0.2.1:4000")
+	rr = postFromForTest(LoginHandler, "/login", url.Values{"username": {"lockee"}, "passwd": {"lockee12345"}}, anonSess, "192.0.2.11:4000")
+	if loc := rr.Header().Get("Location"); loc != "/" {
+		t.Errorf("Unlocked account cannot log in: %s, %q", loc, readMsg())
+	}
+
+	for i := 0; i < userIPLoginThrottle.numLockout; i++ {
+		models.RecordLoginFailure("lockee", "192.0.2.11", models.LoginActionLogin)
+	}
+	rr = postFromForTest(LoginHandler, "/login", url.Values{"username": {"lockee"}, "passwd": {"lockee12345"}}, anonSess, "192.0.2.12:4000")
+	if loc := rr.Header().Get("Location"); loc != "/" {
+		t.Errorf("Failures from another address locked the user out: %s, %q", loc, readMsg())
+	}
+
+	for i := 0; i < ipLoginThrottle.numLockout; i++ {
+		models.RecordLoginFailure("nosuchuser", "192.0.2.13", models.LoginActionForgotPass)
+	}
+	postFromForTest(ForgotPasswdHandler, "/forgotpass", url.Values{"username": {"lockee"}}, anonSess, "192.0.2.13:4000")
+	if msg := readMsg(); !strings.Contains(msg, "Too many failed attempts") {
+		t.Errorf("Locked IP could request a password reset: %q", msg)
+	}
+
+	if body := getForTest(AdminLoginsHandler, "/admin/logins", adminSess).Body.String(); !strings.Contains(body, "192.0.2.13") {
+		t.Errorf("Failed attempts not listed: %s", body)
+	}
+}
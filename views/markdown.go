@@ -0,0 +1,262 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"bytes"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+	"html/template"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// markdown converts posts to HTML. Raw HTML in posts is dropped by goldmark, and the
+// output is sanitized again by htmlPolicy, so the only images are those written by
+// censorRenderer. Single newlines are line breaks, as they
+// were before posts were rendered as Markdown.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(html.WithHardWraps()),
+	goldmark.WithRendererOptions(renderer.WithNodeRenderers(util.Prioritized(newCensorRenderer(), 100))),
+)
+
+var htmlPolicy = bluemonday.UGCPolicy()
+
+func init() {
+	htmlPolicy.RequireNoFollowOnLinks(true)
+	htmlPolicy.AllowAttrs("class").Matching(bluemonday.SpaceSeparatedTokens).OnElements("code")
+	htmlPolicy.AllowAttrs("alt").OnElements("img")
+}
+
+// uploadedImagePrefix starts the URLs of images uploaded to the forum.
+const uploadedImagePrefix = "/img?name="
+
+// censorRenderer renders text, code and images like goldmark's HTML renderer, but censors
+// them first. Link targets and markup are left intact. Only images uploaded to the forum
+// are shown so that posts can't embed tracking pixels; other images become links.
+type censorRenderer struct {
+	html.Config
+}
+
+func newCensorRenderer() renderer.NodeRenderer {
+	r := &censorRenderer{Config: html.NewConfig()}
+	r.HardWraps = true
+	return r
+}
+
+func (r *censorRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindText, r.renderText)
+	reg.Register(ast.KindString, r.renderString)
+	reg.Register(ast.KindCodeSpan, r.renderCodeSpan)
+	reg.Register(ast.KindCodeBlock, r.renderCodeBlock)
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+	reg.Register(ast.KindImage, r.renderImage)
+}
+
+func (r *censorRenderer) renderText(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.Text)
+	value := []byte(censor(string(n.Segment.Value(source))))
+	if n.IsRaw() {
+		r.Writer.RawWrite(w, value)
+		return ast.WalkContinue, nil
+	}
+	r.Writer.Write(w, value)
+	if n.HardLineBreak() || (n.SoftLineBreak() && r.HardWraps) {
+		w.WriteString("<br>\n")
+	} else if n.SoftLineBreak() {
+		w.WriteByte('\n')
+	}
+	return ast.WalkContinue, nil
+}
+
+func (r *censorRenderer) renderString(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.String)
+	value := []byte(censor(string(n.Value)))
+	if n.IsCode() {
+		w.Write(value)
+	} else if n.IsRaw() {
+		r.Writer.RawWrite(w, value)
+	} else {
+		r.Writer.Write(w, value)
+	}
+	return ast.WalkContinue, nil
+}
+
+// writeLines writes the censored lines of a code block.
+func (r *censorRenderer) writeLines(w util.BufWriter, source []byte, n ast.Node) {
+	var buf bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		buf.Write(line.Value(source))
+	}
+	r.Writer.RawWrite(w, []byte(censor(buf.String())))
+}
+
+func (r *censorRenderer) renderCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.WriteString("<pre><code>")
+		r.writeLines(w, source, node)
+	} else {
+		w.WriteString("</code></pre>\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+func (r *censorRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		w.WriteString("</code></pre>\n")
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+	w.WriteString("<pre><code")
+	if language := n.Language(source); language != nil {
+		w.WriteString(` class="language-`)
+		r.Writer.Write(w, language)
+		w.WriteByte('"')
+	}
+	w.WriteByte('>')
+	r.writeLines(w, source, n)
+	return ast.WalkContinue, nil
+}
+
+func (r *censorRenderer) renderCodeSpan(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		w.WriteString("</code>")
+		return ast.WalkContinue, nil
+	}
+	var buf bytes.Buffer
+	for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+		value := c.(*ast.Text).Segment.Value(source)
+		if bytes.HasSuffix(value, []byte("\n")) {
+			buf.Write(value[:len(value)-1])
+			buf.WriteByte(' ')
+		} else {
+			buf.Write(value)
+		}
+	}
+	w.WriteString("<code>")
+	r.Writer.RawWrite(w, []byte(censor(buf.String())))
+	return ast.WalkSkipChildren, nil
+}
+
+// renderTexts writes the censored text of an image's alt text.
+func (r *censorRenderer) renderTexts(w util.BufWriter, source []byte, node ast.Node) {
+	for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+		if s, ok := c.(*ast.String); ok {
+			r.renderString(w, source, s, true)
+		} else if t, ok := c.(*ast.Text); ok {
+			r.renderText(w, source, t, true)
+		} else {
+			r.renderTexts(w, source, c)
+		}
+	}
+}
+
+func (r *censorRenderer) renderImage(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.Image)
+	dest := util.EscapeHTML(util.URLEscape(n.Destination, true))
+	if !strings.HasPrefix(string(n.Destination), uploadedImagePrefix) {
+		w.WriteString(`<a href="`)
+		if !html.IsDangerousURL(n.Destination) {
+			w.Write(dest)
+		}
+		w.WriteString(`">`)
+		r.renderTexts(w, source, n)
+		w.WriteString("</a>")
+		return ast.WalkSkipChildren, nil
+	}
+	w.WriteString(`<img src="`)
+	w.Write(dest)
+	w.WriteString(`" alt="`)
+	r.renderTexts(w, source, n)
+	w.WriteByte('"')
+	if n.Title != nil {
+		w.WriteString(` title="`)
+		r.Writer.Write(w, []byte(censor(string(n.Title))))
+		w.WriteByte('"')
+	}
+	w.WriteByte('>')
+	return ast.WalkSkipChildren, nil
+}
+
+// fenceLegacyCode turns lines indented by 4 spaces into fenced code blocks. Posts from
+// before Markdown used 4-space indented lines for code without a blank line before them,
+// which CommonMark would read as part of the preceding paragraph. Posts that already use
+// ``` fences are left alone.
+func fenceLegacyCode(content string) string {
+	if strings.Contains(content, "```") {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	var out []string
+	inCode := false
+	for _, line := range lines {
+		isCode := strings.HasPrefix(line, "    ") && strings.TrimSpace(line) != ""
+		if isCode != inCode {
+			out = append(out, "```")
+		}
+		if isCode {
+			line = line[4:]
+		}
+		out = append(out, line)
+		inCode = isCode
+	}
+	if inCode {
+		out = append(out, "```")
+	}
+	return strings.Join(out, "\n")
+}
+
+// postMarkdown returns the content of a post as Markdown. Posts created before the forum
+// was upgraded to render Markdown have their code fenced, so that they look as they did.
+func postMarkdown(content string, createdDate int64) string {
+	content = strings.Replace(content, "\r", "", -1)
+	markdownDate, _ := strconv.ParseInt(models.Config(models.MarkdownDate), 10, 64)
+	if createdDate < markdownDate {
+		content = fenceLegacyCode(content)
+	}
+	return content
+}
+
+// formatComment renders a post created at createdDate as HTML.
+func formatComment(comment string, createdDate int64) template.HTML {
+	comment = postMarkdown(comment, createdDate)
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(comment), &buf); err != nil {
+		log.Printf("[ERROR] Error rendering markdown: %s\n", err)
+		return template.HTML(template.HTMLEscapeString(censor(comment)))
+	}
+	return template.HTML(htmlPolicy.SanitizeBytes(buf.Bytes()))
+}
+
+// formatReply quotes a post as a Markdown block quote.
+func formatReply(quotedUser string, quoteContent string) string {
+	quoteContent = strings.Replace(quoteContent, "\r", "", -1)
+	quoteContent = strings.TrimSpace(quoteContent)
+	lines := strings.Split(quoteContent, "\n")
+	for i, line := range lines {
+		lines[i] = "> " + line
+	}
+	return quotedUser + " wrote:\n\n" + strings.Join(lines, "\n") + "\n\n"
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatComment(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+		not  []string
+	}{
+		{"# Title\n\n- one\n- two", []string{"<h1", "<li>one</li>"}, nil},
+		{"line one\nline two", []string{"line one<br>"}, nil},
+		{"Code:\n\n    x := 1\n    y := 2\n\nDone.", []string{"<pre><code>x := 1\ny := 2\n</code></pre>", "Done."}, nil},
+		{"- a\n    - b", []string{"<li>b</li>"}, []string{"<pre>"}},
+		{"- a\n\n    more about a", []string{"<p>more about a</p>"}, []string{"<pre>"}},
+		{"```go\na := 1\n```", []string{`<code class="language-go">a := 1`}, nil},
+		{"<script>alert(1)</script> hi", nil, []string{"<script"}},
+		{"<img src=\"https://tracker.example/p.gif\">", nil, []string{"<img"}},
+		{"![pic](https://tracker.example/p.gif)", []string{`href="https://tracker.example/p.gif"`, ">pic</a>"}, []string{"<img"}},
+		{"![pic](/img?name=abc.png)", []string{`<img src="/img?name=abc.png" alt="pic">`}, nil},
+		{"[x](javascript:alert(1))", nil, []string{"javascript:"}},
+		{"see https://example.com/a", []string{`href="https://example.com/a"`, `rel="nofollow"`}, nil},
+	}
+	for _, c := range cases {
+		got := string(formatComment(c.in, time.Now().Unix()))
+		for _, w := range c.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("formatComment(%q) = %q, want it to contain %q", c.in, got, w)
+			}
+		}
+		for _, n := range c.not {
+			if strings.Contains(got, n) {
+				t.Errorf("formatComment(%q) = %q, should not contain %q", c.in, got, n)
+			}
+		}
+	}
+}
+
+func TestFormatCommentCensor(t *testing.T) {
+	oldWords := models.Config(models.CensoredWords)
+	models.WriteConfig(models.CensoredWords, "darn")
+	defer models.WriteConfig(models.CensoredWords, oldWords)
+
+	for _, in := range []string{"darn it", "`darn`", "```\ndarn\n```", "    darn", "![darn](/img?name=abc.png)", "![darn](https://example.com/a.png)"} {
+		if got := string(formatComment(in, time.Now().Unix())); strings.Contains(got, "darn") || !strings.Contains(got, "****") {
+			t.Errorf("formatComment(%q) = %q, want the word censored", in, got)
+		}
+	}
+	if got := string(formatComment("[x](https://example.com/darn)", time.Now().Unix())); !strings.Contains(got, `href="https://example.com/darn"`) {
+		t.Errorf("Link target censored: %q", got)
+	}
+}
+
+func TestFormatReply(t *testing.T) {
+	got := string(formatComment(formatReply("alice", "hello\n\n    code"), time.Now().Unix()))
+	if !strings.Contains(got, "<blockquote>") || !strings.Contains(got, "<pre><code>code") {
+		t.Errorf("Unexpected reply rendering: %q", got)
+	}
+}
+
+func TestLegacyCode(t *testing.T) {
+	if got := fenceLegacyCode("Code:\n    x := 1\nDone."); got != "Code:\n```\nx := 1\n```\nDone." {
+		t.Errorf("Code not fenced: %q", got)
+	}
+	if got := fenceLegacyCode("```\n    x := 1\n```"); got != "```\n    x := 1\n```" {
+		t.Errorf("Post with fences changed: %q", got)
+	}
+
+	models.CreateUser("oldtimer", "oldtimer12345", "")
+	userID, _ := models.ReadUserIDByName("oldtimer")
+	oldDate := time.Now().AddDate(-1, 0, 0).Unix()
+	db.Exec(`INSERT INTO messages(fromid, toid, content, created_date) VALUES(?, ?, ?, ?);`, userID, userID, "Old code:\n    x := 1\nDone.", oldDate)
+	db.Exec(`INSERT INTO messages(fromid, toid, content, created_date) VALUES(?, ?, ?, ?);`, userID, userID, "New text:\n    y := 2\nDone.", time.Now().Unix())
+	body := getForTest(PrivateMessageHandler, "/pm", sessionForTest("oldtimer")).Body.String()
+	if !strings.Contains(body, "<pre><code>x := 1\n</code></pre>") {
+		t.Errorf("Code of an old post not rendered as code: %s", body)
+	}
+	if strings.Contains(body, "<pre><code>y := 2") {
+		t.Errorf("Indented line of a new post rendered as code: %s", body)
+	}
+	var content string
+	db.QueryRow(`SELECT content FROM messages WHERE fromid=? AND created_date=?;`, userID, oldDate).Scan(&content)
+	if content != "Old code:\n    x := 1\nDone." {
+		t.Errorf("Content of an old post changed: %q", content)
+	}
+}
@@ -9,10 +9,12 @@ import (
 	"github.com/s-gv/orangeforum/models/db"
 	"github.com/s-gv/orangeforum/static"
 	"github.com/s-gv/orangeforum/templates"
+	"github.com/s-gv/orangeforum/utils"
 	"html/template"
 	"io"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -28,8 +30,10 @@ var IndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session)
 		Desc     string
 		IsSticky int
 	}
+	isSuperAdmin := sess.IsUserSuperAdmin()
+
 	groups := []Group{}
-	rows := db.Query(`SELECT name, description, is_sticky FROM groups WHERE is_closed=0 ORDER BY is_sticky DESC, RANDOM() LIMIT 25;`)
+	rows := db.Query(`SELECT name, description, is_sticky FROM groups WHERE is_closed=0 AND `+models.VisibleGroupsSQL+` ORDER BY is_sticky DESC, RANDOM() LIMIT 25;`, isSuperAdmin, sess.UserID)
 	for rows.Next() {
 		groups = append(groups, Group{})
 		g := &groups[len(groups)-1]
@@ -48,7 +52,7 @@ var IndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session)
 		NumComments int
 	}
 	topics := []Topic{}
-	trows := db.Query(`SELECT topics.id, topics.title, topics.num_comments, topics.created_date, topics.is_deleted, topics.is_closed, groups.name, groups.is_closed, users.username FROM topics INNER JOIN groups ON topics.groupid=groups.id INNER JOIN users ON topics.userid=users.id ORDER BY topics.created_date DESC LIMIT 20;`)
+	trows := db.Query(`SELECT topics.id, topics.title, topics.num_comments, topics.created_date, topics.is_deleted, topics.is_closed, groups.name, groups.is_closed, users.username FROM topics INNER JOIN groups ON topics.groupid=groups.id INNER JOIN users ON topics.userid=users.id WHERE topics.is_pending=0 AND `+models.VisibleGroupsSQL+` ORDER BY topics.created_date DESC LIMIT 20;`, isSuperAdmin, sess.UserID)
 	for trows.Next() {
 		t := Topic{}
 		var cDate int64
@@ -60,8 +64,11 @@ var IndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session)
 			topics = append(topics, t)
 		}
 	}
+	commonData := readCommonData(r, sess)
+	commonData.FeedURL = "?"
+
 	templates.Render(w, "index.html", map[string]interface{}{
-		"Common":                readCommonData(r, sess),
+		"Common":                commonData,
 		"GroupCreationDisabled": models.Config(models.GroupCreationDisabled) == "1",
 		"HeaderMsg":             models.Config(models.HeaderMsg),
 		"Groups":                groups,
@@ -84,21 +91,46 @@ var AdminIndexHandler = A(func(w http.ResponseWriter, r *http.Request, sess Sess
 		loginMsg := strings.TrimSpace(r.PostFormValue("login_msg"))
 		signupMsg := strings.TrimSpace(r.PostFormValue("signup_msg"))
 		signupDisabled := "0"
+		inviteOnly := "0"
 		groupCreationDisabled := "0"
 		imageUploadEnabled := "0"
 		allowGroupSubscription := "0"
 		allowTopicSubscription := "0"
 		readOnlyMode := "0"
+		require2FA := "0"
+		requireVerifiedEmail := "0"
 		dataDir := r.PostFormValue("data_dir")
+		breachedPasswdFile := strings.TrimSpace(r.PostFormValue("breached_passwd_file"))
 		bodyAppendage := r.PostFormValue("body_appendage")
+		forumURL := strings.TrimRight(strings.TrimSpace(r.PostFormValue("forum_url")), "/")
 		defaultFromEmail := r.PostFormValue("default_from_mail")
 		smtpHost := r.PostFormValue("smtp_host")
 		smtpPort := r.PostFormValue("smtp_port")
 		smtpUser := r.PostFormValue("smtp_user")
 		smtpPass := r.PostFormValue("smtp_pass")
+		oidcIssuer := strings.TrimSpace(r.PostFormValue("oidc_issuer"))
+		oidcClientID := strings.TrimSpace(r.PostFormValue("oidc_client_id"))
+		oidcClientSecret := r.PostFormValue("oidc_client_secret")
+		oidcScopes := strings.Join(strings.Fields(r.PostFormValue("oidc_scopes")), " ")
+		oidcAdminClaim := strings.TrimSpace(r.PostFormValue("oidc_admin_claim"))
+		oidcAdminGroup := strings.TrimSpace(r.PostFormValue("oidc_admin_group"))
+		ldapURL := strings.TrimSpace(r.PostFormValue("ldap_url"))
+		ldapBindDN := strings.TrimSpace(r.PostFormValue("ldap_bind_dn"))
+		ldapBindPass := r.PostFormValue("ldap_bind_pass")
+		ldapBaseDN := strings.TrimSpace(r.PostFormValue("ldap_base_dn"))
+		ldapUserFilter := strings.TrimSpace(r.PostFormValue("ldap_user_filter"))
+		ldapGroupAttr := strings.TrimSpace(r.PostFormValue("ldap_group_attr"))
+		ldapGroupRoles := r.PostFormValue("ldap_group_roles")
+		premodAccountAge, premodNumPosts, premodErr := parsePremodThresholds(r.PostFormValue(models.PremodAccountAge), r.PostFormValue(models.PremodNumPosts))
+		infractionPointsDays := strings.TrimSpace(r.PostFormValue(models.InfractionPointsDays))
+		infractionEscalations := r.PostFormValue(models.InfractionEscalations)
+		ldapOnly := "0"
 		if r.PostFormValue("signup_disabled") != "" {
 			signupDisabled = "1"
 		}
+		if r.PostFormValue(models.InviteOnly) != "" {
+			inviteOnly = "1"
+		}
 		if r.PostFormValue("group_creation_disabled") != "" {
 			groupCreationDisabled = "1"
 		}
@@ -114,6 +146,15 @@ var AdminIndexHandler = A(func(w http.ResponseWriter, r *http.Request, sess Sess
 		if r.PostFormValue(models.ReadOnlyMode) != "" {
 			readOnlyMode = "1"
 		}
+		if r.PostFormValue(models.Require2FA) != "" {
+			require2FA = "1"
+		}
+		if r.PostFormValue(models.RequireVerifiedEmail) != "" {
+			requireVerifiedEmail = "1"
+		}
+		if r.PostFormValue(models.LDAPOnly) != "" {
+			ldapOnly = "1"
+		}
 		if dataDir != "" {
 			if dataDir[len(dataDir)-1] != '/' {
 				dataDir = dataDir + "/"
@@ -124,26 +165,83 @@ var AdminIndexHandler = A(func(w http.ResponseWriter, r *http.Request, sess Sess
 		if forumName == "" {
 			errMsg = "Forum name is empty."
 		}
+		if require2FA == "1" && !models.IsTOTPEnabled(sessUserID(&sess)) {
+			errMsg = "Turn on two-factor authentication for your account before requiring it."
+		}
+		if breachedPasswdFile != "" {
+			if _, err := utils.IsPasswdBreached(breachedPasswdFile, ""); err != nil {
+				errMsg = "Unable to read the breached password list: " + err.Error()
+			}
+		}
+		if oidcIssuer != "" && (oidcClientID == "" || !strings.Contains(" "+oidcScopes+" ", " openid ")) {
+			errMsg = "Single sign-on needs a client ID, and the scopes must include openid."
+		}
+		if ldapURL != "" && ((!strings.HasPrefix(ldapURL, "ldap://") && !strings.HasPrefix(ldapURL, "ldaps://")) || !strings.Contains(ldapUserFilter, "%s")) {
+			errMsg = "LDAP URL should start with ldap:// or ldaps://, and the user filter must contain %s."
+		}
+		if _, err := parseGroupRoles(ldapGroupRoles); err != nil {
+			errMsg = err.Error() + ` (Expected "mod <group> = <LDAP group DN>" or "admin <group> = <LDAP group DN>".)`
+		}
+		if premodErr != nil {
+			errMsg = premodErr.Error()
+		}
+		if infractionPointsDays == "" {
+			infractionPointsDays = "0"
+		}
+		if days, err := strconv.Atoi(infractionPointsDays); err != nil || days < 0 {
+			errMsg = "The number of days warning points count for should be a whole number, or 0 to count them forever."
+		}
+		if _, err := parseEscalations(infractionEscalations); err != nil {
+			errMsg = err.Error() + ` (Expected "<points> = suspend <days>" or "<points> = ban".)`
+		}
 
 		if errMsg == "" {
+			oldConfig := models.ConfigAllVals()
 			models.WriteConfig(models.ForumName, forumName)
 			models.WriteConfig(models.HeaderMsg, headerMsg)
 			models.WriteConfig(models.LoginMsg, loginMsg)
 			models.WriteConfig(models.SignupMsg, signupMsg)
 			models.WriteConfig(models.SignupDisabled, signupDisabled)
+			models.WriteConfig(models.InviteOnly, inviteOnly)
 			models.WriteConfig(models.CensoredWords, censoredWords)
 			models.WriteConfig(models.GroupCreationDisabled, groupCreationDisabled)
 			models.WriteConfig(models.ImageUploadEnabled, imageUploadEnabled)
 			models.WriteConfig(models.AllowGroupSubscription, allowGroupSubscription)
 			models.WriteConfig(models.AllowTopicSubscription, allowTopicSubscription)
 			models.WriteConfig(models.ReadOnlyMode, readOnlyMode)
+			models.WriteConfig(models.Require2FA, require2FA)
+			models.WriteConfig(models.RequireVerifiedEmail, requireVerifiedEmail)
+			models.WriteConfig(models.PremodAccountAge, strconv.Itoa(premodAccountAge))
+			models.WriteConfig(models.PremodNumPosts, strconv.Itoa(premodNumPosts))
+			models.WriteConfig(models.InfractionPointsDays, infractionPointsDays)
+			models.WriteConfig(models.InfractionEscalations, infractionEscalations)
 			models.WriteConfig(models.DataDir, dataDir)
+			models.WriteConfig(models.BreachedPasswdFile, breachedPasswdFile)
 			models.WriteConfig(models.BodyAppendage, bodyAppendage)
+			models.WriteConfig(models.ForumURL, forumURL)
 			models.WriteConfig(models.DefaultFromMail, defaultFromEmail)
 			models.WriteConfig(models.SMTPHost, smtpHost)
 			models.WriteConfig(models.SMTPPort, smtpPort)
 			models.WriteConfig(models.SMTPUser, smtpUser)
 			models.WriteConfig(models.SMTPPass, smtpPass)
+			models.WriteConfig(models.OIDCIssuer, oidcIssuer)
+			models.WriteConfig(models.OIDCClientID, oidcClientID)
+			models.WriteConfig(models.OIDCClientSecret, oidcClientSecret)
+			models.WriteConfig(models.OIDCScopes, oidcScopes)
+			models.WriteConfig(models.OIDCAdminClaim, oidcAdminClaim)
+			models.WriteConfig(models.OIDCAdminGroup, oidcAdminGroup)
+			models.WriteConfig(models.LDAPURL, ldapURL)
+			models.WriteConfig(models.LDAPBindDN, ldapBindDN)
+			models.WriteConfig(models.LDAPBindPass, ldapBindPass)
+			models.WriteConfig(models.LDAPBaseDN, ldapBaseDN)
+			models.WriteConfig(models.LDAPUserFilter, ldapUserFilter)
+			models.WriteConfig(models.LDAPGroupAttr, ldapGroupAttr)
+			models.WriteConfig(models.LDAPGroupRoles, ldapGroupRoles)
+			models.WriteConfig(models.LDAPOnly, ldapOnly)
+			auditConfig(r, &sess, oldConfig, models.ConfigAllVals())
+			if _, ok := utils.CurrentMailer().(*utils.SMTPMailer); ok {
+				utils.SetMailer(utils.NewSMTPMailer())
+			}
 			sess.SetFlashMsg("Update successful.")
 		} else {
 			sess.SetFlashMsg(errMsg)
@@ -183,13 +281,58 @@ var AdminIndexHandler = A(func(w http.ResponseWriter, r *http.Request, sess Sess
 	}
 
 	templates.Render(w, "adminindex.html", map[string]interface{}{
-		"Common":      readCommonData(r, sess),
-		"Config":      models.ConfigAllVals(),
-		"ExtraNotes":  extraNotes,
-		"NumUsers":    models.NumUsers(),
-		"NumGroups":   models.NumGroups(),
-		"NumTopics":   models.NumTopics(),
-		"NumComments": models.NumComments(),
+		"Common":          readCommonData(r, sess),
+		"Config":          models.ConfigAllVals(),
+		"ExtraNotes":      extraNotes,
+		"NumUsers":        models.NumUsers(),
+		"NumGroups":       models.NumGroups(),
+		"NumTopics":       models.NumTopics(),
+		"NumComments":     models.NumComments(),
+		"NumReports":      models.NumOpenReports(""),
+		"NumAuditEntries": models.NumAuditEntries(time.Now().Add(-24 * time.Hour).Unix()),
+		"NumFailedMails":  len(models.ReadFailedMails(numFailedMails)),
+		"NumFailedLogins": models.NumLoginFailures(time.Now().Add(-loginFailureWindow).Unix()),
+		"NumInvitedUsers": models.NumInvitedUsers(),
+		"NumBlocks":       models.NumBlocks(models.BlockIP) + models.NumBlocks(models.BlockEmail),
+	})
+})
+
+var numFailedMails = 100
+
+var AdminMailHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	if !sess.IsUserSuperAdmin() {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	if r.Method == "POST" {
+		mailID := r.PostFormValue("id")
+		if r.PostFormValue("action") == "Retry" {
+			models.RetryMail(mailID)
+		} else if r.PostFormValue("action") == "Delete" {
+			models.DeleteMail(mailID)
+		}
+		http.Redirect(w, r, "/admin/mail", http.StatusSeeOther)
+		return
+	}
+
+	type Mail struct {
+		models.QueuedMail
+		IsDead         bool
+		CreatedDateStr string
+		NextAttemptStr string
+	}
+	var mails []Mail
+	for _, m := range models.ReadFailedMails(numFailedMails) {
+		mails = append(mails, Mail{
+			QueuedMail:     m,
+			IsDead:         m.Status == models.MailDead,
+			CreatedDateStr: timeAgoFromNow(time.Unix(m.CreatedDate, 0)),
+			NextAttemptStr: time.Unix(m.NextAttemptDate, 0).UTC().Format(time.RFC1123),
+		})
+	}
+	templates.Render(w, "adminmail.html", map[string]interface{}{
+		"Common": readCommonData(r, sess),
+		"Mails":  mails,
 	})
 })
 
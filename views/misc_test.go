@@ -7,6 +7,7 @@ package views
 import (
 	"github.com/s-gv/orangeforum/models"
 	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/search"
 	"github.com/s-gv/orangeforum/static"
 	"net/http"
 	"net/http/httptest"
@@ -17,8 +18,9 @@ import (
 
 func TestMain(m *testing.M) {
 	// Setup
-	db.Init("sqlite3", ":memory:")
+	db.Init("sqlite3", "file::memory:?cache=shared")
 	models.Migrate()
+	search.Migrate()
 
 	models.CreateSuperUser("admin", "admin12345")
 
@@ -0,0 +1,154 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/templates"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var notificationsPerPage = 50
+
+func sessUserID(sess *Session) string {
+	if !sess.UserID.Valid {
+		return ""
+	}
+	return strconv.FormatInt(sess.UserID.Int64, 10)
+}
+
+// notifyMentions notifies the users @mentioned in content, except those in skip. It
+// returns the IDs of the users notified.
+func notifyMentions(sess *Session, groupID string, content string, what string, url string, skip map[string]bool) []string {
+	var notified []string
+	actorID := sessUserID(sess)
+	for _, userID := range models.ReadMentionedUserIDs(content, groupID) {
+		if !skip[userID] {
+			models.CreateNotification(userID, actorID, models.NotifyMention, "mentioned you in "+what, url)
+			notified = append(notified, userID)
+		}
+	}
+	return notified
+}
+
+// notifyNewComment notifies the owner of the topic, the owner of the comment being
+// replied to, and the users mentioned in the comment, if they can still see the group.
+func notifyNewComment(sess *Session, topicID string, commentID string, content string) {
+	var topicOwnerID, groupID, title string
+	db.QueryRow(`SELECT userid, groupid, title FROM topics WHERE id=?;`, topicID).Scan(&topicOwnerID, &groupID, &title)
+	var parentOwnerID string
+	db.QueryRow(`SELECT parents.userid FROM comments INNER JOIN comments parents ON parents.id=comments.parentid
+		WHERE comments.id=?;`, commentID).Scan(&parentOwnerID)
+
+	actorID := sessUserID(sess)
+	url := "/comments?id=" + commentID
+	notified := map[string]bool{actorID: true}
+	if parentOwnerID != "" && models.CanUserViewGroup(parentOwnerID, groupID) {
+		models.CreateNotification(parentOwnerID, actorID, models.NotifyCommentReply, `replied to your comment in "`+censor(title)+`"`, url)
+		notified[parentOwnerID] = true
+	}
+	if !notified[topicOwnerID] && models.CanUserViewGroup(topicOwnerID, groupID) {
+		models.CreateNotification(topicOwnerID, actorID, models.NotifyTopicReply, `replied to your topic "`+censor(title)+`"`, url)
+		notified[topicOwnerID] = true
+	}
+	notifyMentions(sess, groupID, content, `a comment in "`+censor(title)+`"`, url, notified)
+}
+
+// notifyNewTopic notifies the users subscribed to the group and the users mentioned
+// in the topic.
+func notifyNewTopic(sess *Session, groupID string, groupName string, topicID string, title string, content string) {
+	actorID := sessUserID(sess)
+	url := "/topics?id=" + topicID
+	notified := map[string]bool{actorID: true}
+	for _, userID := range notifyMentions(sess, groupID, content, `the topic "`+censor(title)+`"`, url, notified) {
+		notified[userID] = true
+	}
+	if models.Config(models.AllowGroupSubscription) == "0" {
+		return
+	}
+	rows := db.Query(`SELECT userid FROM groupsubscriptions WHERE groupid=?;`, groupID)
+	for rows.Next() {
+		var userID string
+		rows.Scan(&userID)
+		if !notified[userID] && models.CanUserViewGroup(userID, groupID) {
+			models.CreateNotification(userID, actorID, models.NotifyNewTopic, `posted "`+censor(title)+`" in `+groupName, url)
+		}
+	}
+}
+
+// notifyTopicModAction notifies the owner of a topic that a moderator acted on it.
+func notifyTopicModAction(sess *Session, perms postPerms, action string) {
+	if perms.IsOwner {
+		return
+	}
+	var ownerID, title string
+	db.QueryRow(`SELECT userid, title FROM topics WHERE id=?;`, perms.TopicID).Scan(&ownerID, &title)
+	models.CreateNotification(ownerID, sessUserID(sess), models.NotifyModAction, action+` your topic "`+censor(title)+`"`, "/topics?id="+perms.TopicID)
+}
+
+// notifyCommentModAction notifies the owner of a comment that a moderator acted on it.
+func notifyCommentModAction(sess *Session, perms postPerms, commentID string, action string) {
+	if perms.IsOwner {
+		return
+	}
+	var ownerID, title string
+	db.QueryRow(`SELECT comments.userid, topics.title FROM comments INNER JOIN topics ON topics.id=comments.topicid
+		WHERE comments.id=?;`, commentID).Scan(&ownerID, &title)
+	models.CreateNotification(ownerID, sessUserID(sess), models.NotifyModAction, action+` your comment in "`+censor(title)+`"`, "/comments?id="+commentID)
+}
+
+var NotificationsHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	userID := sessUserID(&sess)
+	if r.Method == "POST" {
+		if r.PostFormValue("action") == "Mark all as read" {
+			models.MarkAllNotificationsRead(userID)
+		} else {
+			r.ParseForm()
+			models.MarkNotificationsRead(userID, r.PostForm["id"])
+		}
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+		return
+	}
+
+	page, err := strconv.Atoi(r.FormValue("p"))
+	if err != nil || page < 0 {
+		page = 0
+	}
+
+	type Notification struct {
+		models.Notification
+		CreatedDateStr string
+	}
+	var notifications []Notification
+	nextPage := -1
+	for i, n := range models.ReadNotifications(userID, page*notificationsPerPage, notificationsPerPage+1) {
+		if i == notificationsPerPage {
+			nextPage = page + 1
+			break
+		}
+		notifications = append(notifications, Notification{n, timeAgoFromNow(time.Unix(n.CreatedDate, 0))})
+	}
+
+	commonData := readCommonData(r, sess)
+	commonData.PageTitle = "Notifications"
+	templates.Render(w, "notifications.html", map[string]interface{}{
+		"Common":        commonData,
+		"Notifications": notifications,
+		"NextPage":      nextPage,
+	})
+})
+
+// NotificationOpenHandler marks a notification as read and redirects to the post.
+var NotificationOpenHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	url, err := models.ReadNotificationURL(sessUserID(&sess), r.FormValue("id"))
+	if err != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+})
@@ -0,0 +1,95 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"encoding/json"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifications(t *testing.T) {
+	models.CreateUser("ntauthor", "ntauthor12345", "")
+	models.CreateUser("ntreplier", "ntreplier12345", "")
+	models.CreateUser("ntmentioned", "ntmentioned12345", "")
+	authorID, _ := models.ReadUserIDByName("ntauthor")
+	mentionedID, _ := models.ReadUserIDByName("ntmentioned")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"ntgroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("ntgroup")
+	models.CreateGroupMod("ntreplier", groupID)
+
+	authorSess := sessionForTest("ntauthor")
+	replierSess := sessionForTest("ntreplier")
+
+	rr := apiRequestForTest(APITopicsHandler, "POST", "/api/v1/topics", `{"group_id": `+groupID+`, "title": "Notification topic"}`, authorSess)
+	var topic apiTopic
+	json.Unmarshal(rr.Body.Bytes(), &topic)
+	topicID := strconv.FormatInt(topic.ID, 10)
+
+	rr = apiRequestForTest(APICommentsHandler, "POST", "/api/v1/comments", `{"topic_id": `+topicID+`, "content": "Hello @ntmentioned"}`, replierSess)
+	var comment apiComment
+	json.Unmarshal(rr.Body.Bytes(), &comment)
+	commentID := strconv.FormatInt(comment.ID, 10)
+
+	if n := models.NumUnreadNotifications(strconv.Itoa(authorID)); n != 1 {
+		t.Errorf("Topic owner has %d notifications, want 1", n)
+	}
+	if n := models.NumUnreadNotifications(strconv.Itoa(mentionedID)); n != 1 {
+		t.Errorf("Mentioned user has %d notifications, want 1", n)
+	}
+
+	rr = apiRequestForTest(APICommentsHandler, "POST", "/api/v1/comments", `{"topic_id": `+topicID+`, "parent_id": `+commentID+`, "content": "A reply"}`, authorSess)
+	var reply apiComment
+	json.Unmarshal(rr.Body.Bytes(), &reply)
+	if rr := apiRequestForTest(APICommentsHandler, "DELETE", "/api/v1/comments?id="+strconv.FormatInt(reply.ID, 10), "", replierSess); rr.Code != http.StatusNoContent {
+		t.Fatalf("Moderator cannot delete comment: got %v", rr.Code)
+	}
+	if n := models.NumUnreadNotifications(strconv.Itoa(authorID)); n != 2 {
+		t.Errorf("Owner of deleted comment has %d notifications, want 2", n)
+	}
+
+	body := getForTest(NotificationsHandler, "/notifications", replierSess).Body.String()
+	if !strings.Contains(body, "replied to your comment") {
+		t.Errorf("Notifications page does not show reply: %s", body)
+	}
+	body = getForTest(NotificationsHandler, "/notifications", authorSess).Body.String()
+	if !strings.Contains(body, "deleted your comment") || !strings.Contains(body, "Notifications <span class=\"alert\">(2)</span>") {
+		t.Errorf("Notifications page does not show moderator action: %s", body)
+	}
+
+	var csrf string
+	db.QueryRow(`SELECT csrf FROM sessions WHERE sessionid=?;`, authorSess).Scan(&csrf)
+	form := url.Values{"csrf": {csrf}, "action": {"Mark all as read"}}
+	req, _ := http.NewRequest("POST", "/notifications", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "sessionid", Path: "/", Value: authorSess, HttpOnly: true})
+	rr = httptest.NewRecorder()
+	NotificationsHandler(rr, req)
+	if n := models.NumUnreadNotifications(strconv.Itoa(authorID)); rr.Code != http.StatusSeeOther || n != 0 {
+		t.Errorf("Mark all as read: got %v, %d unread", rr.Code, n)
+	}
+
+	// A user removed from a private group is not told about new comments in it.
+	db.Exec(`INSERT INTO groups(name, description, is_private, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		"ntprivate", "", true, time.Now().Unix(), time.Now().Unix())
+	privateID := models.ReadGroupIDByName("ntprivate")
+	models.CreateGroupMember(strconv.Itoa(authorID), privateID)
+	models.CreateGroupMod("ntreplier", privateID)
+	rr = apiRequestForTest(APITopicsHandler, "POST", "/api/v1/topics", `{"group_id": `+privateID+`, "title": "Private notification topic"}`, authorSess)
+	json.Unmarshal(rr.Body.Bytes(), &topic)
+	models.DeleteGroupMember(strconv.Itoa(authorID), privateID)
+	apiRequestForTest(APICommentsHandler, "POST", "/api/v1/comments", `{"topic_id": `+strconv.FormatInt(topic.ID, 10)+`, "content": "Secret"}`, replierSess)
+	if n := models.NumUnreadNotifications(strconv.Itoa(authorID)); n != 0 {
+		t.Errorf("User removed from a private group notified of a comment in it: %d notifications", n)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"errors"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/oidc"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// oidcProvider returns the identity provider from the config. ok is false if single
+// sign-on isn't set up.
+func oidcProvider(r *http.Request) (p oidc.Provider, ok bool) {
+	issuer := models.Config(models.OIDCIssuer)
+	if issuer == "" {
+		return p, false
+	}
+	baseURL := models.Config(models.ForumURL)
+	if baseURL == "" {
+		baseURL = "http://" + r.Host
+		if r.TLS != nil {
+			baseURL = "https://" + r.Host
+		}
+	}
+	return oidc.Provider{
+		Issuer:       issuer,
+		ClientID:     models.Config(models.OIDCClientID),
+		ClientSecret: models.Config(models.OIDCClientSecret),
+		RedirectURL:  baseURL + "/login/oidc/callback",
+		Scopes:       strings.Fields(models.Config(models.OIDCScopes)),
+	}, true
+}
+
+// oidcUserName returns an unused username for a new user, based on the claims.
+func oidcUserName(claims oidc.Claims) string {
+	email := claims.String("email")
+	if i := strings.Index(email, "@"); i >= 0 {
+		email = email[:i]
+	}
+	for _, name := range []string{claims.String("preferred_username"), claims.String("nickname"), email, claims.String("name"), "user"} {
+		var b []byte
+		for _, ch := range []byte(name) {
+			if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '_' {
+				b = append(b, ch)
+			} else if ch == '.' || ch == '-' || ch == ' ' {
+				b = append(b, '_')
+			}
+		}
+		name = strings.Trim(string(b), "_")
+		if len(name) > 32 {
+			name = name[:32]
+		}
+		if validateUserName(name) != nil {
+			continue
+		}
+		base := name
+		for i := 2; models.ProbeUser(name); i++ {
+			suffix := strconv.Itoa(i)
+			if len(base)+len(suffix) > 32 {
+				base = base[:32-len(suffix)]
+			}
+			name = base + suffix
+		}
+		return name
+	}
+	return "user"
+}
+
+// oidcUser returns the user linked to the identity in claims. An identity that isn't linked
+// yet is linked to the user with the same e-mail address if the provider has verified it and
+// the user has confirmed it, or else a new user is created.
+func oidcUser(issuer string, claims oidc.Claims) (int, error) {
+	subject := issuer + " " + claims.String("sub")
+	if len(subject) > 512 {
+		return 0, errors.New("Single sign-on subject too long.")
+	}
+	if userID, err := models.ReadUserIDByOIDCSubject(subject); err == nil {
+		return userID, nil
+	}
+	// Unverified addresses are neither trusted for linking nor saved, so that they can't
+	// be used to take over an account later.
+	email := claims.String("email")
+	if !claims.Bool("email_verified") || len(email) > 64 {
+		email = ""
+	}
+	if email != "" {
+		if userID, err := models.ReadUserIDByEmail(email); err == nil {
+			models.LinkOIDCSubject(userID, subject)
+			return userID, nil
+		}
+	}
+	return models.CreateOIDCUser(oidcUserName(claims), email, subject)
+}
+
+var OIDCLoginHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	p, ok := oidcProvider(r)
+	if !ok {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	if sess.IsUserValid() {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	// The PKCE code verifier is the only secret. State, nonce and code challenge are all
+	// derived from it, since they are sent to the provider in the same URL anyway.
+	challenge := oidc.CodeChallenge(newChallenge(&sess))
+	authURL, err := p.AuthCodeURL(challenge, challenge, challenge)
+	if err != nil {
+		log.Printf("[ERROR] Single sign-on: %s\n", err)
+		sess.SetFlashMsg("Single sign-on is unavailable. Try again later.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+})
+
+var OIDCCallbackHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	p, ok := oidcProvider(r)
+	if !ok {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	fail := func(msg string) {
+		sess.SetFlashMsg(msg)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	}
+	verifier := takeChallenge(&sess)
+	challenge := oidc.CodeChallenge(verifier)
+	if errCode := r.FormValue("error"); errCode != "" {
+		fail("Single sign-on failed: " + errCode)
+		return
+	}
+	if verifier == "" || r.FormValue("state") != challenge {
+		fail("Single sign-on expired. Try again.")
+		return
+	}
+	// Blocked clients can't sign up through single sign-on either.
+	if isIPBlocked(remoteIP(r)) {
+		fail(errIPBlocked.Error())
+		return
+	}
+	claims, err := p.Exchange(r.FormValue("code"), verifier, challenge)
+	if err != nil {
+		log.Printf("[ERROR] Single sign-on: %s\n", err)
+		fail("Single sign-on failed.")
+		return
+	}
+	userID, err := oidcUser(p.Issuer, claims)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if adminGroup := models.Config(models.OIDCAdminGroup); adminGroup != "" {
+		isAdmin := false
+		for _, group := range claims.Strings(models.Config(models.OIDCAdminClaim)) {
+			if group == adminGroup {
+				isAdmin = true
+			}
+		}
+		models.UpdateUserSuperAdmin(userID, isAdmin)
+	}
+
+	var isBanned bool
+	db.QueryRow(`SELECT is_banned FROM users WHERE id=?;`, userID).Scan(&isBanned)
+	if isBanned {
+		fail("User banned")
+		return
+	}
+	if models.IsTOTPEnabled(strconv.Itoa(userID)) {
+		sess.setPendingLogin(int64(userID))
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+	sess.logIn(int64(userID))
+	http.Redirect(w, r, loginRedirectURL(&sess, "/"), http.StatusSeeOther)
+})
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/oidc/oidctest"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	idp := oidctest.NewServer("forum", "s3cret")
+	defer idp.Close()
+	models.WriteConfig(models.ForumURL, "https://forum.test")
+	models.WriteConfig(models.OIDCIssuer, idp.URL)
+	models.WriteConfig(models.OIDCClientID, "forum")
+	models.WriteConfig(models.OIDCClientSecret, "s3cret")
+	models.WriteConfig(models.OIDCAdminGroup, "forum-admins")
+	defer func() {
+		models.WriteConfig(models.ForumURL, "")
+		models.WriteConfig(models.OIDCIssuer, "")
+		models.WriteConfig(models.OIDCAdminGroup, "")
+	}()
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }}
+	// login returns the name of the user that the identity in claims logged in as.
+	login := func(claims map[string]interface{}, tamper bool) string {
+		idp.Claims = claims
+		sessionID := randSeq(32)
+		db.Exec(`INSERT INTO sessions(sessionid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+			sessionID, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+		rr := getForTest(OIDCLoginHandler, "/login/oidc", sessionID)
+		resp, err := client.Get(rr.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("Authorization request: %s", err)
+		}
+		resp.Body.Close()
+		callback, _ := url.Parse(resp.Header.Get("Location"))
+		if tamper {
+			q := callback.Query()
+			q.Set("state", "forged")
+			callback.RawQuery = q.Encode()
+		}
+		getForTest(OIDCCallbackHandler, callback.RequestURI(), sessionID)
+		var userName string
+		db.QueryRow(`SELECT users.username FROM sessions INNER JOIN users ON users.id=sessions.userid WHERE sessions.sessionid=?;`, sessionID).Scan(&userName)
+		return userName
+	}
+	isSuperAdmin := func(userName string) bool {
+		var isAdmin bool
+		db.QueryRow(`SELECT is_superadmin FROM users WHERE username=?;`, userName).Scan(&isAdmin)
+		return isAdmin
+	}
+
+	jane := map[string]interface{}{"sub": "jane", "preferred_username": "jane.doe", "email": "jane@example.com", "email_verified": true}
+	if got := login(jane, false); got != "jane_doe" || models.ReadUserEmail("jane_doe") != "jane@example.com" {
+		t.Fatalf("New user not provisioned: %q", got)
+	}
+	jane["preferred_username"] = "jane.d"
+	if got := login(jane, false); got != "jane_doe" {
+		t.Errorf("Returning user logged in as %q", got)
+	}
+	if got := login(jane, true); got != "" {
+		t.Errorf("Forged state logged in as %q", got)
+	}
+
+	models.CreateUser("oidcbob", "oidcbob12345", "bob@example.com")
+	if got := login(map[string]interface{}{"sub": "bob", "email": "bob@example.com", "email_verified": false}, false); got == "oidcbob" || got == "" {
+		t.Errorf("Unverified e-mail logged in as %q", got)
+	}
+	if got := login(map[string]interface{}{"sub": "bob2", "email": "BOB@example.com", "email_verified": true}, false); got != "oidcbob" {
+		t.Errorf("Verified e-mail not linked: %q", got)
+	}
+	models.CreateUser("oidcdave", "oidcdave12345", "dave@example.com")
+	db.Exec(`UPDATE users SET is_email_confirmed=? WHERE username=?;`, false, "oidcdave")
+	if got := login(map[string]interface{}{"sub": "dave", "email": "dave@example.com", "email_verified": true}, false); got == "oidcdave" || got == "" {
+		t.Errorf("Unconfirmed e-mail from before confirmation was added logged in as %q", got)
+	}
+
+	admin := map[string]interface{}{"sub": "carol", "preferred_username": "jane.doe", "groups": []string{"staff", "forum-admins"}}
+	if got := login(admin, false); got != "jane_doe2" || !isSuperAdmin(got) {
+		t.Errorf("Admin group not mapped: %q", got)
+	}
+	admin["groups"] = []string{"staff"}
+	if got := login(admin, false); got != "jane_doe2" || isSuperAdmin(got) {
+		t.Errorf("Admin privileges not revoked: %q", got)
+	}
+}
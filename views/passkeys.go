@@ -0,0 +1,202 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"encoding/json"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/templates"
+	"github.com/s-gv/orangeforum/webauthn"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A WebAuthn challenge has to be answered within maxChallengeLife.
+const maxChallengeLife = 5 * time.Minute
+
+// relyingParty describes the forum to authenticators. The forum URL from the config is used
+// if set, so that passkeys keep working behind a reverse proxy.
+func relyingParty(r *http.Request) webauthn.RelyingParty {
+	rp := webauthn.RelyingParty{Name: models.Config(models.ForumName)}
+	if u, err := url.Parse(models.Config(models.ForumURL)); err == nil && u.Host != "" {
+		rp.ID = u.Hostname()
+		rp.Origins = []string{u.Scheme + "://" + u.Host}
+		return rp
+	}
+	rp.ID = r.Host
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		rp.ID = host
+	}
+	rp.Origins = []string{"https://" + r.Host, "http://" + r.Host}
+	return rp
+}
+
+// newChallenge saves a new WebAuthn challenge in the session and returns it.
+func newChallenge(sess *Session) string {
+	challenge := webauthn.NewChallenge()
+	db.Exec(`UPDATE sessions SET challenge=?, challenge_date=? WHERE sessionid=?;`, challenge, time.Now().Unix(), sess.SessionID)
+	return challenge
+}
+
+// takeChallenge returns the WebAuthn challenge of the session, or "" if it has expired.
+// A challenge can be taken only once.
+func takeChallenge(sess *Session) string {
+	var challenge string
+	var challengeDate int64
+	db.QueryRow(`SELECT challenge, challenge_date FROM sessions WHERE sessionid=?;`, sess.SessionID).Scan(&challenge, &challengeDate)
+	db.Exec(`UPDATE sessions SET challenge='', challenge_date=0 WHERE sessionid=?;`, sess.SessionID)
+	if time.Unix(challengeDate, 0).Before(time.Now().Add(-maxChallengeLife)) {
+		return ""
+	}
+	return challenge
+}
+
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+// passkeyLoginOptions returns the options for the "Login with a passkey" button.
+func passkeyLoginOptions(r *http.Request, sess *Session) string {
+	return jsonString(relyingParty(r).RequestOptions(newChallenge(sess)))
+}
+
+var PasskeyLoginHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	redirectURL, err := url.QueryUnescape(r.FormValue("next"))
+	if err != nil || redirectURL == "" || redirectURL[0] != '/' {
+		redirectURL = "/"
+	}
+	if r.Method != "POST" || sess.IsUserValid() {
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+	fail := func(msg string) {
+		sess.SetFlashMsg(msg)
+		http.Redirect(w, r, "/login?next="+redirectURL, http.StatusSeeOther)
+	}
+
+	ip := remoteIP(r)
+	credentialID := r.PostFormValue("credential_id")
+	if len(credentialID) > 1400 {
+		fail("Unknown security key.")
+		return
+	}
+	passkey, err := models.ReadPasskeyByCredentialID(credentialID)
+	userName := ""
+	if err == nil {
+		db.QueryRow(`SELECT username FROM users WHERE id=?;`, passkey.UserID).Scan(&userName)
+	}
+	if err := checkLoginIP(r, userName); err != nil {
+		fail(err.Error())
+		return
+	}
+	if wait := loginWait(userName, ip, time.Now()); wait > 0 {
+		fail(errLoginThrottled(wait).Error())
+		return
+	}
+	if err != nil {
+		models.RecordLoginFailure(userName, ip, models.LoginActionPasskey)
+		fail("Unknown security key.")
+		return
+	}
+	clientData, _ := webauthn.DecodeID(r.PostFormValue("client_data"))
+	authenticatorData, _ := webauthn.DecodeID(r.PostFormValue("authenticator_data"))
+	signature, _ := webauthn.DecodeID(r.PostFormValue("signature"))
+	userHandle, _ := webauthn.DecodeID(r.PostFormValue("user_handle"))
+	cred := webauthn.Credential{PublicKey: passkey.PublicKey, SignCount: passkey.SignCount}
+	assertion, err := relyingParty(r).VerifyAssertion(cred, takeChallenge(&sess), clientData, authenticatorData, signature)
+	if err == nil && len(userHandle) > 0 && string(userHandle) != passkey.UserID {
+		err = webauthn.ErrUserMismatch
+	}
+	if err != nil {
+		models.RecordLoginFailure(userName, ip, models.LoginActionPasskey)
+		fail("Login with security key failed: " + err.Error())
+		return
+	}
+	models.UpdatePasskeyUsed(passkey.ID, assertion.SignCount)
+
+	var isBanned bool
+	db.QueryRow(`SELECT is_banned FROM users WHERE id=?;`, passkey.UserID).Scan(&isBanned)
+	if isBanned {
+		fail("User banned")
+		return
+	}
+	userID, _ := strconv.ParseInt(passkey.UserID, 10, 64)
+	// A key that didn't check the user's PIN or biometric is only one factor.
+	if !assertion.IsUserVerified && models.IsTOTPEnabled(passkey.UserID) {
+		sess.setPendingLogin(userID)
+		http.Redirect(w, r, "/login/2fa?next="+redirectURL, http.StatusSeeOther)
+		return
+	}
+	models.ClearLoginFailuresByUser(userName)
+	sess.logIn(userID)
+	http.Redirect(w, r, loginRedirectURL(&sess, redirectURL), http.StatusSeeOther)
+})
+
+var UserPasskeysHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	userID := sessUserID(&sess)
+	userName, _ := sess.UserName()
+	rp := relyingParty(r)
+
+	if r.Method == "POST" {
+		action := r.PostFormValue("action")
+		if action == "Add" {
+			name := strings.TrimSpace(r.PostFormValue("name"))
+			if len(name) < 1 || len(name) > 64 {
+				sess.SetFlashMsg("Name should have 1-64 characters.")
+				http.Redirect(w, r, "/users/passkeys", http.StatusSeeOther)
+				return
+			}
+			clientData, _ := webauthn.DecodeID(r.PostFormValue("client_data"))
+			attestationObject, _ := webauthn.DecodeID(r.PostFormValue("attestation_object"))
+			cred, err := rp.VerifyRegistration(takeChallenge(&sess), clientData, attestationObject)
+			if err == nil {
+				err = models.CreatePasskey(userID, name, cred.ID, cred.PublicKey, cred.SignCount)
+			}
+			if err != nil {
+				sess.SetFlashMsg("Security key not added: " + err.Error())
+			} else {
+				sess.SetFlashMsg("Security key added.")
+			}
+		} else if action == "Delete" {
+			models.DeletePasskey(userID, r.PostFormValue("id"))
+			sess.SetFlashMsg("Security key removed.")
+		}
+		http.Redirect(w, r, "/users/passkeys", http.StatusSeeOther)
+		return
+	}
+
+	type Passkey struct {
+		ID           string
+		Name         string
+		CreatedDate  string
+		LastUsedDate string
+	}
+	var passkeys []Passkey
+	for _, p := range models.ReadPasskeys(userID) {
+		lastUsed := "never"
+		if p.LastUsedDate != 0 {
+			lastUsed = timeAgoFromNow(time.Unix(p.LastUsedDate, 0))
+		}
+		passkeys = append(passkeys, Passkey{p.ID, p.Name, timeAgoFromNow(time.Unix(p.CreatedDate, 0)), lastUsed})
+	}
+
+	commonData := readCommonData(r, sess)
+	commonData.PageTitle = "Security keys and passkeys"
+
+	templates.Render(w, "profilepasskeys.html", map[string]interface{}{
+		"Common":   commonData,
+		"Passkeys": passkeys,
+		"Options":  jsonString(rp.CreationOptions(newChallenge(&sess), []byte(userID), userName, models.ReadPasskeyCredentialIDs(userID))),
+	})
+})
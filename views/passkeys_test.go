@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/utils"
+	"github.com/s-gv/orangeforum/webauthn/webauthntest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasskeyLogin(t *testing.T) {
+	models.WriteConfig(models.ForumURL, "https://forum.test")
+	defer models.WriteConfig(models.ForumURL, "")
+
+	models.CreateUser("pkuser", "pkuser12345", "")
+	userID, _ := models.ReadUserIDByName("pkuser")
+	challengeForTest := func(sessionID string) string {
+		var challenge string
+		db.QueryRow(`SELECT challenge FROM sessions WHERE sessionid=?;`, sessionID).Scan(&challenge)
+		return challenge
+	}
+	anonSessionForTest := func() string {
+		sessionID := randSeq(32)
+		db.Exec(`INSERT INTO sessions(sessionid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+			sessionID, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+		return sessionID
+	}
+	isLoggedIn := func(sessionID string) bool {
+		var loggedInID string
+		return db.QueryRow(`SELECT userid FROM sessions WHERE sessionid=? AND userid IS NOT NULL;`, sessionID).Scan(&loggedInID) == nil
+	}
+	auth := webauthntest.New()
+	login := func(rpID string) string {
+		sess := anonSessionForTest()
+		getForTest(LoginHandler, "/login", sess)
+		clientData, authData, sig := auth.Get(rpID, "https://forum.test", challengeForTest(sess))
+		rr := postFromForTest(PasskeyLoginHandler, "/login/passkey", url.Values{
+			"credential_id":      {webauthntest.EncodeID(auth.CredentialID)},
+			"client_data":        {webauthntest.EncodeID(clientData)},
+			"authenticator_data": {webauthntest.EncodeID(authData)},
+			"signature":          {webauthntest.EncodeID(sig)},
+			"user_handle":        {webauthntest.EncodeID(auth.UserHandle)},
+		}, sess, "192.0.2.30:4000")
+		if !isLoggedIn(sess) {
+			return rr.Header().Get("Location")
+		}
+		return ""
+	}
+
+	sess := sessionForTest("pkuser")
+	getForTest(UserPasskeysHandler, "/users/passkeys", sess)
+	clientData, attObj := auth.Create("forum.test", "https://forum.test", challengeForTest(sess), []byte(strconv.Itoa(userID)))
+	postFromForTest(UserPasskeysHandler, "/users/passkeys", url.Values{
+		"action":             {"Add"},
+		"name":               {"My key"},
+		"client_data":        {webauthntest.EncodeID(clientData)},
+		"attestation_object": {webauthntest.EncodeID(attObj)},
+	}, sess, "192.0.2.30:4000")
+	passkeys := models.ReadPasskeys(strconv.Itoa(userID))
+	if len(passkeys) != 1 || passkeys[0].Name != "My key" {
+		t.Fatalf("Passkey not added: %v", passkeys)
+	}
+
+	if loc := login("forum.test"); loc != "" {
+		t.Fatalf("Passkey did not log in: %s", loc)
+	}
+	if loc := login("evil.test"); loc == "" {
+		t.Errorf("Passkey for another site logged in")
+	}
+
+	models.EnableTOTP(strconv.Itoa(userID), utils.NewTOTPSecret())
+	auth.UserVerified = false
+	if loc := login("forum.test"); !strings.HasPrefix(loc, "/login/2fa") {
+		t.Errorf("Passkey without user verification skipped two-factor authentication: %s", loc)
+	}
+
+	postFromForTest(UserPasskeysHandler, "/users/passkeys", url.Values{"action": {"Delete"}, "id": {passkeys[0].ID}}, sess, "192.0.2.30:4000")
+	auth.UserVerified = true
+	if loc := login("forum.test"); loc == "" || len(models.ReadPasskeys(strconv.Itoa(userID))) != 0 {
+		t.Errorf("Deleted passkey logged in")
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"errors"
+	"fmt"
+	"github.com/s-gv/orangeforum/ldap"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An LDAP server has to answer each request within ldapTimeout.
+const ldapTimeout = 5 * time.Second
+
+var errLoginUnavailable = errors.New("Login is unavailable. Try again later.")
+
+// A PasswordAuthenticator checks usernames and passwords. CheckPassword returns
+// errIncorrectLogin if they don't match, and another error if they couldn't be checked.
+type PasswordAuthenticator interface {
+	CheckPassword(userName string, passwd string) (DirectoryUser, error)
+}
+
+// DirectoryUser is what an authenticator knows about a user. Users from an external
+// directory are created on their first login, and their group roles are synced on every login.
+type DirectoryUser struct {
+	IsExternal bool
+	Email      string
+	Groups     []string
+}
+
+// localAuthenticator checks passwords against the hashes in the users table.
+type localAuthenticator struct {
+	superAdminsOnly bool
+}
+
+func (a localAuthenticator) CheckPassword(userName string, passwd string) (DirectoryUser, error) {
+	var passwdHashStr string
+	var isSuperAdmin bool
+	if db.QueryRow(`SELECT passwdhash, is_superadmin FROM users WHERE username=?;`, userName).Scan(&passwdHashStr, &isSuperAdmin) != nil {
+		return DirectoryUser{}, errIncorrectLogin
+	}
+	if a.superAdminsOnly && !isSuperAdmin {
+		return DirectoryUser{}, errIncorrectLogin
+	}
+	ok, needsRehash := models.CheckPasswd(passwdHashStr, passwd)
+	if !ok {
+		return DirectoryUser{}, errIncorrectLogin
+	}
+	if needsRehash {
+		if err := models.UpdateUserPasswdHash(userName, passwd); err != nil {
+			log.Printf("[ERROR] Unable to rehash the password of %s: %s\n", userName, err)
+		}
+	}
+	return DirectoryUser{}, nil
+}
+
+// ldapAuthenticator finds users in an LDAP directory with a search filter, and checks
+// their password by binding as them. The search is done as the bind DN, or anonymously
+// if there is none.
+type ldapAuthenticator struct {
+	URL        string
+	BindDN     string
+	BindPass   string
+	BaseDN     string
+	UserFilter string // "%s" is replaced by the escaped username.
+	GroupAttr  string
+}
+
+func (a ldapAuthenticator) CheckPassword(userName string, passwd string) (DirectoryUser, error) {
+	if passwd == "" {
+		return DirectoryUser{}, errIncorrectLogin
+	}
+	// A directory entry with the name of a local user doesn't log in as that user. The
+	// local password is checked by the next authenticator instead.
+	var isExternal bool
+	if db.QueryRow(`SELECT is_external FROM users WHERE username=?;`, userName).Scan(&isExternal) == nil && !isExternal {
+		return DirectoryUser{}, errIncorrectLogin
+	}
+	conn, err := ldap.Dial(a.URL, ldapTimeout)
+	if err != nil {
+		return DirectoryUser{}, err
+	}
+	defer conn.Close()
+	if a.BindDN != "" {
+		if err := conn.Bind(a.BindDN, a.BindPass); err != nil {
+			return DirectoryUser{}, fmt.Errorf("LDAP bind DN: %s", err)
+		}
+	}
+	filter := strings.Replace(a.UserFilter, "%s", ldap.EscapeFilter(userName), -1)
+	entries, err := conn.Search(a.BaseDN, filter, []string{"mail", a.GroupAttr})
+	if err != nil {
+		return DirectoryUser{}, err
+	}
+	if len(entries) != 1 {
+		return DirectoryUser{}, errIncorrectLogin
+	}
+	if err := conn.Bind(entries[0].DN, passwd); err == ldap.ErrInvalidCredentials {
+		return DirectoryUser{}, errIncorrectLogin
+	} else if err != nil {
+		return DirectoryUser{}, err
+	}
+	u := DirectoryUser{IsExternal: true, Groups: entries[0].Attr(a.GroupAttr)}
+	if mail := entries[0].Attr("mail"); len(mail) > 0 && len(mail[0]) <= 64 {
+		u.Email = mail[0]
+	}
+	return u, nil
+}
+
+// passwordAuthenticators returns the authenticators to try, in order. If LDAP is set up,
+// the directory is tried before local passwords. If the forum is set to LDAP only, local
+// passwords work only for superadmins, so that they can still fix the settings.
+func passwordAuthenticators() []PasswordAuthenticator {
+	ldapURL := models.Config(models.LDAPURL)
+	if ldapURL == "" {
+		return []PasswordAuthenticator{localAuthenticator{}}
+	}
+	return []PasswordAuthenticator{
+		ldapAuthenticator{
+			URL:        ldapURL,
+			BindDN:     models.Config(models.LDAPBindDN),
+			BindPass:   models.Config(models.LDAPBindPass),
+			BaseDN:     models.Config(models.LDAPBaseDN),
+			UserFilter: models.Config(models.LDAPUserFilter),
+			GroupAttr:  models.Config(models.LDAPGroupAttr),
+		},
+		localAuthenticator{superAdminsOnly: models.Config(models.LDAPOnly) == "1"},
+	}
+}
+
+// checkPassword tries the authenticators in turn. If none accepts the password and one of
+// them couldn't check it, errLoginUnavailable is returned rather than errIncorrectLogin,
+// since the password may well be right.
+func checkPassword(userName string, passwd string) (DirectoryUser, error) {
+	err := errIncorrectLogin
+	for _, a := range passwordAuthenticators() {
+		u, aErr := a.CheckPassword(userName, passwd)
+		if aErr == nil {
+			return u, nil
+		}
+		if aErr != errIncorrectLogin {
+			log.Printf("[ERROR] Unable to check password of %s: %s\n", userName, aErr)
+			err = errLoginUnavailable
+		}
+	}
+	return DirectoryUser{}, err
+}
+
+// createDirectoryUser creates a user who logged in with a password from an external directory.
+func createDirectoryUser(userName string, u DirectoryUser) (int, error) {
+	if err := validateUserName(userName); err != nil {
+		return 0, errors.New("Your username can't be used on this forum. " + err.Error())
+	}
+	return models.CreateExternalUser(userName, u.Email)
+}
+
+// groupRole maps a directory group to a mod or admin role in a forum group.
+type groupRole struct {
+	Role      string // "mod" or "admin"
+	GroupName string
+	DN        string
+}
+
+// parseGroupRoles parses the LDAP group roles setting, which has lines such as
+// "mod General = cn=forum-mods,ou=groups,dc=example,dc=com".
+func parseGroupRoles(s string) ([]groupRole, error) {
+	var roles []groupRole
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		i := strings.Index(line, " = ")
+		fields := strings.SplitN(line, " ", 2)
+		if i < 0 || len(fields) != 2 || (fields[0] != "mod" && fields[0] != "admin") {
+			return nil, fmt.Errorf("Invalid LDAP group role: %s", line)
+		}
+		roles = append(roles, groupRole{
+			Role:      fields[0],
+			GroupName: strings.TrimSpace(line[len(fields[0]):i]),
+			DN:        strings.TrimSpace(line[i+3:]),
+		})
+	}
+	return roles, nil
+}
+
+// syncGroupRoles gives the user the mapped roles of the directory groups the user is in,
+// and takes away the mapped roles of the other groups. Roles that aren't mapped are left alone.
+func syncGroupRoles(userID int, userName string, groups []string) {
+	roles, err := parseGroupRoles(models.Config(models.LDAPGroupRoles))
+	if err != nil {
+		log.Printf("[ERROR] %s\n", err)
+		return
+	}
+	// Several directory groups may map to the same role.
+	type key struct{ role, groupID string }
+	hasRole := make(map[key]bool)
+	for _, role := range roles {
+		groupID := models.ReadGroupIDByName(role.GroupName)
+		if groupID == "" {
+			continue
+		}
+		k := key{role.Role, groupID}
+		if _, ok := hasRole[k]; !ok {
+			hasRole[k] = false
+		}
+		for _, dn := range groups {
+			if strings.EqualFold(dn, role.DN) {
+				hasRole[k] = true
+			}
+		}
+	}
+	uid := strconv.Itoa(userID)
+	for k, isMember := range hasRole {
+		if k.role == "mod" {
+			if isMember && !models.IsUserGroupMod(uid, k.groupID) {
+				models.CreateGroupMod(userName, k.groupID)
+			} else if !isMember {
+				models.DeleteGroupMod(uid, k.groupID)
+			}
+		} else {
+			if isMember && !models.IsUserGroupAdmin(uid, k.groupID) {
+				models.CreateGroupAdmin(userName, k.groupID)
+			} else if !isMember {
+				models.DeleteGroupAdmin(uid, k.groupID)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/s-gv/orangeforum/ldap/ldaptest"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLDAPLogin(t *testing.T) {
+	srv := ldaptest.NewServer()
+	defer srv.Close()
+	srv.AddEntry("cn=forum,ou=services,dc=example,dc=com", "servicepass", nil)
+	srv.AddEntry("uid=ldapalice,ou=people,dc=example,dc=com", "alicepass1", map[string][]string{
+		"uid": {"ldapalice"}, "mail": {"alice@example.com"}, "memberOf": {"cn=forum-mods,ou=groups,dc=example,dc=com"}})
+	srv.AddEntry("uid=ldapbob,ou=people,dc=example,dc=com", "bobpass12", map[string][]string{"uid": {"ldapbob"}})
+	srv.AddEntry("uid=bad.name,ou=people,dc=example,dc=com", "badpass12", map[string][]string{"uid": {"bad.name"}})
+	srv.AddEntry("uid=ldapcarol,ou=people,dc=example,dc=com", "carolpass1", map[string][]string{"uid": {"ldapcarol"}})
+	srv.AddEntry("uid=admin,ou=people,dc=example,dc=com", "diradminpass", map[string][]string{
+		"uid": {"admin"}, "memberOf": {"cn=forum-mods,ou=groups,dc=example,dc=com"}})
+
+	models.WriteConfig(models.LDAPURL, srv.URL)
+	models.WriteConfig(models.LDAPBindDN, "cn=forum,ou=services,dc=example,dc=com")
+	models.WriteConfig(models.LDAPBindPass, "servicepass")
+	models.WriteConfig(models.LDAPBaseDN, "ou=people,dc=example,dc=com")
+	models.WriteConfig(models.LDAPUserFilter, "(&(uid=%s)(uid=*))")
+	models.WriteConfig(models.LDAPGroupAttr, "memberOf")
+	models.WriteConfig(models.LDAPGroupRoles, "mod LDAP team = cn=forum-mods,ou=groups,dc=example,dc=com")
+	defer func() {
+		models.WriteConfig(models.LDAPURL, "")
+		models.WriteConfig(models.LDAPOnly, "0")
+	}()
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"LDAP team", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("LDAP team")
+
+	login := func(userName string, passwd string) bool {
+		sessionID := randSeq(32)
+		db.Exec(`INSERT INTO sessions(sessionid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+			sessionID, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+		postFromForTest(LoginHandler, "/login", url.Values{"username": {userName}, "passwd": {passwd}}, sessionID, "192.0.2.40:4000")
+		var loggedInID string
+		return db.QueryRow(`SELECT userid FROM sessions WHERE sessionid=? AND userid IS NOT NULL;`, sessionID).Scan(&loggedInID) == nil
+	}
+
+	if login("ldapalice", "wrongpass") || models.ProbeUser("ldapalice") {
+		t.Fatalf("Wrong LDAP password logged in")
+	}
+	if !login("ldapalice", "alicepass1") {
+		t.Fatalf("LDAP password did not log in")
+	}
+	aliceID, _ := models.ReadUserIDByName("ldapalice")
+	if models.ReadUserEmail("ldapalice") != "alice@example.com" || !models.IsUserGroupMod(strconv.Itoa(aliceID), groupID) {
+		t.Errorf("LDAP user not provisioned with e-mail and group role")
+	}
+	if login("bad.name", "badpass12") || models.ProbeUser("bad.name") {
+		t.Errorf("LDAP user with an invalid forum username provisioned")
+	}
+	if login("*", "alicepass1") {
+		t.Errorf("Filter injection logged in")
+	}
+
+	if !login("ldapbob", "bobpass12") {
+		t.Fatalf("LDAP password did not log in")
+	}
+	models.CreateGroupMod("ldapbob", groupID)
+	bobID, _ := models.ReadUserIDByName("ldapbob")
+	if !login("ldapbob", "bobpass12") || models.IsUserGroupMod(strconv.Itoa(bobID), groupID) {
+		t.Errorf("Mapped group role not revoked")
+	}
+
+	models.CreateUser("ldapcarol", "localcarolpass", "")
+	models.CreateGroupMod("ldapcarol", groupID)
+	carolID, _ := models.ReadUserIDByName("ldapcarol")
+	if login("ldapcarol", "carolpass1") || !models.IsUserGroupMod(strconv.Itoa(carolID), groupID) {
+		t.Errorf("LDAP password logged in as a local user with the same name")
+	}
+	if login("admin", "diradminpass") {
+		t.Errorf("LDAP password logged in as the local superadmin")
+	}
+	if !login("ldapcarol", "localcarolpass") {
+		t.Errorf("Local password rejected")
+	}
+	if !login("admin", "admin12345") {
+		t.Errorf("Local superadmin password rejected")
+	}
+	postFromForTest(UserProfileUpdateHandler, "/users/update?u=ldapcarol", url.Values{"action": {"Link"}}, sessionForTest("admin"), "192.0.2.41:4000")
+	if !login("ldapcarol", "carolpass1") {
+		t.Errorf("LDAP password rejected after the superadmin linked the user")
+	}
+
+	models.WriteConfig(models.LDAPOnly, "1")
+	if login("ldapcarol", "localcarolpass") {
+		t.Errorf("Local password accepted with LDAP only")
+	}
+	if !login("admin", "admin12345") {
+		t.Errorf("Local superadmin password rejected with LDAP only")
+	}
+	models.WriteConfig(models.LDAPOnly, "0")
+
+	srv.Close()
+	if login("ldapalice", "alicepass1") {
+		t.Errorf("LDAP password accepted with the server down")
+	}
+	if !login("ldapcarol", "localcarolpass") {
+		t.Errorf("Local password rejected with the LDAP server down")
+	}
+}
+
+func TestPasswdRehash(t *testing.T) {
+	models.CreateUser("rehashuser", "rehashpass1", "")
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("rehashpass1"), bcrypt.MinCost)
+	db.Exec(`UPDATE users SET passwdhash=? WHERE username=?;`, hex.EncodeToString(bcryptHash), "rehashuser")
+	passwdHash := func() string {
+		var h string
+		db.QueryRow(`SELECT passwdhash FROM users WHERE username=?;`, "rehashuser").Scan(&h)
+		return h
+	}
+
+	login := func(passwd string) bool {
+		sessionID := randSeq(32)
+		db.Exec(`INSERT INTO sessions(sessionid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+			sessionID, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+		postFromForTest(LoginHandler, "/login", url.Values{"username": {"rehashuser"}, "passwd": {passwd}}, sessionID, "192.0.2.45:4000")
+		var loggedInID string
+		return db.QueryRow(`SELECT userid FROM sessions WHERE sessionid=? AND userid IS NOT NULL;`, sessionID).Scan(&loggedInID) == nil
+	}
+	if login("wrongpass1") || !strings.HasPrefix(passwdHash(), hex.EncodeToString([]byte("$2"))) {
+		t.Errorf("Wrong password logged in or rehashed the legacy hash")
+	}
+	if !login("rehashpass1") || !strings.HasPrefix(passwdHash(), "$argon2id$") {
+		t.Fatalf("Legacy bcrypt hash not accepted and rehashed: %s", passwdHash())
+	}
+
+	oldHash := passwdHash()
+	defer func(p models.Argon2Params) { models.PasswdHashParams = p }(models.PasswdHashParams)
+	models.PasswdHashParams.Time++
+	if !login("rehashpass1") || passwdHash() == oldHash {
+		t.Errorf("Hash with outdated parameters not rehashed")
+	}
+	oldHash = passwdHash()
+	if !login("rehashpass1") || passwdHash() != oldHash {
+		t.Errorf("Current hash rehashed")
+	}
+
+	long := strings.Repeat("long passphrase ", 20)
+	if err := validatePasswd(long, long); err != nil {
+		t.Errorf("Long password rejected: %s", err)
+	}
+
+	sum := sha1.Sum([]byte("password123"))
+	dir, _ := ioutil.TempDir("", "orangeforum-breached")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "breached.txt")
+	ioutil.WriteFile(path, []byte(strings.ToUpper(hex.EncodeToString(sum[:]))+":42\n"), 0600)
+	models.WriteConfig(models.BreachedPasswdFile, path)
+	defer models.WriteConfig(models.BreachedPasswdFile, "")
+	if validatePasswd("password123", "password123") == nil {
+		t.Errorf("Breached password accepted")
+	}
+	if err := validatePasswd("password1234", "password1234"); err != nil {
+		t.Errorf("Password not in the list rejected: %s", err)
+	}
+}
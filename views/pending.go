@@ -0,0 +1,178 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/templates"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var numPendingPostsPerPage = 50
+
+// isPostHeld reports whether a new post of the user in the group waits for a mod's
+// approval. It does if the account is younger than the pre-moderation age (in days) or
+// has fewer approved posts than the pre-moderation post count, using the stricter of the
+// forum's and the group's settings. Posts of the mods and admins of the group are never held.
+func isPostHeld(sess *Session, groupID string) bool {
+	if isMod, isAdmin, isSuperAdmin := sess.groupRoles(groupID); isMod || isAdmin || isSuperAdmin {
+		return false
+	}
+	minAge, _ := strconv.Atoi(models.Config(models.PremodAccountAge))
+	minPosts, _ := strconv.Atoi(models.Config(models.PremodNumPosts))
+	var groupMinAge, groupMinPosts int
+	db.QueryRow(`SELECT premod_account_age, premod_num_posts FROM groups WHERE id=?;`, groupID).Scan(&groupMinAge, &groupMinPosts)
+	if groupMinAge > minAge {
+		minAge = groupMinAge
+	}
+	if groupMinPosts > minPosts {
+		minPosts = groupMinPosts
+	}
+	if minAge <= 0 && minPosts <= 0 {
+		return false
+	}
+	var createdDate int64
+	db.QueryRow(`SELECT created_date FROM users WHERE id=?;`, sess.UserID).Scan(&createdDate)
+	if time.Unix(createdDate, 0).AddDate(0, 0, minAge).After(time.Now()) {
+		return true
+	}
+	return models.NumApprovedPosts(sessUserID(sess)) < minPosts
+}
+
+// parsePremodThresholds parses the pre-moderation account age (in days) and number of
+// posts. An empty value is 0, which turns that threshold off.
+func parsePremodThresholds(ageStr string, numPostsStr string) (int, int, error) {
+	var vals [2]int
+	for i, s := range []string{ageStr, numPostsStr} {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("Pre-moderation account age and number of posts should be non-negative whole numbers.")
+		}
+		vals[i] = n
+	}
+	return vals[0], vals[1], nil
+}
+
+// publishTopic tells the group subscribers and the users mentioned in the topic about
+// a new topic once it is visible. sess is the session of the author.
+func publishTopic(r *http.Request, sess *Session, groupID string, groupName string, topicID string, title string, content string) {
+	notifyGroupSubscribers(r, groupID, groupName, title)
+	notifyNewTopic(sess, groupID, groupName, topicID, title, content)
+}
+
+// authorSession stands in for the author of a post when it is published after approval,
+// so that the notifications come from the author rather than the mod.
+func authorSession(userID string) *Session {
+	id, _ := strconv.ParseInt(userID, 10, 64)
+	return &Session{UserID: sql.NullInt64{Int64: id, Valid: true}}
+}
+
+// approvePost makes a pending post visible to others, counts a comment in its topic
+// and bumps the topic, and notifies the author and the users who would have been
+// notified when it was posted.
+func approvePost(r *http.Request, sess *Session, post models.PendingPost, groupID string, groupName string) {
+	perms, _ := readTopicPerms(sess, post.TopicID)
+	author := authorSession(post.UserID)
+	if post.Kind == models.PendingTopic {
+		db.Exec(`UPDATE topics SET is_pending=0, activity_date=?, published_date=? WHERE id=?;`, time.Now().Unix(), time.Now().Unix(), post.ID)
+		publishTopic(r, author, groupID, groupName, post.ID, post.Title, post.Content)
+		models.CreateNotification(post.UserID, sessUserID(sess), models.NotifyModAction, `approved your topic "`+censor(post.Title)+`"`, "/topics?id="+post.ID)
+		auditTopic(r, sess, perms, models.AuditTopicApprove, "", "")
+	} else {
+		db.Exec(`UPDATE comments SET is_pending=0, published_date=? WHERE id=?;`, time.Now().Unix(), post.ID)
+		publishComment(r, author, post.TopicID, post.Title, post.ID, post.Content)
+		models.CreateNotification(post.UserID, sessUserID(sess), models.NotifyModAction, `approved your comment in "`+censor(post.Title)+`"`, "/comments?id="+post.ID)
+		auditComment(r, sess, perms, post.ID, models.AuditCommentApprove, "", "")
+	}
+}
+
+// rejectPost deletes a pending post. It stays pending, so it is held again if its author
+// undeletes it.
+func rejectPost(r *http.Request, sess *Session, post models.PendingPost) {
+	perms, _ := readTopicPerms(sess, post.TopicID)
+	if post.Kind == models.PendingTopic {
+		db.Exec(`UPDATE topics SET is_deleted=1 WHERE id=?;`, post.ID)
+		models.CreateNotification(post.UserID, sessUserID(sess), models.NotifyModAction, `rejected your topic "`+censor(post.Title)+`"`, "/topics?id="+post.ID)
+		auditTopic(r, sess, perms, models.AuditTopicReject, "", post.Title+"\n\n"+post.Content)
+	} else {
+		db.Exec(`UPDATE comments SET is_deleted=1 WHERE id=?;`, post.ID)
+		models.CreateNotification(post.UserID, sessUserID(sess), models.NotifyModAction, `rejected your comment in "`+censor(post.Title)+`"`, "/comments?id="+post.ID)
+		auditComment(r, sess, perms, post.ID, models.AuditCommentReject, "", post.Content)
+	}
+}
+
+var GroupPendingHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	groupID := r.FormValue("id")
+	var groupName string
+	if db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName) != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	if isMod, isAdmin, isSuperAdmin := sess.groupRoles(groupID); !isMod && !isAdmin && !isSuperAdmin {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	pendingURL := "/groups/pending?id=" + groupID
+
+	if r.Method == "POST" {
+		post, err := models.ReadPendingPost(r.PostFormValue("kind"), r.PostFormValue("postid"), groupID)
+		action := r.PostFormValue("action")
+		if err != nil {
+			sess.SetFlashMsg("The post was already approved or rejected.")
+		} else if action == "Approve" {
+			approvePost(r, &sess, post, groupID, groupName)
+			sess.SetFlashMsg("Post approved.")
+		} else if action == "Reject" {
+			rejectPost(r, &sess, post)
+			sess.SetFlashMsg("Post rejected.")
+		}
+		http.Redirect(w, r, pendingURL, http.StatusSeeOther)
+		return
+	}
+
+	type Post struct {
+		models.PendingPost
+		URL            string
+		TopicName      string
+		ContentHTML    template.HTML
+		CreatedDateStr string
+	}
+	var posts []Post
+	for _, p := range models.ReadPendingPosts(groupID, numPendingPostsPerPage) {
+		url := "/topics?id=" + p.ID
+		if p.Kind == models.PendingComment {
+			url = "/comments?id=" + p.ID
+		}
+		posts = append(posts, Post{
+			PendingPost:    p,
+			URL:            url,
+			TopicName:      censor(p.Title),
+			ContentHTML:    formatComment(p.Content, p.CreatedDate),
+			CreatedDateStr: timeAgoFromNow(time.Unix(p.CreatedDate, 0)),
+		})
+	}
+
+	commonData := readCommonData(r, sess)
+	commonData.PageTitle = "Pending posts"
+
+	templates.Render(w, "pending.html", map[string]interface{}{
+		"Common":     commonData,
+		"GroupID":    groupID,
+		"GroupName":  groupName,
+		"PendingURL": pendingURL,
+		"Posts":      posts,
+	})
+})
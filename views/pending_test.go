@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPremoderation(t *testing.T) {
+	models.CreateUser("pmnewbie", "pmnewbie12345", "")
+	models.CreateUser("pmmod", "pmmod12345", "")
+	models.CreateUser("pmreader", "pmreader12345", "")
+	newbieID, _ := models.ReadUserIDByName("pmnewbie")
+	db.Exec(`INSERT INTO groups(name, description, premod_num_posts, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		"pmgroup", "", 1, time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("pmgroup")
+	models.CreateGroupMod("pmmod", groupID)
+
+	newbieSess := sessionForTest("pmnewbie")
+	modSess := sessionForTest("pmmod")
+	readerSess := sessionForTest("pmreader")
+
+	postFromForTest(TopicCreateHandler, "/topics/new", url.Values{"gid": {groupID}, "title": {"Welcome thread"}, "content": {"Say hi"}}, modSess, "192.0.2.100:4000")
+	var topicID string
+	var isPending bool
+	db.QueryRow(`SELECT id, is_pending FROM topics WHERE title=?;`, "Welcome thread").Scan(&topicID, &isPending)
+	if isPending {
+		t.Fatalf("Topic of a mod held for approval")
+	}
+
+	postFromForTest(CommentCreateHandler, "/comments/new?tid="+topicID, url.Values{"content": {"Hi from the newbie"}}, newbieSess, "192.0.2.101:4000")
+	var commentID string
+	var numComments int
+	db.QueryRow(`SELECT id, is_pending FROM comments WHERE topicid=?;`, topicID).Scan(&commentID, &isPending)
+	db.QueryRow(`SELECT num_comments FROM topics WHERE id=?;`, topicID).Scan(&numComments)
+	if !isPending || numComments != 0 {
+		t.Fatalf("Comment of a new user not held: is_pending=%v num_comments=%d", isPending, numComments)
+	}
+	if body := getForTest(TopicIndexHandler, "/topics?id="+topicID, readerSess).Body.String(); strings.Contains(body, "Hi from the newbie") {
+		t.Errorf("Pending comment visible to others")
+	}
+	if rr := getForTest(CommentIndexHandler, "/comments?id="+commentID, readerSess); rr.Code != http.StatusNotFound {
+		t.Errorf("Pending comment page visible to others: %d", rr.Code)
+	}
+	if body := getForTest(TopicIndexHandler, "/topics?id="+topicID, newbieSess).Body.String(); !strings.Contains(body, "Hi from the newbie") {
+		t.Errorf("Pending comment not visible to its author")
+	}
+	if rr := getForTest(CommentCreateHandler, "/comments/new?tid="+topicID+"&parent="+commentID, readerSess); rr.Code != http.StatusNotFound {
+		t.Errorf("Pending comment can be replied to by others: %d", rr.Code)
+	}
+	if body := getForTest(CommentCreateHandler, "/comments/new?tid="+topicID+"&quote="+commentID, readerSess).Body.String(); strings.Contains(body, "Hi from the newbie") {
+		t.Errorf("Pending comment can be quoted by others")
+	}
+	if rr := apiRequestForTest(APICommentsHandler, "POST", "/api/v1/comments", `{"topic_id": `+topicID+`, "parent_id": `+commentID+`, "content": "Replying early"}`, readerSess); rr.Code != http.StatusBadRequest {
+		t.Errorf("Pending comment can be replied to through the API: %d", rr.Code)
+	}
+	if rr := getForTest(CommentCreateHandler, "/comments/new?tid="+topicID+"&parent="+commentID, modSess); rr.Code != http.StatusOK {
+		t.Errorf("Pending comment can't be replied to by a mod: %d", rr.Code)
+	}
+
+	if rr := getForTest(GroupPendingHandler, "/groups/pending?id="+groupID, readerSess); rr.Code != http.StatusForbidden {
+		t.Errorf("Approval queue visible to a user who is not a mod: %d", rr.Code)
+	}
+	if body := getForTest(GroupPendingHandler, "/groups/pending?id="+groupID, modSess).Body.String(); !strings.Contains(body, "Hi from the newbie") {
+		t.Fatalf("Pending comment not in the approval queue: %s", body)
+	}
+	postFromForTest(GroupPendingHandler, "/groups/pending?id="+groupID, url.Values{"kind": {models.PendingComment}, "postid": {commentID}, "action": {"Approve"}}, modSess, "192.0.2.102:4000")
+	db.QueryRow(`SELECT num_comments FROM topics WHERE id=?;`, topicID).Scan(&numComments)
+	if numComments != 1 {
+		t.Errorf("Approved comment not counted: num_comments=%d", numComments)
+	}
+	if body := getForTest(TopicIndexHandler, "/topics?id="+topicID, readerSess).Body.String(); !strings.Contains(body, "Hi from the newbie") {
+		t.Errorf("Approved comment not visible to others")
+	}
+	if n := models.NumUnreadNotifications(strconv.Itoa(newbieID)); n != 1 {
+		t.Errorf("Author has %d notifications after approval, want 1", n)
+	}
+	if entries := models.ReadAuditEntries(models.AuditFilter{GroupID: groupID, Action: models.AuditCommentApprove}, 10); len(entries) != 1 {
+		t.Errorf("Approval not in the audit log: %v", entries)
+	}
+
+	postFromForTest(TopicCreateHandler, "/topics/new", url.Values{"gid": {groupID}, "title": {"Second post"}, "content": {"No longer new"}}, newbieSess, "192.0.2.101:4000")
+	db.QueryRow(`SELECT is_pending FROM topics WHERE title=?;`, "Second post").Scan(&isPending)
+	if isPending {
+		t.Errorf("Post held after the user reached the group's post count")
+	}
+
+	models.WriteConfig(models.PremodAccountAge, "1")
+	defer models.WriteConfig(models.PremodAccountAge, "0")
+	postFromForTest(TopicCreateHandler, "/topics/new", url.Values{"gid": {groupID}, "title": {"Buy cheap stuff"}, "content": {"Spam"}}, newbieSess, "192.0.2.101:4000")
+	var spamID string
+	db.QueryRow(`SELECT id, is_pending FROM topics WHERE title=?;`, "Buy cheap stuff").Scan(&spamID, &isPending)
+	if !isPending {
+		t.Fatalf("Topic of a new account not held under the forum's account age")
+	}
+	if body := getForTest(GroupIndexHandler, "/groups?name=pmgroup", readerSess).Body.String(); strings.Contains(body, "Buy cheap stuff") {
+		t.Errorf("Pending topic listed for others")
+	}
+	if rr := getForTest(TopicIndexHandler, "/topics?id="+spamID, readerSess); rr.Code != http.StatusNotFound {
+		t.Errorf("Pending topic visible to others: %d", rr.Code)
+	}
+	postFromForTest(GroupPendingHandler, "/groups/pending?id="+groupID, url.Values{"kind": {models.PendingTopic}, "postid": {spamID}, "action": {"Reject"}}, modSess, "192.0.2.102:4000")
+	var isDeleted bool
+	db.QueryRow(`SELECT is_deleted FROM topics WHERE id=?;`, spamID).Scan(&isDeleted)
+	if !isDeleted || models.NumPendingPosts(groupID) != 0 {
+		t.Errorf("Rejected topic not deleted")
+	}
+	if n := models.NumUnreadNotifications(strconv.Itoa(newbieID)); n != 2 {
+		t.Errorf("Author has %d notifications after rejection, want 2", n)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"errors"
+	"github.com/s-gv/orangeforum/models/db"
+)
+
+var errNotFound = errors.New("Not found.")
+var errForbidden = errors.New("Forbidden.")
+
+// postPerms holds the privileges of the session user on a topic or comment. It is
+// shared by the HTML and JSON API handlers so that both enforce the same rules.
+type postPerms struct {
+	GroupID        string
+	GroupName      string
+	TopicID        string
+	IsTopicClosed  bool
+	IsTopicDeleted bool
+	IsTopicPending bool
+	IsOwner        bool
+	IsMod          bool
+	IsAdmin        bool
+	IsSuperAdmin   bool
+}
+
+// CanModerate reports whether the user can close, reopen, pin and delete any post in the group.
+func (p postPerms) CanModerate() bool {
+	return p.IsMod || p.IsAdmin || p.IsSuperAdmin
+}
+
+// CanEdit reports whether the user can edit or delete the post.
+func (p postPerms) CanEdit() bool {
+	return p.IsOwner || p.CanModerate()
+}
+
+// readTopicPerms returns errNotFound if the topic doesn't exist or is waiting for
+// approval and the user is not its owner or a mod, and errForbidden if its group is
+// closed or not visible to the user.
+func readTopicPerms(sess *Session, topicID string) (postPerms, error) {
+	p := postPerms{TopicID: topicID}
+	var ownerID int64
+	if db.QueryRow(`SELECT userid, groupid, is_closed, is_deleted, is_pending FROM topics WHERE id=?;`, topicID).Scan(
+		&ownerID, &p.GroupID, &p.IsTopicClosed, &p.IsTopicDeleted, &p.IsTopicPending) != nil {
+		return p, errNotFound
+	}
+	isGroupClosed := true
+	db.QueryRow(`SELECT name, is_closed FROM groups WHERE id=?;`, p.GroupID).Scan(&p.GroupName, &isGroupClosed)
+	if isGroupClosed || !sess.CanViewGroup(p.GroupID) {
+		return p, errForbidden
+	}
+	p.IsOwner = sess.UserID.Valid && ownerID == sess.UserID.Int64
+	p.IsMod, p.IsAdmin, p.IsSuperAdmin = sess.groupRoles(p.GroupID)
+	if p.IsTopicPending && !p.IsOwner && !p.CanModerate() {
+		return p, errNotFound
+	}
+	return p, nil
+}
+
+// readCommentPerms is like readTopicPerms, but IsOwner refers to the comment. It also
+// returns errForbidden if the topic is closed.
+func readCommentPerms(sess *Session, commentID string) (postPerms, error) {
+	var topicID string
+	var ownerID int64
+	var isPending bool
+	if db.QueryRow(`SELECT topicid, userid, is_pending FROM comments WHERE id=?;`, commentID).Scan(&topicID, &ownerID, &isPending) != nil {
+		return postPerms{}, errNotFound
+	}
+	p, err := readTopicPerms(sess, topicID)
+	if err != nil {
+		return p, err
+	}
+	p.IsOwner = sess.UserID.Valid && ownerID == sess.UserID.Int64
+	if isPending && !p.IsOwner && !p.CanModerate() {
+		return p, errNotFound
+	}
+	if p.IsTopicClosed {
+		return p, errForbidden
+	}
+	return p, nil
+}
@@ -46,7 +46,7 @@ var PrivateMessageHandler = A(func(w http.ResponseWriter, r *http.Request, sess
 		msg := Message{}
 		rows.Scan(&msg.ID, &msg.From, &msg.To, &content, &msg.IsRead, &cDate)
 		msg.CreatedDate = timeAgoFromNow(time.Unix(cDate, 0))
-		msg.Content = formatComment(content)
+		msg.Content = formatComment(content, cDate)
 		if len(msgs) < messagesPerPage {
 			msgs = append(msgs, msg)
 		} else {
@@ -63,23 +63,6 @@ var PrivateMessageHandler = A(func(w http.ResponseWriter, r *http.Request, sess
 		cont = formatReply(to, cont)
 	}
 
-	if flag := r.FormValue("flag"); flag != "" {
-		rows := db.Query(`SELECT users.username FROM mods
-			INNER JOIN users ON users.id=mods.userid
-			INNER JOIN topics ON topics.groupid=mods.groupid
-			INNER JOIN comments ON comments.topicid=topics.id
-			WHERE comments.id=?;`, flag)
-		for rows.Next() {
-			var mod string
-			rows.Scan(&mod)
-			if to != "" {
-				to = to + ", "
-			}
-			to = to + mod
-		}
-		cont = "Flagging " + "http://" + r.Host + "/comments?id=" + flag
-	}
-
 	if lmd != "" && len(msgs) == 0 {
 		http.Redirect(w, r, "/pm", http.StatusSeeOther)
 		return
@@ -112,6 +95,16 @@ var PrivateMessageCreateHandler = A(func(w http.ResponseWriter, r *http.Request,
 			http.Redirect(w, r, "/pm", http.StatusSeeOther)
 			return
 		}
+		if err := checkEmailVerified(&sess); err != nil {
+			sess.SetFlashMsg(err.Error())
+			http.Redirect(w, r, "/pm", http.StatusSeeOther)
+			return
+		}
+		if err := checkCanPost(r, &sess, ""); err != nil {
+			sess.SetFlashMsg(err.Error())
+			http.Redirect(w, r, "/pm", http.StatusSeeOther)
+			return
+		}
 
 		tousernames := strings.Split(tousers, ",")
 		touserids := []string{}
@@ -128,7 +121,7 @@ var PrivateMessageCreateHandler = A(func(w http.ResponseWriter, r *http.Request,
 		}
 
 		for _, userid := range touserids {
-			db.Exec(`INSERT INTO messages(fromid, toid, content, created_date) VALUES(?, ?, ?, ?);`, sess.UserID, userid, content, int(time.Now().Unix()))
+			db.Exec(`INSERT INTO messages(fromid, toid, content, ip, created_date) VALUES(?, ?, ?, ?, ?);`, sess.UserID, userid, content, remoteIP(r), int(time.Now().Unix()))
 		}
 
 		sess.SetFlashMsg("Message sent.")
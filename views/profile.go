@@ -5,10 +5,12 @@
 package views
 
 import (
+	"github.com/s-gv/orangeforum/models"
 	"github.com/s-gv/orangeforum/models/db"
 	"github.com/s-gv/orangeforum/templates"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -16,21 +18,66 @@ import (
 
 var UserProfileHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session) {
 	userName := r.FormValue("u")
-	var about, email string
-	var isBanned bool
+	var about, email, digest string
+	var isBanned, isExternal bool
 	var userID int64
-	if db.QueryRow(`SELECT id, about, email, is_banned FROM users WHERE username=?;`, userName).Scan(&userID, &about, &email, &isBanned) != nil {
+	if db.QueryRow(`SELECT id, about, email, is_banned, digest, is_external FROM users WHERE username=?;`, userName).Scan(&userID, &about, &email, &isBanned, &digest, &isExternal) != nil {
 		ErrNotFoundHandler(w, r)
 		return
 	}
 
+	commonData := readCommonData(r, sess)
+	commonData.FeedURL = "?u=" + url.QueryEscape(userName)
+
+	var pendingEmail string
+	if commonData.IsSuperAdmin || (sess.UserID.Valid && userID == sess.UserID.Int64) {
+		pendingEmail, _ = models.ReadPendingEmail(strconv.FormatInt(userID, 10))
+	}
+
+	var numLoginFailures int
+	var isLocked bool
+	if commonData.IsSuperAdmin {
+		since := time.Now().Add(-loginFailureWindow).Unix()
+		numLoginFailures, _ = models.NumLoginFailuresByUser(userName, since)
+		isLocked = userIPLoginThrottle.isLocked(models.MaxLoginFailuresByUserIP(userName, since))
+	}
+
+	// The user and the superadmins see the user's suspension and warnings.
+	type Warning struct {
+		models.Warning
+		CreatedDateStr string
+	}
+	var warnings []Warning
+	var suspendedUntil, suspendReason string
+	numPoints := 0
+	if commonData.IsSuperAdmin || (sess.UserID.Valid && userID == sess.UserID.Int64) {
+		if until, reason := models.ReadSuspension(strconv.FormatInt(userID, 10)); until != 0 {
+			suspendedUntil, suspendReason = expiryDateStr(until), reason
+		}
+		numPoints = infractionPoints(strconv.FormatInt(userID, 10), "")
+		for _, w := range models.ReadWarnings(strconv.FormatInt(userID, 10)) {
+			warnings = append(warnings, Warning{Warning: w, CreatedDateStr: timeAgoFromNow(time.Unix(w.CreatedDate, 0))})
+		}
+	}
+
 	templates.Render(w, "profile.html", map[string]interface{}{
-		"Common":   readCommonData(r, sess),
-		"UserName": userName,
-		"About":    about,
-		"Email":    email,
-		"IsSelf":   sess.UserID.Valid && (userID == sess.UserID.Int64),
-		"IsBanned": isBanned,
+		"Common":           commonData,
+		"UserName":         userName,
+		"About":            about,
+		"Email":            email,
+		"PendingEmail":     pendingEmail,
+		"CanInvite":        sess.UserID.Valid && userID == sess.UserID.Int64 && canCreateInvites(&sess),
+		"Digest":           digest,
+		"Digests":          models.DigestAllVals,
+		"IsSelf":           sess.UserID.Valid && (userID == sess.UserID.Int64),
+		"IsBanned":         isBanned,
+		"IsExternal":       isExternal,
+		"NumLoginFailures": numLoginFailures,
+		"IsLocked":         isLocked,
+		"SuspendedUntil":   suspendedUntil,
+		"SuspendReason":    suspendReason,
+		"NumPoints":        numPoints,
+		"Warnings":         warnings,
 	})
 })
 
@@ -50,23 +97,57 @@ var UserProfileUpdateHandler = A(func(w http.ResponseWriter, r *http.Request, se
 			return
 		}
 		action := r.PostFormValue("action")
-		var isSuperAdmin bool
-		db.QueryRow(`SELECT is_superadmin FROM users WHERE id=?;`, sess.UserID).Scan(&isSuperAdmin)
+		isSuperAdmin := sess.IsUserSuperAdmin()
 		if action == "Update" {
 			if isSuperAdmin || userID == sess.UserID.Int64 {
 				email := strings.TrimSpace(r.FormValue("email"))
 				about := r.FormValue("about")
-				if len(email) > 64 {
-					sess.SetFlashMsg("Email should have fewer than 64 characters.")
-					http.Redirect(w, r, "/users?u="+userName, http.StatusSeeOther)
-					return
+				digest := r.FormValue("digest")
+				if !models.IsValidDigest(digest) {
+					digest = models.DigestImmediate
 				}
 				if len(about) > 1024 {
 					sess.SetFlashMsg("About should have fewer than 1024 characters.")
 					http.Redirect(w, r, "/users?u="+userName, http.StatusSeeOther)
 					return
 				}
-				db.Exec(`UPDATE users SET email=?, about=? WHERE id=?;`, email, about, userID)
+				var oldDigest string
+				db.QueryRow(`SELECT digest FROM users WHERE id=?;`, userID).Scan(&oldDigest)
+				if digest != oldDigest {
+					// Digests start from now, so posts that were already e-mailed aren't sent again.
+					db.Exec(`UPDATE users SET digest_sent_date=? WHERE id=?;`, time.Now().Unix(), userID)
+				}
+				emailMsg, err := updateEmail(r, strconv.FormatInt(userID, 10), userName, email)
+				if err != nil {
+					sess.SetFlashMsg(err.Error())
+					http.Redirect(w, r, "/users?u="+userName, http.StatusSeeOther)
+					return
+				}
+				db.Exec(`UPDATE users SET about=?, digest=? WHERE id=?;`, about, digest, userID)
+				if emailMsg != "" {
+					sess.SetFlashMsg(emailMsg)
+					http.Redirect(w, r, "/users?u="+userName, http.StatusSeeOther)
+					return
+				}
+			} else {
+				ErrForbiddenHandler(w, r)
+				return
+			}
+		} else if action == "Resend" {
+			if isSuperAdmin || userID == sess.UserID.Int64 {
+				pendingEmail, tokenDate := models.ReadPendingEmail(strconv.FormatInt(userID, 10))
+				if pendingEmail == "" {
+					ErrNotFoundHandler(w, r)
+					return
+				}
+				if time.Unix(tokenDate, 0).After(time.Now().Add(-emailResendInterval)) {
+					sess.SetFlashMsg("Confirmation link already sent to " + pendingEmail + ". Try again in a minute.")
+				} else {
+					sendEmailConfirmation(r, strconv.FormatInt(userID, 10), userName, pendingEmail)
+					sess.SetFlashMsg("Confirmation link sent to " + pendingEmail + ".")
+				}
+				http.Redirect(w, r, "/users?u="+userName, http.StatusSeeOther)
+				return
 			} else {
 				ErrForbiddenHandler(w, r)
 				return
@@ -75,6 +156,7 @@ var UserProfileUpdateHandler = A(func(w http.ResponseWriter, r *http.Request, se
 			if isSuperAdmin {
 				db.Exec(`UPDATE users SET is_banned=1 WHERE id=?;`, userID)
 				db.Exec(`DELETE FROM sessions WHERE userid=?;`, userID)
+				auditUser(r, &sess, strconv.FormatInt(userID, 10), userName, models.AuditUserBan)
 			} else {
 				ErrForbiddenHandler(w, r)
 				return
@@ -82,10 +164,66 @@ var UserProfileUpdateHandler = A(func(w http.ResponseWriter, r *http.Request, se
 		} else if action == "Unban" {
 			if isSuperAdmin {
 				db.Exec(`UPDATE users SET is_banned=0 WHERE id=?;`, userID)
+				auditUser(r, &sess, strconv.FormatInt(userID, 10), userName, models.AuditUserUnban)
 			} else {
 				ErrForbiddenHandler(w, r)
 				return
 			}
+		} else if action == "Suspend" || action == "Warn" {
+			if !isSuperAdmin || userID == sess.UserID.Int64 {
+				ErrForbiddenHandler(w, r)
+				return
+			}
+			reason := strings.TrimSpace(r.PostFormValue("reason"))
+			if reason == "" || len(reason) > 250 {
+				sess.SetFlashMsg("Give a reason of up to 250 characters.")
+				http.Redirect(w, r, "/users?u="+userName, http.StatusSeeOther)
+				return
+			}
+			if action == "Suspend" {
+				days, err := strconv.Atoi(strings.TrimSpace(r.PostFormValue("days")))
+				if err != nil || days <= 0 {
+					sess.SetFlashMsg("Number of days should be a whole number greater than 0.")
+					http.Redirect(w, r, "/users?u="+userName, http.StatusSeeOther)
+					return
+				}
+				suspendUser(r, &sess, strconv.FormatInt(userID, 10), userName, time.Now().AddDate(0, 0, days).Unix(), reason)
+			} else {
+				points, err := strconv.Atoi(strings.TrimSpace(r.PostFormValue("points")))
+				if err != nil || points < 0 {
+					sess.SetFlashMsg("Points should be a whole number.")
+					http.Redirect(w, r, "/users?u="+userName, http.StatusSeeOther)
+					return
+				}
+				warnUser(r, &sess, strconv.FormatInt(userID, 10), userName, "", reason, points)
+			}
+		} else if action == "Unsuspend" {
+			if isSuperAdmin {
+				models.UnsuspendUser(strconv.FormatInt(userID, 10))
+				auditUser(r, &sess, strconv.FormatInt(userID, 10), userName, models.AuditUserUnsuspend)
+			} else {
+				ErrForbiddenHandler(w, r)
+				return
+			}
+		} else if action == "Unlock" {
+			if isSuperAdmin {
+				models.ClearLoginFailuresByUser(userName)
+				auditUser(r, &sess, strconv.FormatInt(userID, 10), userName, models.AuditUserUnlock)
+			} else {
+				ErrForbiddenHandler(w, r)
+				return
+			}
+		} else if action == "Link" || action == "Unlink" {
+			if !isSuperAdmin || userID == sess.UserID.Int64 {
+				ErrForbiddenHandler(w, r)
+				return
+			}
+			models.UpdateUserExternal(int(userID), action == "Link")
+			if action == "Link" {
+				auditUser(r, &sess, strconv.FormatInt(userID, 10), userName, models.AuditUserLink)
+			} else {
+				auditUser(r, &sess, strconv.FormatInt(userID, 10), userName, models.AuditUserUnlink)
+			}
 		}
 	}
 	sess.SetFlashMsg("Update successful.")
@@ -120,10 +258,11 @@ var UserCommentsHandler = UA(func(w http.ResponseWriter, r *http.Request, sess S
 
 	var comments []Comment
 	var rows *db.Rows
+	isSuperAdmin := sess.IsUserSuperAdmin()
 	if lastCommentDate == 0 {
-		rows = db.Query(`SELECT topics.title, comments.topicid, comments.id, comments.content, comments.image, comments.created_date, comments.is_deleted FROM comments INNER JOIN topics ON topics.id = comments.topicid AND comments.userid=? ORDER BY comments.created_date DESC LIMIT ?;`, ownerID, commentsPerPage)
+		rows = db.Query(`SELECT topics.title, comments.topicid, comments.id, comments.content, comments.image, comments.created_date, comments.is_deleted FROM comments INNER JOIN topics ON topics.id = comments.topicid AND comments.userid=? INNER JOIN groups ON groups.id = topics.groupid WHERE (comments.is_pending=0 OR comments.userid=?) AND `+models.VisibleGroupsSQL+` ORDER BY comments.created_date DESC LIMIT ?;`, ownerID, sess.UserID, isSuperAdmin, sess.UserID, commentsPerPage)
 	} else {
-		rows = db.Query(`SELECT topics.title, comments.topicid, comments.id, comments.content, comments.image, comments.created_date, comments.is_deleted FROM comments INNER JOIN topics ON topics.id = comments.topicid AND comments.userid=? AND comments.created_date < ? ORDER BY comments.created_date DESC LIMIT ?;`, ownerID, lastCommentDate, commentsPerPage)
+		rows = db.Query(`SELECT topics.title, comments.topicid, comments.id, comments.content, comments.image, comments.created_date, comments.is_deleted FROM comments INNER JOIN topics ON topics.id = comments.topicid AND comments.userid=? AND comments.created_date < ? INNER JOIN groups ON groups.id = topics.groupid WHERE (comments.is_pending=0 OR comments.userid=?) AND `+models.VisibleGroupsSQL+` ORDER BY comments.created_date DESC LIMIT ?;`, ownerID, lastCommentDate, sess.UserID, isSuperAdmin, sess.UserID, commentsPerPage)
 	}
 
 	var cDate int64
@@ -134,7 +273,7 @@ var UserCommentsHandler = UA(func(w http.ResponseWriter, r *http.Request, sess S
 		var content string
 		rows.Scan(&c.TopicName, &c.TopicID, &c.ID, &content, &c.ImgSrc, &cDate, &c.IsDeleted)
 		c.CreatedDate = timeAgoFromNow(time.Unix(cDate, 0))
-		c.Content = formatComment(content)
+		c.Content = formatComment(content, cDate)
 	}
 
 	if len(comments) >= commentsPerPage {
@@ -143,8 +282,11 @@ var UserCommentsHandler = UA(func(w http.ResponseWriter, r *http.Request, sess S
 		lastCommentDate = 0
 	}
 
+	commonData := readCommonData(r, sess)
+	commonData.FeedURL = "?u=" + url.QueryEscape(ownerName)
+
 	templates.Render(w, "profilecomments.html", map[string]interface{}{
-		"Common":          readCommonData(r, sess),
+		"Common":          commonData,
 		"OwnerName":       ownerName,
 		"Comments":        comments,
 		"LastCommentDate": lastCommentDate,
@@ -174,10 +316,11 @@ var UserTopicsHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Ses
 	var topics []Topic
 	var rows *db.Rows
 	var cDate int64
+	isSuperAdmin := sess.IsUserSuperAdmin()
 	if lastTopicDate == 0 {
-		rows = db.Query(`SELECT id, title, is_deleted, is_closed, created_date FROM topics WHERE userid=? ORDER BY created_date DESC LIMIT ?;`, ownerID, numTopicsPerPage)
+		rows = db.Query(`SELECT topics.id, topics.title, topics.is_deleted, topics.is_closed, topics.created_date FROM topics INNER JOIN groups ON groups.id = topics.groupid WHERE topics.userid=? AND (topics.is_pending=0 OR topics.userid=?) AND `+models.VisibleGroupsSQL+` ORDER BY topics.created_date DESC LIMIT ?;`, ownerID, sess.UserID, isSuperAdmin, sess.UserID, numTopicsPerPage)
 	} else {
-		rows = db.Query(`SELECT id, title, is_deleted, is_closed, created_date FROM topics WHERE userid=? AND created_date < ? ORDER BY created_date DESC LIMIT ?;`, ownerID, lastTopicDate, numTopicsPerPage)
+		rows = db.Query(`SELECT topics.id, topics.title, topics.is_deleted, topics.is_closed, topics.created_date FROM topics INNER JOIN groups ON groups.id = topics.groupid WHERE topics.userid=? AND topics.created_date < ? AND (topics.is_pending=0 OR topics.userid=?) AND `+models.VisibleGroupsSQL+` ORDER BY topics.created_date DESC LIMIT ?;`, ownerID, lastTopicDate, sess.UserID, isSuperAdmin, sess.UserID, numTopicsPerPage)
 	}
 	for rows.Next() {
 		topics = append(topics, Topic{})
@@ -193,8 +336,11 @@ var UserTopicsHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Ses
 		lastTopicDate = 0
 	}
 
+	commonData := readCommonData(r, sess)
+	commonData.FeedURL = "?u=" + url.QueryEscape(ownerName)
+
 	templates.Render(w, "profiletopics.html", map[string]interface{}{
-		"Common":        readCommonData(r, sess),
+		"Common":        commonData,
 		"OwnerName":     ownerName,
 		"Topics":        topics,
 		"LastTopicDate": lastTopicDate,
@@ -225,16 +371,175 @@ var UserGroupsHandler = A(func(w http.ResponseWriter, r *http.Request, sess Sess
 	rows = db.Query(`SELECT groups.id, groups.name, groups.is_closed, groups.created_date FROM groups INNER JOIN mods ON mods.groupid=groups.id AND mods.userid=?;`, ownerID)
 	for rows.Next() {
 		modInGroups = append(modInGroups, Group{})
-		g := &adminInGroups[len(adminInGroups)-1]
+		g := &modInGroups[len(modInGroups)-1]
+		var cDate int64
+		rows.Scan(&g.ID, &g.Name, &g.IsClosed, &cDate)
+		g.CreatedDate = timeAgoFromNow(time.Unix(cDate, 0))
+	}
+
+	var memberInGroups []Group
+	rows = db.Query(`SELECT groups.id, groups.name, groups.is_closed, groups.created_date FROM groups INNER JOIN members ON members.groupid=groups.id AND members.userid=? WHERE groups.is_private=1;`, ownerID)
+	for rows.Next() {
+		memberInGroups = append(memberInGroups, Group{})
+		g := &memberInGroups[len(memberInGroups)-1]
+		var cDate int64
+		rows.Scan(&g.ID, &g.Name, &g.IsClosed, &cDate)
+		g.CreatedDate = timeAgoFromNow(time.Unix(cDate, 0))
+	}
+
+	var invitedToGroups []Group
+	rows = db.Query(`SELECT groups.id, groups.name, groups.is_closed, memberrequests.created_date FROM groups INNER JOIN memberrequests ON memberrequests.groupid=groups.id AND memberrequests.userid=? AND memberrequests.is_invite=1;`, ownerID)
+	for rows.Next() {
+		invitedToGroups = append(invitedToGroups, Group{})
+		g := &invitedToGroups[len(invitedToGroups)-1]
 		var cDate int64
 		rows.Scan(&g.ID, &g.Name, &g.IsClosed, &cDate)
 		g.CreatedDate = timeAgoFromNow(time.Unix(cDate, 0))
 	}
 
 	templates.Render(w, "profilegroups.html", map[string]interface{}{
-		"Common":        readCommonData(r, sess),
-		"OwnerName":     ownerName,
-		"AdminInGroups": adminInGroups,
-		"ModInGroups":   modInGroups,
+		"Common":          readCommonData(r, sess),
+		"OwnerName":       ownerName,
+		"AdminInGroups":   adminInGroups,
+		"ModInGroups":     modInGroups,
+		"MemberInGroups":  memberInGroups,
+		"InvitedToGroups": invitedToGroups,
+	})
+})
+
+var UserTokensHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	userID := strconv.FormatInt(sess.UserID.Int64, 10)
+	newToken := ""
+
+	if r.Method == "POST" {
+		action := r.PostFormValue("action")
+		if action == "Create" {
+			name := strings.TrimSpace(r.PostFormValue("name"))
+			if len(name) < 1 || len(name) > 64 {
+				sess.SetFlashMsg("Token name should have 1-64 characters.")
+				http.Redirect(w, r, "/users/tokens", http.StatusSeeOther)
+				return
+			}
+			var scopes []string
+			for _, scope := range models.ScopeAllVals {
+				if r.PostFormValue("scope_"+scope) != "" {
+					scopes = append(scopes, scope)
+				}
+			}
+			if len(scopes) == 0 {
+				sess.SetFlashMsg("Select at least one scope.")
+				http.Redirect(w, r, "/users/tokens", http.StatusSeeOther)
+				return
+			}
+			newToken = randSeq(32)
+			if err := models.CreateAPIToken(userID, name, newToken, scopes); err != nil {
+				sess.SetFlashMsg(err.Error())
+				http.Redirect(w, r, "/users/tokens", http.StatusSeeOther)
+				return
+			}
+		} else if action == "Revoke" {
+			models.DeleteAPIToken(userID, r.PostFormValue("id"))
+			sess.SetFlashMsg("Token revoked.")
+			http.Redirect(w, r, "/users/tokens", http.StatusSeeOther)
+			return
+		}
+	}
+
+	type Token struct {
+		ID           string
+		Name         string
+		Scopes       string
+		CreatedDate  string
+		LastUsedDate string
+	}
+	var tokens []Token
+	for _, t := range models.ReadAPITokens(userID) {
+		lastUsed := "never"
+		if t.LastUsedDate != 0 {
+			lastUsed = timeAgoFromNow(time.Unix(t.LastUsedDate, 0))
+		}
+		tokens = append(tokens, Token{
+			ID:           t.ID,
+			Name:         t.Name,
+			Scopes:       strings.Join(t.Scopes, ", "),
+			CreatedDate:  timeAgoFromNow(time.Unix(t.CreatedDate, 0)),
+			LastUsedDate: lastUsed,
+		})
+	}
+
+	commonData := readCommonData(r, sess)
+	commonData.PageTitle = "API tokens"
+
+	templates.Render(w, "profiletokens.html", map[string]interface{}{
+		"Common":   commonData,
+		"Tokens":   tokens,
+		"NewToken": newToken,
+		"Scopes":   models.ScopeAllVals,
+	})
+})
+
+// UserSessionsHandler lists the sessions a user is logged in with and logs them out.
+// Superadmins can manage the sessions of any user with ?u=<username>.
+var UserSessionsHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	commonData := readCommonData(r, sess)
+	userName := r.FormValue("u")
+	if userName == "" {
+		userName = commonData.UserName
+	}
+	if userName != commonData.UserName && !commonData.IsSuperAdmin {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	id, err := models.ReadUserIDByName(userName)
+	if err != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	userID := strconv.Itoa(id)
+	sessionsURL := "/users/sessions?u=" + url.QueryEscape(userName)
+
+	if r.Method == "POST" {
+		action := r.PostFormValue("action")
+		if action == "Revoke" {
+			models.DeleteUserSession(userID, r.PostFormValue("id"))
+			sess.SetFlashMsg("Session logged out.")
+		} else if action == "Revoke all" {
+			models.DeleteUserSessions(userID, sess.SessionID)
+			sess.SetFlashMsg("Sessions logged out.")
+		}
+		if (action == "Revoke" || action == "Revoke all") && userName != commonData.UserName {
+			auditUser(r, &sess, userID, userName, models.AuditUserLogout)
+		}
+		http.Redirect(w, r, sessionsURL, http.StatusSeeOther)
+		return
+	}
+
+	type UserSession struct {
+		ID           string
+		UserAgent    string
+		IP           string
+		CreatedDate  string
+		LastSeenDate string
+		IsCurrent    bool
+	}
+	var sessions []UserSession
+	for _, s := range models.ReadUserSessions(userID, time.Now().Add(-maxSessionLife).Unix()) {
+		sessions = append(sessions, UserSession{
+			ID:           s.ID,
+			UserAgent:    s.UserAgent,
+			IP:           s.IP,
+			CreatedDate:  timeAgoFromNow(time.Unix(s.CreatedDate, 0)),
+			LastSeenDate: timeAgoFromNow(time.Unix(s.LastSeenDate, 0)),
+			IsCurrent:    s.SessionID == sess.SessionID,
+		})
+	}
+
+	commonData.PageTitle = "Sessions"
+
+	templates.Render(w, "profilesessions.html", map[string]interface{}{
+		"Common":   commonData,
+		"UserName": userName,
+		"IsSelf":   userName == commonData.UserName,
+		"Sessions": sessions,
 	})
 })
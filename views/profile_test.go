@@ -16,7 +16,7 @@ import (
 
 func grabCSRFToken(body string) (string, error) {
 	csrfToken := ""
-	r := regexp.MustCompile("<input type=\"hidden\" name=\"csrf\" value=\"([A-Za-z0-9]+)\">")
+	r := regexp.MustCompile("<input type=\"hidden\" name=\"csrf\" value=\"([A-Za-z0-9_=-]+)\">")
 	match := r.FindStringSubmatch(body)
 	if len(match) > 0 {
 		csrfToken = match[1]
@@ -29,7 +29,7 @@ func grabCSRFToken(body string) (string, error) {
 
 func grabSessionID(recorder *httptest.ResponseRecorder) (string, error) {
 	sessionid := ""
-	r := regexp.MustCompile("^sessionid=([A-Za-z0-9]+);")
+	r := regexp.MustCompile("^sessionid=([A-Za-z0-9_=-]+);")
 	for _, cookie := range recorder.HeaderMap["Set-Cookie"] {
 		matches := r.FindStringSubmatch(cookie)
 		if len(matches) > 0 {
@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"errors"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// With proxy authentication, a reverse proxy that has already authenticated the user names
+// the user in a request header, and the forum logs the session in as that user. The header
+// is trusted only from the proxy's addresses. The client's address is taken from the
+// X-Forwarded-For or X-Real-IP headers of requests from the proxies, with or without a header.
+var proxyAuth struct {
+	header  string
+	proxies []*net.IPNet
+}
+
+// SetProxyAuth trusts header and the forwarded client address from the proxies, which are IP
+// addresses or CIDR ranges such as "10.0.0.0/8". An empty header turns proxy authentication
+// off.
+func SetProxyAuth(header string, proxies []string) error {
+	var nets []*net.IPNet
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		ipNet, err := parseIPNet(p)
+		if err != nil {
+			return err
+		}
+		nets = append(nets, ipNet)
+	}
+	if header != "" && len(nets) == 0 {
+		return errors.New("Proxy authentication needs the addresses of the trusted proxies")
+	}
+	proxyAuth.header = textproto.CanonicalMIMEHeaderKey(header)
+	proxyAuth.proxies = nets
+	return nil
+}
+
+// parseIPNet parses an IP address or a CIDR range. An address is a range of one.
+func parseIPNet(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+			s += "/32"
+		} else {
+			s += "/128"
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	return ipNet, err
+}
+
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range proxyAuth.proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerIP returns the address the request came from, which may be a proxy.
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// remoteIP returns the client's address. For a request from a trusted proxy, it is the last
+// address in X-Forwarded-For that isn't a trusted proxy, or else X-Real-IP.
+func remoteIP(r *http.Request) string {
+	ip := peerIP(r)
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+	if forwarded := r.Header["X-Forwarded-For"]; len(forwarded) > 0 {
+		addrs := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(addrs) - 1; i >= 0 && isTrustedProxy(ip); i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if net.ParseIP(addr) == nil {
+				break
+			}
+			ip = addr
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return ip
+}
+
+// proxyLogIn logs the session in as the user named in the proxy authentication header,
+// creating the user if needed. Requests without the header are left alone. If the request
+// is rejected, a response is written and ok is false.
+func proxyLogIn(w http.ResponseWriter, r *http.Request, sess *Session) (ok bool) {
+	if proxyAuth.header == "" {
+		return true
+	}
+	values := r.Header[proxyAuth.header]
+	if len(values) == 0 {
+		return true
+	}
+	if !isTrustedProxy(peerIP(r)) {
+		log.Printf("[INFO] Refused %s header from untrusted address %s\n", proxyAuth.header, r.RemoteAddr)
+		http.Error(w, "403 Forbidden: untrusted proxy authentication header", http.StatusForbidden)
+		return false
+	}
+	userName := strings.TrimSpace(values[0])
+	if len(values) > 1 || userName == "" {
+		http.Error(w, "400 Bad Request: invalid proxy authentication header", http.StatusBadRequest)
+		return false
+	}
+
+	var userID int
+	var isBanned bool
+	if db.QueryRow(`SELECT id, is_banned FROM users WHERE username=?;`, userName).Scan(&userID, &isBanned) != nil {
+		if err := validateUserName(userName); err != nil {
+			http.Error(w, "403 Forbidden: "+err.Error(), http.StatusForbidden)
+			return false
+		}
+		var err error
+		if userID, err = models.CreateExternalUser(userName, ""); err != nil {
+			http.Error(w, "403 Forbidden: "+err.Error(), http.StatusForbidden)
+			return false
+		}
+	}
+	if isBanned {
+		http.Error(w, "403 Forbidden: User banned", http.StatusForbidden)
+		return false
+	}
+	if !(sess.UserID.Valid && sess.UserID.Int64 == int64(userID)) {
+		sess.logIn(int64(userID))
+	}
+	return true
+}
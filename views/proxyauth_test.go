@@ -0,0 +1,95 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProxyAuth(t *testing.T) {
+	if err := SetProxyAuth("X-Remote-User", []string{"192.0.2.0/24", "2001:db8::1"}); err != nil {
+		t.Fatalf("SetProxyAuth: %s", err)
+	}
+	defer SetProxyAuth("", nil)
+	if SetProxyAuth("X-Remote-User", []string{""}) == nil || SetProxyAuth("X-Remote-User", []string{"bad"}) == nil {
+		t.Errorf("Invalid proxy addresses accepted")
+	}
+
+	sessionID := randSeq(32)
+	db.Exec(`INSERT INTO sessions(sessionid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		sessionID, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+	get := func(userName string, remoteAddr string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/notifications", nil)
+		req.AddCookie(&http.Cookie{Name: "sessionid", Path: "/", Value: sessionID, HttpOnly: true})
+		if userName != "" {
+			req.Header.Set("X-Remote-User", userName)
+		}
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		NotificationsHandler(rr, req)
+		return rr
+	}
+	loggedInAs := func() string {
+		var userName string
+		db.QueryRow(`SELECT users.username FROM sessions INNER JOIN users ON sessions.userid=users.id WHERE sessionid=?;`, sessionID).Scan(&userName)
+		return userName
+	}
+
+	if rr := get("proxyeve", "198.51.100.7:4000"); rr.Code != http.StatusForbidden || models.ProbeUser("proxyeve") {
+		t.Fatalf("Header from an untrusted address accepted: %d", rr.Code)
+	}
+	if rr := get("proxyeve", "192.0.2.5:4000"); rr.Code != http.StatusOK || loggedInAs() != "proxyeve" {
+		t.Fatalf("Header from a trusted proxy not logged in: %d", rr.Code)
+	}
+	if rr := get("", "192.0.2.5:4000"); rr.Code != http.StatusOK || loggedInAs() != "proxyeve" {
+		t.Errorf("Session without the header not kept: %d", rr.Code)
+	}
+	models.CreateUser("proxyfrank", "proxyfrank12345", "")
+	if rr := get("proxyfrank", "[2001:db8::1]:4000"); rr.Code != http.StatusOK || loggedInAs() != "proxyfrank" {
+		t.Errorf("Session not switched to the user in the header: %d", rr.Code)
+	}
+	if rr := get("proxyeve", "[2001:db8::2]:4000"); rr.Code != http.StatusForbidden || loggedInAs() != "proxyfrank" {
+		t.Errorf("Header from an untrusted IPv6 address accepted: %d", rr.Code)
+	}
+	if rr := get("bad.name", "192.0.2.5:4000"); rr.Code != http.StatusForbidden || models.ProbeUser("bad.name") {
+		t.Errorf("User with an invalid username created: %d", rr.Code)
+	}
+	db.Exec(`UPDATE users SET is_banned=? WHERE username=?;`, true, "proxyfrank")
+	if rr := get("proxyfrank", "192.0.2.5:4000"); rr.Code != http.StatusForbidden {
+		t.Errorf("Banned user logged in: %d", rr.Code)
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	SetProxyAuth("", []string{"192.0.2.0/24"})
+	defer SetProxyAuth("", nil)
+	for _, c := range []struct {
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"198.51.100.7:4000", nil, "198.51.100.7"},
+		{"198.51.100.7:4000", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "198.51.100.7"},
+		{"192.0.2.5:4000", nil, "192.0.2.5"},
+		{"192.0.2.5:4000", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"192.0.2.5:4000", map[string]string{"X-Forwarded-For": "10.1.1.1, 203.0.113.9, 192.0.2.6"}, "203.0.113.9"},
+		{"192.0.2.5:4000", map[string]string{"X-Forwarded-For": "203.0.113.9, junk"}, "192.0.2.5"},
+		{"192.0.2.5:4000", map[string]string{"X-Real-IP": "2001:db8::9"}, "2001:db8::9"},
+	} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remoteAddr
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		if got := remoteIP(req); got != c.want {
+			t.Errorf("remoteIP(%s, %v) = %s, want %s", c.remoteAddr, c.headers, got, c.want)
+		}
+	}
+}
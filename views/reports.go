@@ -0,0 +1,274 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"errors"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/templates"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var numReportsPerPage = 50
+
+const maxReportDetailsLen = 1000
+
+var reportKindNames = map[string]string{
+	models.ReportTopic:   "topic",
+	models.ReportComment: "comment",
+	models.ReportPM:      "private message",
+}
+
+// reportedPost is a topic, comment or private message that the session user can see.
+type reportedPost struct {
+	Kind        string
+	ID          string
+	GroupID     string // "" for private messages.
+	TopicID     string
+	OwnerID     string
+	Title       string
+	Content     string
+	CreatedDate int64
+	URL         string
+}
+
+// readReportedPost returns errNotFound if the post doesn't exist, is deleted, or isn't
+// visible to the user. Only the recipient of a private message can see it.
+func readReportedPost(sess *Session, kind string, id string) (reportedPost, error) {
+	p := reportedPost{Kind: kind, ID: id}
+	if kind == models.ReportTopic {
+		if db.QueryRow(`SELECT groupid, userid, title, content, created_date FROM topics WHERE id=? AND is_deleted=0 AND is_pending=0;`, id).Scan(
+			&p.GroupID, &p.OwnerID, &p.Title, &p.Content, &p.CreatedDate) != nil {
+			return p, errNotFound
+		}
+		p.TopicID = id
+		p.URL = "/topics?id=" + id
+	} else if kind == models.ReportComment {
+		if db.QueryRow(`SELECT topics.groupid, topics.id, comments.userid, topics.title, comments.content, comments.created_date FROM comments
+			INNER JOIN topics ON topics.id=comments.topicid WHERE comments.id=? AND comments.is_deleted=0 AND comments.is_pending=0;`, id).Scan(
+			&p.GroupID, &p.TopicID, &p.OwnerID, &p.Title, &p.Content, &p.CreatedDate) != nil {
+			return p, errNotFound
+		}
+		p.URL = "/comments?id=" + id
+	} else if kind == models.ReportPM {
+		if db.QueryRow(`SELECT fromid, content, created_date FROM messages WHERE id=? AND toid=?;`, id, sess.UserID).Scan(&p.OwnerID, &p.Content, &p.CreatedDate) != nil {
+			return p, errNotFound
+		}
+		p.URL = "/pm"
+	} else {
+		return p, errNotFound
+	}
+	if p.GroupID != "" && !sess.CanViewGroup(p.GroupID) {
+		return p, errNotFound
+	}
+	return p, nil
+}
+
+// reportQueueURL is the page where the reports of the group are reviewed.
+func reportQueueURL(groupID string) string {
+	if groupID == "" {
+		return "/admin/reports"
+	}
+	return "/groups/reports?id=" + groupID
+}
+
+var ReportCreateHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	kind := r.FormValue("kind")
+	id := r.FormValue("id")
+	post, err := readReportedPost(&sess, kind, id)
+	if err != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	userID := sessUserID(&sess)
+	reportURL := "/reports/new?kind=" + kind + "&id=" + id
+
+	if r.Method == "POST" {
+		reason := r.PostFormValue("reason")
+		details := strings.TrimSpace(r.PostFormValue("details"))
+		if !models.IsValidReportReason(reason) {
+			sess.SetFlashMsg("Choose a reason.")
+		} else if len(details) > maxReportDetailsLen {
+			sess.SetFlashMsg("Details are too long.")
+		} else if post.OwnerID == userID {
+			sess.SetFlashMsg("You can't report your own " + reportKindNames[kind] + ".")
+		} else if !models.IsReportedBy(kind, id, userID) {
+			// The copy of the post in the report is rendered as a new post.
+			content := postMarkdown(post.Content, post.CreatedDate)
+			if kind == models.ReportTopic {
+				content = post.Title + "\n\n" + content
+			}
+			models.CreateReport(kind, id, post.GroupID, userID, post.OwnerID, reason, details, content)
+			for _, reviewerID := range models.ReadReportReviewerIDs(post.GroupID) {
+				models.CreateNotification(reviewerID, userID, models.NotifyReport,
+					"reported a "+reportKindNames[kind]+" ("+reason+")", reportQueueURL(post.GroupID))
+			}
+			sess.SetFlashMsg("Thanks for the report. It will be reviewed by the moderators.")
+		}
+		http.Redirect(w, r, reportURL, http.StatusSeeOther)
+		return
+	}
+
+	commonData := readCommonData(r, sess)
+	commonData.PageTitle = "Report"
+
+	templates.Render(w, "reportnew.html", map[string]interface{}{
+		"Common":     commonData,
+		"Kind":       kind,
+		"KindName":   reportKindNames[kind],
+		"ID":         id,
+		"Title":      censor(post.Title),
+		"Content":    formatComment(post.Content, post.CreatedDate),
+		"URL":        post.URL,
+		"IsReported": models.IsReportedBy(kind, id, userID),
+		"Reasons":    models.ReportReasonAllVals,
+	})
+})
+
+// resolveReport applies the action of a mod to the reported post, closes the open reports
+// on the post and tells the reporters what was done.
+func resolveReport(r *http.Request, sess *Session, report models.Report, action string) error {
+	var topicID string
+	if report.Kind == models.ReportTopic {
+		topicID = report.TargetID
+	} else if report.Kind == models.ReportComment {
+		db.QueryRow(`SELECT topicid FROM comments WHERE id=?;`, report.TargetID).Scan(&topicID)
+	}
+	perms, _ := readTopicPerms(sess, topicID)
+
+	resolution, outcome := "", ""
+	if action == "Dismiss" {
+		resolution, outcome = models.ResolveDismiss, "no action was taken"
+		audit(r, sess, models.AuditEntry{GroupID: report.GroupID, Action: models.AuditReportDismiss, TargetID: report.ID,
+			Target: reportKindNames[report.Kind] + " by " + report.OwnerName})
+	} else if action == "Delete" {
+		if report.Kind == models.ReportTopic {
+			db.Exec(`UPDATE topics SET is_deleted=1 WHERE id=?;`, report.TargetID)
+			notifyTopicModAction(sess, perms, "deleted")
+			auditTopic(r, sess, perms, models.AuditTopicDelete, "", "")
+		} else if report.Kind == models.ReportComment {
+			db.Exec(`UPDATE comments SET is_deleted=1 WHERE id=?;`, report.TargetID)
+			notifyCommentModAction(sess, perms, report.TargetID, "deleted")
+			auditComment(r, sess, perms, report.TargetID, models.AuditCommentDelete, "", "")
+		} else {
+			db.Exec(`DELETE FROM messages WHERE id=?;`, report.TargetID)
+			audit(r, sess, models.AuditEntry{Action: models.AuditPMDelete, TargetID: report.TargetID,
+				Target: "private message by " + report.OwnerName, OldValue: report.Content})
+		}
+		resolution, outcome = models.ResolveDelete, "the "+reportKindNames[report.Kind]+" was deleted"
+	} else if action == "Close" && topicID != "" {
+		db.Exec(`UPDATE topics SET is_closed=1 WHERE id=?;`, topicID)
+		notifyTopicModAction(sess, perms, "closed")
+		auditTopic(r, sess, perms, models.AuditTopicClose, "", "")
+		resolution, outcome = models.ResolveClose, "the topic was closed"
+	} else if action == "Ban" {
+		if !sess.IsUserSuperAdmin() {
+			return errForbidden
+		}
+		if report.OwnerID == sessUserID(sess) {
+			return errors.New("You can't ban yourself.")
+		}
+		db.Exec(`UPDATE users SET is_banned=1 WHERE id=?;`, report.OwnerID)
+		models.DeleteUserSessions(report.OwnerID, "")
+		auditUser(r, sess, report.OwnerID, report.OwnerName, models.AuditUserBan)
+		resolution, outcome = models.ResolveBan, "the author was banned"
+	} else {
+		return errors.New("Unknown action.")
+	}
+
+	reports := models.ReadOpenReportsByTarget(report.Kind, report.TargetID)
+	models.ResolveReports(report.Kind, report.TargetID, sessUserID(sess), resolution)
+	url := "/pm"
+	if report.Kind == models.ReportTopic {
+		url = "/topics?id=" + report.TargetID
+	} else if report.Kind == models.ReportComment {
+		url = "/comments?id=" + report.TargetID
+	}
+	for _, rep := range reports {
+		models.CreateNotification(rep.ReporterID, sessUserID(sess), models.NotifyReport,
+			"reviewed your report of a "+reportKindNames[rep.Kind]+" ("+rep.Reason+"): "+outcome, url)
+	}
+	return nil
+}
+
+// reportQueue shows the open reports of a group, or of the whole forum and private
+// messages if groupID is "", and resolves them. The caller checks that the user is a mod.
+func reportQueue(w http.ResponseWriter, r *http.Request, sess *Session, groupID string, groupName string) {
+	queueURL := reportQueueURL(groupID)
+	if r.Method == "POST" {
+		report, err := models.ReadReport(r.PostFormValue("reportid"))
+		if err != nil || report.Resolution != "" || (groupID != "" && report.GroupID != groupID) {
+			sess.SetFlashMsg("The report was already resolved.")
+		} else if err := resolveReport(r, sess, report, r.PostFormValue("action")); err != nil {
+			sess.SetFlashMsg(err.Error())
+		} else {
+			sess.SetFlashMsg("Report resolved.")
+		}
+		http.Redirect(w, r, queueURL, http.StatusSeeOther)
+		return
+	}
+
+	type Report struct {
+		models.Report
+		KindName       string
+		URL            string
+		ContentHTML    template.HTML
+		CreatedDateStr string
+	}
+	var reports []Report
+	for _, rep := range models.ReadOpenReports(groupID, numReportsPerPage) {
+		url := "/comments?id=" + rep.TargetID
+		if rep.Kind == models.ReportTopic {
+			url = "/topics?id=" + rep.TargetID
+		} else if rep.Kind == models.ReportPM {
+			url = ""
+		}
+		reports = append(reports, Report{
+			Report:         rep,
+			KindName:       reportKindNames[rep.Kind],
+			URL:            url,
+			ContentHTML:    formatComment(rep.Content, rep.CreatedDate),
+			CreatedDateStr: timeAgoFromNow(time.Unix(rep.CreatedDate, 0)),
+		})
+	}
+
+	commonData := readCommonData(r, *sess)
+	commonData.PageTitle = "Reports"
+
+	templates.Render(w, "reports.html", map[string]interface{}{
+		"Common":       commonData,
+		"GroupID":      groupID,
+		"GroupName":    groupName,
+		"QueueURL":     queueURL,
+		"Reports":      reports,
+		"IsSuperAdmin": sess.IsUserSuperAdmin(),
+	})
+}
+
+var GroupReportsHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	groupID := r.FormValue("id")
+	var groupName string
+	if db.QueryRow(`SELECT name FROM groups WHERE id=?;`, groupID).Scan(&groupName) != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	if isMod, isAdmin, isSuperAdmin := sess.groupRoles(groupID); !isMod && !isAdmin && !isSuperAdmin {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	reportQueue(w, r, &sess, groupID, groupName)
+})
+
+var AdminReportsHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	if !sess.IsUserSuperAdmin() {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	reportQueue(w, r, &sess, "", "")
+})
@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReports(t *testing.T) {
+	models.CreateUser("rpowner", "rpowner12345", "")
+	models.CreateUser("rpreporter", "rpreporter12345", "")
+	models.CreateUser("rpmod", "rpmod12345", "")
+	ownerID, _ := models.ReadUserIDByName("rpowner")
+	reporterID, _ := models.ReadUserIDByName("rpreporter")
+	modID, _ := models.ReadUserIDByName("rpmod")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"rpgroup", "", time.Now().Unix(), time.Now().Unix())
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"rpothergroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("rpgroup")
+	models.CreateGroupMod("rpmod", groupID)
+	db.Exec(`INSERT INTO topics(title, content, userid, groupid, created_date, updated_date, activity_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+		"Reported topic", "Buy cheap stuff", ownerID, groupID, time.Now().Unix(), time.Now().Unix(), time.Now().Unix())
+	var topicID, commentID, pmID string
+	db.QueryRow(`SELECT id FROM topics WHERE title=?;`, "Reported topic").Scan(&topicID)
+	db.Exec(`INSERT INTO comments(topicid, userid, content, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		topicID, ownerID, "Rude comment", time.Now().Unix(), time.Now().Unix())
+	db.QueryRow(`SELECT id FROM comments WHERE topicid=?;`, topicID).Scan(&commentID)
+	db.Exec(`INSERT INTO messages(fromid, toid, content, created_date) VALUES(?, ?, ?, ?);`, ownerID, reporterID, "Rude message", time.Now().Unix())
+	db.QueryRow(`SELECT id FROM messages WHERE fromid=? AND toid=?;`, ownerID, reporterID).Scan(&pmID)
+
+	reporterSess := sessionForTest("rpreporter")
+	modSess := sessionForTest("rpmod")
+	report := func(sessionID string, kind string, id string, reason string) {
+		postFromForTest(ReportCreateHandler, "/reports/new?kind="+kind+"&id="+id, url.Values{"reason": {reason}, "details": {"Please look"}}, sessionID, "192.0.2.80:4000")
+	}
+	report(reporterSess, models.ReportComment, commentID, "bogus")
+	report(sessionForTest("rpowner"), models.ReportComment, commentID, models.ReasonHarassment)
+	if n := models.NumOpenReports(groupID); n != 0 {
+		t.Errorf("Report with an invalid reason or of one's own post created: %d", n)
+	}
+	report(reporterSess, models.ReportComment, commentID, models.ReasonHarassment)
+	report(reporterSess, models.ReportComment, commentID, models.ReasonHarassment)
+	report(reporterSess, models.ReportTopic, topicID, models.ReasonSpam)
+	if n := models.NumOpenReports(groupID); n != 2 {
+		t.Fatalf("Expected 2 open reports in the group, got %d", n)
+	}
+	if rr := getForTest(ReportCreateHandler, "/reports/new?kind=pm&id="+pmID, modSess); rr.Code != http.StatusNotFound {
+		t.Errorf("Private message of another user can be reported: %d", rr.Code)
+	}
+	report(reporterSess, models.ReportPM, pmID, models.ReasonHarassment)
+	if models.NumOpenReports("") != 3 || models.NumOpenReports(groupID) != 2 {
+		t.Errorf("Private message report not in the global queue only")
+	}
+	if n := models.NumUnreadNotifications(strconv.Itoa(modID)); n != 2 {
+		t.Errorf("Mod has %d notifications of reports, want 2", n)
+	}
+
+	otherGroupID := models.ReadGroupIDByName("rpothergroup")
+	if rr := getForTest(GroupReportsHandler, "/groups/reports?id="+otherGroupID, modSess); rr.Code != http.StatusForbidden {
+		t.Errorf("Mod can see the reports of another group: %d", rr.Code)
+	}
+	if rr := getForTest(AdminReportsHandler, "/admin/reports", modSess); rr.Code != http.StatusForbidden {
+		t.Errorf("Mod can see the global queue: %d", rr.Code)
+	}
+	body := getForTest(GroupReportsHandler, "/groups/reports?id="+groupID, modSess).Body.String()
+	if !strings.Contains(body, "Rude comment") || strings.Contains(body, "Rude message") {
+		t.Errorf("Group queue doesn't show the group's reports only")
+	}
+
+	readReportID := func(kind string, id string) string {
+		reports := models.ReadOpenReportsByTarget(kind, id)
+		if len(reports) != 1 {
+			t.Fatalf("Expected 1 open report of %s %s, got %d", kind, id, len(reports))
+		}
+		return reports[0].ID
+	}
+	pmReportID := readReportID(models.ReportPM, pmID)
+	postFromForTest(GroupReportsHandler, "/groups/reports?id="+groupID, url.Values{"action": {"Delete"}, "reportid": {pmReportID}}, modSess, "192.0.2.81:4000")
+	if models.NumOpenReports("") != 3 {
+		t.Errorf("Mod resolved a report outside the group")
+	}
+	postFromForTest(GroupReportsHandler, "/groups/reports?id="+groupID, url.Values{"action": {"Ban"}, "reportid": {readReportID(models.ReportTopic, topicID)}}, modSess, "192.0.2.81:4000")
+	var isBanned bool
+	db.QueryRow(`SELECT is_banned FROM users WHERE id=?;`, ownerID).Scan(&isBanned)
+	if isBanned || models.NumOpenReports(groupID) != 2 {
+		t.Errorf("Mod banned a user")
+	}
+
+	postFromForTest(GroupReportsHandler, "/groups/reports?id="+groupID, url.Values{"action": {"Delete"}, "reportid": {readReportID(models.ReportComment, commentID)}}, modSess, "192.0.2.81:4000")
+	var isDeleted bool
+	db.QueryRow(`SELECT is_deleted FROM comments WHERE id=?;`, commentID).Scan(&isDeleted)
+	if !isDeleted || models.NumOpenReports(groupID) != 1 {
+		t.Errorf("Comment not deleted when resolving the report")
+	}
+	ownerSess := sessionForTest("rpowner")
+	if body := getForTest(CommentUpdateHandler, "/comments/edit?id="+commentID, ownerSess).Body.String(); strings.Contains(body, "Undelete") {
+		t.Errorf("Author offered to undelete a comment a mod deleted")
+	}
+	postFromForTest(CommentUpdateHandler, "/comments/edit?id="+commentID, url.Values{"action": {"Undelete"}}, ownerSess, "192.0.2.83:4000")
+	db.QueryRow(`SELECT is_deleted FROM comments WHERE id=?;`, commentID).Scan(&isDeleted)
+	if !isDeleted {
+		t.Errorf("Author undeleted a comment a mod deleted")
+	}
+	postFromForTest(GroupReportsHandler, "/groups/reports?id="+groupID, url.Values{"action": {"Close"}, "reportid": {readReportID(models.ReportTopic, topicID)}}, modSess, "192.0.2.81:4000")
+	var isClosed bool
+	db.QueryRow(`SELECT is_closed FROM topics WHERE id=?;`, topicID).Scan(&isClosed)
+	if !isClosed || models.NumOpenReports(groupID) != 0 {
+		t.Errorf("Topic not closed when resolving the report")
+	}
+	body = getForTest(NotificationsHandler, "/notifications", reporterSess).Body.String()
+	if !strings.Contains(body, "the comment was deleted") || !strings.Contains(body, "the topic was closed") {
+		t.Errorf("Reporter not notified of the resolution: %s", body)
+	}
+
+	postFromForTest(AdminReportsHandler, "/admin/reports", url.Values{"action": {"Ban"}, "reportid": {pmReportID}}, sessionForTest("admin"), "192.0.2.82:4000")
+	db.QueryRow(`SELECT is_banned FROM users WHERE id=?;`, ownerID).Scan(&isBanned)
+	if !isBanned || models.NumOpenReports("") != 0 {
+		t.Errorf("Superadmin didn't ban the author of a reported message")
+	}
+}
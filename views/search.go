@@ -0,0 +1,125 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/search"
+	"github.com/s-gv/orangeforum/templates"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var searchResultsPerPage = 30
+
+var SearchHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	terms := strings.TrimSpace(r.FormValue("q"))
+	kind := r.FormValue("in")
+	groupName := strings.TrimSpace(r.FormValue("group"))
+	author := strings.TrimSpace(r.FormValue("author"))
+	fromDateStr := r.FormValue("from")
+	toDateStr := r.FormValue("to")
+
+	if kind != search.KindTopic && kind != search.KindComment && kind != search.KindMessage {
+		kind = ""
+	}
+	var fromDate, toDate int64
+	if t, err := time.Parse("2006-01-02", fromDateStr); err == nil {
+		fromDate = t.Unix()
+	}
+	if t, err := time.Parse("2006-01-02", toDateStr); err == nil {
+		toDate = t.AddDate(0, 0, 1).Unix()
+	}
+	if before, err := strconv.ParseInt(r.FormValue("before"), 10, 64); err == nil && before > 0 {
+		if toDate == 0 || before < toDate {
+			toDate = before
+		}
+	}
+
+	type Result struct {
+		Kind        string
+		URL         string
+		Title       string
+		GroupName   string
+		UserName    string
+		ToName      string
+		Snippet     string
+		CreatedDate string
+	}
+	var results []Result
+	var lastResultDate int64
+	if terms != "" && len(terms) <= 200 {
+		isSuperAdmin := sess.IsUserSuperAdmin()
+		found := search.Search(search.Query{
+			Terms:        terms,
+			Kind:         kind,
+			GroupName:    groupName,
+			Author:       author,
+			FromDate:     fromDate,
+			ToDate:       toDate,
+			UserID:       sess.UserID,
+			IsSuperAdmin: isSuperAdmin,
+			Limit:        searchResultsPerPage,
+		})
+		for _, f := range found {
+			res := Result{
+				Kind:        f.Kind,
+				Title:       censor(f.Title),
+				GroupName:   f.GroupName,
+				UserName:    f.UserName,
+				ToName:      f.ToName,
+				Snippet:     censor(snippet(f.Content, 200)),
+				CreatedDate: timeAgoFromNow(time.Unix(f.CreatedDate, 0)),
+			}
+			if f.Kind == search.KindTopic {
+				res.URL = "/topics?id=" + f.ID
+			} else if f.Kind == search.KindComment {
+				res.URL = "/comments?id=" + f.ID
+			} else {
+				res.URL = "/pm"
+			}
+			results = append(results, res)
+		}
+		if len(found) >= searchResultsPerPage {
+			lastResultDate = found[len(found)-1].CreatedDate
+		}
+	}
+
+	nextURL := ""
+	if lastResultDate != 0 {
+		q := r.URL.Query()
+		q.Set("before", strconv.FormatInt(lastResultDate, 10))
+		nextURL = "/search?" + q.Encode()
+	}
+
+	commonData := readCommonData(r, sess)
+	commonData.PageTitle = "Search"
+	if terms != "" {
+		commonData.PageTitle = "Search: " + terms
+	}
+
+	templates.Render(w, "search.html", map[string]interface{}{
+		"Common":     commonData,
+		"Query":      terms,
+		"In":         kind,
+		"Group":      groupName,
+		"Author":     author,
+		"FromDate":   fromDateStr,
+		"ToDate":     toDateStr,
+		"IsSearched": terms != "",
+		"Results":    results,
+		"NextURL":    nextURL,
+	})
+})
+
+// snippet returns the first n characters of content on a single line.
+func snippet(content string, n int) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if runes := []rune(content); len(runes) > n {
+		return string(runes[:n]) + "..."
+	}
+	return content
+}
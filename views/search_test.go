@@ -0,0 +1,56 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchHandler(t *testing.T) {
+	models.CreateUser("searcher", "searcher12345", "")
+	models.CreateUser("searchpeer", "searchpeer12345", "")
+	userID, _ := models.ReadUserIDByName("searcher")
+	peerID, _ := models.ReadUserIDByName("searchpeer")
+
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"searchpublic", "", time.Now().Unix(), time.Now().Unix())
+	db.Exec(`INSERT INTO groups(name, description, is_private, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+		"searchprivate", "", true, time.Now().Unix(), time.Now().Unix())
+	publicID := models.ReadGroupIDByName("searchpublic")
+	privateID := models.ReadGroupIDByName("searchprivate")
+	models.CreateGroupMember(strconv.Itoa(userID), privateID)
+
+	db.Exec(`INSERT INTO topics(title, content, userid, groupid, created_date, updated_date, activity_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+		"Public walrus sighting", "", userID, publicID, time.Now().Unix(), time.Now().Unix(), time.Now().Unix())
+	db.Exec(`INSERT INTO topics(title, content, userid, groupid, created_date, updated_date, activity_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+		"Private walrus plans", "", userID, privateID, time.Now().Unix(), time.Now().Unix(), time.Now().Unix())
+	db.Exec(`INSERT INTO messages(fromid, toid, content, created_date) VALUES(?, ?, ?, ?);`,
+		peerID, userID, "Walrus message for you", time.Now().Unix())
+
+	userSess := sessionForTest("searcher")
+
+	body := getForTest(SearchHandler, "/search?q=walrus", "").Body.String()
+	if !strings.Contains(body, "Public walrus sighting") {
+		t.Errorf("Search does not find topic in public group.")
+	}
+	if strings.Contains(body, "Private walrus plans") || strings.Contains(body, "Walrus message") {
+		t.Errorf("Search shows private content to an anonymous user.")
+	}
+
+	body = getForTest(SearchHandler, "/search?q=walrus", userSess).Body.String()
+	if !strings.Contains(body, "Private walrus plans") || !strings.Contains(body, "Walrus message") {
+		t.Errorf("Search does not find private content for a member. Body: %s\n", body)
+	}
+
+	body = getForTest(SearchHandler, "/search?q=walrus&group=searchpublic", userSess).Body.String()
+	if strings.Contains(body, "Private walrus plans") || strings.Contains(body, "Walrus message") {
+		t.Errorf("Search does not filter by group.")
+	}
+}
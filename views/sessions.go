@@ -6,12 +6,12 @@ package views
 
 import (
 	"database/sql"
-	"encoding/hex"
 	"errors"
+	"github.com/s-gv/orangeforum/models"
 	"github.com/s-gv/orangeforum/models/db"
-	"golang.org/x/crypto/bcrypt"
-	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -22,46 +22,87 @@ type Session struct {
 	Msg         string
 	CreatedDate time.Time
 	UpdatedDate time.Time
+	IsToken     bool     // The request was authenticated with an API token rather than a cookie.
+	Scopes      []string // Scopes of the API token.
 }
 
 const maxSessionLife = 200 * time.Hour
 const maxSessionLifeBeforeUpdate = 100 * time.Hour
 
+// sessionSeenInterval is how often the last seen time, IP address and user agent of a
+// session are updated.
+const sessionSeenInterval = 5 * time.Minute
+
 var ErrAuthFail = errors.New("username / password incorrect")
+var errIncorrectLogin = errors.New("Incorrect username or password")
+var errTwoFactorRequired = errors.New("Enter the code from your authenticator app")
 var ErrNoFlashMsg = errors.New("No flash message")
 
 func Authenticate() error {
 	return nil
 }
 
-func OpenSession(w http.ResponseWriter, r *http.Request) Session {
+// readSession returns the session named by the sessionid cookie if it exists and hasn't expired.
+func readSession(r *http.Request) (Session, error) {
 	cookie, err := r.Cookie("sessionid")
-	if err == nil {
-		sessionId := cookie.Value
-		r := db.QueryRow(`SELECT sessionid, userid, csrf, msg, created_date, updated_date FROM sessions WHERE sessionid=?;`, sessionId)
-		sess := Session{}
-		var cDate int64
-		var uDate int64
-		if err := r.Scan(&sess.SessionID, &sess.UserID, &sess.CSRFToken, &sess.Msg, &cDate, &uDate); err == nil {
-			sess.CreatedDate = time.Unix(cDate, 0)
-			sess.UpdatedDate = time.Unix(uDate, 0)
-			if sess.UpdatedDate.After(time.Now().Add(-maxSessionLife)) {
-				if sess.UpdatedDate.Before(time.Now().Add(-maxSessionLifeBeforeUpdate)) {
-					nowDate := int64(time.Now().Unix())
-					db.Exec(`UPDATE sessions SET updated_date=? WHERE sessionid=?;`, nowDate, sessionId)
-				}
-				return sess
-			} else {
-				//log.Printf("[INFO] Session %s and last update date %s has expired.\n", sess.SessionID, sess.UpdatedDate)
-			}
-		} else {
-			//log.Printf("[INFO] Session %s not found. %s\n", sess.SessionID, err)
-		}
+	if err != nil {
+		return Session{}, err
+	}
+	sessionId := cookie.Value
+	row := db.QueryRow(`SELECT sessionid, userid, csrf, msg, created_date, updated_date, last_seen_date FROM sessions WHERE sessionid=?;`, sessionId)
+	sess := Session{}
+	var cDate int64
+	var uDate int64
+	var lastSeenDate int64
+	if err := row.Scan(&sess.SessionID, &sess.UserID, &sess.CSRFToken, &sess.Msg, &cDate, &uDate, &lastSeenDate); err != nil {
+		return Session{}, err
+	}
+	sess.CreatedDate = time.Unix(cDate, 0)
+	sess.UpdatedDate = time.Unix(uDate, 0)
+	if !sess.UpdatedDate.After(time.Now().Add(-maxSessionLife)) {
+		return Session{}, errors.New("Session expired")
 	}
+	if sess.UpdatedDate.Before(time.Now().Add(-maxSessionLifeBeforeUpdate)) {
+		nowDate := int64(time.Now().Unix())
+		db.Exec(`UPDATE sessions SET updated_date=? WHERE sessionid=?;`, nowDate, sessionId)
+	}
+	if time.Unix(lastSeenDate, 0).Before(time.Now().Add(-sessionSeenInterval)) {
+		db.Exec(`UPDATE sessions SET user_agent=?, ip=?, last_seen_date=? WHERE sessionid=?;`,
+			userAgent(r), remoteIP(r), time.Now().Unix(), sessionId)
+	}
+	return sess, nil
+}
 
-	sess := Session{randSeq(32), sql.NullInt64{}, randSeq(32), "", time.Now(), time.Now()}
-	db.Exec(`INSERT INTO sessions(sessionid, userid, csrf, msg, created_date, updated_date) values(?, ?, ?, ?, ?, ?);`,
-		sess.SessionID, sess.UserID, sess.CSRFToken, sess.Msg, int64(sess.CreatedDate.Unix()), int64(sess.UpdatedDate.Unix()))
+// readTokenSession authenticates a request with an "Authorization: Bearer <token>" header.
+// isToken is false if the request has no such header.
+func readTokenSession(r *http.Request) (sess Session, isToken bool, err error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return Session{}, false, nil
+	}
+	userID, scopes, err := models.ReadAPITokenUser(strings.TrimSpace(auth[len("Bearer "):]))
+	if err != nil {
+		return Session{}, true, err
+	}
+	sess = Session{
+		UserID:      sql.NullInt64{Int64: userID, Valid: true},
+		CreatedDate: time.Now(),
+		UpdatedDate: time.Now(),
+		IsToken:     true,
+		Scopes:      scopes,
+	}
+	return sess, true, nil
+}
+
+func OpenSession(w http.ResponseWriter, r *http.Request) Session {
+	if sess, err := readSession(r); err == nil {
+		return sess
+	}
+
+	sess := Session{SessionID: randSeq(32), CSRFToken: randSeq(32), CreatedDate: time.Now(), UpdatedDate: time.Now()}
+	db.Exec(`INSERT INTO sessions(sessionid, userid, csrf, msg, created_date, updated_date, user_agent, ip, last_seen_date) values(?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		sess.SessionID, sess.UserID, sess.CSRFToken, sess.Msg, int64(sess.CreatedDate.Unix()), int64(sess.UpdatedDate.Unix()),
+		userAgent(r), remoteIP(r), int64(sess.UpdatedDate.Unix()))
 	db.Exec(`DELETE FROM sessions WHERE updated_date < ?;`, int64(time.Now().Add(-maxSessionLife).Unix()))
 
 	http.SetCookie(w, &http.Cookie{Name: "sessionid", Path: "/", Value: sess.SessionID, HttpOnly: true})
@@ -70,6 +111,15 @@ func OpenSession(w http.ResponseWriter, r *http.Request) Session {
 	return sess
 }
 
+// userAgent returns the User-Agent header of the request, cut to fit in the sessions table.
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > 250 {
+		ua = ua[:250]
+	}
+	return ua
+}
+
 func (sess *Session) SetFlashMsg(msg string) {
 	db.Exec(`UPDATE sessions SET msg=? WHERE sessionid=?;`, msg, sess.SessionID)
 }
@@ -81,44 +131,123 @@ func (sess *Session) FlashMsg() string {
 	return msg
 }
 
+// Authenticate checks the password of userName and logs the session in. Passwords are
+// checked by the authenticators from passwordAuthenticators, and users from an external
+// directory are created on their first login. If the user has two-factor authentication on,
+// the session is only marked as pending the second step and errTwoFactorRequired is
+// returned, unless the session is already logged in as that user.
 func (sess *Session) Authenticate(userName string, passwd string) error {
-	r := db.QueryRow(`SELECT id, passwdhash, is_banned FROM users WHERE username=?;`, userName)
-	var passwdHashStr string
-	var userID int
 	var isBanned bool
-	if err := r.Scan(&userID, &passwdHashStr, &isBanned); err != nil {
-		return errors.New("Incorrect username or password")
-	}
-	if isBanned {
+	if db.QueryRow(`SELECT is_banned FROM users WHERE username=?;`, userName).Scan(&isBanned) == nil && isBanned {
 		return errors.New("User banned")
 	}
-	passwdHash, err := hex.DecodeString(passwdHashStr)
+	dirUser, err := checkPassword(userName, passwd)
 	if err != nil {
-		log.Panicf("[ERROR] Error in converting password hash from hex to byte slice: %s\n", err)
+		return err
+	}
+	var totpSecret string
+	var userID int
+	if err := db.QueryRow(`SELECT id, totp_secret FROM users WHERE username=?;`, userName).Scan(&userID, &totpSecret); err != nil {
+		if !dirUser.IsExternal {
+			return errIncorrectLogin
+		}
+		if userID, err = createDirectoryUser(userName, dirUser); err != nil {
+			return err
+		}
+	}
+	if dirUser.IsExternal {
+		syncGroupRoles(userID, userName, dirUser.Groups)
 	}
-	if err := bcrypt.CompareHashAndPassword(passwdHash, []byte(passwd)); err != nil {
-		return errors.New("Incorrect username or password")
+	if totpSecret != "" && !(sess.UserID.Valid && sess.UserID.Int64 == int64(userID)) {
+		sess.setPendingLogin(int64(userID))
+		return errTwoFactorRequired
 	}
-	sess.UserID = sql.NullInt64{int64(userID), true}
-	db.Exec(`UPDATE sessions SET userid=? WHERE sessionid=?;`, sess.UserID, sess.SessionID)
+	sess.logIn(int64(userID))
 	return nil
 }
 
+// logIn marks the session as logged in as the user.
+func (sess *Session) logIn(userID int64) {
+	sess.UserID = sql.NullInt64{Int64: userID, Valid: true}
+	db.Exec(`UPDATE sessions SET userid=?, pending_userid=NULL, pending_date=0 WHERE sessionid=?;`, sess.UserID, sess.SessionID)
+}
+
+// setPendingLogin marks the session as waiting for the user's two-factor code.
+func (sess *Session) setPendingLogin(userID int64) {
+	db.Exec(`UPDATE sessions SET pending_userid=?, pending_date=? WHERE sessionid=?;`, userID, time.Now().Unix(), sess.SessionID)
+}
+
 func (sess *Session) IsUserValid() bool {
 	return sess.UserID.Valid
 }
 
+// HasScope reports whether the session may be used for scope. Sessions opened with the
+// session cookie have every scope.
+func (sess *Session) HasScope(scope string) bool {
+	if !sess.IsToken {
+		return true
+	}
+	for _, s := range sess.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// requestScope returns the scope an API token needs for the request.
+func requestScope(r *http.Request) string {
+	if r.Method == "GET" || r.Method == "HEAD" {
+		return models.ScopeRead
+	}
+	return models.ScopePost
+}
+
+// IsUserSuperAdmin reports whether the user is a superadmin. API tokens without the
+// moderate scope don't carry superadmin privileges.
 func (sess *Session) IsUserSuperAdmin() bool {
-	if sess.IsUserValid() {
+	if sess.IsUserValid() && sess.HasScope(models.ScopeModerate) {
 		r := db.QueryRow(`SELECT is_superadmin FROM users WHERE id=?;`, sess.UserID)
 		IsSuperAdmin := false
 		if err := r.Scan(&IsSuperAdmin); err == nil {
-			return IsSuperAdmin
+			return IsSuperAdmin && !sess.isMissingTOTP()
 		}
 	}
 	return false
 }
 
+// isMissingTOTP reports whether the forum requires two-factor authentication of the user
+// but the user hasn't turned it on. Superadmin and group admin privileges are withheld until then.
+func (sess *Session) isMissingTOTP() bool {
+	userID := strconv.FormatInt(sess.UserID.Int64, 10)
+	return models.IsTOTPRequired(userID) && !models.IsTOTPEnabled(userID)
+}
+
+// CanViewGroup reports whether the user may read the topics in a group. Private
+// groups are visible only to their members and to superadmins.
+func (sess *Session) CanViewGroup(groupID string) bool {
+	if !models.IsGroupPrivate(groupID) {
+		return true
+	}
+	if sess.IsUserValid() {
+		return sess.IsUserSuperAdmin() || models.IsUserGroupMember(strconv.FormatInt(sess.UserID.Int64, 10), groupID)
+	}
+	return false
+}
+
+// groupRoles returns whether the user is a mod or an admin of the group, and whether
+// the user is a superadmin.
+func (sess *Session) groupRoles(groupID string) (isMod bool, isAdmin bool, isSuperAdmin bool) {
+	if !sess.UserID.Valid || !sess.HasScope(models.ScopeModerate) {
+		return false, false, false
+	}
+	var tmp string
+	isMod = db.QueryRow(`SELECT id FROM mods WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
+	isAdmin = db.QueryRow(`SELECT id FROM admins WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil && !sess.isMissingTOTP()
+	isSuperAdmin = sess.IsUserSuperAdmin()
+	return isMod, isAdmin, isSuperAdmin
+}
+
 func (sess *Session) UserName() (string, error) {
 	if sess.UserID.Valid {
 		r := db.QueryRow(`SELECT username FROM users WHERE id=?;`, sess.UserID)
@@ -0,0 +1,75 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserSessions(t *testing.T) {
+	models.CreateUser("sessuser", "sessuser12345", "")
+	models.CreateUser("sessother", "sessother12345", "")
+	id, _ := models.ReadUserIDByName("sessuser")
+	userID := strconv.Itoa(id)
+	numSessions := func() int {
+		return len(models.ReadUserSessions(userID, time.Now().Add(-maxSessionLife).Unix()))
+	}
+
+	phone := sessionForTest("sessuser")
+	req, _ := http.NewRequest("GET", "/users/sessions", nil)
+	req.AddCookie(&http.Cookie{Name: "sessionid", Path: "/", Value: phone, HttpOnly: true})
+	req.Header.Set("User-Agent", "TestPhone/1.0")
+	req.RemoteAddr = "192.0.2.70:4000"
+	rr := httptest.NewRecorder()
+	UserSessionsHandler(rr, req)
+	if body := rr.Body.String(); rr.Code != http.StatusOK || !strings.Contains(body, "TestPhone/1.0") || !strings.Contains(body, "192.0.2.70") {
+		t.Fatalf("User agent and IP address of the session not shown: %d", rr.Code)
+	}
+
+	laptop := sessionForTest("sessuser")
+	sessionForTest("sessuser")
+	if numSessions() != 3 {
+		t.Fatalf("Expected 3 sessions, got %d", numSessions())
+	}
+	if rr := getForTest(UserSessionsHandler, "/users/sessions?u=sessuser", sessionForTest("sessother")); rr.Code != http.StatusForbidden {
+		t.Errorf("Other user can see the sessions: %d", rr.Code)
+	}
+	var phoneID string
+	db.QueryRow(`SELECT id FROM sessions WHERE sessionid=?;`, phone).Scan(&phoneID)
+	postFromForTest(UserSessionsHandler, "/users/sessions", url.Values{"action": {"Revoke"}, "id": {phoneID}}, sessionForTest("sessother"), "192.0.2.71:4000")
+	if numSessions() != 3 {
+		t.Errorf("Session revoked by another user")
+	}
+	postFromForTest(UserSessionsHandler, "/users/sessions", url.Values{"action": {"Revoke"}, "id": {phoneID}}, laptop, "192.0.2.71:4000")
+	if numSessions() != 2 {
+		t.Errorf("Session not revoked")
+	}
+	postFromForTest(UserSessionsHandler, "/users/sessions", url.Values{"action": {"Revoke all"}}, laptop, "192.0.2.71:4000")
+	if sessions := models.ReadUserSessions(userID, 0); len(sessions) != 1 || sessions[0].SessionID != laptop {
+		t.Errorf("Other sessions not revoked: %v", sessions)
+	}
+
+	sessionForTest("sessuser")
+	postFromForTest(UserSessionsHandler, "/users/sessions?u=sessuser", url.Values{"action": {"Revoke all"}}, sessionForTest("admin"), "192.0.2.72:4000")
+	if numSessions() != 0 {
+		t.Errorf("Superadmin didn't revoke the user's sessions")
+	}
+
+	current := sessionForTest("sessuser")
+	sessionForTest("sessuser")
+	form := url.Values{"passwd": {"sessuser12345"}, "newpass": {"sessuser67890"}, "confirm": {"sessuser67890"}}
+	postFromForTest(ChangePasswdHandler, "/changepass?u=sessuser", form, current, "192.0.2.73:4000")
+	if sessions := models.ReadUserSessions(userID, 0); len(sessions) != 1 || sessions[0].SessionID != current {
+		t.Errorf("Password change didn't log out the other sessions: %v", sessions)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"database/sql"
+	"github.com/s-gv/orangeforum/models/db"
+	"html/template"
+	"time"
+)
+
+// maxThreadDepth is the deepest reply shown in the threaded view. Deeper replies are
+// collapsed behind a link to the comment that starts the subthread.
+var maxThreadDepth = 6
+
+type threadComment struct {
+	ID             string
+	TopicID        string
+	ParentID       string
+	ParentUserName string
+	Content        template.HTML
+	ImgSrc         string
+	CreatedDate    string
+	UserName       string
+	IsOwner        bool
+	CanEdit        bool
+	IsDeleted      bool
+	IsPending      bool
+	Pos            int
+	Depth          int
+	NumHidden      int
+}
+
+// Indent is the left margin (in px) of the comment in the threaded view.
+func (c threadComment) Indent() int {
+	return c.Depth * 24
+}
+
+// allPos is passed to readThreadComments to read all comments in a topic.
+var allPos = [2]int{-(1<<62 - 1), 1<<62 - 1}
+
+// threadRootsSQL selects the comments of a topic that start threads in the threaded view:
+// those the user can see that don't reply to a comment the user can see. Comments waiting
+// for approval can only be seen by their authors and the mods. It takes the topic ID, and
+// then the user ID and whether the user moderates the group, twice.
+const threadRootsSQL = `FROM comments LEFT JOIN comments parents ON parents.id=comments.parentid
+	WHERE comments.topicid=? AND (comments.is_pending=0 OR comments.userid=? OR ?=1)
+	AND (parents.id IS NULL OR NOT (parents.is_pending=0 OR parents.userid=? OR ?=1))`
+
+// canModerateTopic reports whether the user is a mod, an admin or a superadmin of the
+// topic's group.
+func canModerateTopic(sess *Session, topicID string) bool {
+	var groupID string
+	db.QueryRow(`SELECT groupid FROM topics WHERE id=?;`, topicID).Scan(&groupID)
+	isMod, isAdmin, isSuperAdmin := sess.groupRoles(groupID)
+	return isMod || isAdmin || isSuperAdmin
+}
+
+// readThreadComments returns the comments in a topic with positions in [pos[0], pos[1]),
+// in the order of their position.
+func readThreadComments(sess *Session, topicID string, pos [2]int) []threadComment {
+	return queryThreadComments(sess, topicID, canModerateTopic(sess, topicID), `comments.pos >= ? AND comments.pos < ?`, pos[0], pos[1])
+}
+
+// readThreads returns the comments in num threads of a topic, starting from the thread
+// at offset, and the number of threads in the topic. Threads are in the order of the
+// position of the comment that starts them.
+func readThreads(sess *Session, topicID string, offset int, num int) ([]threadComment, int) {
+	userID, canModerate := sess.UserID.Int64, canModerateTopic(sess, topicID)
+	var numThreads int
+	db.QueryRow(`SELECT COUNT(*) `+threadRootsSQL+`;`, topicID, userID, canModerate, userID, canModerate).Scan(&numThreads)
+	comments := queryThreadComments(sess, topicID, canModerate, `comments.id IN (WITH RECURSIVE threads(id) AS (
+			SELECT id FROM (SELECT comments.id `+threadRootsSQL+` ORDER BY comments.pos LIMIT ? OFFSET ?) roots
+			UNION ALL
+			SELECT replies.id FROM comments replies INNER JOIN threads ON replies.parentid=threads.id
+			WHERE replies.is_pending=0 OR replies.userid=? OR ?=1)
+		SELECT id FROM threads)`,
+		topicID, userID, canModerate, userID, canModerate, num, offset, userID, canModerate)
+	return comments, numThreads
+}
+
+// readCommentThread returns a comment with the comments it replies to and the comments
+// in its subthread.
+func readCommentThread(sess *Session, topicID string, commentID string) []threadComment {
+	userID, canModerate := sess.UserID.Int64, canModerateTopic(sess, topicID)
+	return queryThreadComments(sess, topicID, canModerate, `comments.id IN (WITH RECURSIVE ancestors(id, parentid, depth) AS (
+			SELECT id, parentid, 0 FROM comments WHERE id=?
+			UNION ALL
+			SELECT parents.id, parents.parentid, ancestors.depth+1 FROM comments parents
+			INNER JOIN ancestors ON parents.id=ancestors.parentid WHERE ancestors.depth < 50),
+		subthread(id) AS (
+			SELECT id FROM comments WHERE id=?
+			UNION ALL
+			SELECT replies.id FROM comments replies INNER JOIN subthread ON replies.parentid=subthread.id
+			WHERE replies.is_pending=0 OR replies.userid=? OR ?=1)
+		SELECT id FROM ancestors UNION SELECT id FROM subthread)`,
+		commentID, commentID, userID, canModerate)
+}
+
+// queryThreadComments returns the comments in a topic that match cond, in the order of
+// their position. Comments waiting for approval are left out unless the user wrote them
+// or canModerate is true.
+func queryThreadComments(sess *Session, topicID string, canModerate bool, cond string, args ...interface{}) []threadComment {
+	var comments []threadComment
+	rows := db.Query(`SELECT comments.id, comments.parentid, parentusers.username, comments.content, comments.image,
+		comments.is_deleted, comments.is_pending, comments.pos, comments.created_date, users.id, users.username
+		FROM comments INNER JOIN users ON comments.userid=users.id
+		LEFT JOIN comments parents ON parents.id=comments.parentid
+		LEFT JOIN users parentusers ON parentusers.id=parents.userid
+		WHERE comments.topicid=? AND `+cond+` ORDER BY comments.pos;`, append([]interface{}{topicID}, args...)...)
+	for rows.Next() {
+		c := threadComment{TopicID: topicID}
+		var parentID, parentUserName sql.NullString
+		var content string
+		var ownerID, cDate int64
+		rows.Scan(&c.ID, &parentID, &parentUserName, &content, &c.ImgSrc, &c.IsDeleted, &c.IsPending, &c.Pos, &cDate, &ownerID, &c.UserName)
+		c.ParentID = parentID.String
+		c.ParentUserName = parentUserName.String
+		c.Content = formatComment(content, cDate)
+		c.CreatedDate = timeAgoFromNow(time.Unix(cDate, 0))
+		c.IsOwner = sess.UserID.Valid && ownerID == sess.UserID.Int64
+		if c.IsPending && !c.IsOwner && !canModerate {
+			continue
+		}
+		comments = append(comments, c)
+	}
+	return comments
+}
+
+// threadChildren groups comments by the comment they reply to. Top-level comments are
+// under "".
+func threadChildren(comments []threadComment) map[string][]threadComment {
+	ids := make(map[string]bool)
+	for _, c := range comments {
+		ids[c.ID] = true
+	}
+	children := make(map[string][]threadComment)
+	for _, c := range comments {
+		parentID := c.ParentID
+		if !ids[parentID] {
+			parentID = ""
+		}
+		children[parentID] = append(children[parentID], c)
+	}
+	return children
+}
+
+func countReplies(children map[string][]threadComment, commentID string) int {
+	n := 0
+	for _, c := range children[commentID] {
+		n += 1 + countReplies(children, c.ID)
+	}
+	return n
+}
+
+// flattenThread appends c and its replies to out, in the order they are shown in
+// the threaded view. Replies deeper than maxThreadDepth are counted in NumHidden of
+// the comment that starts the collapsed subthread.
+func flattenThread(children map[string][]threadComment, c threadComment, depth int, out []threadComment) []threadComment {
+	c.Depth = depth
+	if depth >= maxThreadDepth {
+		c.NumHidden = countReplies(children, c.ID)
+		return append(out, c)
+	}
+	out = append(out, c)
+	for _, reply := range children[c.ID] {
+		out = flattenThread(children, reply, depth+1, out)
+	}
+	return out
+}
+
+// readParentComment returns the ID of the comment being replied to, after checking
+// that it is in the topic, has not been deleted, and is visible to the user if it is
+// waiting for approval.
+func readParentComment(sess *Session, topicID string, parentID string) (sql.NullInt64, error) {
+	var id sql.NullInt64
+	if parentID == "" {
+		return id, nil
+	}
+	if db.QueryRow(`SELECT id FROM comments WHERE id=? AND topicid=? AND is_deleted=0;`, parentID, topicID).Scan(&id) != nil {
+		return sql.NullInt64{}, errNotFound
+	}
+	if _, err := readCommentPerms(sess, parentID); err != nil {
+		return sql.NullInt64{}, errNotFound
+	}
+	return id, nil
+}
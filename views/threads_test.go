@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"encoding/json"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThreadedComments(t *testing.T) {
+	models.CreateUser("threader", "threader12345", "")
+	userID, _ := models.ReadUserIDByName("threader")
+	db.Exec(`INSERT INTO groups(name, description, created_date, updated_date) VALUES(?, ?, ?, ?);`,
+		"threadgroup", "", time.Now().Unix(), time.Now().Unix())
+	groupID := models.ReadGroupIDByName("threadgroup")
+	db.Exec(`INSERT INTO topics(title, content, userid, groupid, created_date, updated_date, activity_date) VALUES(?, ?, ?, ?, ?, ?, ?);`,
+		"Threaded topic", "", userID, groupID, time.Now().Unix(), time.Now().Unix(), time.Now().Unix())
+	var topicID string
+	db.QueryRow(`SELECT id FROM topics WHERE title=?;`, "Threaded topic").Scan(&topicID)
+	sess := sessionForTest("threader")
+
+	// Post a chain of replies: each comment replies to the previous one.
+	var ids []string
+	parentID := "0"
+	for i := 0; i < 4; i++ {
+		rr := apiRequestForTest(APICommentsHandler, "POST", "/api/v1/comments",
+			`{"topic_id": `+topicID+`, "parent_id": `+parentID+`, "content": "Reply number `+strconv.Itoa(i)+`"}`, sess)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Error creating reply: got %v, body %s", rr.Code, rr.Body.String())
+		}
+		var c apiComment
+		json.Unmarshal(rr.Body.Bytes(), &c)
+		if i > 0 && strconv.FormatInt(c.ParentID, 10) != parentID {
+			t.Errorf("Unexpected parent: %+v", c)
+		}
+		parentID = strconv.FormatInt(c.ID, 10)
+		ids = append(ids, parentID)
+	}
+
+	if rr := apiRequestForTest(APICommentsHandler, "POST", "/api/v1/comments", `{"topic_id": `+topicID+`, "parent_id": 1000000, "content": "Orphan"}`, sess); rr.Code != http.StatusBadRequest {
+		t.Errorf("Reply to a comment that does not exist: got %v", rr.Code)
+	}
+
+	oldDepth := maxThreadDepth
+	maxThreadDepth = 2
+	defer func() { maxThreadDepth = oldDepth }()
+
+	body := getForTest(TopicIndexHandler, "/topics?id="+topicID+"&view=threaded", "").Body.String()
+	if !strings.Contains(body, "Reply number 2") || strings.Contains(body, "Reply number 3") || !strings.Contains(body, "1 more") {
+		t.Errorf("Deep replies are not collapsed in threaded view: %s", body)
+	}
+	body = getForTest(TopicIndexHandler, "/topics?id="+topicID, "").Body.String()
+	if !strings.Contains(body, "Reply number 3") || !strings.Contains(body, "in reply to") {
+		t.Errorf("Flat view does not have all replies: %s", body)
+	}
+	body = getForTest(CommentIndexHandler, "/comments?id="+ids[2], "").Body.String()
+	if !strings.Contains(body, "Reply number 0") || !strings.Contains(body, "Reply number 1") || !strings.Contains(body, "Reply number 3") {
+		t.Errorf("Comment permalink does not show thread context: %s", body)
+	}
+
+	// Start a second thread, and show one thread per page.
+	rr := apiRequestForTest(APICommentsHandler, "POST", "/api/v1/comments", `{"topic_id": `+topicID+`, "content": "Second thread"}`, sess)
+	var second apiComment
+	json.Unmarshal(rr.Body.Bytes(), &second)
+	apiRequestForTest(APICommentsHandler, "POST", "/api/v1/comments",
+		`{"topic_id": `+topicID+`, "parent_id": `+strconv.FormatInt(second.ID, 10)+`, "content": "Reply to the second thread"}`, sess)
+	oldPerPage := numCommentsPerPage
+	numCommentsPerPage = 1
+	defer func() { numCommentsPerPage = oldPerPage }()
+	body = getForTest(TopicIndexHandler, "/topics?id="+topicID+"&view=threaded", "").Body.String()
+	if !strings.Contains(body, "Reply number 1") || strings.Contains(body, "Second thread") {
+		t.Errorf("First page of threads has the wrong comments: %s", body)
+	}
+	body = getForTest(TopicIndexHandler, "/topics?id="+topicID+"&view=threaded&p=1", "").Body.String()
+	if !strings.Contains(body, "Second thread") || !strings.Contains(body, "Reply to the second thread") || strings.Contains(body, "Reply number 0") {
+		t.Errorf("Second page of threads has the wrong comments: %s", body)
+	}
+	body = getForTest(CommentIndexHandler, "/comments?id="+ids[2], "").Body.String()
+	if strings.Contains(body, "Second thread") {
+		t.Errorf("Comment permalink shows another thread: %s", body)
+	}
+}
@@ -5,11 +5,11 @@
 package views
 
 import (
+	"errors"
 	"github.com/s-gv/orangeforum/models"
 	"github.com/s-gv/orangeforum/models/db"
 	"github.com/s-gv/orangeforum/templates"
 	"github.com/s-gv/orangeforum/utils"
-	"html/template"
 	"net/http"
 	"strconv"
 	"strings"
@@ -18,6 +18,38 @@ import (
 
 var numCommentsPerPage = 50
 
+func validateTopic(title string, content string) error {
+	if len(title) < 8 || len(title) > 80 {
+		return errors.New("Title should have 8-80 characters.")
+	}
+	if len(content) > 5000 {
+		return errors.New("Content should have less than 5000 characters.")
+	}
+	return nil
+}
+
+// notifyGroupSubscribers e-mails the subscribers of a group that a new topic has been posted.
+// Subscribers who get digests are e-mailed later by sendDigests.
+func notifyGroupSubscribers(r *http.Request, groupID string, groupName string, title string) {
+	if models.Config(models.AllowGroupSubscription) == "0" {
+		return
+	}
+	groupURL := "http://" + r.Host + "/groups?name=" + groupName
+	rows := db.Query(`SELECT users.email, groupsubscriptions.token FROM users
+		INNER JOIN groupsubscriptions ON users.id=groupsubscriptions.userid AND groupsubscriptions.groupid=?
+		INNER JOIN groups ON groups.id=groupsubscriptions.groupid
+		WHERE users.digest=? AND (groups.is_private=0 OR users.is_superadmin=1 OR users.id IN (SELECT userid FROM members WHERE groupid=groups.id));`, groupID, models.DigestImmediate)
+	for rows.Next() {
+		var email, token string
+		rows.Scan(&email, &token)
+		if email != "" {
+			unSubURL := "http://" + r.Host + "/groups/unsubscribe?token=" + token
+			utils.SendMail(email, `New topic in `+groupName,
+				"A new topic titled \""+title+"\" has been posted to "+groupName+".\r\nSee topics posted to the group at "+groupURL+"\r\n\r\nIf you do not want these emails, unsubscribe by following this link: "+unSubURL)
+		}
+	}
+}
+
 var TopicIndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session) {
 	topicID := r.FormValue("id")
 	page64, err := strconv.ParseInt(r.FormValue("p"), 10, 64)
@@ -29,14 +61,18 @@ var TopicIndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Ses
 		page = 0
 	}
 	var title, content, groupID, groupName string
-	var isDeleted, isClosed bool
+	var isDeleted, isClosed, isPending bool
 	var ownerID, createdDate int64
-	if db.QueryRow(`SELECT title, content, userid, groupid, is_deleted, is_closed, created_date FROM topics WHERE id=?;`, topicID).Scan(
-		&title, &content, &ownerID, &groupID, &isDeleted, &isClosed, &createdDate) != nil {
+	if db.QueryRow(`SELECT title, content, userid, groupid, is_deleted, is_closed, is_pending, created_date FROM topics WHERE id=?;`, topicID).Scan(
+		&title, &content, &ownerID, &groupID, &isDeleted, &isClosed, &isPending, &createdDate) != nil {
+		ErrNotFoundHandler(w, r)
+		return
+	}
+	if isDeleted || !sess.CanViewGroup(groupID) {
 		ErrNotFoundHandler(w, r)
 		return
 	}
-	if isDeleted {
+	if _, err := readTopicPerms(&sess, topicID); err == errNotFound {
 		ErrNotFoundHandler(w, r)
 		return
 	}
@@ -48,41 +84,30 @@ var TopicIndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Ses
 		db.QueryRow(`SELECT token FROM topicsubscriptions WHERE topicid=? AND userid=?;`, topicID, sess.UserID).Scan(&subToken)
 	}
 
-	var lastPos int
-	db.QueryRow(`SELECT pos FROM comments WHERE topicid=? ORDER BY pos DESC LIMIT 1;`, topicID).Scan(&lastPos)
-	isLastPage := (lastPos < (page+1)*numCommentsPerPage)
+	isThreaded := r.FormValue("view") == "threaded"
+	var comments []threadComment
+	var isLastPage bool
 	numPages := 0
-	if lastPos > 0 {
-		numPages = 1 + lastPos/numCommentsPerPage
-	}
-
-	type Comment struct {
-		ID          string
-		Content     template.HTML
-		ImgSrc      string
-		CreatedDate string
-		UserName    string
-		IsOwner     bool
-		IsDeleted   bool
-	}
-
-	var comments []Comment
-	var cDate int64
-	var rows *db.Rows
-	if page == 0 {
-		rows = db.Query(`SELECT users.id, users.username, comments.id, comments.content, comments.image, comments.is_deleted, comments.created_date FROM comments INNER JOIN users ON comments.userid=users.id AND comments.topicid=? AND comments.pos < ? ORDER BY comments.pos;`, topicID, numCommentsPerPage)
+	if isThreaded {
+		threads, numThreads := readThreads(&sess, topicID, page*numCommentsPerPage, numCommentsPerPage)
+		numPages = (numThreads + numCommentsPerPage - 1) / numCommentsPerPage
+		isLastPage = (numThreads <= (page+1)*numCommentsPerPage)
+		children := threadChildren(threads)
+		for _, root := range children[""] {
+			comments = flattenThread(children, root, 0, comments)
+		}
 	} else {
-		rows = db.Query(`SELECT users.id, users.username, comments.id, comments.content, comments.image, comments.is_deleted, comments.created_date FROM comments INNER JOIN users ON comments.userid=users.id AND comments.topicid=? AND comments.pos >= ? AND comments.pos < ? ORDER BY comments.pos;`, topicID, page*numCommentsPerPage, (page+1)*numCommentsPerPage)
-	}
-	for rows.Next() {
-		comments = append(comments, Comment{})
-		c := &comments[len(comments)-1]
-		var ownerID int64
-		var content string
-		rows.Scan(&ownerID, &c.UserName, &c.ID, &content, &c.ImgSrc, &c.IsDeleted, &cDate)
-		c.CreatedDate = timeAgoFromNow(time.Unix(cDate, 0))
-		c.IsOwner = sess.UserID.Valid && (ownerID == sess.UserID.Int64)
-		c.Content = formatComment(content)
+		var lastPos int
+		db.QueryRow(`SELECT pos FROM comments WHERE topicid=? ORDER BY pos DESC LIMIT 1;`, topicID).Scan(&lastPos)
+		isLastPage = (lastPos < (page+1)*numCommentsPerPage)
+		if lastPos > 0 {
+			numPages = 1 + lastPos/numCommentsPerPage
+		}
+		pos := [2]int{page * numCommentsPerPage, (page + 1) * numCommentsPerPage}
+		if page == 0 {
+			pos[0] = allPos[0]
+		}
+		comments = readThreadComments(&sess, topicID, pos)
 	}
 
 	var tmp string
@@ -95,6 +120,7 @@ var TopicIndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Ses
 
 	commonData := readCommonData(r, sess)
 	commonData.PageTitle = censor(title)
+	commonData.FeedURL = "?t=" + topicID
 
 	templates.Render(w, "topicindex.html", map[string]interface{}{
 		"Common":               commonData,
@@ -106,14 +132,16 @@ var TopicIndexHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Ses
 		"CreatedDate":          timeAgoFromNow(time.Unix(createdDate, 0)),
 		"SubToken":             subToken,
 		"Title":                title,
-		"Content":              formatComment(content),
+		"Content":              formatComment(content, createdDate),
 		"IsClosed":             isClosed,
+		"IsPending":            isPending,
 		"IsOwner":              isOwner,
 		"IsMod":                isMod,
 		"IsAdmin":              isAdmin,
 		"IsSuperAdmin":         isSuperAdmin,
 		"IsImageUploadEnabled": models.Config(models.ImageUploadEnabled) != "0",
 		"Comments":             comments,
+		"IsThreaded":           isThreaded,
 		"IsLastPage":           isLastPage,
 		"NextPage":             page + 1,
 		"CurrentPage":          page,
@@ -127,46 +155,42 @@ var TopicCreateHandler = A(func(w http.ResponseWriter, r *http.Request, sess Ses
 	var groupName string
 	isGroupClosed := 1
 	db.QueryRow(`SELECT name, is_closed FROM groups WHERE id=?;`, groupID).Scan(&groupName, &isGroupClosed)
-	if isGroupClosed == 1 {
+	if isGroupClosed == 1 || !sess.CanViewGroup(groupID) {
 		ErrForbiddenHandler(w, r)
 		return
 	}
 
-	var tmp int
-	isMod := db.QueryRow(`SELECT id FROM mods WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
-	isAdmin := db.QueryRow(`SELECT id FROM admins WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
-	isSuperAdmin := false
-	db.QueryRow(`SELECT is_superadmin FROM users WHERE id=?`, sess.UserID).Scan(&isSuperAdmin)
+	isMod, isAdmin, isSuperAdmin := sess.groupRoles(groupID)
 
 	if r.Method == "POST" {
 		title := strings.TrimSpace(r.PostFormValue("title"))
 		content := strings.TrimSpace(r.PostFormValue("content"))
-		isSticky := r.PostFormValue("is_sticky") != ""
-		if len(title) < 8 || len(title) > 80 {
-			sess.SetFlashMsg("Title should have 8-80 characters.")
+		isSticky := r.PostFormValue("is_sticky") != "" && (isMod || isAdmin || isSuperAdmin)
+		if err := checkEmailVerified(&sess); err != nil {
+			sess.SetFlashMsg(err.Error())
 			http.Redirect(w, r, "/topics/new?gid="+groupID, http.StatusSeeOther)
 			return
 		}
-		if len(content) > 5000 {
-			sess.SetFlashMsg("Content should have less than 5000 characters.")
+		if err := checkCanPost(r, &sess, groupID); err != nil {
+			sess.SetFlashMsg(err.Error())
 			http.Redirect(w, r, "/topics/new?gid="+groupID, http.StatusSeeOther)
 			return
 		}
-		db.Exec(`INSERT INTO topics(title, content, userid, groupid, is_sticky, created_date, updated_date, activity_date) VALUES(?, ?, ?, ?, ?, ?, ?, ?);`,
-			title, content, sess.UserID, groupID, isSticky, int(time.Now().Unix()), int(time.Now().Unix()), int(time.Now().Unix()))
+		if err := validateTopic(title, content); err != nil {
+			sess.SetFlashMsg(err.Error())
+			http.Redirect(w, r, "/topics/new?gid="+groupID, http.StatusSeeOther)
+			return
+		}
+		isPending := isPostHeld(&sess, groupID)
+		db.Exec(`INSERT INTO topics(title, content, userid, groupid, is_sticky, is_pending, ip, created_date, updated_date, activity_date, published_date) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+			title, content, sess.UserID, groupID, isSticky, isPending, remoteIP(r), int(time.Now().Unix()), int(time.Now().Unix()), int(time.Now().Unix()), int(time.Now().Unix()))
+		var newTopicID string
+		db.QueryRow(`SELECT id FROM topics WHERE userid=? AND groupid=? ORDER BY id DESC LIMIT 1;`, sess.UserID, groupID).Scan(&newTopicID)
 
-		if models.Config(models.AllowGroupSubscription) != "0" {
-			groupURL := "http://" + r.Host + "/groups?name=" + groupName
-			rows := db.Query(`SELECT users.email, groupsubscriptions.token FROM users INNER JOIN groupsubscriptions ON users.id=groupsubscriptions.userid AND groupsubscriptions.groupid=?;`, groupID)
-			for rows.Next() {
-				var email, token string
-				rows.Scan(&email, &token)
-				if email != "" {
-					unSubURL := "http://" + r.Host + "/groups/unsubscribe?token=" + token
-					utils.SendMail(email, `New topic in `+groupName,
-						"A new topic titled \""+title+"\" has been posted to "+groupName+".\r\nSee topics posted to the group at "+groupURL+"\r\n\r\nIf you do not want these emails, unsubscribe by following this link: "+unSubURL)
-				}
-			}
+		if isPending {
+			sess.SetFlashMsg("Your topic will be visible to others after a moderator approves it.")
+		} else {
+			publishTopic(r, &sess, groupID, groupName, newTopicID, title, content)
 		}
 		http.Redirect(w, r, "/groups?name="+groupName, http.StatusSeeOther)
 		return
@@ -190,7 +214,6 @@ var TopicCreateHandler = A(func(w http.ResponseWriter, r *http.Request, sess Ses
 
 var TopicUpdateHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
 	topicID := r.FormValue("id")
-	groupID := ""
 	title := strings.TrimSpace(r.PostFormValue("title"))
 	content := strings.TrimSpace(r.PostFormValue("content"))
 	action := r.PostFormValue("action")
@@ -198,60 +221,67 @@ var TopicUpdateHandler = A(func(w http.ResponseWriter, r *http.Request, sess Ses
 	isClosed := true
 	isDeleted := true
 
-	if db.QueryRow(`SELECT groupid FROM topics WHERE id=?;`, topicID).Scan(&groupID) != nil {
+	perms, err := readTopicPerms(&sess, topicID)
+	if err == errNotFound {
 		ErrNotFoundHandler(w, r)
 		return
 	}
-
-	isGroupClosed := 1
-	var groupName string
-	db.QueryRow(`SELECT name, is_closed FROM groups WHERE id=?;`, groupID).Scan(&groupName, &isGroupClosed)
-	if isGroupClosed == 1 {
+	if err != nil {
 		ErrForbiddenHandler(w, r)
 		return
 	}
+	groupID, groupName := perms.GroupID, perms.GroupName
+	isMod, isAdmin, isSuperAdmin := perms.IsMod, perms.IsAdmin, perms.IsSuperAdmin
 
-	var tmp int
-	var uID int64
-	db.QueryRow(`SELECT userid FROM topics WHERE id=?;`, topicID).Scan(&uID)
-
-	isOwner := (uID == sess.UserID.Int64)
-	isMod := db.QueryRow(`SELECT id FROM mods WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
-	isAdmin := db.QueryRow(`SELECT id FROM admins WHERE groupid=? AND userid=?;`, groupID, sess.UserID).Scan(&tmp) == nil
-	isSuperAdmin := false
-	db.QueryRow(`SELECT is_superadmin FROM users WHERE id=?`, sess.UserID).Scan(&isSuperAdmin)
-
-	if !isMod && !isAdmin && !isSuperAdmin {
+	if !perms.CanEdit() {
+		ErrForbiddenHandler(w, r)
+		return
+	}
+	if !perms.CanModerate() {
 		db.QueryRow(`SELECT is_sticky FROM topics WHERE id=?;`, topicID).Scan(&isSticky)
-		if !isOwner {
-			ErrForbiddenHandler(w, r)
-			return
-		}
 	}
 
 	if r.Method == "POST" {
-		if len(title) < 8 || len(title) > 80 {
-			sess.SetFlashMsg("Title should have 8-80 characters.")
-			http.Redirect(w, r, "/topics/edit?id="+topicID, http.StatusSeeOther)
-			return
-		}
-		if len(content) > 5000 {
-			sess.SetFlashMsg("Content should have less than 5000 characters.")
+		if err := validateTopic(title, content); err != nil {
+			sess.SetFlashMsg(err.Error())
 			http.Redirect(w, r, "/topics/edit?id="+topicID, http.StatusSeeOther)
 			return
 		}
 		if action == "Update" {
+			if err := checkCanPost(r, &sess, groupID); err != nil {
+				sess.SetFlashMsg(err.Error())
+				http.Redirect(w, r, "/topics/edit?id="+topicID, http.StatusSeeOther)
+				return
+			}
+			var oldTitle, oldContent string
+			var wasSticky bool
+			db.QueryRow(`SELECT title, content, is_sticky FROM topics WHERE id=?;`, topicID).Scan(&oldTitle, &oldContent, &wasSticky)
 			db.Exec(`UPDATE topics SET title=?, content=?, is_sticky=?, updated_date=? WHERE id=?;`, title, content, isSticky, int(time.Now().Unix()), topicID)
-		} else if action == "Close" && (isMod || isAdmin || isSuperAdmin) {
+			notifyTopicModAction(&sess, perms, "edited")
+			if title != oldTitle || content != oldContent {
+				auditTopic(r, &sess, perms, models.AuditTopicEdit, oldTitle+"\n\n"+oldContent, title+"\n\n"+content)
+			}
+			if isSticky != wasSticky {
+				auditTopic(r, &sess, perms, models.AuditTopicSticky, strconv.FormatBool(wasSticky), strconv.FormatBool(isSticky))
+			}
+		} else if action == "Close" && perms.CanModerate() {
 			db.Exec(`UPDATE topics SET is_closed=1 WHERE id=?;`, topicID)
-		} else if action == "Reopen" && (isMod || isAdmin || isSuperAdmin) {
+			notifyTopicModAction(&sess, perms, "closed")
+			auditTopic(r, &sess, perms, models.AuditTopicClose, "", "")
+		} else if action == "Reopen" && perms.CanModerate() {
 			db.Exec(`UPDATE topics SET is_closed=0 WHERE id=?;`, topicID)
+			notifyTopicModAction(&sess, perms, "reopened")
+			auditTopic(r, &sess, perms, models.AuditTopicReopen, "", "")
 		} else if action == "Delete" {
 			db.Exec(`UPDATE topics SET is_deleted=1 WHERE id=?;`, topicID)
+			notifyTopicModAction(&sess, perms, "deleted")
+			auditTopic(r, &sess, perms, models.AuditTopicDelete, "", "")
 			http.Redirect(w, r, "/topics/edit?id="+topicID, http.StatusSeeOther)
 			return
-		} else if action == "Undelete" {
+		} else if action == "Undelete" && perms.CanModerate() {
 			db.Exec(`UPDATE topics SET is_deleted=0 WHERE id=?;`, topicID)
+			notifyTopicModAction(&sess, perms, "restored")
+			auditTopic(r, &sess, perms, models.AuditTopicUndelete, "", "")
 		}
 		http.Redirect(w, r, "/topics?id="+topicID, http.StatusSeeOther)
 		return
@@ -284,11 +314,15 @@ var TopicSubscribeHandler = A(func(w http.ResponseWriter, r *http.Request, sess
 		ErrForbiddenHandler(w, r)
 		return
 	}
-	var tmp string
-	if db.QueryRow(`SELECT id FROM topics WHERE id=?;`, topicID).Scan(&tmp) != nil {
+	var groupID string
+	if db.QueryRow(`SELECT groupid FROM topics WHERE id=?;`, topicID).Scan(&groupID) != nil {
 		ErrNotFoundHandler(w, r)
 		return
 	}
+	if !sess.CanViewGroup(groupID) {
+		ErrForbiddenHandler(w, r)
+		return
+	}
 	if r.Method == "POST" {
 		var tmp string
 		if db.QueryRow(`SELECT id FROM topicsubscriptions WHERE userid=? AND topicid=?;`, sess.UserID, topicID).Scan(&tmp) != nil {
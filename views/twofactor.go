@@ -0,0 +1,173 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"database/sql"
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/templates"
+	"github.com/s-gv/orangeforum/utils"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The second step of a login has to be completed within maxPendingLoginLife of the first.
+const maxPendingLoginLife = 10 * time.Minute
+
+// readPendingLogin returns the user that entered the right password in this session and
+// still has to enter a two-factor code.
+func readPendingLogin(sess *Session) (userID string, userName string, ok bool) {
+	var pendingUserID sql.NullInt64
+	var pendingDate int64
+	db.QueryRow(`SELECT pending_userid, pending_date FROM sessions WHERE sessionid=?;`, sess.SessionID).Scan(&pendingUserID, &pendingDate)
+	if !pendingUserID.Valid || time.Unix(pendingDate, 0).Before(time.Now().Add(-maxPendingLoginLife)) {
+		return "", "", false
+	}
+	userID = strconv.FormatInt(pendingUserID.Int64, 10)
+	if db.QueryRow(`SELECT username FROM users WHERE id=?;`, userID).Scan(&userName) != nil {
+		return "", "", false
+	}
+	return userID, userName, true
+}
+
+// checkTwoFactorCode accepts a code from the authenticator app of the user or one of the
+// user's recovery codes. isRecovery is true if a recovery code was used up.
+func checkTwoFactorCode(userID string, code string) (ok bool, isRecovery bool) {
+	if secret := models.ReadTOTPSecret(userID); secret != "" {
+		if step, ok := utils.ValidateTOTP(secret, code, time.Now()); ok {
+			return models.UseTOTPStep(userID, step), false
+		}
+	}
+	if models.UseRecoveryCode(userID, code) {
+		return true, true
+	}
+	return false, false
+}
+
+// loginRedirectURL returns where to go after logging in. Users who have to turn on
+// two-factor authentication are sent to do so first.
+func loginRedirectURL(sess *Session, redirectURL string) string {
+	userID := sessUserID(sess)
+	if models.IsTOTPRequired(userID) && !models.IsTOTPEnabled(userID) {
+		sess.SetFlashMsg("Turn on two-factor authentication to use your admin privileges.")
+		return "/users/2fa"
+	}
+	return redirectURL
+}
+
+var LoginTwoFactorHandler = UA(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	redirectURL, err := url.QueryUnescape(r.FormValue("next"))
+	if err != nil || redirectURL == "" || redirectURL[0] != '/' {
+		redirectURL = "/"
+	}
+	if sess.IsUserValid() {
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+	userID, userName, ok := readPendingLogin(&sess)
+	if !ok {
+		sess.SetFlashMsg("Login again.")
+		http.Redirect(w, r, "/login?next="+redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == "POST" {
+		code := strings.TrimSpace(r.PostFormValue("code"))
+		ip := remoteIP(r)
+		if wait := loginWait(userName, ip, time.Now()); wait > 0 {
+			sess.SetFlashMsg(errLoginThrottled(wait).Error())
+			http.Redirect(w, r, "/login/2fa?next="+redirectURL, http.StatusSeeOther)
+			return
+		}
+		ok, isRecovery := checkTwoFactorCode(userID, code)
+		if !ok {
+			models.RecordLoginFailure(userName, ip, models.LoginActionTwoFactor)
+			sess.SetFlashMsg("Incorrect code.")
+			http.Redirect(w, r, "/login/2fa?next="+redirectURL, http.StatusSeeOther)
+			return
+		}
+		models.ClearLoginFailuresByUser(userName)
+		uid, _ := strconv.ParseInt(userID, 10, 64)
+		sess.logIn(uid)
+		if isRecovery {
+			sess.SetFlashMsg("Recovery code used. You have " + strconv.Itoa(models.NumRecoveryCodes(userID)) + " left.")
+			http.Redirect(w, r, "/users/2fa", http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, loginRedirectURL(&sess, redirectURL), http.StatusSeeOther)
+		return
+	}
+	templates.Render(w, "login2fa.html", map[string]interface{}{
+		"Common": readCommonData(r, sess),
+		"next":   template.URL(url.QueryEscape(redirectURL)),
+	})
+})
+
+var UserTwoFactorHandler = A(func(w http.ResponseWriter, r *http.Request, sess Session) {
+	userID := sessUserID(&sess)
+	userName, _ := sess.UserName()
+	isEnabled := models.IsTOTPEnabled(userID)
+	var recoveryCodes []string
+	secret := ""
+	errMsg := ""
+
+	if r.Method == "POST" {
+		action := r.PostFormValue("action")
+		code := strings.TrimSpace(r.PostFormValue("code"))
+		ip := remoteIP(r)
+		if wait := loginWait(userName, ip, time.Now()); wait > 0 {
+			sess.SetFlashMsg(errLoginThrottled(wait).Error())
+			http.Redirect(w, r, "/users/2fa", http.StatusSeeOther)
+			return
+		}
+		if action == "Turn on" && !isEnabled {
+			secret = r.PostFormValue("secret")
+			if _, ok := utils.ValidateTOTP(secret, code, time.Now()); !ok || len(secret) > 64 {
+				errMsg = "Incorrect code. Check the time on your device and try again."
+			} else {
+				recoveryCodes = models.EnableTOTP(userID, secret)
+				isEnabled = true
+			}
+		} else if (action == "Turn off" || action == "New recovery codes") && isEnabled {
+			if ok, _ := checkTwoFactorCode(userID, code); !ok {
+				models.RecordLoginFailure(userName, ip, models.LoginActionTwoFactor)
+				sess.SetFlashMsg("Incorrect code.")
+				http.Redirect(w, r, "/users/2fa", http.StatusSeeOther)
+				return
+			}
+			if action == "Turn off" {
+				models.DisableTOTP(userID)
+				sess.SetFlashMsg("Two-factor authentication turned off.")
+				http.Redirect(w, r, "/users/2fa", http.StatusSeeOther)
+				return
+			}
+			recoveryCodes = models.CreateRecoveryCodes(userID)
+		}
+	}
+	if !isEnabled && secret == "" {
+		secret = utils.NewTOTPSecret()
+	}
+
+	commonData := readCommonData(r, sess)
+	commonData.PageTitle = "Two-factor authentication"
+	if errMsg != "" {
+		commonData.Msg = errMsg
+	}
+
+	templates.Render(w, "profile2fa.html", map[string]interface{}{
+		"Common":           commonData,
+		"IsEnabled":        isEnabled,
+		"IsRequired":       models.IsTOTPRequired(userID),
+		"Secret":           secret,
+		"URI":              template.URL(utils.TOTPURI(models.Config(models.ForumName), userName, secret)),
+		"RecoveryCodes":    recoveryCodes,
+		"NumRecoveryCodes": models.NumRecoveryCodes(userID),
+	})
+})
@@ -0,0 +1,86 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package views
+
+import (
+	"github.com/s-gv/orangeforum/models"
+	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTwoFactorLogin(t *testing.T) {
+	models.CreateUser("tfuser", "tfuser12345", "")
+	userID, _ := models.ReadUserIDByName("tfuser")
+	secret := utils.NewTOTPSecret()
+	recoveryCodes := models.EnableTOTP(strconv.Itoa(userID), secret)
+
+	anonSessionForTest := func() string {
+		sessionID := randSeq(32)
+		db.Exec(`INSERT INTO sessions(sessionid, csrf, msg, created_date, updated_date) VALUES(?, ?, ?, ?, ?);`,
+			sessionID, randSeq(32), "", time.Now().Unix(), time.Now().Unix())
+		return sessionID
+	}
+	isLoggedIn := func(sessionID string) bool {
+		var loggedInID string
+		return db.QueryRow(`SELECT userid FROM sessions WHERE sessionid=? AND userid IS NOT NULL;`, sessionID).Scan(&loggedInID) == nil
+	}
+
+	sess := anonSessionForTest()
+	rr := postFromForTest(LoginHandler, "/login", url.Values{"username": {"tfuser"}, "passwd": {"tfuser12345"}}, sess, "192.0.2.20:4000")
+	if loc := rr.Header().Get("Location"); !strings.HasPrefix(loc, "/login/2fa") || isLoggedIn(sess) {
+		t.Fatalf("Password alone logged in: %s", loc)
+	}
+	postFromForTest(LoginTwoFactorHandler, "/login/2fa", url.Values{"code": {"000000"}}, sess, "192.0.2.20:4000")
+	if isLoggedIn(sess) {
+		t.Fatalf("Incorrect code logged in")
+	}
+	code, _ := utils.TOTPCode(secret, time.Now().Unix()/30)
+	postFromForTest(LoginTwoFactorHandler, "/login/2fa", url.Values{"code": {code}}, sess, "192.0.2.20:4000")
+	if !isLoggedIn(sess) {
+		t.Fatalf("Correct code did not log in")
+	}
+
+	sess = anonSessionForTest()
+	postFromForTest(LoginHandler, "/login", url.Values{"username": {"tfuser"}, "passwd": {"tfuser12345"}}, sess, "192.0.2.20:4000")
+	postFromForTest(LoginTwoFactorHandler, "/login/2fa", url.Values{"code": {code}}, sess, "192.0.2.20:4000")
+	if isLoggedIn(sess) {
+		t.Fatalf("A used code logged in again")
+	}
+	postFromForTest(LoginTwoFactorHandler, "/login/2fa", url.Values{"code": {recoveryCodes[0]}}, sess, "192.0.2.20:4000")
+	if !isLoggedIn(sess) || models.NumRecoveryCodes(strconv.Itoa(userID)) != len(recoveryCodes)-1 {
+		t.Fatalf("Recovery code did not log in")
+	}
+
+	if models.ResetTOTP("tfuser") != nil || models.IsTOTPEnabled(strconv.Itoa(userID)) {
+		t.Errorf("Two-factor authentication not reset")
+	}
+}
+
+func TestTwoFactorRequired(t *testing.T) {
+	models.CreateSuperUser("tfadmin", "tfadmin12345")
+	userID, _ := models.ReadUserIDByName("tfadmin")
+	sessionID := sessionForTest("tfadmin")
+	sess := Session{SessionID: sessionID}
+	db.QueryRow(`SELECT userid FROM sessions WHERE sessionid=?;`, sessionID).Scan(&sess.UserID)
+
+	models.WriteConfig(models.Require2FA, "1")
+	defer models.WriteConfig(models.Require2FA, "0")
+	if sess.IsUserSuperAdmin() {
+		t.Errorf("Superadmin privileges without two-factor authentication")
+	}
+	if rr := getForTest(AdminIndexHandler, "/admin", sessionID); rr.Code != http.StatusForbidden {
+		t.Errorf("Admin page without two-factor authentication: got %v", rr.Code)
+	}
+	models.EnableTOTP(strconv.Itoa(userID), utils.NewTOTPSecret())
+	if !sess.IsUserSuperAdmin() {
+		t.Errorf("No superadmin privileges with two-factor authentication")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"github.com/s-gv/orangeforum/models"
 	"github.com/s-gv/orangeforum/models/db"
+	"github.com/s-gv/orangeforum/utils"
 	"html/template"
 	"io"
 	"log"
@@ -30,13 +31,16 @@ type CommonData struct {
 	UserName          string
 	IsSuperAdmin      bool
 	IsNotification    bool
+	NumNotifications  int
 	ForumName         string
 	PageTitle         string
 	CurrentURL        template.URL
+	FeedURL           string
 	BodyAppendage     string
 	IsGroupSubAllowed bool
 	IsTopicSubAllowed bool
 	ExtraNotesShort   []ExtraNote
+	SuspensionMsg     string
 }
 
 type ExtraNote struct {
@@ -48,25 +52,10 @@ type ExtraNote struct {
 	UpdatedDate time.Time
 }
 
-var linkRe *regexp.Regexp
-var italicRe *regexp.Regexp
-var boldRe *regexp.Regexp
-var codeRe *regexp.Regexp
-var oldCodeRe *regexp.Regexp
-var quoteRe *regexp.Regexp
 var censorRe *regexp.Regexp
 
 var censored string
 
-func init() {
-	linkRe = regexp.MustCompile("https?://([A-Za-z0-9\\-]+\\.[A-Za-z0-9\\-\\.]+|localhost)(:[0-9]+)?[a-zA-Z0-9@:%_\\+\\.~#?&/=;\\-]*[a-zA-Z0-9@:%_\\+~#?&/=;\\-]")
-	italicRe = regexp.MustCompile("\\*([^\\*\n]+)\\*")
-	boldRe = regexp.MustCompile("\\*\\*([^\\*\n]+)\\*\\*")
-	codeRe = regexp.MustCompile("(?:^|\n)```.*\n(?s:(.+))\n```(?:$|\n)")
-	oldCodeRe = regexp.MustCompile("(?:^|\n)    ([^\n]+)")
-	quoteRe = regexp.MustCompile("((?:^|\n)>*)[ ]*(\\S[^\n]*)")
-}
-
 func ErrServerHandler(w http.ResponseWriter, r *http.Request) {
 	if r := recover(); r != nil {
 		log.Printf("[INFO] Recovered from panic: %s\n[INFO] Debug stack: %s\n", r, debug.Stack())
@@ -82,12 +71,27 @@ func ErrForbiddenHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "403 Forbidden", http.StatusForbidden)
 }
 
+// openRequestSession returns the session for a request authenticated with the session
+// cookie, logged in as the user named by a trusted proxy if any. API tokens are accepted
+// only by the API and the feeds. If the request is rejected, a response is written and ok
+// is false.
+func openRequestSession(w http.ResponseWriter, r *http.Request) (sess Session, ok bool) {
+	sess = OpenSession(w, r)
+	if !proxyLogIn(w, r, &sess) {
+		return sess, false
+	}
+	if r.Method == "POST" && r.PostFormValue("csrf") != sess.CSRFToken {
+		ErrForbiddenHandler(w, r)
+		return sess, false
+	}
+	return sess, true
+}
+
 func UA(handler func(w http.ResponseWriter, r *http.Request, sess Session)) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer ErrServerHandler(w, r)
-		sess := OpenSession(w, r)
-		if r.Method == "POST" && r.PostFormValue("csrf") != sess.CSRFToken {
-			ErrForbiddenHandler(w, r)
+		sess, ok := openRequestSession(w, r)
+		if !ok {
 			return
 		}
 		//log.Printf("[INFO] Request: %s\n", r.URL)
@@ -98,9 +102,8 @@ func UA(handler func(w http.ResponseWriter, r *http.Request, sess Session)) func
 func A(handler func(w http.ResponseWriter, r *http.Request, sess Session)) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer ErrServerHandler(w, r)
-		sess := OpenSession(w, r)
-		if r.Method == "POST" && r.PostFormValue("csrf") != sess.CSRFToken {
-			ErrForbiddenHandler(w, r)
+		sess, ok := openRequestSession(w, r)
+		if !ok {
 			return
 		}
 		if !sess.UserID.Valid {
@@ -148,58 +151,18 @@ func validateName(name string) error {
 	return nil
 }
 
-func formatComment(comment string) template.HTML {
-	comment = strings.Replace(comment, "\r", "", -1)
-
-	comment = template.HTMLEscapeString(comment)
-
-	if strings.Contains(comment, "```") {
-		// Newer version -- Markdown style backtick marked code blocks
-		comment = codeRe.ReplaceAllString(comment, "<pre>$1</pre>")
-	} else {
-		// Older version -- SO style 4-space indented code blocks
-		comment = oldCodeRe.ReplaceAllString(comment, "<pre>$1</pre>")
-		comment = strings.Replace(comment, "</pre><pre>", "\n", -1)
-	}
-
-	comment = strings.Replace(comment, "\n\n", "</p><p>", -1)
-	comment = strings.Replace(comment, "\n", "<br>", -1)
-
-	comment = boldRe.ReplaceAllString(comment, "<b>$1</b>")
-	comment = italicRe.ReplaceAllString(comment, "<em>$1</em>")
-
-	comment = linkRe.ReplaceAllString(comment, "<a href=\"$0\">$0</a>")
-
-	formatted := "<p>" + comment + "</p>"
-	return template.HTML(censor(formatted))
-}
-
-func formatReply(quotedUser string, quoteContent string) string {
-	quoteContent = strings.Replace(quoteContent, "\r", "", -1)
-	quoteContent = codeRe.ReplaceAllString(quoteContent, "\n$1\n")
-	if quoteContent[0] == '\n' {
-		quoteContent = quoteContent[1:]
-	}
-	quoteContent = quoteRe.ReplaceAllString(quoteContent, "$1> $2")
-	quoteContent = "```\n" + quotedUser + " wrote:\n" + quoteContent + "\n```\n"
-	return quoteContent
-}
-
 func censor(content string) string {
 	cWords := models.Config(models.CensoredWords)
 	if cWords != censored {
 		censored = cWords
-		cWordList := strings.Split(censored, ",")
-		if len(cWordList) > 0 {
-			r := "(?i:"
-			for i, w := range cWordList {
-				r = r + strings.TrimSpace(w)
-				if i < len(cWordList)-1 {
-					r = r + "|"
-				}
+		var cWordList []string
+		for _, w := range strings.Split(censored, ",") {
+			if w = strings.TrimSpace(w); w != "" {
+				cWordList = append(cWordList, w)
 			}
-			r = r + ")"
-			censorRe = regexp.MustCompile(r)
+		}
+		if len(cWordList) > 0 {
+			censorRe = regexp.MustCompile("(?i:" + strings.Join(cWordList, "|") + ")")
 		} else {
 			censorRe = nil
 		}
@@ -238,13 +201,38 @@ func saveImage(r *http.Request) string {
 	return imageName
 }
 
+func validateUserName(userName string) error {
+	if len(userName) < 2 || len(userName) > 32 {
+		return errors.New("Username should have 2-32 characters.")
+	}
+	if censored := censor(userName); censored != userName {
+		return errors.New("Fix username: " + censored)
+	}
+	for _, ch := range userName {
+		if (ch < 'A' || ch > 'Z') && (ch < 'a' || ch > 'z') && ch != '_' && (ch < '0' || ch > '9') {
+			return errors.New("Username can contain only alphabets, numbers, and underscore.")
+		}
+	}
+	return nil
+}
+
+// maxPasswdLen only guards against hashing huge inputs; it is not a policy limit.
+const maxPasswdLen = 1024
+
 func validatePasswd(passwd string, passwdConfirm string) error {
-	if len(passwd) < 8 || len(passwd) > 40 {
-		return errors.New("Password should have 8-40 characters.")
+	if len(passwd) < 8 || len(passwd) > maxPasswdLen {
+		return errors.New("Password should have 8-" + strconv.Itoa(maxPasswdLen) + " characters.")
 	}
 	if passwd != passwdConfirm {
 		return errors.New("Passwords don't match.")
 	}
+	if path := models.Config(models.BreachedPasswdFile); path != "" {
+		if breached, err := utils.IsPasswdBreached(path, passwd); err != nil {
+			log.Printf("[ERROR] Unable to check the breached password list: %s\n", err)
+		} else if breached {
+			return errors.New("This password has appeared in a data breach. Please choose a different one.")
+		}
+	}
 	return nil
 }
 
@@ -272,11 +260,17 @@ func readCommonData(r *http.Request, sess Session) CommonData {
 	}
 
 	pmNotification := false
+	numNotifications := 0
+	suspension := ""
 	if sess.UserID.Valid {
 		var tmp string
 		if err := db.QueryRow(`SELECT id FROM messages WHERE toid=? AND is_read=?`, sess.UserID, false).Scan(&tmp); err == nil {
 			pmNotification = true
 		}
+		numNotifications = models.NumUnreadNotifications(sessUserID(&sess))
+		if until, reason := models.ReadSuspension(sessUserID(&sess)); until != 0 {
+			suspension = suspensionMsg(until, reason)
+		}
 	}
 
 	rows := db.Query(`SELECT id, name FROM extranotes;`)
@@ -293,11 +287,13 @@ func readCommonData(r *http.Request, sess Session) CommonData {
 		UserName:          userName,
 		IsSuperAdmin:      isSuperAdmin,
 		IsNotification:    pmNotification,
+		NumNotifications:  numNotifications,
 		ForumName:         models.Config(models.ForumName),
 		CurrentURL:        template.URL(url.QueryEscape(currentURL)),
 		IsGroupSubAllowed: models.Config(models.AllowGroupSubscription) != "0",
 		IsTopicSubAllowed: models.Config(models.AllowTopicSubscription) != "0",
 		BodyAppendage:     models.Config(models.BodyAppendage),
 		ExtraNotesShort:   extraNotes,
+		SuspensionMsg:     suspension,
 	}
 }
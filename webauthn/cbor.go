@@ -0,0 +1,119 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The subset of CBOR (RFC 7049) used by WebAuthn: integers, byte and text strings,
+// arrays, maps, booleans and null. Indefinite lengths, tags and floats aren't supported.
+
+var errCBOR = errors.New("Malformed CBOR")
+
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first item in b and returns it with the bytes that follow it.
+// Integers decode to int64, byte strings to []byte, text strings to string, arrays to
+// []interface{} and maps to map[interface{}]interface{}.
+func decodeCBOR(b []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(b, 0)
+}
+
+func decodeCBORItem(b []byte, depth int) (interface{}, []byte, error) {
+	if len(b) == 0 || depth > maxCBORDepth {
+		return nil, nil, errCBOR
+	}
+	major := b[0] >> 5
+	info := b[0] & 0x1f
+	b = b[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, b, nil
+		case 21:
+			return true, b, nil
+		case 22, 23:
+			return nil, b, nil
+		}
+		return nil, nil, errCBOR
+	}
+
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info == 24 && len(b) >= 1:
+		n, b = uint64(b[0]), b[1:]
+	case info == 25 && len(b) >= 2:
+		n, b = uint64(binary.BigEndian.Uint16(b)), b[2:]
+	case info == 26 && len(b) >= 4:
+		n, b = uint64(binary.BigEndian.Uint32(b)), b[4:]
+	case info == 27 && len(b) >= 8:
+		n, b = binary.BigEndian.Uint64(b), b[8:]
+	default:
+		return nil, nil, errCBOR
+	}
+
+	switch major {
+	case 0:
+		if n > 1<<63-1 {
+			return nil, nil, errCBOR
+		}
+		return int64(n), b, nil
+	case 1:
+		if n > 1<<63-1 {
+			return nil, nil, errCBOR
+		}
+		return -1 - int64(n), b, nil
+	case 2, 3:
+		if n > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		if major == 3 {
+			return string(b[:n]), b[n:], nil
+		}
+		return b[:n], b[n:], nil
+	case 4:
+		if n > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		items := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var item interface{}
+			var err error
+			if item, b, err = decodeCBORItem(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, b, nil
+	case 5:
+		if n > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		m := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			var key, val interface{}
+			var err error
+			if key, b, err = decodeCBORItem(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			if val, b, err = decodeCBORItem(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+				m[key] = val
+			default:
+				return nil, nil, errCBOR
+			}
+		}
+		return m, b, nil
+	}
+	return nil, nil, errCBOR
+}
@@ -0,0 +1,326 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package webauthn verifies WebAuthn registrations and assertions, so that users can log
+// in with security keys and passkeys. Attestation statements are not verified: like most
+// websites, the forum accepts whatever authenticator the user chooses.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// COSE algorithms of the supported public keys.
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+var SupportedAlgs = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// ErrUserMismatch is returned by callers when the user handle of an assertion doesn't
+// match the owner of the credential.
+var ErrUserMismatch = errors.New("Security key belongs to another user")
+
+// Flags of the authenticator data.
+const (
+	flagUserPresent  byte = 0x01
+	flagUserVerified byte = 0x04
+	flagAttestedData byte = 0x40
+)
+
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+}
+
+// Assertion is the result of a successful login with a credential.
+type Assertion struct {
+	SignCount      uint32
+	IsUserVerified bool // The authenticator checked a PIN or biometric, not just presence.
+}
+
+// RelyingParty is the website credentials are registered with.
+type RelyingParty struct {
+	ID      string   // Domain name, such as "forum.example.com".
+	Name    string   // Shown to the user by the authenticator.
+	Origins []string // Origins the browser may report, such as "https://forum.example.com".
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// EncodeID encodes credential IDs, user handles and challenges as unpadded base64url,
+// which is what browsers use in clientDataJSON.
+func EncodeID(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeID(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// NewChallenge returns a random challenge. It must be saved on the server and used only once.
+func NewChallenge() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return EncodeID(b)
+}
+
+// CreationOptions returns the options for navigator.credentials.create(). Binary values
+// are base64url encoded and have to be decoded by the script before the call.
+func (rp RelyingParty) CreationOptions(challenge string, userHandle []byte, userName string, exclude [][]byte) map[string]interface{} {
+	var params []map[string]interface{}
+	for _, alg := range SupportedAlgs {
+		params = append(params, map[string]interface{}{"type": "public-key", "alg": alg})
+	}
+	excludeCredentials := []map[string]interface{}{}
+	for _, id := range exclude {
+		excludeCredentials = append(excludeCredentials, map[string]interface{}{"type": "public-key", "id": EncodeID(id)})
+	}
+	return map[string]interface{}{
+		"challenge":          challenge,
+		"rp":                 map[string]interface{}{"id": rp.ID, "name": rp.Name},
+		"user":               map[string]interface{}{"id": EncodeID(userHandle), "name": userName, "displayName": userName},
+		"pubKeyCredParams":   params,
+		"excludeCredentials": excludeCredentials,
+		"authenticatorSelection": map[string]interface{}{
+			"residentKey":        "required",
+			"requireResidentKey": true,
+			"userVerification":   "preferred",
+		},
+		"attestation": "none",
+		"timeout":     120000,
+	}
+}
+
+// RequestOptions returns the options for navigator.credentials.get(). No credentials are
+// listed, so the authenticator offers the passkeys it has for the site.
+func (rp RelyingParty) RequestOptions(challenge string) map[string]interface{} {
+	return map[string]interface{}{
+		"challenge":        challenge,
+		"rpId":             rp.ID,
+		"userVerification": "preferred",
+		"timeout":          120000,
+	}
+}
+
+func (rp RelyingParty) checkClientData(clientDataJSON []byte, typ string, challenge string) error {
+	var c clientData
+	if err := json.Unmarshal(clientDataJSON, &c); err != nil {
+		return errors.New("Malformed client data")
+	}
+	if c.Type != typ {
+		return errors.New("Unexpected client data type")
+	}
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(strings.TrimRight(c.Challenge, "=")), []byte(challenge)) != 1 {
+		return errors.New("Challenge mismatch")
+	}
+	for _, origin := range rp.Origins {
+		if c.Origin == origin {
+			return nil
+		}
+	}
+	return errors.New("Origin mismatch")
+}
+
+func (rp RelyingParty) parseAuthData(b []byte) (authData, error) {
+	var a authData
+	if len(b) < 37 {
+		return a, errors.New("Malformed authenticator data")
+	}
+	a.rpIDHash, a.flags, a.signCount = b[:32], b[32], binary.BigEndian.Uint32(b[33:37])
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(a.rpIDHash, rpIDHash[:]) {
+		return a, errors.New("Relying party mismatch")
+	}
+	if a.flags&flagUserPresent == 0 {
+		return a, errors.New("User not present")
+	}
+	if a.flags&flagAttestedData != 0 {
+		b = b[37:]
+		if len(b) < 18 {
+			return a, errors.New("Malformed attested credential data")
+		}
+		n := int(binary.BigEndian.Uint16(b[16:18]))
+		b = b[18:]
+		if n == 0 || n > 1023 || len(b) < n {
+			return a, errors.New("Malformed credential ID")
+		}
+		a.credentialID, b = b[:n], b[n:]
+		_, rest, err := decodeCBOR(b)
+		if err != nil {
+			return a, err
+		}
+		a.publicKey = b[:len(b)-len(rest)]
+	}
+	return a, nil
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create() and returns
+// the new credential.
+func (rp RelyingParty) VerifyRegistration(challenge string, clientDataJSON []byte, attestationObject []byte) (Credential, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return Credential{}, err
+	}
+	obj, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return Credential{}, err
+	}
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return Credential{}, errCBOR
+	}
+	rawAuthData, ok := m["authData"].([]byte)
+	if !ok {
+		return Credential{}, errors.New("Missing authenticator data")
+	}
+	a, err := rp.parseAuthData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if a.credentialID == nil {
+		return Credential{}, errors.New("Missing attested credential data")
+	}
+	if _, err := parsePublicKey(a.publicKey); err != nil {
+		return Credential{}, err
+	}
+	return Credential{ID: a.credentialID, PublicKey: a.publicKey, SignCount: a.signCount}, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get() made with cred.
+func (rp RelyingParty) VerifyAssertion(cred Credential, challenge string, clientDataJSON []byte, authenticatorData []byte, signature []byte) (Assertion, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return Assertion{}, err
+	}
+	a, err := rp.parseAuthData(authenticatorData)
+	if err != nil {
+		return Assertion{}, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), clientDataHash[:]...)
+	if err := verifySignature(cred.PublicKey, signed, signature); err != nil {
+		return Assertion{}, err
+	}
+	// Authenticators that count signatures must count up. Otherwise, the credential may have been cloned.
+	if (a.signCount != 0 || cred.SignCount != 0) && a.signCount <= cred.SignCount {
+		return Assertion{}, errors.New("Signature counter did not increase")
+	}
+	return Assertion{SignCount: a.signCount, IsUserVerified: a.flags&flagUserVerified != 0}, nil
+}
+
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+func coseBytes(m map[interface{}]interface{}, label int64, n int) ([]byte, error) {
+	b, ok := m[label].([]byte)
+	if !ok || (n > 0 && len(b) != n) {
+		return nil, errors.New("Malformed public key")
+	}
+	return b, nil
+}
+
+// parsePublicKey decodes a COSE_Key (RFC 8152).
+func parsePublicKey(coseKey []byte) (publicKey, error) {
+	obj, _, err := decodeCBOR(coseKey)
+	if err != nil {
+		return publicKey{}, err
+	}
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return publicKey{}, errCBOR
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	crv, _ := m[int64(-1)].(int64)
+	switch {
+	case kty == 2 && alg == AlgES256 && crv == 1:
+		x, err := coseBytes(m, -2, 32)
+		if err != nil {
+			return publicKey{}, err
+		}
+		y, err := coseBytes(m, -3, 32)
+		if err != nil {
+			return publicKey{}, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return publicKey{}, errors.New("Malformed public key")
+		}
+		return publicKey{alg, pub}, nil
+	case kty == 1 && alg == AlgEdDSA && crv == 6:
+		x, err := coseBytes(m, -2, ed25519.PublicKeySize)
+		if err != nil {
+			return publicKey{}, err
+		}
+		return publicKey{alg, ed25519.PublicKey(x)}, nil
+	case kty == 3 && alg == AlgRS256:
+		n, err := coseBytes(m, -1, 0)
+		if err != nil {
+			return publicKey{}, err
+		}
+		e, err := coseBytes(m, -2, 0)
+		if err != nil {
+			return publicKey{}, err
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 || pub.E < 3 || len(e) > 4 {
+			return publicKey{}, errors.New("Unsupported RSA key")
+		}
+		return publicKey{alg, pub}, nil
+	}
+	return publicKey{}, errors.New("Unsupported public key algorithm")
+}
+
+func verifySignature(coseKey []byte, signed []byte, signature []byte) error {
+	pub, err := parsePublicKey(coseKey)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(signed)
+	ok := false
+	switch key := pub.key.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, hash[:], signature)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, signed, signature)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil
+	}
+	if !ok {
+		return errors.New("Invalid signature")
+	}
+	return nil
+}
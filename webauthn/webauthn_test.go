@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package webauthn
+
+import (
+	"github.com/s-gv/orangeforum/webauthn/webauthntest"
+	"testing"
+)
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := RelyingParty{ID: "forum.example.com", Name: "Forum", Origins: []string{"https://forum.example.com"}}
+	auth := webauthntest.New()
+
+	challenge := NewChallenge()
+	clientData, attObj := auth.Create("forum.example.com", "https://forum.example.com", challenge, []byte("42"))
+	if _, err := rp.VerifyRegistration(NewChallenge(), clientData, attObj); err == nil {
+		t.Errorf("Registration with the wrong challenge accepted")
+	}
+	cred, err := rp.VerifyRegistration(challenge, clientData, attObj)
+	if err != nil {
+		t.Fatalf("Registration rejected: %s", err)
+	}
+	if string(cred.ID) != string(auth.CredentialID) || cred.SignCount != 1 {
+		t.Errorf("Unexpected credential: %v", cred)
+	}
+	if _, err := rp.VerifyRegistration(challenge, clientData, attObj[:len(attObj)-10]); err == nil {
+		t.Errorf("Truncated attestation object accepted")
+	}
+
+	challenge = NewChallenge()
+	clientData, authData, sig := auth.Get("forum.example.com", "https://forum.example.com", challenge)
+	assertion, err := rp.VerifyAssertion(cred, challenge, clientData, authData, sig)
+	if err != nil || assertion.SignCount != 2 || !assertion.IsUserVerified {
+		t.Fatalf("Assertion rejected: %v, %s", assertion, err)
+	}
+	cred.SignCount = assertion.SignCount
+	if _, err := rp.VerifyAssertion(cred, challenge, clientData, authData, sig); err == nil {
+		t.Errorf("Replayed assertion accepted")
+	}
+
+	for _, c := range []struct {
+		rpID   string
+		origin string
+	}{
+		{"evil.example.com", "https://forum.example.com"},
+		{"forum.example.com", "https://evil.example.com"},
+	} {
+		challenge = NewChallenge()
+		clientData, authData, sig = auth.Get(c.rpID, c.origin, challenge)
+		if _, err := rp.VerifyAssertion(cred, challenge, clientData, authData, sig); err == nil {
+			t.Errorf("Assertion for %s at %s accepted", c.rpID, c.origin)
+		}
+	}
+
+	challenge = NewChallenge()
+	clientData, authData, sig = auth.Get("forum.example.com", "https://forum.example.com", challenge)
+	sig[len(sig)-1] ^= 1
+	if _, err := rp.VerifyAssertion(cred, challenge, clientData, authData, sig); err == nil {
+		t.Errorf("Assertion with a bad signature accepted")
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	v, rest, err := decodeCBOR([]byte{0xa2, 0x01, 0x02, 0x63, 'f', 'm', 't', 0x82, 0x20, 0x41, 0xff, 0x00})
+	m, ok := v.(map[interface{}]interface{})
+	if err != nil || !ok || len(rest) != 1 || m[int64(1)] != int64(2) {
+		t.Fatalf("Unexpected result: %v, %v, %v", v, rest, err)
+	}
+	if arr, ok := m["fmt"].([]interface{}); !ok || arr[0] != int64(-1) || string(arr[1].([]byte)) != "\xff" {
+		t.Errorf("Unexpected array: %v", m["fmt"])
+	}
+	for _, b := range [][]byte{{}, {0x5f}, {0x42, 0x00}, {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}} {
+		if _, _, err := decodeCBOR(b); err == nil {
+			t.Errorf("Malformed CBOR %x accepted", b)
+		}
+	}
+}
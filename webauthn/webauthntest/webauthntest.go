@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Sagar Gubbi. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package webauthntest provides a software authenticator for testing the WebAuthn
+// login without a browser or a security key.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// Authenticator holds one ES256 passkey, like a security key with a single credential.
+type Authenticator struct {
+	CredentialID []byte
+	UserHandle   []byte
+	SignCount    uint32
+	UserVerified bool // Whether the authenticator claims to have checked a PIN or biometric.
+	key          *ecdsa.PrivateKey
+}
+
+func New() *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &Authenticator{CredentialID: id, UserVerified: true, key: key}
+}
+
+// Create returns the clientDataJSON and attestationObject that a browser would send after
+// navigator.credentials.create().
+func (a *Authenticator) Create(rpID string, origin string, challenge string, userHandle []byte) (clientDataJSON []byte, attestationObject []byte) {
+	a.UserHandle = userHandle
+	clientDataJSON = a.clientData("webauthn.create", origin, challenge)
+
+	var pubKey []byte
+	pubKey = appendHead(pubKey, 5, 5)
+	pubKey = appendInt(appendInt(pubKey, 1), 2)  // kty: EC2
+	pubKey = appendInt(appendInt(pubKey, 3), -7) // alg: ES256
+	pubKey = appendInt(appendInt(pubKey, -1), 1) // crv: P-256
+	pubKey = appendBytes(appendInt(pubKey, -2), pad32(a.key.PublicKey.X.Bytes()))
+	pubKey = appendBytes(appendInt(pubKey, -3), pad32(a.key.PublicKey.Y.Bytes()))
+
+	authData := a.authData(rpID, 0x40)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = append(authData, byte(len(a.CredentialID)>>8), byte(len(a.CredentialID)))
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, pubKey...)
+
+	attestationObject = appendHead(attestationObject, 5, 3)
+	attestationObject = appendText(appendText(attestationObject, "fmt"), "none")
+	attestationObject = appendHead(appendText(attestationObject, "attStmt"), 5, 0)
+	attestationObject = appendBytes(appendText(attestationObject, "authData"), authData)
+	return clientDataJSON, attestationObject
+}
+
+// Get returns the clientDataJSON, authenticatorData and signature that a browser would
+// send after navigator.credentials.get().
+func (a *Authenticator) Get(rpID string, origin string, challenge string) (clientDataJSON []byte, authenticatorData []byte, signature []byte) {
+	clientDataJSON = a.clientData("webauthn.get", origin, challenge)
+	authenticatorData = a.authData(rpID, 0)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	hash := sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, hash[:])
+	if err != nil {
+		panic(err)
+	}
+	return clientDataJSON, authenticatorData, signature
+}
+
+func (a *Authenticator) clientData(typ string, origin string, challenge string) []byte {
+	b, _ := json.Marshal(map[string]interface{}{"type": typ, "challenge": challenge, "origin": origin, "crossOrigin": false})
+	return b
+}
+
+func (a *Authenticator) authData(rpID string, flags byte) []byte {
+	a.SignCount++
+	flags |= 0x01
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	b := append(rpIDHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[33:], a.SignCount)
+	return b
+}
+
+// EncodeID encodes b like browsers do in WebAuthn responses.
+func EncodeID(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func pad32(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+func appendHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n < 1<<8:
+		return append(b, major<<5|24, byte(n))
+	case n < 1<<16:
+		return append(b, major<<5|25, byte(n>>8), byte(n))
+	}
+	return append(b, major<<5|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendInt(b []byte, n int64) []byte {
+	if n < 0 {
+		return appendHead(b, 1, uint64(-1-n))
+	}
+	return appendHead(b, 0, uint64(n))
+}
+
+func appendBytes(b []byte, v []byte) []byte {
+	return append(appendHead(b, 2, uint64(len(v))), v...)
+}
+
+func appendText(b []byte, s string) []byte {
+	return append(appendHead(b, 3, uint64(len(s))), s...)
+}